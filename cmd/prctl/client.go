@@ -0,0 +1,200 @@
+package main
+
+import (
+    "bytes"
+    "context"
+    "encoding/json"
+    "fmt"
+    "io"
+    "net/http"
+    "net/http/httptest"
+    "net/url"
+    "os"
+    "strconv"
+    "strings"
+    "time"
+
+    "github.com/go-chi/chi/v5"
+    _ "github.com/jackc/pgx/v5/stdlib"
+    "github.com/jmoiron/sqlx"
+
+    "pr-review-assigner/internal/auth"
+    "pr-review-assigner/internal/config"
+    "pr-review-assigner/internal/handlers"
+    "pr-review-assigner/internal/problem"
+    "pr-review-assigner/internal/repo"
+    "pr-review-assigner/internal/repo/memory"
+    "pr-review-assigner/internal/repo/sqlite"
+    "pr-review-assigner/internal/service"
+)
+
+// client calls the JSON API. In direct mode requests never leave the process:
+// the transport serves them with the regular handlers, so both modes share
+// validation, error codes and output.
+type client struct {
+    base  string
+    token string
+    http  *http.Client
+    db    *sqlx.DB // direct mode only; closed by Close
+}
+
+func newClient(base, token string) *client {
+    return &client{
+        base:  strings.TrimSuffix(base, "/"),
+        token: token,
+        http:  &http.Client{Timeout: 30 * time.Second},
+    }
+}
+
+// reviewersFromEnv reads REVIEWER_COUNT and REVIEWER_STRATEGY like the server does,
+// so direct mode assigns reviewers the same way; unset variables keep the server defaults
+func reviewersFromEnv() (config.Reviewers, error) {
+    rv := config.Default().Reviewers
+    if v := os.Getenv("REVIEWER_COUNT"); v != "" {
+        n, err := strconv.Atoi(v)
+        if err != nil {
+            return rv, fmt.Errorf("REVIEWER_COUNT: expected a number, got %q", v)
+        }
+        rv.Count = n
+    }
+    rv.Strategy = envOr("REVIEWER_STRATEGY", rv.Strategy)
+    return rv, nil
+}
+
+func validateReviewers(rv config.Reviewers) error {
+    if rv.Count < 1 || rv.Count > 10 {
+        return fmt.Errorf("reviewer count must be between 1 and 10, got %d", rv.Count)
+    }
+    if !contains(service.Strategies, rv.Strategy) {
+        return fmt.Errorf("unknown reviewer strategy %q, expected %s", rv.Strategy, strings.Join(service.Strategies, " or "))
+    }
+    return nil
+}
+
+// newDirectClient opens the database and routes requests through service.Service
+// with full admin rights, as the server's own operator would have.
+// sqlite://PATH opens a file database the same way the server does;
+// memory:// starts empty and is lost on exit, which is mostly useful for trying commands out.
+func newDirectClient(dsn string, rv config.Reviewers) (*client, error) {
+    if err := validateReviewers(rv); err != nil {
+        return nil, err
+    }
+
+    var store repo.RepoInterface
+    var db *sqlx.DB
+    var err error
+    switch {
+    case strings.HasPrefix(dsn, "memory://"):
+        store = memory.New()
+    case strings.HasPrefix(dsn, "sqlite://"):
+        db, err = sqlite.Open(context.Background(), strings.TrimPrefix(dsn, "sqlite://"))
+    default:
+        db, err = sqlx.Connect("pgx", dsn)
+    }
+    if err != nil {
+        return nil, fmt.Errorf("db connect: %w", err)
+    }
+    if db != nil {
+        store = repo.New(db)
+    }
+
+    svc := service.New(store)
+    svc.ReviewerCount = rv.Count
+    svc.Strategy = rv.Strategy
+
+    authn := localAuthenticator{}
+    r := chi.NewRouter()
+    handlers.NewHandler(svc, authn).RegisterRoutes(r)
+
+    return &client{
+        base:  "http://prctl.local",
+        token: "local",
+        http:  &http.Client{Transport: inProcess{r}},
+        db:    db,
+    }, nil
+}
+
+// Close releases the database connection of direct mode
+func (c *client) Close() error {
+    if c.db == nil {
+        return nil
+    }
+    return c.db.Close()
+}
+
+// localAuthenticator grants admin to every request in direct mode
+type localAuthenticator struct{}
+
+func (localAuthenticator) Authenticate(ctx context.Context, token string) (*auth.Principal, error) {
+    return &auth.Principal{Subject: "prctl", Scopes: []string{auth.ScopeAdmin}}, nil
+}
+
+// inProcess is an http.RoundTripper that serves requests with a local handler
+type inProcess struct {
+    handler http.Handler
+}
+
+func (t inProcess) RoundTrip(req *http.Request) (*http.Response, error) {
+    rec := httptest.NewRecorder()
+    t.handler.ServeHTTP(rec, req)
+    resp := rec.Result()
+    resp.Request = req
+    return resp, nil
+}
+
+// do sends body as JSON and decodes a successful response into out;
+// an io.Writer out receives the raw response body instead
+func (c *client) do(method, path string, query url.Values, body, out interface{}) error {
+    var r io.Reader
+    if body != nil {
+        data, err := json.Marshal(body)
+        if err != nil {
+            return err
+        }
+        r = bytes.NewReader(data)
+    }
+    return c.doRaw(method, path, query, "application/json", r, out)
+}
+
+func (c *client) doRaw(method, path string, query url.Values, contentType string, body io.Reader, out interface{}) error {
+    u := c.base + path
+    if len(query) > 0 {
+        u += "?" + query.Encode()
+    }
+    req, err := http.NewRequest(method, u, body)
+    if err != nil {
+        return err
+    }
+    if body != nil {
+        req.Header.Set("Content-Type", contentType)
+    }
+    if c.token != "" {
+        req.Header.Set("Authorization", "Bearer "+c.token)
+    }
+
+    resp, err := c.http.Do(req)
+    if err != nil {
+        return err
+    }
+    defer resp.Body.Close()
+
+    if resp.StatusCode >= 400 {
+        var p problem.Problem
+        if err := json.NewDecoder(resp.Body).Decode(&p); err != nil || p.Code == "" {
+            return fmt.Errorf("%s %s: %s", method, path, resp.Status)
+        }
+        // Details of a 5xx are only in the server log; the request id finds them
+        if p.Status >= 500 && p.RequestID != "" {
+            return fmt.Errorf("%s: %s (request id %s)", p.Code, p.Detail, p.RequestID)
+        }
+        return fmt.Errorf("%s: %s", p.Code, p.Detail)
+    }
+    if out == nil || resp.StatusCode == http.StatusNoContent {
+        return nil
+    }
+    if w, ok := out.(io.Writer); ok {
+        _, err := io.Copy(w, resp.Body)
+        return err
+    }
+    return json.NewDecoder(resp.Body).Decode(out)
+}
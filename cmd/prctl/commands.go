@@ -0,0 +1,214 @@
+package main
+
+import (
+    "flag"
+    "fmt"
+    "io"
+    "net/http"
+    "net/url"
+    "os"
+    "strconv"
+    "strings"
+
+    "pr-review-assigner/internal/handlers"
+)
+
+func teamCreate(c *client, args []string) (interface{}, error) {
+    fs := flag.NewFlagSet("team create", flag.ContinueOnError)
+    var members, leads, inactive listFlag
+    fs.Var(&members, "member", "member as ID=NAME, repeatable")
+    fs.Var(&leads, "lead", "user id of a team lead, repeatable")
+    fs.Var(&inactive, "inactive", "user id of an inactive member, repeatable")
+    pos, err := parseArgs(fs, args, 1)
+    if err != nil {
+        return nil, err
+    }
+
+    team := handlers.Team{TeamName: pos[0], Members: []handlers.TeamMember{}}
+    for _, m := range members {
+        id, name, found := strings.Cut(m, "=")
+        if !found || id == "" || name == "" {
+            return nil, fmt.Errorf("team create: -member must be ID=NAME, got %q", m)
+        }
+        team.Members = append(team.Members, handlers.TeamMember{
+            UserID:   id,
+            Username: name,
+            IsActive: !contains(inactive, id),
+            IsLead:   contains(leads, id),
+        })
+    }
+
+    var resp handlers.TeamResponse
+    if err := c.do(http.MethodPost, "/team/add", nil, team, &resp); err != nil {
+        return nil, err
+    }
+    return resp.Team, nil
+}
+
+func teamGet(c *client, args []string) (interface{}, error) {
+    pos, err := parseArgs(flag.NewFlagSet("team get", flag.ContinueOnError), args, 1)
+    if err != nil {
+        return nil, err
+    }
+    var team handlers.Team
+    err = c.do(http.MethodGet, "/team/get", url.Values{"team_name": {pos[0]}}, nil, &team)
+    return team, err
+}
+
+func teamSync(c *client, args []string) (interface{}, error) {
+    fs := flag.NewFlagSet("team sync", flag.ContinueOnError)
+    file := fs.String("f", "", "team manifest (YAML or JSON), - for stdin")
+    dryRun := fs.Bool("dry-run", false, "only show the planned diff")
+    if _, err := parseArgs(fs, args, 0); err != nil {
+        return nil, err
+    }
+    if *file == "" {
+        return nil, errUsage
+    }
+
+    manifest := os.Stdin
+    if *file != "-" {
+        f, err := os.Open(*file)
+        if err != nil {
+            return nil, err
+        }
+        defer f.Close()
+        manifest = f
+    }
+
+    var resp handlers.SyncResponse
+    query := url.Values{"dry_run": {strconv.FormatBool(*dryRun)}}
+    if err := c.doRaw(http.MethodPost, "/teams/sync", query, "application/yaml", manifest, &resp); err != nil {
+        return nil, err
+    }
+    return resp, nil
+}
+
+func userSetActive(c *client, args []string, active bool) (interface{}, error) {
+    name := "user deactivate"
+    if active {
+        name = "user activate"
+    }
+    pos, err := parseArgs(flag.NewFlagSet(name, flag.ContinueOnError), args, 1)
+    if err != nil {
+        return nil, err
+    }
+    var resp handlers.UserResponse
+    err = c.do(http.MethodPost, "/users/setIsActive", nil, handlers.SetUserActiveRequest{UserID: pos[0], IsActive: active}, &resp)
+    return resp.User, err
+}
+
+func prCreate(c *client, args []string) (interface{}, error) {
+    fs := flag.NewFlagSet("pr create", flag.ContinueOnError)
+    name := fs.String("name", "", "pull request title")
+    author := fs.String("author", "", "author user id")
+    pos, err := parseArgs(fs, args, 1)
+    if err != nil {
+        return nil, err
+    }
+    var resp handlers.PullRequestResponse
+    err = c.do(http.MethodPost, "/pullRequest/create", nil, handlers.CreatePRRequest{
+        PullRequestID:   pos[0],
+        PullRequestName: *name,
+        AuthorID:        *author,
+    }, &resp)
+    return resp.PR, err
+}
+
+func prMerge(c *client, args []string) (interface{}, error) {
+    pos, err := parseArgs(flag.NewFlagSet("pr merge", flag.ContinueOnError), args, 1)
+    if err != nil {
+        return nil, err
+    }
+    var resp handlers.PullRequestResponse
+    err = c.do(http.MethodPost, "/pullRequest/merge", nil, handlers.MergePRRequest{PullRequestID: pos[0]}, &resp)
+    return resp.PR, err
+}
+
+func prReassign(c *client, args []string) (interface{}, error) {
+    fs := flag.NewFlagSet("pr reassign", flag.ContinueOnError)
+    old := fs.String("old", "", "reviewer to replace")
+    pos, err := parseArgs(fs, args, 1)
+    if err != nil {
+        return nil, err
+    }
+    var resp handlers.ReassignResponse
+    err = c.do(http.MethodPost, "/pullRequest/reassign", nil, handlers.ReassignRequest{PullRequestID: pos[0], OldUserID: *old}, &resp)
+    return resp, err
+}
+
+func prShow(c *client, args []string) (interface{}, error) {
+    pos, err := parseArgs(flag.NewFlagSet("pr show", flag.ContinueOnError), args, 1)
+    if err != nil {
+        return nil, err
+    }
+    var resp handlers.PullRequestResponse
+    err = c.do(http.MethodGet, "/pullRequest/get", url.Values{"pull_request_id": {pos[0]}}, nil, &resp)
+    return resp.PR, err
+}
+
+func stats(c *client) (interface{}, error) {
+    var resp handlers.StatsResponse
+    err := c.do(http.MethodGet, "/stats", nil, nil, &resp)
+    return resp, err
+}
+
+// export saves the JSON Lines snapshot to a file or stdout
+func export(c *client, out io.Writer, args []string) error {
+    fs := flag.NewFlagSet("export", flag.ContinueOnError)
+    file := fs.String("f", "-", "output file, - for stdout")
+    if _, err := parseArgs(fs, args, 0); err != nil {
+        return err
+    }
+
+    if *file != "-" {
+        f, err := os.Create(*file)
+        if err != nil {
+            return err
+        }
+        if err := c.doRaw(http.MethodGet, "/admin/export", nil, "", nil, f); err != nil {
+            f.Close()
+            return err
+        }
+        return f.Close()
+    }
+    return c.doRaw(http.MethodGet, "/admin/export", nil, "", nil, out)
+}
+
+func importSnapshot(c *client, args []string) (interface{}, error) {
+    fs := flag.NewFlagSet("import", flag.ContinueOnError)
+    file := fs.String("f", "", "snapshot produced by export, - for stdin")
+    mode := fs.String("mode", "merge", "merge or replace")
+    if _, err := parseArgs(fs, args, 0); err != nil {
+        return nil, err
+    }
+    if *file == "" {
+        return nil, errUsage
+    }
+
+    in := os.Stdin
+    if *file != "-" {
+        f, err := os.Open(*file)
+        if err != nil {
+            return nil, err
+        }
+        defer f.Close()
+        in = f
+    }
+
+    var resp handlers.ImportResponse
+    query := url.Values{"mode": {*mode}}
+    if err := c.doRaw(http.MethodPost, "/admin/import", query, "application/x-ndjson", in, &resp); err != nil {
+        return nil, err
+    }
+    return resp, nil
+}
+
+func contains(list []string, v string) bool {
+    for _, s := range list {
+        if s == v {
+            return true
+        }
+    }
+    return false
+}
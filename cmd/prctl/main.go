@@ -0,0 +1,186 @@
+// Command prctl is an admin CLI for the reviewer assigner. It talks to the
+// HTTP API, or with -db runs the same handlers in-process against the database.
+package main
+
+import (
+    "errors"
+    "flag"
+    "fmt"
+    "io"
+    "os"
+    "strings"
+)
+
+const usage = `usage: prctl [global flags] <command> [args]
+
+commands:
+  team create NAME -member ID=NAME... [-lead ID...] [-inactive ID...]
+  team get NAME
+  team sync -f FILE [-dry-run]
+  user activate ID
+  user deactivate ID
+  pr create ID -name TITLE -author USER
+  pr merge ID
+  pr reassign ID -old USER
+  pr show ID
+  stats
+  export [-f FILE]
+  import -f FILE [-mode merge|replace]
+
+global flags:
+`
+
+// errUsage makes main print the usage text and exit with status 2
+var errUsage = errors.New("invalid usage")
+
+func main() {
+    os.Exit(prctl(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// prctl runs the command line and returns the exit status; it returns instead of
+// exiting so that direct mode closes its database
+func prctl(args []string, stdout, stderr io.Writer) int {
+    rv, err := reviewersFromEnv()
+    if err != nil {
+        fmt.Fprintln(stderr, "prctl:", err)
+        return 2
+    }
+
+    global := flag.NewFlagSet("prctl", flag.ContinueOnError)
+    global.SetOutput(stderr)
+    server := global.String("server", envOr("PRCTL_SERVER", "http://localhost:8080"), "API base URL (env PRCTL_SERVER)")
+    token := global.String("token", os.Getenv("PRCTL_TOKEN"), "bearer token (env PRCTL_TOKEN)")
+    dsn := global.String("db", "", "run directly against this database (postgres://, sqlite://PATH or memory://) instead of the HTTP API")
+    global.IntVar(&rv.Count, "reviewer-count", rv.Count, "with -db: number of reviewers assigned to a new pull request (env REVIEWER_COUNT)")
+    global.StringVar(&rv.Strategy, "reviewer-strategy", rv.Strategy, "with -db: reviewer selection, random or least_loaded (env REVIEWER_STRATEGY)")
+    output := global.String("o", "table", "output format: table, json or yaml")
+    global.Usage = func() {
+        fmt.Fprint(global.Output(), usage)
+        global.PrintDefaults()
+    }
+    if err := global.Parse(args); err != nil {
+        return 2
+    }
+
+    format, err := parseFormat(*output)
+    if err != nil {
+        fmt.Fprintln(stderr, "prctl:", err)
+        return 2
+    }
+
+    var c *client
+    if *dsn != "" {
+        c, err = newDirectClient(*dsn, rv)
+        if err != nil {
+            fmt.Fprintln(stderr, "prctl:", err)
+            return 1
+        }
+        defer c.Close()
+    } else {
+        c = newClient(*server, *token)
+    }
+
+    err = run(c, stdout, format, global.Args())
+    switch {
+    case errors.Is(err, errUsage):
+        global.Usage()
+        return 2
+    case err != nil:
+        fmt.Fprintln(stderr, "prctl:", err)
+        return 1
+    }
+    return 0
+}
+
+// run dispatches a command and prints its result
+func run(c *client, out io.Writer, format string, args []string) error {
+    if len(args) == 0 {
+        return errUsage
+    }
+    cmd, args := args[0], args[1:]
+    switch cmd {
+    case "team", "user", "pr":
+        if len(args) == 0 {
+            return errUsage
+        }
+        cmd, args = cmd+" "+args[0], args[1:]
+    }
+
+    var result interface{}
+    var err error
+    switch cmd {
+    case "team create":
+        result, err = teamCreate(c, args)
+    case "team get":
+        result, err = teamGet(c, args)
+    case "team sync":
+        result, err = teamSync(c, args)
+    case "user activate":
+        result, err = userSetActive(c, args, true)
+    case "user deactivate":
+        result, err = userSetActive(c, args, false)
+    case "pr create":
+        result, err = prCreate(c, args)
+    case "pr merge":
+        result, err = prMerge(c, args)
+    case "pr reassign":
+        result, err = prReassign(c, args)
+    case "pr show":
+        result, err = prShow(c, args)
+    case "stats":
+        if len(args) != 0 {
+            return errUsage
+        }
+        result, err = stats(c)
+    case "export":
+        // The snapshot is written as is; -o does not apply
+        return export(c, out, args)
+    case "import":
+        result, err = importSnapshot(c, args)
+    default:
+        return errUsage
+    }
+    if err != nil {
+        return err
+    }
+    return write(out, format, result)
+}
+
+// parseArgs parses flags that may appear before or after positional
+// arguments and returns the positionals; want is their exact number
+func parseArgs(fs *flag.FlagSet, args []string, want int) ([]string, error) {
+    fs.SetOutput(io.Discard)
+    var positional []string
+    for {
+        if err := fs.Parse(args); err != nil {
+            return nil, fmt.Errorf("%s: %w", fs.Name(), err)
+        }
+        args = fs.Args()
+        if len(args) == 0 {
+            break
+        }
+        positional = append(positional, args[0])
+        args = args[1:]
+    }
+    if len(positional) != want {
+        return nil, errUsage
+    }
+    return positional, nil
+}
+
+// listFlag collects a repeatable string flag
+type listFlag []string
+
+func (l *listFlag) String() string { return strings.Join(*l, ",") }
+
+func (l *listFlag) Set(v string) error {
+    *l = append(*l, v)
+    return nil
+}
+
+func envOr(key, fallback string) string {
+    if v := os.Getenv(key); v != "" {
+        return v
+    }
+    return fallback
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+    "encoding/json"
+    "fmt"
+    "io"
+    "sort"
+    "strings"
+    "text/tabwriter"
+    "time"
+
+    "gopkg.in/yaml.v3"
+
+    "pr-review-assigner/internal/handlers"
+)
+
+func parseFormat(s string) (string, error) {
+    switch s {
+    case "table", "json", "yaml":
+        return s, nil
+    }
+    return "", fmt.Errorf("unknown output format %q (want table, json or yaml)", s)
+}
+
+// write prints a result; json and yaml keep the API field names
+func write(out io.Writer, format string, v interface{}) error {
+    switch format {
+    case "json":
+        enc := json.NewEncoder(out)
+        enc.SetIndent("", "  ")
+        return enc.Encode(v)
+    case "yaml":
+        // Round-trip through JSON so YAML uses the same keys as the API
+        data, err := json.Marshal(v)
+        if err != nil {
+            return err
+        }
+        var generic interface{}
+        if err := json.Unmarshal(data, &generic); err != nil {
+            return err
+        }
+        enc := yaml.NewEncoder(out)
+        enc.SetIndent(2)
+        defer enc.Close()
+        return enc.Encode(generic)
+    }
+
+    tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+    defer tw.Flush()
+
+    switch v := v.(type) {
+    case handlers.Team:
+        fmt.Fprintf(tw, "TEAM\t%s\n\n", v.TeamName)
+        fmt.Fprintln(tw, "USER_ID\tUSERNAME\tACTIVE\tLEAD")
+        for _, m := range v.Members {
+            fmt.Fprintf(tw, "%s\t%s\t%t\t%t\n", m.UserID, m.Username, m.IsActive, m.IsLead)
+        }
+    case handlers.User:
+        fmt.Fprintln(tw, "USER_ID\tUSERNAME\tTEAM\tACTIVE")
+        fmt.Fprintf(tw, "%s\t%s\t%s\t%t\n", v.UserID, v.Username, v.TeamName, v.IsActive)
+    case handlers.PullRequest:
+        writePR(tw, v)
+    case handlers.ReassignResponse:
+        writePR(tw, v.PR)
+        fmt.Fprintf(tw, "REPLACED_BY\t%s\n", v.ReplacedBy)
+    case handlers.StatsResponse:
+        ids := make([]string, 0, len(v.AssignmentStats))
+        for id := range v.AssignmentStats {
+            ids = append(ids, id)
+        }
+        sort.Slice(ids, func(i, j int) bool {
+            a, b := v.AssignmentStats[ids[i]], v.AssignmentStats[ids[j]]
+            if a != b {
+                return a > b
+            }
+            return ids[i] < ids[j]
+        })
+        fmt.Fprintln(tw, "USER_ID\tASSIGNMENTS")
+        for _, id := range ids {
+            fmt.Fprintf(tw, "%s\t%d\n", id, v.AssignmentStats[id])
+        }
+    case handlers.SyncResponse:
+        writePlan(tw, v)
+    case handlers.ImportResponse:
+        kinds := make([]string, 0, len(v.Import.Counts))
+        for kind := range v.Import.Counts {
+            kinds = append(kinds, kind)
+        }
+        sort.Strings(kinds)
+        fmt.Fprintf(tw, "MODE\t%s\n\n", v.Import.Mode)
+        fmt.Fprintln(tw, "KIND\tRECORDS")
+        for _, kind := range kinds {
+            fmt.Fprintf(tw, "%s\t%d\n", kind, v.Import.Counts[kind])
+        }
+    default:
+        return fmt.Errorf("no table output for %T", v)
+    }
+    return nil
+}
+
+func writePR(w io.Writer, pr handlers.PullRequest) {
+    fmt.Fprintf(w, "ID\t%s\n", pr.PullRequestID)
+    fmt.Fprintf(w, "NAME\t%s\n", pr.PullRequestName)
+    fmt.Fprintf(w, "AUTHOR\t%s\n", pr.AuthorID)
+    fmt.Fprintf(w, "STATUS\t%s\n", pr.Status)
+    fmt.Fprintf(w, "REVIEWERS\t%s\n", strings.Join(pr.AssignedReviewers, ", "))
+    fmt.Fprintf(w, "CREATED\t%s\n", formatTime(pr.CreatedAt))
+    fmt.Fprintf(w, "MERGED\t%s\n", formatTime(pr.MergedAt))
+}
+
+// writePlan lists planned or applied changes one per line
+func writePlan(w io.Writer, resp handlers.SyncResponse) {
+    p := resp.Plan
+    if p == nil {
+        return
+    }
+    fmt.Fprintln(w, "CHANGE\tTEAM\tUSER\tDETAILS")
+    for _, t := range p.TeamsCreated {
+        fmt.Fprintf(w, "team created\t%s\t\t\n", t)
+    }
+    for _, r := range p.TeamsRenamed {
+        fmt.Fprintf(w, "team renamed\t%s\t\tfrom %s\n", r.To, r.From)
+    }
+    for _, m := range p.MembersAdded {
+        fmt.Fprintf(w, "member added\t%s\t%s\t\n", m.TeamName, m.UserID)
+    }
+    for _, m := range p.MembersRemoved {
+        fmt.Fprintf(w, "member removed\t%s\t%s\t\n", m.TeamName, m.UserID)
+    }
+    for _, a := range p.ActivityChanged {
+        fmt.Fprintf(w, "activity changed\t\t%s\t%t -> %t\n", a.UserID, a.From, a.To)
+    }
+    for _, u := range p.UsersRenamed {
+        fmt.Fprintf(w, "user renamed\t\t%s\t%s -> %s\n", u.UserID, u.From, u.To)
+    }
+    for _, l := range p.LeadsChanged {
+        fmt.Fprintf(w, "lead changed\t%s\t%s\tis_lead=%t\n", l.TeamName, l.UserID, l.IsLead)
+    }
+    if p.DryRun {
+        fmt.Fprintln(w, "\t\t\t(dry run, nothing applied)")
+    }
+}
+
+func formatTime(t *time.Time) string {
+    if t == nil {
+        return "-"
+    }
+    return t.Format(time.RFC3339)
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+    "bytes"
+    "encoding/json"
+    "errors"
+    "net/http/httptest"
+    "os"
+    "path/filepath"
+    "strings"
+    "testing"
+
+    "github.com/go-chi/chi/v5"
+
+    "pr-review-assigner/internal/auth"
+    "pr-review-assigner/internal/config"
+    "pr-review-assigner/internal/handlers"
+    "pr-review-assigner/internal/repo/memory"
+    "pr-review-assigner/internal/service"
+)
+
+const testToken = "test-admin-token"
+
+// newTestServer serves the regular API over HTTP with an empty memory store
+func newTestServer(t *testing.T) string {
+    t.Helper()
+    store := memory.New()
+    r := chi.NewRouter()
+    handlers.NewHandler(service.New(store), auth.NewTokenAuthenticator(store, testToken)).RegisterRoutes(r)
+    srv := httptest.NewServer(r)
+    t.Cleanup(srv.Close)
+    return srv.URL
+}
+
+func runCmd(t *testing.T, c *client, format string, args ...string) (string, error) {
+    t.Helper()
+    var out bytes.Buffer
+    err := run(c, &out, format, args)
+    return out.String(), err
+}
+
+func TestHTTPClient(t *testing.T) {
+    c := newClient(newTestServer(t)+"/", testToken)
+
+    out, err := runCmd(t, c, "table", "team", "create", "backend", "-member", "u1=Alice", "-member", "u2=Bob", "-lead", "u1")
+    if err != nil {
+        t.Fatalf("team create: %v", err)
+    }
+    if !strings.Contains(out, "TEAM  backend") || !strings.Contains(out, "u1       Alice     true    true") {
+        t.Errorf("unexpected team table:\n%s", out)
+    }
+
+    out, err = runCmd(t, c, "json", "pr", "create", "pr-1", "-name", "Add search", "-author", "u1")
+    if err != nil {
+        t.Fatalf("pr create: %v", err)
+    }
+    var pr handlers.PullRequest
+    if err := json.Unmarshal([]byte(out), &pr); err != nil {
+        t.Fatalf("pr create output is not JSON: %v\n%s", err, out)
+    }
+    if pr.PullRequestID != "pr-1" || len(pr.AssignedReviewers) != 1 || pr.AssignedReviewers[0] != "u2" {
+        t.Errorf("unexpected PR %+v", pr)
+    }
+
+    out, err = runCmd(t, c, "yaml", "pr", "show", "pr-1")
+    if err != nil || !strings.Contains(out, "pull_request_id: pr-1") {
+        t.Errorf("expected YAML with API field names, got %v\n%s", err, out)
+    }
+
+    // API errors are reported by their code and detail
+    if _, err := runCmd(t, c, "table", "pr", "show", "missing"); err == nil || !strings.Contains(err.Error(), "NOT_FOUND") {
+        t.Errorf("expected NOT_FOUND, got %v", err)
+    }
+    if _, err := runCmd(t, newClient(c.base, "bogus"), "table", "stats"); err == nil || !strings.Contains(err.Error(), "UNAUTHORIZED") {
+        t.Errorf("expected UNAUTHORIZED for an unknown token, got %v", err)
+    }
+
+    for _, args := range [][]string{nil, {"team"}, {"pr", "show"}, {"pr", "show", "a", "b"}, {"bogus"}, {"team", "sync"}} {
+        if _, err := runCmd(t, c, "table", args...); !errors.Is(err, errUsage) {
+            t.Errorf("expected usage error for %q, got %v", args, err)
+        }
+    }
+}
+
+func TestExportImport(t *testing.T) {
+    c := newClient(newTestServer(t), testToken)
+    if _, err := runCmd(t, c, "table", "team", "create", "backend", "-member", "u1=Alice", "-member", "u2=Bob"); err != nil {
+        t.Fatalf("team create: %v", err)
+    }
+
+    file := filepath.Join(t.TempDir(), "snapshot.jsonl")
+    if _, err := runCmd(t, c, "table", "export", "-f", file); err != nil {
+        t.Fatalf("export: %v", err)
+    }
+
+    target := newClient(newTestServer(t), testToken)
+    out, err := runCmd(t, target, "table", "import", "-f", file)
+    if err != nil {
+        t.Fatalf("import: %v", err)
+    }
+    if !strings.Contains(out, "MODE  merge") {
+        t.Errorf("unexpected import table:\n%s", out)
+    }
+    if out, err := runCmd(t, target, "table", "team", "get", "backend"); err != nil || !strings.Contains(out, "Bob") {
+        t.Errorf("expected imported team, got %v\n%s", err, out)
+    }
+}
+
+func TestDirectMode(t *testing.T) {
+    var stdout, stderr bytes.Buffer
+    code := prctl([]string{"-db", "memory://", "-o", "json", "team", "create", "backend", "-member", "u1=Alice"}, &stdout, &stderr)
+    if code != 0 {
+        t.Fatalf("expected exit 0, got %d: %s", code, stderr.String())
+    }
+    if !strings.Contains(stdout.String(), `"team_name": "backend"`) {
+        t.Errorf("unexpected output %s", stdout.String())
+    }
+
+    stdout.Reset()
+    stderr.Reset()
+    if code := prctl([]string{"-db", "memory://", "pr", "show", "pr-1"}, &stdout, &stderr); code != 1 || !strings.Contains(stderr.String(), "NOT_FOUND") {
+        t.Errorf("expected exit 1 with NOT_FOUND, got %d: %s", code, stderr.String())
+    }
+    stderr.Reset()
+    if code := prctl([]string{"-db", "memory://", "-reviewer-strategy", "bogus", "stats"}, &stdout, &stderr); code != 1 || !strings.Contains(stderr.String(), "unknown reviewer strategy") {
+        t.Errorf("expected exit 1 for an unknown strategy, got %d: %s", code, stderr.String())
+    }
+    stderr.Reset()
+    if code := prctl([]string{"-o", "xml", "stats"}, &stdout, &stderr); code != 2 {
+        t.Errorf("expected exit 2 for an unknown format, got %d", code)
+    }
+}
+
+// Direct mode assigns as many reviewers as the configured count, not the service default
+func TestDirectModeReviewers(t *testing.T) {
+    c, err := newDirectClient("memory://", config.Reviewers{Count: 3, Strategy: service.StrategyLeastLoaded})
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer c.Close()
+
+    if _, err := runCmd(t, c, "table", "team", "create", "backend",
+        "-member", "u1=Alice", "-member", "u2=Bob", "-member", "u3=Carol", "-member", "u4=Dan"); err != nil {
+        t.Fatalf("team create: %v", err)
+    }
+    out, err := runCmd(t, c, "json", "pr", "create", "pr-1", "-name", "Add search", "-author", "u1")
+    if err != nil {
+        t.Fatalf("pr create: %v", err)
+    }
+    var pr handlers.PullRequest
+    if err := json.Unmarshal([]byte(out), &pr); err != nil || len(pr.AssignedReviewers) != 3 {
+        t.Errorf("expected three reviewers, got %v\n%s", err, out)
+    }
+
+    t.Setenv("REVIEWER_COUNT", "1")
+    t.Setenv("REVIEWER_STRATEGY", service.StrategyLeastLoaded)
+    rv, err := reviewersFromEnv()
+    if err != nil || rv.Count != 1 || rv.Strategy != service.StrategyLeastLoaded {
+        t.Errorf("expected reviewer settings from the environment, got %+v, %v", rv, err)
+    }
+    t.Setenv("REVIEWER_COUNT", "two")
+    if _, err := reviewersFromEnv(); err == nil {
+        t.Error("expected an error for a non-numeric REVIEWER_COUNT")
+    }
+}
+
+// Direct mode works with a file database and closes it when the command finishes
+func TestDirectModeSQLite(t *testing.T) {
+    path := filepath.Join(t.TempDir(), "prctl.db")
+    var stdout, stderr bytes.Buffer
+    if code := prctl([]string{"-db", "sqlite://" + path, "team", "create", "backend", "-member", "u1=Alice"}, &stdout, &stderr); code != 0 {
+        t.Fatalf("team create: exit %d: %s", code, stderr.String())
+    }
+    stdout.Reset()
+    if code := prctl([]string{"-db", "sqlite://" + path, "team", "get", "backend"}, &stdout, &stderr); code != 0 || !strings.Contains(stdout.String(), "Alice") {
+        t.Fatalf("team get: exit %d: %s%s", code, stdout.String(), stderr.String())
+    }
+    if _, err := os.Stat(path); err != nil {
+        t.Errorf("expected database file: %v", err)
+    }
+
+    c, err := newDirectClient("sqlite://"+path, config.Default().Reviewers)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if err := c.Close(); err != nil {
+        t.Fatalf("Close: %v", err)
+    }
+    if err := c.db.Ping(); err == nil {
+        t.Error("expected the database to be closed")
+    }
+}
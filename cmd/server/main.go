@@ -1,46 +1,408 @@
 package main
 
 import (
+    "context"
+    "encoding/json"
+    "errors"
+    "flag"
+    "fmt"
+    "io/fs"
     "log"
-    "net/http"
+    "log/slog"
+    "net"
     "os"
+    "os/signal"
+    "strings"
+    "sync"
+    "syscall"
+    "time"
 
     "github.com/go-chi/chi/v5"
     "github.com/jmoiron/sqlx"
     _ "github.com/jackc/pgx/v5/stdlib"
-    
+
+    "pr-review-assigner/internal/auth"
+    "pr-review-assigner/internal/config"
+    "pr-review-assigner/internal/dashboard"
+    "pr-review-assigner/internal/grpcapi"
     "pr-review-assigner/internal/handlers"
+    "pr-review-assigner/internal/health"
+    "pr-review-assigner/internal/logging"
+    "pr-review-assigner/internal/migrate"
+    "pr-review-assigner/internal/notify"
     "pr-review-assigner/internal/repo"
+    "pr-review-assigner/internal/repo/memory"
+    "pr-review-assigner/internal/repo/sqlite"
+    "pr-review-assigner/internal/reqmeta"
+    "pr-review-assigner/internal/scim"
+    "pr-review-assigner/internal/server"
     "pr-review-assigner/internal/service"
+    "pr-review-assigner/internal/tracing"
+    "pr-review-assigner/migrations"
 )
 
 func main() {
-    dsn := os.Getenv("DATABASE_URL")
-    if dsn == "" {
-        dsn = "postgres://user:password@db:5432/db?sslmode=disable"
+    // CLI mode: server sync -f teams.yaml [-dry-run]; configuration then comes from the file and environment only
+    args, syncArgs := os.Args[1:], []string(nil)
+    if len(args) > 0 && args[0] == "sync" {
+        args, syncArgs = nil, args[1:]
     }
-    
-    db, err := sqlx.Connect("pgx", dsn)
+
+    migrateMode := flag.String("migrate", "", "up, down (one step) or status: manage database migrations and exit")
+    cfg, err := config.Load(flag.CommandLine, args)
     if err != nil {
-        log.Fatalf("db connect: %v", err)
+        log.Fatal(err)
     }
-    defer db.Close()
 
+    // JSON logs to stderr; records made with a request context carry its request_id
+    logger, err := logging.New(os.Stderr, cfg.Logging.Level, cfg.Logging.Format)
+    if err != nil {
+        log.Fatal(err)
+    }
+    slog.SetDefault(logger)
+    
     // Initialize dependencies
-    repository := repo.New(db)
-    svc := service.New(repository)  // repo.Repo реализует repo.RepoInterface
-    handler := handlers.NewHandler(svc)
+    store, err := openRepo(cfg.Database)
+    if err != nil {
+        fatal("db connect", err)
+    }
+    defer store.Close()
+    repository := store.repo
+
+    // Migration mode: server -migrate=up|down|status
+    if *migrateMode != "" {
+        if err := runMigrate(store.migrations, *migrateMode); err != nil {
+            fatal("migrate", err)
+        }
+        return
+    }
+    // A SQLite file has no separate deploy step, so its schema is always kept current
+    if (cfg.Database.AutoMigrate || strings.HasPrefix(cfg.Database.URL, "sqlite://")) && store.migrations != nil {
+        applied, err := store.migrations.Up(context.Background())
+        if err != nil {
+            fatal("migrate", err)
+        }
+        for _, m := range applied {
+            slog.Info("migration applied", "version", m.Version, "name", m.Name)
+        }
+    }
+
+    svc := service.New(repository)
+    svc.ReviewerCount = cfg.Reviewers.Count
+    svc.Strategy = cfg.Reviewers.Strategy
+    svc.IdempotencyTTL = time.Duration(cfg.Server.IdempotencyTTL)
+    // A request cannot answer after the write timeout, so its key is not held any longer than that
+    svc.IdempotencyLease = time.Duration(cfg.Server.WriteTimeout)
+
+    if syncArgs != nil {
+        if err := runSync(svc, syncArgs); err != nil {
+            fatal("sync", err)
+        }
+        return
+    }
+
+    // OpenTelemetry spans for HTTP routes, service operations and SQL queries
+    shutdownTracing, err := tracing.Setup(context.Background(), cfg.Tracing.Exporter, cfg.Tracing.Endpoint, cfg.Tracing.File)
+    if err != nil {
+        fatal("tracing", err)
+    }
+
+    // SIGTERM (deploys) and SIGINT (Ctrl+C) start a graceful shutdown
+    ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+    defer stop()
+
+    // Readiness: the database answers, its schema matches this binary and background workers run
+    checker := health.NewChecker()
+    if store.db != nil {
+        checker.Add("database", store.db.PingContext)
+    }
+    if store.migrations != nil {
+        checker.Add("migrations", store.migrations.Check)
+    }
+
+    // Background workers stop when the event broker is closed during shutdown
+    var workers sync.WaitGroup
+
+    // Webhook notifications for PR events
+    if len(cfg.Notifications.Webhooks) > 0 {
+        notifier := notify.New(cfg.Notifications.Webhooks, time.Duration(cfg.Notifications.Timeout))
+        state := checker.Worker("notifier")
+        state.Started()
+        workers.Add(1)
+        go func() {
+            defer workers.Done()
+            notifier.Run(context.Background(), svc.Events)
+            state.Stopped(nil)
+        }()
+    }
+
+    // Expired idempotency keys are ignored on lookup; this only keeps the table small
+    purgeState := checker.Worker("idempotency_purge")
+    purgeState.Started()
+    workers.Add(1)
+    go func() {
+        defer workers.Done()
+        ticker := time.NewTicker(time.Hour)
+        defer ticker.Stop()
+        for {
+            select {
+            case <-ctx.Done():
+                purgeState.Stopped(nil)
+                return
+            case <-ticker.C:
+                if n, err := svc.PurgeIdempotencyKeys(ctx); err != nil {
+                    slog.Warn("failed to purge idempotency keys", "error", err)
+                } else if n > 0 {
+                    slog.Debug("purged idempotency keys", "count", n)
+                }
+            }
+        }
+    }()
+
+    // API tokens from the database plus an optional bootstrap admin token
+    if cfg.Auth.AdminToken == "" {
+        slog.Warn("ADMIN_TOKEN is not set: only tokens stored in the database are accepted")
+    }
+    authn := auth.Authenticator(auth.NewTokenAuthenticator(repository, cfg.Auth.AdminToken))
+
+    // Optional SSO JWT validation against a JWKS file or URL
+    if jwt := cfg.Auth.JWT; jwt.JWKS != "" {
+        keys, err := auth.NewKeySet(context.Background(), jwt.JWKS)
+        if err != nil {
+            fatal("jwt", err)
+        }
+        authn = auth.ChainAuthenticator{
+            Tokens: authn,
+            JWT: auth.NewJWTAuthenticator(keys, auth.JWTConfig{
+                Issuer:      jwt.Issuer,
+                Audience:    jwt.Audience,
+                UserClaim:   jwt.UserClaim,
+                ScopesClaim: jwt.ScopesClaim,
+            }),
+        }
+        go reloadKeysOnSIGHUP(keys)
+    }
+
+    handler := handlers.NewHandler(svc, authn)
+    handler.SetConfig(cfg)
+    handler.SetBodyLimit(int64(cfg.Server.MaxBodyBytes))
+    handler.SetHealth(checker)
 
     // Setup router
     r := chi.NewRouter()
+    r.Use(reqmeta.Middleware, tracing.Middleware, logging.AccessLog(logger))
     handler.RegisterRoutes(r)
+    r.Group(func(r chi.Router) {
+        // Scopes are checked per resource: Users need admin:users, Groups admin:teams
+        r.Use(auth.Middleware(authn))
+        scimHandler := scim.NewHandler(svc, "/scim/v2")
+        scimHandler.SetBodyLimit(int64(cfg.Server.MaxBodyBytes))
+        r.Mount("/scim/v2", scimHandler.Routes())
+    })
+
+    // HTML dashboard with cookie sessions for people who don't use curl
+    ui := dashboard.New(svc, authn, "/ui")
+    ui.SetSecureCookie(cfg.Dashboard.SecureCookie)
+    r.Mount("/ui", ui.Routes())
 
-    // Start server
-    port := os.Getenv("PORT")
-    if port == "" {
-        port = "8080"
+    // gRPC API on its own port, sharing the service and authentication
+    lis, err := net.Listen("tcp", cfg.Server.GRPCAddr)
+    if err != nil {
+        fatal("grpc", err)
     }
-    
-    log.Printf("Server starting on port %s", port)
-    log.Fatal(http.ListenAndServe(":"+port, r))
-}
\ No newline at end of file
+    grpcServer := grpcapi.NewServer(svc, authn)
+    grpcState := checker.Worker("grpc")
+    grpcState.Started()
+    grpcDone := make(chan struct{})
+    go func() {
+        defer close(grpcDone)
+        slog.Info("gRPC server starting", "addr", cfg.Server.GRPCAddr)
+        err := grpcServer.Serve(lis)
+        grpcState.Stopped(err)
+        if err != nil {
+            slog.Error("grpc stopped", "error", err)
+            stop()
+        }
+    }()
+
+    srv, err := server.New(cfg.Server, r)
+    if err != nil {
+        fatal("server", err)
+    }
+    // Event streams never go idle; closing the broker ends them (and the gRPC
+    // watchers) so draining only waits for ordinary requests. Events published
+    // by requests still in flight are persisted and can be replayed by clients,
+    // but are no longer pushed to webhooks.
+    srv.RegisterOnShutdown(checker.ShutDown)
+    srv.RegisterOnShutdown(svc.Events.Close)
+    go func() {
+        <-ctx.Done()
+        slog.Info("shutting down")
+        grpcServer.GracefulStop()
+    }()
+
+    runErr := srv.Run(ctx)
+    stop()
+    <-grpcDone
+    workers.Wait()
+    // Flush the spans still buffered by the batch exporter
+    flushCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    if err := shutdownTracing(flushCtx); err != nil {
+        slog.Error("tracing shutdown", "error", err)
+    }
+    cancel()
+    if runErr != nil {
+        store.Close()
+        fatal("server", runErr)
+    }
+    // The database is closed by the deferred store.Close once nothing uses it
+    slog.Info("server stopped")
+}
+
+// fatal logs err and exits; deferred calls are skipped, as with log.Fatal
+func fatal(msg string, err error) {
+    slog.Error(msg, "error", err)
+    os.Exit(1)
+}
+
+// storage is the repository together with the handles used for migrations and
+// readiness checks; db and migrations are nil for memory://
+type storage struct {
+    repo       repo.RepoInterface
+    db         *sqlx.DB
+    migrations *migrate.Runner
+}
+
+func (st *storage) Close() error {
+    if st.db == nil {
+        return nil
+    }
+    return st.db.Close()
+}
+
+// openRepo connects to Postgres. sqlite://PATH keeps everything in a single
+// file, and memory:// keeps state in the process so the service can be demoed
+// without a database.
+func openRepo(cfg config.Database) (*storage, error) {
+    dsn := cfg.URL
+    if strings.HasPrefix(dsn, "memory://") {
+        slog.Warn("DATABASE_URL is memory://: state is kept in memory and lost on exit")
+        return &storage{repo: memory.New()}, nil
+    }
+    var (
+        db     *sqlx.DB
+        schema fs.FS = migrations.FS
+        err    error
+    )
+    if path, ok := strings.CutPrefix(dsn, "sqlite://"); ok {
+        db, err = sqlite.Connect(context.Background(), path)
+        schema = sqlite.Migrations
+    } else {
+        db, err = sqlx.Connect("pgx", dsn)
+    }
+    if err != nil {
+        return nil, err
+    }
+    db.SetMaxOpenConns(cfg.MaxOpenConns)
+    db.SetMaxIdleConns(cfg.MaxIdleConns)
+    db.SetConnMaxLifetime(time.Duration(cfg.ConnMaxLifetime))
+    runner, err := migrate.New(db, schema)
+    if err != nil {
+        db.Close()
+        return nil, err
+    }
+    return &storage{repo: repo.New(db), db: db, migrations: runner}, nil
+}
+
+// runMigrate applies, rolls back or reports migrations for -migrate
+func runMigrate(runner *migrate.Runner, mode string) error {
+    if runner == nil {
+        return errors.New("memory:// storage has no schema to migrate")
+    }
+    ctx := context.Background()
+    switch mode {
+    case "up":
+        applied, err := runner.Up(ctx)
+        for _, m := range applied {
+            fmt.Printf("applied %d_%s\n", m.Version, m.Name)
+        }
+        if err == nil && len(applied) == 0 {
+            fmt.Println("no pending migrations")
+        }
+        return err
+    case "down":
+        reverted, err := runner.Down(ctx)
+        if reverted != nil {
+            fmt.Printf("reverted %d_%s\n", reverted.Version, reverted.Name)
+        } else if err == nil {
+            fmt.Println("nothing to revert")
+        }
+        return err
+    case "status":
+        st, err := runner.Status(ctx)
+        if err != nil {
+            return err
+        }
+        fmt.Printf("version %d of %d", st.Current, st.Latest)
+        if st.Dirty {
+            fmt.Print(" (dirty)")
+        }
+        fmt.Println()
+        for _, m := range st.Pending {
+            fmt.Printf("pending %d_%s\n", m.Version, m.Name)
+        }
+        return nil
+    default:
+        return fmt.Errorf("unknown mode %q, expected up, down or status", mode)
+    }
+}
+
+// reloadKeysOnSIGHUP re-reads the JWKS so rotated keys are picked up without a restart
+func reloadKeysOnSIGHUP(keys *auth.KeySet) {
+    sig := make(chan os.Signal, 1)
+    signal.Notify(sig, syscall.SIGHUP)
+    for range sig {
+        if err := keys.Reload(context.Background()); err != nil {
+            slog.Error("jwks reload failed", "error", err)
+            continue
+        }
+        slog.Info("jwks reloaded")
+    }
+}
+
+// runSync applies a team manifest file and prints the resulting plan
+func runSync(svc *service.Service, args []string) error {
+    fs := flag.NewFlagSet("sync", flag.ExitOnError)
+    file := fs.String("f", "", "path to the team manifest (YAML or JSON), - for stdin")
+    dryRun := fs.Bool("dry-run", false, "print the planned diff without applying it")
+    fs.Parse(args)
+
+    if *file == "" {
+        fs.Usage()
+        os.Exit(2)
+    }
+
+    in := os.Stdin
+    if *file != "-" {
+        f, err := os.Open(*file)
+        if err != nil {
+            return err
+        }
+        defer f.Close()
+        in = f
+    }
+
+    manifest, err := service.ParseTeamManifest(in)
+    if err != nil {
+        return err
+    }
+
+    plan, err := svc.SyncTeams(context.Background(), manifest, *dryRun)
+    if err != nil {
+        return err
+    }
+
+    enc := json.NewEncoder(os.Stdout)
+    enc.SetIndent("", "  ")
+    return enc.Encode(plan)
+}
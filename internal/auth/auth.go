@@ -0,0 +1,147 @@
+// Package auth отвечает за аутентификацию вызывающих и проверку scope'ов
+package auth
+
+import (
+    "context"
+    "crypto/rand"
+    "crypto/sha256"
+    "crypto/subtle"
+    "database/sql"
+    "encoding/hex"
+    "errors"
+    "fmt"
+    "strings"
+
+    "pr-review-assigner/internal/repo"
+)
+
+const (
+    ScopeRead       = "read"
+    ScopeWritePRs   = "write:prs"
+    ScopeAdminTeams = "admin:teams"
+    ScopeAdminUsers = "admin:users"
+    ScopeAdmin      = "admin" // включает все остальные
+)
+
+// KnownScopes - все scope'ы, которые можно выдать токену
+var KnownScopes = []string{ScopeRead, ScopeWritePRs, ScopeAdminTeams, ScopeAdminUsers, ScopeAdmin}
+
+// TokenPrefix облегчает поиск случайно опубликованных токенов
+const TokenPrefix = "pra_"
+
+var ErrUnauthorized = errors.New("invalid or missing credentials")
+
+// Principal - аутентифицированный вызывающий
+type Principal struct {
+    Subject    string   // имя токена или subject из JWT
+    UserID     string   // связанный users.id, может быть пустым
+    Scopes     []string
+    Credential string   // уникальный ключ учетных данных: token:<id>, jwt:<iss>|<sub> или bootstrap
+}
+
+// CredentialBootstrap - Credential bootstrap-токена администратора
+const CredentialBootstrap = "bootstrap"
+
+func (p *Principal) HasScope(scope string) bool {
+    for _, s := range p.Scopes {
+        if s == scope || s == ScopeAdmin {
+            return true
+        }
+    }
+    return false
+}
+
+type principalKey struct{}
+
+func WithPrincipal(ctx context.Context, p *Principal) context.Context {
+    return context.WithValue(ctx, principalKey{}, p)
+}
+
+// FromContext возвращает вызывающего; nil означает внутренний вызов (CLI, фоновые задачи)
+func FromContext(ctx context.Context) *Principal {
+    p, _ := ctx.Value(principalKey{}).(*Principal)
+    return p
+}
+
+// Authenticator проверяет bearer-токен
+type Authenticator interface {
+    Authenticate(ctx context.Context, token string) (*Principal, error)
+}
+
+// TokenStore - хранилище API-токенов (реализуется repo.Repo)
+type TokenStore interface {
+    GetAPITokenByHash(ctx context.Context, tokenHash string) (*repo.APIToken, error)
+}
+
+// TokenAuthenticator проверяет API-токены из БД и bootstrap-токен администратора
+type TokenAuthenticator struct {
+    store         TokenStore
+    bootstrapHash string
+}
+
+// NewTokenAuthenticator создает аутентификатор; пустой bootstrap отключает bootstrap-токен
+func NewTokenAuthenticator(store TokenStore, bootstrap string) *TokenAuthenticator {
+    a := &TokenAuthenticator{store: store}
+    if bootstrap != "" {
+        a.bootstrapHash = HashToken(bootstrap)
+    }
+    return a
+}
+
+func (a *TokenAuthenticator) Authenticate(ctx context.Context, token string) (*Principal, error) {
+    if token == "" {
+        return nil, ErrUnauthorized
+    }
+
+    hash := HashToken(token)
+    if a.bootstrapHash != "" && subtle.ConstantTimeCompare([]byte(hash), []byte(a.bootstrapHash)) == 1 {
+        return &Principal{Subject: "bootstrap", Scopes: []string{ScopeAdmin}, Credential: CredentialBootstrap}, nil
+    }
+
+    t, err := a.store.GetAPITokenByHash(ctx, hash)
+    if errors.Is(err, sql.ErrNoRows) {
+        return nil, ErrUnauthorized
+    }
+    if err != nil {
+        return nil, err
+    }
+    if t.RevokedAt != nil {
+        return nil, ErrUnauthorized
+    }
+
+    // Имена токенов не уникальны, поэтому учетные данные различаются по id
+    p := &Principal{Subject: t.Name, Scopes: ParseScopes(t.Scopes), Credential: fmt.Sprintf("token:%d", t.ID)}
+    if t.UserID != nil {
+        p.UserID = *t.UserID
+    }
+    return p, nil
+}
+
+// GenerateToken создает новый токен и его хеш; в БД хранится только хеш
+func GenerateToken() (token, hash string, err error) {
+    buf := make([]byte, 32)
+    if _, err := rand.Read(buf); err != nil {
+        return "", "", err
+    }
+    token = TokenPrefix + hex.EncodeToString(buf)
+    return token, HashToken(token), nil
+}
+
+// HashToken хеширует токен; токены случайные и длинные, поэтому соль не нужна
+func HashToken(token string) string {
+    sum := sha256.Sum256([]byte(token))
+    return hex.EncodeToString(sum[:])
+}
+
+func ParseScopes(s string) []string {
+    return strings.Fields(s)
+}
+
+func ValidScope(scope string) bool {
+    for _, s := range KnownScopes {
+        if s == scope {
+            return true
+        }
+    }
+    return false
+}
@@ -0,0 +1,78 @@
+package auth
+
+import (
+    "context"
+    "database/sql"
+    "net/http"
+    "net/http/httptest"
+    "testing"
+
+    "pr-review-assigner/internal/repo"
+)
+
+type stubStore map[string]*repo.APIToken
+
+func (s stubStore) GetAPITokenByHash(ctx context.Context, tokenHash string) (*repo.APIToken, error) {
+    if t, ok := s[tokenHash]; ok {
+        return t, nil
+    }
+    return nil, sql.ErrNoRows
+}
+
+func TestMiddlewareScopes(t *testing.T) {
+    readToken, readHash, _ := GenerateToken()
+    store := stubStore{readHash: {ID: 1, Name: "reader", Scopes: ScopeRead}}
+    authn := NewTokenAuthenticator(store, "bootstrap-secret")
+
+    handler := Middleware(authn)(Require(ScopeAdminTeams)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        w.WriteHeader(http.StatusNoContent)
+    })))
+
+    cases := []struct {
+        name   string
+        header string
+        status int
+    }{
+        {"no token", "", http.StatusUnauthorized},
+        {"unknown token", "Bearer pra_unknown", http.StatusUnauthorized},
+        {"missing scope", "Bearer " + readToken, http.StatusForbidden},
+        {"bootstrap admin", "Bearer bootstrap-secret", http.StatusNoContent},
+    }
+
+    for _, tc := range cases {
+        req := httptest.NewRequest(http.MethodPost, "/team/add", nil)
+        if tc.header != "" {
+            req.Header.Set("Authorization", tc.header)
+        }
+        rec := httptest.NewRecorder()
+        handler.ServeHTTP(rec, req)
+
+        if rec.Code != tc.status {
+            t.Errorf("%s: expected status %d, got %d", tc.name, tc.status, rec.Code)
+        }
+    }
+}
+
+func TestAdminScopeImpliesAll(t *testing.T) {
+    p := &Principal{Scopes: []string{ScopeAdmin}}
+    for _, scope := range KnownScopes {
+        if !p.HasScope(scope) {
+            t.Errorf("admin should imply %s", scope)
+        }
+    }
+}
+
+// Учетные данные различают токены с одинаковым именем и bootstrap-токен
+func TestPrincipalCredential(t *testing.T) {
+    token, hash, _ := GenerateToken()
+    authn := NewTokenAuthenticator(stubStore{hash: {ID: 7, Name: "ci", Scopes: ScopeRead}}, "bootstrap-secret")
+
+    p, err := authn.Authenticate(context.Background(), token)
+    if err != nil || p.Credential != "token:7" {
+        t.Errorf("expected token:7, got %+v %v", p, err)
+    }
+    p, err = authn.Authenticate(context.Background(), "bootstrap-secret")
+    if err != nil || p.Credential != CredentialBootstrap {
+        t.Errorf("expected the bootstrap credential, got %+v %v", p, err)
+    }
+}
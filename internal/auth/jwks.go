@@ -0,0 +1,203 @@
+package auth
+
+import (
+    "context"
+    "crypto"
+    "crypto/ecdsa"
+    "crypto/elliptic"
+    "crypto/rsa"
+    "encoding/base64"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io"
+    "math/big"
+    "net/http"
+    "os"
+    "strings"
+    "sync"
+    "time"
+)
+
+var ErrUnknownKey = errors.New("unknown signing key")
+
+// jwk - ключ из JWKS (RFC 7517); поддерживаются RSA и EC P-256
+type jwk struct {
+    Kty string `json:"kty"`
+    Kid string `json:"kid"`
+    Use string `json:"use"`
+    Alg string `json:"alg"`
+    N   string `json:"n"`
+    E   string `json:"e"`
+    Crv string `json:"crv"`
+    X   string `json:"x"`
+    Y   string `json:"y"`
+}
+
+// KeySet - набор публичных ключей, загружаемый из файла или по URL
+type KeySet struct {
+    source string
+    client *http.Client
+
+    mu         sync.RWMutex
+    keys       map[string]crypto.PublicKey
+    loadedAt   time.Time
+    minRefresh time.Duration
+}
+
+// NewKeySet загружает JWKS из source: путь к файлу или http(s) URL
+func NewKeySet(ctx context.Context, source string) (*KeySet, error) {
+    ks := &KeySet{
+        source:     source,
+        client:     &http.Client{Timeout: 10 * time.Second},
+        minRefresh: time.Minute,
+    }
+    if err := ks.Reload(ctx); err != nil {
+        return nil, err
+    }
+    return ks, nil
+}
+
+// Reload перечитывает ключи; при ошибке остается прежний набор
+func (ks *KeySet) Reload(ctx context.Context) error {
+    data, err := ks.fetch(ctx)
+    if err != nil {
+        return fmt.Errorf("load jwks: %w", err)
+    }
+    keys, err := ParseJWKS(data)
+    if err != nil {
+        return err
+    }
+
+    ks.mu.Lock()
+    ks.keys = keys
+    ks.loadedAt = time.Now()
+    ks.mu.Unlock()
+    return nil
+}
+
+// Key возвращает ключ по kid; неизвестный kid вызывает перезагрузку (не чаще minRefresh),
+// чтобы ротация ключей у провайдера подхватывалась без рестарта
+func (ks *KeySet) Key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+    if key, ok := ks.lookup(kid); ok {
+        return key, nil
+    }
+
+    ks.mu.RLock()
+    stale := time.Since(ks.loadedAt) >= ks.minRefresh
+    ks.mu.RUnlock()
+    if stale {
+        if err := ks.Reload(ctx); err != nil {
+            return nil, err
+        }
+        if key, ok := ks.lookup(kid); ok {
+            return key, nil
+        }
+    }
+    return nil, ErrUnknownKey
+}
+
+func (ks *KeySet) lookup(kid string) (crypto.PublicKey, bool) {
+    ks.mu.RLock()
+    defer ks.mu.RUnlock()
+
+    if key, ok := ks.keys[kid]; ok {
+        return key, true
+    }
+    // Токен без kid допустим, если ключ единственный
+    if kid == "" && len(ks.keys) == 1 {
+        for _, key := range ks.keys {
+            return key, true
+        }
+    }
+    return nil, false
+}
+
+func (ks *KeySet) fetch(ctx context.Context) ([]byte, error) {
+    if !strings.HasPrefix(ks.source, "http://") && !strings.HasPrefix(ks.source, "https://") {
+        return os.ReadFile(ks.source)
+    }
+
+    req, err := http.NewRequestWithContext(ctx, http.MethodGet, ks.source, nil)
+    if err != nil {
+        return nil, err
+    }
+    resp, err := ks.client.Do(req)
+    if err != nil {
+        return nil, err
+    }
+    defer resp.Body.Close()
+
+    if resp.StatusCode != http.StatusOK {
+        return nil, fmt.Errorf("unexpected status %s", resp.Status)
+    }
+    return io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+}
+
+// ParseJWKS разбирает документ JWKS; ключи с use, отличным от sig, пропускаются
+func ParseJWKS(data []byte) (map[string]crypto.PublicKey, error) {
+    var doc struct {
+        Keys []jwk `json:"keys"`
+    }
+    if err := json.Unmarshal(data, &doc); err != nil {
+        return nil, fmt.Errorf("parse jwks: %w", err)
+    }
+
+    keys := make(map[string]crypto.PublicKey, len(doc.Keys))
+    for _, k := range doc.Keys {
+        if k.Use != "" && k.Use != "sig" {
+            continue
+        }
+        key, err := k.publicKey()
+        if err != nil {
+            return nil, fmt.Errorf("jwks key %q: %w", k.Kid, err)
+        }
+        keys[k.Kid] = key
+    }
+    if len(keys) == 0 {
+        return nil, errors.New("jwks contains no signing keys")
+    }
+    return keys, nil
+}
+
+func (k jwk) publicKey() (crypto.PublicKey, error) {
+    switch k.Kty {
+    case "RSA":
+        n, err := decodeBigInt(k.N)
+        if err != nil {
+            return nil, err
+        }
+        e, err := decodeBigInt(k.E)
+        if err != nil {
+            return nil, err
+        }
+        return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+    case "EC":
+        if k.Crv != "P-256" {
+            return nil, fmt.Errorf("unsupported curve %s", k.Crv)
+        }
+        x, err := decodeBigInt(k.X)
+        if err != nil {
+            return nil, err
+        }
+        y, err := decodeBigInt(k.Y)
+        if err != nil {
+            return nil, err
+        }
+        key := &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}
+        if _, err := key.ECDH(); err != nil {
+            return nil, err
+        }
+        return key, nil
+    default:
+        return nil, fmt.Errorf("unsupported key type %s", k.Kty)
+    }
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+    b, err := base64.RawURLEncoding.DecodeString(s)
+    if err != nil {
+        return nil, err
+    }
+    return new(big.Int).SetBytes(b), nil
+}
@@ -0,0 +1,111 @@
+package auth
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "strings"
+    "time"
+
+    "github.com/golang-jwt/jwt/v5"
+)
+
+// JWTConfig - параметры проверки JWT от SSO
+type JWTConfig struct {
+    Issuer      string // обязательный iss, пустой - не проверять
+    Audience    string // обязательный aud, пустой - не проверять
+    UserClaim   string // claim со значением users.id, по умолчанию sub
+    ScopesClaim string // claim со scope'ами (строка через пробел или массив), по умолчанию scope
+    Leeway      time.Duration
+}
+
+// JWTAuthenticator проверяет JWT, подписанные ключами из JWKS (RS256, ES256)
+type JWTAuthenticator struct {
+    keys   *KeySet
+    cfg    JWTConfig
+    parser *jwt.Parser
+}
+
+func NewJWTAuthenticator(keys *KeySet, cfg JWTConfig) *JWTAuthenticator {
+    if cfg.UserClaim == "" {
+        cfg.UserClaim = "sub"
+    }
+    if cfg.ScopesClaim == "" {
+        cfg.ScopesClaim = "scope"
+    }
+
+    opts := []jwt.ParserOption{
+        jwt.WithValidMethods([]string{"RS256", "ES256"}),
+        jwt.WithExpirationRequired(),
+        jwt.WithLeeway(cfg.Leeway),
+    }
+    if cfg.Issuer != "" {
+        opts = append(opts, jwt.WithIssuer(cfg.Issuer))
+    }
+    if cfg.Audience != "" {
+        opts = append(opts, jwt.WithAudience(cfg.Audience))
+    }
+
+    return &JWTAuthenticator{keys: keys, cfg: cfg, parser: jwt.NewParser(opts...)}
+}
+
+func (a *JWTAuthenticator) Authenticate(ctx context.Context, token string) (*Principal, error) {
+    claims := jwt.MapClaims{}
+    _, err := a.parser.ParseWithClaims(token, claims, func(t *jwt.Token) (interface{}, error) {
+        kid, _ := t.Header["kid"].(string)
+        return a.keys.Key(ctx, kid)
+    })
+    if err != nil {
+        return nil, fmt.Errorf("%w: %v", ErrUnauthorized, err)
+    }
+
+    subject, _ := claims["sub"].(string)
+    userID, _ := claims[a.cfg.UserClaim].(string)
+    if userID == "" {
+        return nil, fmt.Errorf("%w: claim %s is missing", ErrUnauthorized, a.cfg.UserClaim)
+    }
+
+    scopes, err := claimScopes(claims[a.cfg.ScopesClaim])
+    if err != nil {
+        return nil, fmt.Errorf("%w: %v", ErrUnauthorized, err)
+    }
+
+    issuer, _ := claims["iss"].(string)
+    return &Principal{Subject: subject, UserID: userID, Scopes: scopes, Credential: "jwt:" + issuer + "|" + subject}, nil
+}
+
+// claimScopes принимает scope как строку через пробел (RFC 8693) или массив строк (scp)
+func claimScopes(v interface{}) ([]string, error) {
+    switch v := v.(type) {
+    case nil:
+        return nil, nil
+    case string:
+        return ParseScopes(v), nil
+    case []interface{}:
+        scopes := make([]string, 0, len(v))
+        for _, s := range v {
+            str, ok := s.(string)
+            if !ok {
+                return nil, errors.New("scope claim must contain strings")
+            }
+            scopes = append(scopes, str)
+        }
+        return scopes, nil
+    default:
+        return nil, errors.New("scope claim has unsupported type")
+    }
+}
+
+// ChainAuthenticator направляет JWT (три сегмента через точку) в JWT-аутентификатор,
+// остальные токены - в аутентификатор API-токенов
+type ChainAuthenticator struct {
+    Tokens Authenticator
+    JWT    Authenticator // nil - JWT не принимаются
+}
+
+func (c ChainAuthenticator) Authenticate(ctx context.Context, token string) (*Principal, error) {
+    if c.JWT != nil && strings.Count(token, ".") == 2 && !strings.HasPrefix(token, TokenPrefix) {
+        return c.JWT.Authenticate(ctx, token)
+    }
+    return c.Tokens.Authenticate(ctx, token)
+}
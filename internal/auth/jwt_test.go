@@ -0,0 +1,188 @@
+package auth
+
+import (
+    "context"
+    "crypto/ecdsa"
+    "crypto/elliptic"
+    "crypto/rand"
+    "crypto/rsa"
+    "encoding/base64"
+    "encoding/json"
+    "errors"
+    "math/big"
+    "os"
+    "path/filepath"
+    "testing"
+    "time"
+
+    "github.com/golang-jwt/jwt/v5"
+)
+
+func b64(b []byte) string {
+    return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func rsaJWK(kid string, key *rsa.PublicKey) map[string]string {
+    return map[string]string{
+        "kty": "RSA", "kid": kid, "use": "sig", "alg": "RS256",
+        "n": b64(key.N.Bytes()), "e": b64(big.NewInt(int64(key.E)).Bytes()),
+    }
+}
+
+func ecJWK(kid string, key *ecdsa.PublicKey) map[string]string {
+    return map[string]string{
+        "kty": "EC", "kid": kid, "use": "sig", "alg": "ES256", "crv": "P-256",
+        "x": b64(key.X.FillBytes(make([]byte, 32))), "y": b64(key.Y.FillBytes(make([]byte, 32))),
+    }
+}
+
+func writeJWKS(t *testing.T, path string, keys ...map[string]string) {
+    t.Helper()
+    data, _ := json.Marshal(map[string]interface{}{"keys": keys})
+    if err := os.WriteFile(path, data, 0o600); err != nil {
+        t.Fatal(err)
+    }
+}
+
+func sign(t *testing.T, method jwt.SigningMethod, kid string, key interface{}, claims jwt.MapClaims) string {
+    t.Helper()
+    tok := jwt.NewWithClaims(method, claims)
+    tok.Header["kid"] = kid
+    s, err := tok.SignedString(key)
+    if err != nil {
+        t.Fatal(err)
+    }
+    return s
+}
+
+func validClaims() jwt.MapClaims {
+    return jwt.MapClaims{
+        "iss":   "https://sso.example.com",
+        "aud":   "pr-review-assigner",
+        "sub":   "abc-123",
+        "login": "u1",
+        "scope": "read write:prs",
+        "exp":   time.Now().Add(time.Hour).Unix(),
+    }
+}
+
+func TestJWTAuthenticator(t *testing.T) {
+    rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+    ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+    otherKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+
+    path := filepath.Join(t.TempDir(), "jwks.json")
+    writeJWKS(t, path, rsaJWK("rsa1", &rsaKey.PublicKey), ecJWK("ec1", &ecKey.PublicKey))
+
+    ctx := context.Background()
+    keys, err := NewKeySet(ctx, path)
+    if err != nil {
+        t.Fatalf("NewKeySet: %v", err)
+    }
+    authn := NewJWTAuthenticator(keys, JWTConfig{
+        Issuer:    "https://sso.example.com",
+        Audience:  "pr-review-assigner",
+        UserClaim: "login",
+    })
+
+    for _, tc := range []struct {
+        name   string
+        method jwt.SigningMethod
+        kid    string
+        key    interface{}
+    }{
+        {"RS256", jwt.SigningMethodRS256, "rsa1", rsaKey},
+        {"ES256", jwt.SigningMethodES256, "ec1", ecKey},
+    } {
+        p, err := authn.Authenticate(ctx, sign(t, tc.method, tc.kid, tc.key, validClaims()))
+        if err != nil {
+            t.Fatalf("%s: unexpected error %v", tc.name, err)
+        }
+        if p.UserID != "u1" || p.Subject != "abc-123" {
+            t.Errorf("%s: unexpected principal %+v", tc.name, p)
+        }
+        if !p.HasScope(ScopeWritePRs) || p.HasScope(ScopeAdminTeams) {
+            t.Errorf("%s: unexpected scopes %v", tc.name, p.Scopes)
+        }
+    }
+
+    rejected := map[string]string{}
+
+    c := validClaims()
+    c["iss"] = "https://evil.example.com"
+    rejected["wrong issuer"] = sign(t, jwt.SigningMethodRS256, "rsa1", rsaKey, c)
+
+    c = validClaims()
+    c["aud"] = "other-service"
+    rejected["wrong audience"] = sign(t, jwt.SigningMethodRS256, "rsa1", rsaKey, c)
+
+    c = validClaims()
+    c["exp"] = time.Now().Add(-time.Hour).Unix()
+    rejected["expired"] = sign(t, jwt.SigningMethodRS256, "rsa1", rsaKey, c)
+
+    c = validClaims()
+    delete(c, "login")
+    rejected["missing user claim"] = sign(t, jwt.SigningMethodRS256, "rsa1", rsaKey, c)
+
+    rejected["unknown key"] = sign(t, jwt.SigningMethodRS256, "rsa1", otherKey, validClaims())
+    rejected["hs256"] = sign(t, jwt.SigningMethodHS256, "rsa1", []byte("secret"), validClaims())
+
+    for name, token := range rejected {
+        if _, err := authn.Authenticate(ctx, token); !errors.Is(err, ErrUnauthorized) {
+            t.Errorf("%s: expected ErrUnauthorized, got %v", name, err)
+        }
+    }
+}
+
+func TestKeySetRotation(t *testing.T) {
+    oldKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+    newKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+
+    path := filepath.Join(t.TempDir(), "jwks.json")
+    writeJWKS(t, path, rsaJWK("old", &oldKey.PublicKey))
+
+    ctx := context.Background()
+    keys, err := NewKeySet(ctx, path)
+    if err != nil {
+        t.Fatal(err)
+    }
+    authn := NewJWTAuthenticator(keys, JWTConfig{})
+    token := sign(t, jwt.SigningMethodRS256, "new", newKey, validClaims())
+
+    if _, err := authn.Authenticate(ctx, token); !errors.Is(err, ErrUnauthorized) {
+        t.Fatalf("token signed by unpublished key should be rejected, got %v", err)
+    }
+
+    writeJWKS(t, path, rsaJWK("new", &newKey.PublicKey))
+    if err := keys.Reload(ctx); err != nil {
+        t.Fatal(err)
+    }
+
+    if _, err := authn.Authenticate(ctx, token); err != nil {
+        t.Errorf("token should be accepted after reload, got %v", err)
+    }
+    if _, err := authn.Authenticate(ctx, sign(t, jwt.SigningMethodRS256, "old", oldKey, validClaims())); err == nil {
+        t.Error("token signed by rotated-out key should be rejected")
+    }
+}
+
+func TestChainAuthenticator(t *testing.T) {
+    apiToken, hash, _ := GenerateToken()
+    tokens := NewTokenAuthenticator(stubStore{hash: {ID: 1, Name: "ci", Scopes: ScopeRead}}, "")
+    chain := ChainAuthenticator{Tokens: tokens, JWT: stubAuthenticator{}}
+
+    p, err := chain.Authenticate(context.Background(), apiToken)
+    if err != nil || p.Subject != "ci" {
+        t.Errorf("API token should go to token authenticator, got %+v, %v", p, err)
+    }
+    p, err = chain.Authenticate(context.Background(), "a.b.c")
+    if err != nil || p.Subject != "jwt" {
+        t.Errorf("JWT should go to JWT authenticator, got %+v, %v", p, err)
+    }
+}
+
+type stubAuthenticator struct{}
+
+func (stubAuthenticator) Authenticate(ctx context.Context, token string) (*Principal, error) {
+    return &Principal{Subject: "jwt"}, nil
+}
@@ -0,0 +1,65 @@
+package auth
+
+import (
+    "errors"
+    "log/slog"
+    "net/http"
+    "strings"
+
+    "pr-review-assigner/internal/problem"
+)
+
+// Middleware аутентифицирует запрос по заголовку Authorization: Bearer <token>
+func Middleware(a Authenticator) func(http.Handler) http.Handler {
+    return func(next http.Handler) http.Handler {
+        return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+            token := bearerToken(r)
+            if token == "" {
+                w.Header().Set("WWW-Authenticate", `Bearer realm="pr-review-assigner"`)
+                problem.Write(w, r, problem.New(http.StatusUnauthorized, "UNAUTHORIZED", "missing bearer token"))
+                return
+            }
+
+            p, err := a.Authenticate(r.Context(), token)
+            if err != nil {
+                if errors.Is(err, ErrUnauthorized) {
+                    w.Header().Set("WWW-Authenticate", `Bearer realm="pr-review-assigner", error="invalid_token"`)
+                    problem.Write(w, r, problem.New(http.StatusUnauthorized, "UNAUTHORIZED", err.Error()))
+                    return
+                }
+                // Причину видно только в логе: это сбой хранилища токенов, а не ошибка клиента
+                slog.ErrorContext(r.Context(), "authenticate", "error", err)
+                problem.Write(w, r, problem.New(http.StatusInternalServerError, "INTERNAL_ERROR", "internal error"))
+                return
+            }
+
+            next.ServeHTTP(w, r.WithContext(WithPrincipal(r.Context(), p)))
+        })
+    }
+}
+
+// Require пропускает только вызывающих с указанным scope
+func Require(scope string) func(http.Handler) http.Handler {
+    return func(next http.Handler) http.Handler {
+        return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+            p := FromContext(r.Context())
+            if p == nil {
+                problem.Write(w, r, problem.New(http.StatusUnauthorized, "UNAUTHORIZED", "authentication required"))
+                return
+            }
+            if !p.HasScope(scope) {
+                problem.Write(w, r, problem.New(http.StatusForbidden, "FORBIDDEN", "token lacks scope "+scope))
+                return
+            }
+            next.ServeHTTP(w, r)
+        })
+    }
+}
+
+func bearerToken(r *http.Request) string {
+    header := r.Header.Get("Authorization")
+    if len(header) > 7 && strings.EqualFold(header[:7], "bearer ") {
+        return strings.TrimSpace(header[7:])
+    }
+    return ""
+}
@@ -0,0 +1,165 @@
+package config
+
+import (
+    "encoding/json"
+    "flag"
+    "io"
+    "os"
+    "path/filepath"
+    "strings"
+    "testing"
+    "time"
+)
+
+func load(t *testing.T, args ...string) (*Config, error) {
+    t.Helper()
+    fs := flag.NewFlagSet("test", flag.ContinueOnError)
+    fs.SetOutput(io.Discard)
+    return Load(fs, args)
+}
+
+func writeFile(t *testing.T, content string) string {
+    t.Helper()
+    path := filepath.Join(t.TempDir(), "config.yaml")
+    if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+        t.Fatal(err)
+    }
+    return path
+}
+
+// Флаги переопределяют окружение, окружение - файл, файл - значения по умолчанию
+func TestLayers(t *testing.T) {
+    path := writeFile(t, `
+server:
+  addr: ":7000"
+  grpc_addr: ":7001"
+  read_timeout: 5s
+database:
+  url: postgres://file:secret@db/app
+  max_open_conns: 10
+reviewers:
+  count: 3
+  strategy: least_loaded
+notifications:
+  webhooks:
+    - url: https://hooks.example.com/a
+      secret: hook-secret
+      events: [pr.merged]
+`)
+    t.Setenv("DATABASE_URL", "postgres://env:secret@db/app")
+    t.Setenv("DB_MAX_OPEN_CONNS", "20")
+    t.Setenv("REVIEWER_COUNT", "4")
+    t.Setenv("PORT", "9000")
+
+    c, err := load(t, "-config", path, "-reviewer-count=1", "-db-max-idle-conns", "2")
+    if err != nil {
+        t.Fatalf("Load: %v", err)
+    }
+    if c.Server.Addr != ":9000" || c.Server.GRPCAddr != ":7001" {
+        t.Errorf("unexpected addresses %q, %q", c.Server.Addr, c.Server.GRPCAddr)
+    }
+    if c.Server.ReadTimeout != Duration(5*time.Second) || c.Server.IdleTimeout != Duration(time.Minute) {
+        t.Errorf("unexpected timeouts %v, %v", c.Server.ReadTimeout, c.Server.IdleTimeout)
+    }
+    if c.Database.URL != "postgres://env:secret@db/app" || c.Database.MaxOpenConns != 20 || c.Database.MaxIdleConns != 2 {
+        t.Errorf("unexpected database %+v", c.Database)
+    }
+    if c.Reviewers.Count != 1 || c.Reviewers.Strategy != "least_loaded" {
+        t.Errorf("unexpected reviewers %+v", c.Reviewers)
+    }
+    if len(c.Notifications.Webhooks) != 1 || c.Notifications.Webhooks[0].Events[0] != "pr.merged" {
+        t.Errorf("unexpected webhooks %+v", c.Notifications.Webhooks)
+    }
+
+    // CONFIG_FILE работает так же, как -config
+    t.Setenv("CONFIG_FILE", path)
+    if c, err := load(t); err != nil || c.Server.GRPCAddr != ":7001" {
+        t.Errorf("expected file from CONFIG_FILE, got %+v, %v", c, err)
+    }
+}
+
+func TestValidateReportsAllErrors(t *testing.T) {
+    path := writeFile(t, `
+server:
+  write_timeout: -1s
+  max_body_bytes: 0
+  idempotency_ttl: 0s
+database:
+  url: mysql://localhost/app
+  max_open_conns: 2
+  max_idle_conns: 5
+reviewers:
+  count: 0
+  strategy: round_robin
+auth:
+  jwt:
+    issuer: https://sso.example.com
+notifications:
+  webhooks:
+    - url: hooks.example.com
+      events: [pr.closed]
+logging:
+  level: verbose
+  format: xml
+tracing:
+  exporter: file
+  endpoint: collector:4318
+`)
+    _, err := load(t, "-config", path)
+    if err == nil {
+        t.Fatal("expected validation error")
+    }
+    for _, field := range []string{
+        "server.write_timeout", "server.max_body_bytes", "server.idempotency_ttl", "database.url", "database.max_idle_conns", "reviewers.count",
+        "reviewers.strategy", "auth.jwt.jwks", "notifications.webhooks[0].url", "notifications.webhooks[0].events",
+        "logging.level", "logging.format", "tracing.file", "tracing.endpoint",
+    } {
+        if !strings.Contains(err.Error(), field+":") {
+            t.Errorf("expected an error for %s in:\n%v", field, err)
+        }
+    }
+}
+
+func TestLoadErrors(t *testing.T) {
+    t.Setenv("DATABASE_URL", "memory://")
+
+    if _, err := load(t, "-config", writeFile(t, "server:\n  adr: \":1\"\n")); err == nil || !strings.Contains(err.Error(), "adr") {
+        t.Errorf("expected unknown field error, got %v", err)
+    }
+    if _, err := load(t, "-config", filepath.Join(t.TempDir(), "missing.yaml")); err == nil {
+        t.Error("expected missing file error")
+    }
+    if _, err := load(t, "-reviewer-count=two"); err == nil {
+        t.Error("expected invalid flag error")
+    }
+    t.Setenv("HTTP_READ_TIMEOUT", "soon")
+    if _, err := load(t); err == nil || !strings.Contains(err.Error(), "HTTP_READ_TIMEOUT") {
+        t.Errorf("expected env error naming the variable, got %v", err)
+    }
+}
+
+func TestRedacted(t *testing.T) {
+    t.Setenv("DATABASE_URL", "postgres://user:password@db:5432/app?sslmode=verify-full&password=query-secret&sslpassword=key-secret")
+    t.Setenv("ADMIN_TOKEN", "admin-secret")
+    t.Setenv("JWT_JWKS", "https://sso.example.com/keys?token=jwks-secret")
+    c, err := load(t, "-config", writeFile(t, "notifications:\n  webhooks:\n    - {url: https://hooks.example.com/services/T0/B0/hook-token, secret: hook-secret}\n"))
+    if err != nil {
+        t.Fatalf("Load: %v", err)
+    }
+
+    data, _ := json.Marshal(c.Redacted())
+    out := string(data)
+    for _, secret := range []string{":password@", "query-secret", "key-secret", "jwks-secret", "admin-secret", "hook-secret", "hook-token"} {
+        if strings.Contains(out, secret) {
+            t.Errorf("redacted config leaks %q: %s", secret, out)
+        }
+    }
+    if !strings.Contains(out, `"read_timeout":"15s"`) || !strings.Contains(out, "db:5432/app") || !strings.Contains(out, "sslmode=verify-full") ||
+        !strings.Contains(out, "hooks.example.com") || !strings.Contains(out, "sso.example.com") {
+        t.Errorf("unexpected redacted config %s", out)
+    }
+    // Исходная конфигурация не меняется
+    if c.Auth.AdminToken != "admin-secret" || c.Notifications.Webhooks[0].Secret != "hook-secret" {
+        t.Error("Redacted modified the original config")
+    }
+}
@@ -0,0 +1,340 @@
+// Package dashboard - встроенный HTML-интерфейс для менеджеров поверх того же сервисного слоя, что и JSON API
+package dashboard
+
+import (
+    "bytes"
+    "embed"
+    "errors"
+    "html/template"
+    "io/fs"
+    "log/slog"
+    "net/http"
+    "net/url"
+    "sort"
+    "strconv"
+    "strings"
+
+    "github.com/go-chi/chi/v5"
+    "pr-review-assigner/internal/auth"
+    "pr-review-assigner/internal/repo"
+    "pr-review-assigner/internal/service"
+)
+
+//go:embed templates/*.html static/*
+var assets embed.FS
+
+// pages - имена шаблонов страниц; каждая собирается вместе с layout.html
+var pages = []string{"login", "index", "team", "user", "error"}
+
+type Handler struct {
+    svc          *service.Service
+    authn        auth.Authenticator
+    basePath     string
+    templates    map[string]*template.Template
+    sessions     *sessionStore
+    secureCookie bool
+}
+
+// New создает dashboard; basePath - префикс, под которым смонтированы Routes (например, /ui)
+func New(svc *service.Service, authn auth.Authenticator, basePath string) *Handler {
+    h := &Handler{
+        svc:          svc,
+        authn:        authn,
+        basePath:     strings.TrimSuffix(basePath, "/"),
+        templates:    make(map[string]*template.Template, len(pages)),
+        sessions:     newSessionStore(),
+        secureCookie: true,
+    }
+
+    funcs := template.FuncMap{"url": func(path string) string { return h.basePath + path }}
+    for _, name := range pages {
+        h.templates[name] = template.Must(template.New(name).Funcs(funcs).
+            ParseFS(assets, "templates/layout.html", "templates/"+name+".html"))
+    }
+    return h
+}
+
+// SetSecureCookie задает флаг Secure у cookie; по умолчанию они отправляются только по HTTPS
+func (h *Handler) SetSecureCookie(secure bool) {
+    h.secureCookie = secure
+}
+
+func (h *Handler) Routes() chi.Router {
+    r := chi.NewRouter()
+
+    static, _ := fs.Sub(assets, "static")
+    r.Handle("/static/*", http.StripPrefix(h.basePath+"/static/", http.FileServer(http.FS(static))))
+
+    r.Get("/login", h.LoginPage)
+    r.With(sameOrigin).Post("/login", h.Login)
+    r.With(sameOrigin).Post("/logout", h.Logout)
+
+    r.Group(func(r chi.Router) {
+        r.Use(h.session)
+        r.Get("/", h.Index)
+        r.Get("/teams/{team}", h.Team)
+        r.Get("/users/{id}", h.User)
+
+        r.With(sameOrigin).Post("/users/{id}/active", h.SetUserActive)
+        r.With(sameOrigin).Post("/prs/{id}/reassign", h.Reassign)
+    })
+
+    return r
+}
+
+// Данные страниц
+
+type page struct {
+    Title   string
+    Subject string // имя вошедшего токена или пользователя
+    Flash   string
+}
+
+type statRow struct {
+    UserID  string
+    Name    string
+    Count   int
+    Percent int // ширина столбца относительно максимума
+}
+
+type indexPage struct {
+    page
+    Teams []repo.Team
+    Stats []statRow
+}
+
+type teamPage struct {
+    page
+    Team    string
+    Members []repo.User
+    PRs     []repo.PR
+}
+
+type userPage struct {
+    page
+    User    *repo.User
+    Team    string
+    Reviews []repo.PR
+}
+
+type errorPage struct {
+    page
+    Status  int
+    Message string
+    Back    string
+}
+
+// Страницы
+
+func (h *Handler) Index(w http.ResponseWriter, r *http.Request) {
+    ctx := r.Context()
+
+    teams, err := h.svc.ListTeams(ctx)
+    if err != nil {
+        h.fail(w, r, err)
+        return
+    }
+    stats, err := h.svc.GetStats(ctx)
+    if err != nil {
+        h.fail(w, r, err)
+        return
+    }
+    users, err := h.svc.ListUsers(ctx)
+    if err != nil {
+        h.fail(w, r, err)
+        return
+    }
+
+    names := make(map[string]string, len(users))
+    for _, u := range users {
+        names[u.ID] = u.Name
+    }
+
+    rows := make([]statRow, 0, len(stats.AssignmentStats))
+    max := 0
+    for userID, count := range stats.AssignmentStats {
+        rows = append(rows, statRow{UserID: userID, Name: names[userID], Count: count})
+        if count > max {
+            max = count
+        }
+    }
+    sort.Slice(rows, func(i, j int) bool {
+        if rows[i].Count != rows[j].Count {
+            return rows[i].Count > rows[j].Count
+        }
+        return rows[i].UserID < rows[j].UserID
+    })
+    for i := range rows {
+        if max > 0 {
+            rows[i].Percent = rows[i].Count * 100 / max
+        }
+    }
+
+    h.render(w, r, http.StatusOK, "index", &indexPage{page: h.page(r, "Команды"), Teams: teams, Stats: rows})
+}
+
+func (h *Handler) Team(w http.ResponseWriter, r *http.Request) {
+    teamName := chi.URLParam(r, "team")
+
+    team, members, err := h.svc.GetTeam(r.Context(), teamName)
+    if err != nil {
+        h.fail(w, r, err)
+        return
+    }
+    prs, err := h.svc.ListTeamOpenPRs(r.Context(), teamName)
+    if err != nil {
+        h.fail(w, r, err)
+        return
+    }
+
+    h.render(w, r, http.StatusOK, "team", &teamPage{page: h.page(r, team.Name), Team: team.Name, Members: members, PRs: prs})
+}
+
+func (h *Handler) User(w http.ResponseWriter, r *http.Request) {
+    userID := chi.URLParam(r, "id")
+
+    user, err := h.svc.GetUser(r.Context(), userID)
+    if err != nil {
+        h.fail(w, r, err)
+        return
+    }
+    reviews, err := h.svc.GetUserReviews(r.Context(), userID)
+    if err != nil {
+        h.fail(w, r, err)
+        return
+    }
+    h.render(w, r, http.StatusOK, "user", &userPage{page: h.page(r, user.Name), User: user, Team: user.TeamName, Reviews: reviews})
+}
+
+// Действия; после успеха - redirect на страницу, с которой пришла форма
+
+func (h *Handler) SetUserActive(w http.ResponseWriter, r *http.Request) {
+    active := r.PostFormValue("active") == "true"
+    if _, err := h.svc.SetUserActive(r.Context(), chi.URLParam(r, "id"), active); err != nil {
+        h.fail(w, r, err)
+        return
+    }
+    h.back(w, r, "")
+}
+
+func (h *Handler) Reassign(w http.ResponseWriter, r *http.Request) {
+    prID := chi.URLParam(r, "id")
+    oldUserID := r.PostFormValue("old_user_id")
+
+    // Версия PR на момент показа страницы: если ревьюверов уже поменяли, замена не выполняется
+    ctx := r.Context()
+    if version, err := strconv.ParseInt(r.PostFormValue("version"), 10, 64); err == nil {
+        ctx = service.WithExpectedVersion(ctx, version)
+    }
+    _, newUserID, err := h.svc.ReassignReviewer(ctx, prID, oldUserID)
+    if err != nil {
+        h.fail(w, r, err)
+        return
+    }
+    h.back(w, r, prID+": "+oldUserID+" → "+newUserID)
+}
+
+// Вспомогательные функции
+
+func (h *Handler) page(r *http.Request, title string) page {
+    p := page{Title: title}
+    if c, err := r.Cookie(flashCookie); err == nil {
+        p.Flash, _ = url.QueryUnescape(c.Value)
+    }
+    if principal := auth.FromContext(r.Context()); principal != nil {
+        p.Subject = principal.UserID
+        if p.Subject == "" {
+            p.Subject = principal.Subject
+        }
+    }
+    return p
+}
+
+func (h *Handler) render(w http.ResponseWriter, r *http.Request, status int, name string, data interface{}) {
+    var buf bytes.Buffer
+    if err := h.templates[name].ExecuteTemplate(&buf, "layout", data); err != nil {
+        slog.ErrorContext(r.Context(), "dashboard: render", "template", name, "error", err)
+        http.Error(w, "template error", http.StatusInternalServerError)
+        return
+    }
+    if _, err := r.Cookie(flashCookie); err == nil {
+        // Сообщение показывается один раз
+        http.SetCookie(w, &http.Cookie{Name: flashCookie, Path: h.cookiePath(), MaxAge: -1})
+    }
+    w.Header().Set("Content-Type", "text/html; charset=utf-8")
+    w.WriteHeader(status)
+    buf.WriteTo(w)
+}
+
+// statusByKind - статус страницы ошибки по классу ошибки сервиса, как в JSON API
+var statusByKind = map[service.Kind]int{
+    service.KindInvalid:       http.StatusBadRequest,
+    service.KindNotFound:      http.StatusNotFound,
+    service.KindExists:        http.StatusConflict,
+    service.KindConflict:      http.StatusConflict,
+    service.KindForbidden:     http.StatusForbidden,
+    service.KindUnprocessable: http.StatusUnprocessableEntity,
+    service.KindPrecondition:  http.StatusPreconditionFailed,
+}
+
+// messageByCode - понятные менеджеру сообщения для частых ошибок; для остальных показывается текст ошибки сервиса
+var messageByCode = map[string]string{
+    service.CodeNoTeam:             "У пользователя нет команды",
+    service.CodeNotFound:           "Не найдено",
+    service.CodeForbidden:          "Недостаточно прав для этого действия",
+    service.CodePRMerged:           "PR уже смержен",
+    service.CodeNotAssigned:        "Пользователь не назначен ревьювером этого PR",
+    service.CodeNoCandidate:        "В команде нет активного кандидата на замену",
+    service.CodePreconditionFailed: "PR изменился, пока страница была открыта: обновите ее и повторите",
+}
+
+// internalErrorMessage показывается вместо ошибок, подробности которых клиенту не раскрываются
+const internalErrorMessage = "Внутренняя ошибка, подробности в логе сервера"
+
+// fail показывает страницу ошибки. Статус выбирается по классу ошибки сервиса; сбои базы и ошибки
+// без типа записываются в лог, а пользователь видит только общее сообщение.
+func (h *Handler) fail(w http.ResponseWriter, r *http.Request, err error) {
+    status, message := http.StatusInternalServerError, internalErrorMessage
+    var se *service.Error
+    if !errors.As(err, &se) || se.Kind == service.KindInternal {
+        slog.ErrorContext(r.Context(), "dashboard request failed", "error", err)
+    } else {
+        status = statusByKind[se.Kind]
+        var ok bool
+        if message, ok = messageByCode[se.Code]; !ok {
+            message = se.Error()
+        }
+    }
+
+    h.render(w, r, status, "error", &errorPage{
+        page:    h.page(r, "Ошибка"),
+        Status:  status,
+        Message: message,
+        Back:    h.backPath(r),
+    })
+}
+
+// backPath - страница из поля back формы; принимаются только пути внутри dashboard
+func (h *Handler) backPath(r *http.Request) string {
+    back := r.PostFormValue("back")
+    if !strings.HasPrefix(back, h.basePath+"/") || strings.HasPrefix(back, "//") || strings.Contains(back, "\\") {
+        return h.basePath + "/"
+    }
+    return back
+}
+
+// back возвращает на страницу формы; flash показывается на ней один раз
+func (h *Handler) back(w http.ResponseWriter, r *http.Request, flash string) {
+    if flash != "" {
+        http.SetCookie(w, &http.Cookie{
+            Name:     flashCookie,
+            Value:    url.QueryEscape(flash),
+            Path:     h.cookiePath(),
+            MaxAge:   60,
+            HttpOnly: true,
+            Secure:   h.secureCookie,
+            SameSite: http.SameSiteStrictMode,
+        })
+    }
+    http.Redirect(w, r, h.backPath(r), http.StatusSeeOther)
+}
@@ -0,0 +1,288 @@
+package dashboard
+
+import (
+    "context"
+    "errors"
+    "net/http"
+    "net/http/httptest"
+    "net/url"
+    "strings"
+    "testing"
+    "time"
+
+    "github.com/go-chi/chi/v5"
+    "pr-review-assigner/internal/auth"
+    "pr-review-assigner/internal/repo"
+    "pr-review-assigner/internal/repo/memory"
+    "pr-review-assigner/internal/service"
+)
+
+// newTestRepo - команда backend (u2, u3 и неактивный u9) и открытый PR pr-1 автора u9 с ревьювером u2;
+// u9 неактивен, поэтому единственная замена для u2 - u3
+func newTestRepo(t *testing.T) *memory.Repo {
+    t.Helper()
+    ctx := context.Background()
+    store := memory.New()
+    for _, u := range []repo.User{{ID: "u2", Name: "Bob"}, {ID: "u3", Name: "Carol"}, {ID: "u9", Name: "Zed"}} {
+        if err := store.CreateUser(ctx, u.ID, u.Name); err != nil {
+            t.Fatal(err)
+        }
+    }
+    teamID, err := store.CreateTeam(ctx, "backend")
+    if err != nil {
+        t.Fatal(err)
+    }
+    for _, id := range []string{"u2", "u3", "u9"} {
+        if err := store.AddMember(ctx, teamID, id); err != nil {
+            t.Fatal(err)
+        }
+    }
+    if err := store.SetUserActive(ctx, "u9", false); err != nil {
+        t.Fatal(err)
+    }
+    if err := store.CreatePRWithID(ctx, "pr-1", "Add <search>", "u9"); err != nil {
+        t.Fatal(err)
+    }
+    if err := store.AddReviewer(ctx, "pr-1", "u2"); err != nil {
+        t.Fatal(err)
+    }
+    // Статистика назначений: u2 - 4, u3 - 1
+    for _, id := range []string{"u2", "u2", "u2", "u2", "u3"} {
+        if err := store.AddAssignmentEvent(ctx, "pr-1", id); err != nil {
+            t.Fatal(err)
+        }
+    }
+    return store
+}
+
+func isActive(t *testing.T, store *memory.Repo, userID string) bool {
+    t.Helper()
+    u, err := store.GetUserByID(context.Background(), userID)
+    if err != nil {
+        t.Fatal(err)
+    }
+    return u.IsActive
+}
+
+func reviewerIDs(t *testing.T, store *memory.Repo, prID string) []string {
+    t.Helper()
+    users, err := store.GetPRReviewers(context.Background(), prID)
+    if err != nil {
+        t.Fatal(err)
+    }
+    var ids []string
+    for _, u := range users {
+        ids = append(ids, u.ID)
+    }
+    return ids
+}
+
+type stubAuthenticator map[string]*auth.Principal
+
+func (a stubAuthenticator) Authenticate(ctx context.Context, token string) (*auth.Principal, error) {
+    if p, ok := a[token]; ok {
+        return p, nil
+    }
+    return nil, auth.ErrUnauthorized
+}
+
+// failingAuthenticator имитирует недоступное хранилище токенов
+type failingAuthenticator struct{}
+
+func (failingAuthenticator) Authenticate(ctx context.Context, token string) (*auth.Principal, error) {
+    return nil, errors.New("dial tcp 10.0.0.5:5432: connection refused")
+}
+
+func newTestDashboard(t *testing.T) (http.Handler, *memory.Repo) {
+    store := newTestRepo(t)
+    authn := stubAuthenticator{
+        "admin-token":  {Subject: "ops", Scopes: []string{auth.ScopeAdmin}},
+        "writer-token": {Subject: "ci", Scopes: []string{auth.ScopeWritePRs}},
+    }
+    r := chi.NewRouter()
+    r.Mount("/ui", New(service.New(store), authn, "/ui").Routes())
+    return r, store
+}
+
+func request(t *testing.T, h http.Handler, method, path string, form url.Values, cookies ...*http.Cookie) *httptest.ResponseRecorder {
+    t.Helper()
+    req := httptest.NewRequest(method, path, strings.NewReader(form.Encode()))
+    if form != nil {
+        req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+    }
+    for _, c := range cookies {
+        req.AddCookie(c)
+    }
+    rec := httptest.NewRecorder()
+    h.ServeHTTP(rec, req)
+    return rec
+}
+
+func login(t *testing.T, h http.Handler, token string) *httptest.ResponseRecorder {
+    return request(t, h, http.MethodPost, "/ui/login", url.Values{"token": {token}})
+}
+
+func TestLogin(t *testing.T) {
+    h, _ := newTestDashboard(t)
+
+    if rec := request(t, h, http.MethodGet, "/ui/static/style.css", nil); rec.Code != http.StatusOK {
+        t.Errorf("expected static assets without a session, got %d", rec.Code)
+    }
+
+    rec := request(t, h, http.MethodGet, "/ui/", nil)
+    if rec.Code != http.StatusSeeOther || rec.Header().Get("Location") != "/ui/login" {
+        t.Fatalf("expected redirect to login, got %d %q", rec.Code, rec.Header().Get("Location"))
+    }
+
+    if rec := login(t, h, "bogus"); rec.Code != http.StatusUnauthorized {
+        t.Errorf("expected 401 for unknown token, got %d", rec.Code)
+    }
+    if rec := login(t, h, "writer-token"); rec.Code != http.StatusForbidden {
+        t.Errorf("expected 403 for token without read scope, got %d", rec.Code)
+    }
+
+    rec = login(t, h, "admin-token")
+    if rec.Code != http.StatusSeeOther {
+        t.Fatalf("expected redirect after login, got %d", rec.Code)
+    }
+    cookies := rec.Result().Cookies()
+    if len(cookies) != 1 {
+        t.Fatalf("expected session cookie, got %v", cookies)
+    }
+    c := cookies[0]
+    if !c.HttpOnly || !c.Secure || c.SameSite != http.SameSiteStrictMode || c.Path != "/ui" {
+        t.Errorf("session cookie must be HttpOnly, Secure, SameSite=Strict and scoped to /ui: %+v", c)
+    }
+    if strings.Contains(c.Value, "admin-token") {
+        t.Errorf("session cookie must not carry the token: %q", c.Value)
+    }
+
+    rec = request(t, h, http.MethodGet, "/ui/", nil, c)
+    if rec.Code != http.StatusOK {
+        t.Fatalf("expected index page, got %d", rec.Code)
+    }
+    for _, want := range []string{"backend", "Bob", `style="width: 100%"`, `style="width: 25%"`} {
+        if !strings.Contains(rec.Body.String(), want) {
+            t.Errorf("index page does not contain %q", want)
+        }
+    }
+
+    // После выхода тот же ID сессии больше не действует
+    request(t, h, http.MethodPost, "/ui/logout", url.Values{}, c)
+    if rec := request(t, h, http.MethodGet, "/ui/", nil, c); rec.Code != http.StatusSeeOther {
+        t.Errorf("expected redirect to login after logout, got %d", rec.Code)
+    }
+    if rec := request(t, h, http.MethodGet, "/ui/", nil, &http.Cookie{Name: sessionCookie, Value: "admin-token"}); rec.Code != http.StatusSeeOther {
+        t.Errorf("expected a raw token in the cookie to be rejected, got %d", rec.Code)
+    }
+}
+
+func TestLoginHidesInternalErrors(t *testing.T) {
+    h := New(service.New(newTestRepo(t)), failingAuthenticator{}, "/ui").Routes()
+    rec := request(t, h, http.MethodPost, "/login", url.Values{"token": {"admin-token"}})
+    if rec.Code != http.StatusInternalServerError || strings.Contains(rec.Body.String(), "10.0.0.5") {
+        t.Errorf("expected a generic 500 without the storage error, got %d %q", rec.Code, rec.Body.String())
+    }
+}
+
+func TestSessionExpires(t *testing.T) {
+    s := newSessionStore()
+    now := time.Date(2024, 1, 1, 9, 0, 0, 0, time.UTC)
+    s.now = func() time.Time { return now }
+
+    id, err := s.create("admin-token")
+    if err != nil {
+        t.Fatal(err)
+    }
+    if token, ok := s.token(id); !ok || token != "admin-token" {
+        t.Fatalf("expected session to hold the token, got %q %v", token, ok)
+    }
+    now = now.Add(sessionTTL)
+    if _, ok := s.token(id); ok {
+        t.Error("expected session to expire after sessionTTL")
+    }
+    if len(s.sessions) != 0 {
+        t.Errorf("expected expired session to be removed, got %d", len(s.sessions))
+    }
+}
+
+func TestTeamPageActions(t *testing.T) {
+    h, store := newTestDashboard(t)
+    session := login(t, h, "admin-token").Result().Cookies()[0]
+
+    rec := request(t, h, http.MethodGet, "/ui/teams/backend", nil, session)
+    if rec.Code != http.StatusOK {
+        t.Fatalf("expected team page, got %d", rec.Code)
+    }
+    body := rec.Body.String()
+    for _, want := range []string{"Carol", "pr-1", "Add &lt;search&gt;", `action="/ui/prs/pr-1/reassign"`, `name="version" value="2"`} {
+        if !strings.Contains(body, want) {
+            t.Errorf("team page does not contain %q", want)
+        }
+    }
+
+    if rec := request(t, h, http.MethodGet, "/ui/teams/missing", nil, session); rec.Code != http.StatusNotFound {
+        t.Errorf("expected 404 for unknown team, got %d", rec.Code)
+    }
+
+    // Форма с чужого сайта отклоняется
+    req := httptest.NewRequest(http.MethodPost, "/ui/users/u3/active", strings.NewReader("active=false"))
+    req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+    req.Header.Set("Origin", "https://evil.example")
+    req.AddCookie(session)
+    rec = httptest.NewRecorder()
+    h.ServeHTTP(rec, req)
+    if rec.Code != http.StatusForbidden || !isActive(t, store, "u3") {
+        t.Fatalf("expected cross-origin form to be rejected, got %d", rec.Code)
+    }
+
+    rec = request(t, h, http.MethodPost, "/ui/users/u3/active", url.Values{"active": {"false"}, "back": {"/ui/teams/backend"}}, session)
+    if rec.Code != http.StatusSeeOther || rec.Header().Get("Location") != "/ui/teams/backend" {
+        t.Fatalf("expected redirect back to team, got %d %q", rec.Code, rec.Header().Get("Location"))
+    }
+    if isActive(t, store, "u3") {
+        t.Error("expected u3 to be deactivated")
+    }
+    if err := store.SetUserActive(context.Background(), "u3", true); err != nil {
+        t.Fatal(err)
+    }
+
+    // Переназначение возвращает на страницу команды с сообщением о замене
+    rec = request(t, h, http.MethodPost, "/ui/prs/pr-1/reassign", url.Values{"old_user_id": {"u2"}, "back": {"https://evil.example/"}}, session)
+    if rec.Code != http.StatusSeeOther || rec.Header().Get("Location") != "/ui/" {
+        t.Fatalf("expected redirect to dashboard root for foreign back, got %d %q", rec.Code, rec.Header().Get("Location"))
+    }
+    if ids := reviewerIDs(t, store, "pr-1"); len(ids) != 1 || ids[0] != "u3" {
+        t.Errorf("expected u3 to replace u2, got %v", ids)
+    }
+    var flash *http.Cookie
+    for _, c := range rec.Result().Cookies() {
+        if c.Name == flashCookie {
+            flash = c
+        }
+    }
+    if flash == nil {
+        t.Fatal("expected flash cookie after reassign")
+    }
+    rec = request(t, h, http.MethodGet, "/ui/", nil, session, flash)
+    if !strings.Contains(rec.Body.String(), "pr-1: u2 → u3") {
+        t.Errorf("expected flash message on the next page")
+    }
+
+    rec = request(t, h, http.MethodPost, "/ui/prs/pr-1/reassign", url.Values{"old_user_id": {"u2"}}, session)
+    if rec.Code != http.StatusConflict {
+        t.Errorf("expected 409 for a reviewer that is no longer assigned, got %d", rec.Code)
+    }
+
+    // Ошибка входных данных показывается как 400 с текстом ошибки, а не как внутренняя
+    rec = request(t, h, http.MethodPost, "/ui/prs/pr-1/reassign", url.Values{"old_user_id": {""}}, session)
+    if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "old_user_id") {
+        t.Errorf("expected 400 naming old_user_id for an empty reviewer, got %d", rec.Code)
+    }
+
+    // Форма со страницы, открытой до изменения PR, не заменяет ревьювера
+    rec = request(t, h, http.MethodPost, "/ui/prs/pr-1/reassign", url.Values{"old_user_id": {"u3"}, "version": {"2"}}, session)
+    if ids := reviewerIDs(t, store, "pr-1"); rec.Code != http.StatusPreconditionFailed || len(ids) != 1 || ids[0] != "u3" {
+        t.Errorf("expected 412 for a stale form, got %d with reviewers %v", rec.Code, ids)
+    }
+}
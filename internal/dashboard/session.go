@@ -0,0 +1,188 @@
+package dashboard
+
+import (
+    "crypto/rand"
+    "encoding/base64"
+    "errors"
+    "log/slog"
+    "net/http"
+    "net/url"
+    "strings"
+    "sync"
+    "time"
+
+    "pr-review-assigner/internal/auth"
+)
+
+const (
+    sessionCookie = "pra_dashboard"
+    flashCookie   = "pra_flash"
+    sessionTTL    = 8 * time.Hour
+)
+
+// LoginPage показывает форму входа по API-токену или JWT
+func (h *Handler) LoginPage(w http.ResponseWriter, r *http.Request) {
+    h.render(w, r, http.StatusOK, "login", &errorPage{page: page{Title: "Вход"}})
+}
+
+// Login проверяет токен и открывает сессию; в cookie уходит только ее ID, страницы требуют scope read
+func (h *Handler) Login(w http.ResponseWriter, r *http.Request) {
+    token := strings.TrimSpace(r.PostFormValue("token"))
+
+    p, err := h.authn.Authenticate(r.Context(), token)
+    if err != nil || token == "" {
+        status, message := http.StatusUnauthorized, "Неверный или отозванный токен"
+        if err != nil && !errors.Is(err, auth.ErrUnauthorized) {
+            // Сбой хранилища токенов: его текст не показывается тому, кто еще не вошел
+            slog.ErrorContext(r.Context(), "dashboard: authenticate", "error", err)
+            status, message = http.StatusInternalServerError, internalErrorMessage
+        }
+        h.render(w, r, status, "login", &errorPage{page: page{Title: "Вход"}, Status: status, Message: message})
+        return
+    }
+    if !p.HasScope(auth.ScopeRead) {
+        status := http.StatusForbidden
+        h.render(w, r, status, "login", &errorPage{page: page{Title: "Вход"}, Status: status, Message: "Токену нужен scope " + auth.ScopeRead})
+        return
+    }
+
+    id, err := h.sessions.create(token)
+    if err != nil {
+        slog.ErrorContext(r.Context(), "dashboard: create session", "error", err)
+        status := http.StatusInternalServerError
+        h.render(w, r, status, "login", &errorPage{page: page{Title: "Вход"}, Status: status, Message: internalErrorMessage})
+        return
+    }
+    http.SetCookie(w, h.sessionCookie(id, int(sessionTTL.Seconds())))
+    http.Redirect(w, r, h.basePath+"/", http.StatusSeeOther)
+}
+
+func (h *Handler) Logout(w http.ResponseWriter, r *http.Request) {
+    if c, err := r.Cookie(sessionCookie); err == nil {
+        h.sessions.delete(c.Value)
+    }
+    http.SetCookie(w, h.sessionCookie("", -1))
+    http.Redirect(w, r, h.basePath+"/login", http.StatusSeeOther)
+}
+
+// session аутентифицирует запрос по cookie; без действующей сессии отправляет на страницу входа
+func (h *Handler) session(next http.Handler) http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        c, err := r.Cookie(sessionCookie)
+        if err != nil || c.Value == "" {
+            http.Redirect(w, r, h.basePath+"/login", http.StatusSeeOther)
+            return
+        }
+
+        token, ok := h.sessions.token(c.Value)
+        if !ok {
+            http.SetCookie(w, h.sessionCookie("", -1))
+            http.Redirect(w, r, h.basePath+"/login", http.StatusSeeOther)
+            return
+        }
+
+        p, err := h.authn.Authenticate(r.Context(), token)
+        if err != nil || !p.HasScope(auth.ScopeRead) {
+            // Токен отозван или истек - сессия больше не действует
+            h.sessions.delete(c.Value)
+            http.SetCookie(w, h.sessionCookie("", -1))
+            http.Redirect(w, r, h.basePath+"/login", http.StatusSeeOther)
+            return
+        }
+
+        next.ServeHTTP(w, r.WithContext(auth.WithPrincipal(r.Context(), p)))
+    })
+}
+
+// sessionCookie недоступна скриптам и не отправляется с запросами с других сайтов (SameSite=Strict)
+func (h *Handler) sessionCookie(id string, maxAge int) *http.Cookie {
+    return &http.Cookie{
+        Name:     sessionCookie,
+        Value:    id,
+        Path:     h.cookiePath(),
+        MaxAge:   maxAge,
+        HttpOnly: true,
+        Secure:   h.secureCookie,
+        SameSite: http.SameSiteStrictMode,
+    }
+}
+
+// sessionStore хранит токены сессий в памяти процесса: в cookie попадает только случайный ID,
+// поэтому украденная cookie не раскрывает токен и перестает действовать после выхода или рестарта
+type sessionStore struct {
+    mu       sync.Mutex
+    sessions map[string]storedSession
+    now      func() time.Time
+}
+
+type storedSession struct {
+    token   string
+    expires time.Time
+}
+
+func newSessionStore() *sessionStore {
+    return &sessionStore{sessions: make(map[string]storedSession), now: time.Now}
+}
+
+func (s *sessionStore) create(token string) (string, error) {
+    b := make([]byte, 32)
+    if _, err := rand.Read(b); err != nil {
+        return "", err
+    }
+    id := base64.RawURLEncoding.EncodeToString(b)
+
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    // Истекшие сессии удаляются при входе: отдельный воркер для них не нужен
+    now := s.now()
+    for k, v := range s.sessions {
+        if !now.Before(v.expires) {
+            delete(s.sessions, k)
+        }
+    }
+    s.sessions[id] = storedSession{token: token, expires: now.Add(sessionTTL)}
+    return id, nil
+}
+
+// token возвращает токен действующей сессии
+func (s *sessionStore) token(id string) (string, bool) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    v, ok := s.sessions[id]
+    if !ok {
+        return "", false
+    }
+    if !s.now().Before(v.expires) {
+        delete(s.sessions, id)
+        return "", false
+    }
+    return v.token, true
+}
+
+func (s *sessionStore) delete(id string) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    delete(s.sessions, id)
+}
+
+func (h *Handler) cookiePath() string {
+    if h.basePath == "" {
+        return "/"
+    }
+    return h.basePath
+}
+
+// sameOrigin отклоняет формы, отправленные с другого origin; дополняет SameSite=Strict
+// для браузеров, которые его не поддерживают
+func sameOrigin(next http.Handler) http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        if origin := r.Header.Get("Origin"); origin != "" {
+            u, err := url.Parse(origin)
+            if err != nil || u.Host != r.Host {
+                http.Error(w, "cross-origin request rejected", http.StatusForbidden)
+                return
+            }
+        }
+        next.ServeHTTP(w, r)
+    })
+}
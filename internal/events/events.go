@@ -0,0 +1,128 @@
+// Package events рассылает события по PR и назначениям ревьюверов подписчикам внутри процесса
+package events
+
+import (
+    "sync"
+    "time"
+)
+
+// Типы событий
+const (
+    TypePRCreated        = "pr.created"
+    TypeReviewerAssigned = "reviewer.assigned"
+    TypeReviewerReplaced = "reviewer.replaced"
+    TypePRMerged         = "pr.merged"
+)
+
+// Event - изменение PR; ID возрастает и совпадает с ID в сохраненной истории
+type Event struct {
+    ID             int64     `json:"id"`
+    Type           string    `json:"type"`
+    PRID           string    `json:"pull_request_id"`
+    TeamName       string    `json:"team_name,omitempty"` // команда автора PR
+    AuthorID       string    `json:"author_id"`
+    ReviewerID     string    `json:"reviewer_id,omitempty"`      // назначенный ревьювер
+    ReplacedUserID string    `json:"replaced_user_id,omitempty"` // снятый ревьювер при замене
+    Timestamp      time.Time `json:"timestamp"`
+}
+
+// Matches проверяет фильтр подписчика: команду автора PR и участие пользователя
+// (автор, назначенный или снятый ревьювер); пустые значения не ограничивают
+func (e Event) Matches(teamName, userID string) bool {
+    if teamName != "" && e.TeamName != teamName {
+        return false
+    }
+    if userID != "" && e.AuthorID != userID && e.ReviewerID != userID && e.ReplacedUserID != userID {
+        return false
+    }
+    return true
+}
+
+// subscriberBuffer - сколько событий может накопить подписчик, прежде чем его отключат
+const subscriberBuffer = 64
+
+// Broker рассылает события всем подписчикам. Медленный подписчик не блокирует публикацию:
+// при переполнении буфера его канал закрывается, и он должен подписаться заново и догнать
+// пропущенное по истории, а не терять события молча
+type Broker struct {
+    mu     sync.Mutex
+    subs   map[chan Event]struct{}
+    lastID int64 // наибольший ID опубликованного события
+    closed bool
+}
+
+func NewBroker() *Broker {
+    return &Broker{subs: make(map[chan Event]struct{})}
+}
+
+// Publish отправляет события подписчикам
+func (b *Broker) Publish(events ...Event) {
+    b.mu.Lock()
+    defer b.mu.Unlock()
+
+    for _, e := range events {
+        if e.ID > b.lastID {
+            b.lastID = e.ID
+        }
+        for ch := range b.subs {
+            select {
+            case ch <- e:
+            default:
+                delete(b.subs, ch)
+                close(ch)
+            }
+        }
+    }
+}
+
+// LastID возвращает наибольший ID уже опубликованного события: события с меньшими ID
+// подписка, оформленная после вызова, не получит
+func (b *Broker) LastID() int64 {
+    b.mu.Lock()
+    defer b.mu.Unlock()
+    return b.lastID
+}
+
+// Subscribe возвращает канал событий и функцию отписки, закрывающую канал
+func (b *Broker) Subscribe() (<-chan Event, func()) {
+    ch := make(chan Event, subscriberBuffer)
+
+    b.mu.Lock()
+    if b.closed {
+        close(ch)
+    } else {
+        b.subs[ch] = struct{}{}
+    }
+    b.mu.Unlock()
+
+    var once sync.Once
+    return ch, func() {
+        once.Do(func() {
+            b.mu.Lock()
+            defer b.mu.Unlock()
+            if _, ok := b.subs[ch]; ok {
+                delete(b.subs, ch)
+                close(ch)
+            }
+        })
+    }
+}
+
+// Closed сообщает, закрыт ли брокер: так подписчик отличает остановку сервера от отключения за отставание
+func (b *Broker) Closed() bool {
+    b.mu.Lock()
+    defer b.mu.Unlock()
+    return b.closed
+}
+
+// Close закрывает каналы всех подписчиков, например при остановке сервера
+func (b *Broker) Close() {
+    b.mu.Lock()
+    defer b.mu.Unlock()
+
+    b.closed = true
+    for ch := range b.subs {
+        delete(b.subs, ch)
+        close(ch)
+    }
+}
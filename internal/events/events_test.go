@@ -0,0 +1,43 @@
+package events
+
+import (
+    "testing"
+    "time"
+)
+
+// Отставший подписчик отключается, не задерживая публикацию для остальных
+func TestSlowSubscriberIsDisconnected(t *testing.T) {
+    b := NewBroker()
+    slow, unsubscribeSlow := b.Subscribe()
+    defer unsubscribeSlow()
+    fast, unsubscribeFast := b.Subscribe()
+    defer unsubscribeFast()
+
+    done := make(chan struct{})
+    go func() {
+        defer close(done)
+        for id := int64(1); id <= subscriberBuffer+1; id++ {
+            b.Publish(Event{ID: id})
+            <-fast
+        }
+    }()
+    select {
+    case <-done:
+    case <-time.After(time.Second):
+        t.Fatal("publish blocked on a slow subscriber")
+    }
+
+    // Медленный получает то, что уместилось в буфер, а затем закрытый канал
+    for id := int64(1); id <= subscriberBuffer; id++ {
+        if e := <-slow; e.ID != id {
+            t.Fatalf("expected event %d, got %d", id, e.ID)
+        }
+    }
+    if _, ok := <-slow; ok {
+        t.Error("expected the slow subscriber's channel to be closed")
+    }
+    if b.Closed() {
+        t.Error("expected the broker to stay open")
+    }
+    unsubscribeSlow() // повторная отписка после отключения безопасна
+}
@@ -0,0 +1,97 @@
+package grpcapi
+
+import (
+    "context"
+    "errors"
+    "log/slog"
+    "strings"
+
+    "google.golang.org/grpc"
+    "google.golang.org/grpc/codes"
+    "google.golang.org/grpc/metadata"
+    "google.golang.org/grpc/status"
+
+    pb "pr-review-assigner/api/assigner/v1"
+    "pr-review-assigner/internal/auth"
+)
+
+// scopeAuthed: any valid token; the service decides by role, as for the HTTP routes
+const scopeAuthed = "*"
+
+// methodScopes mirrors the scopes of the corresponding HTTP routes
+var methodScopes = map[string]string{
+    pb.AssignerService_CreateTeam_FullMethodName:        auth.ScopeAdminTeams,
+    pb.AssignerService_GetTeam_FullMethodName:           auth.ScopeRead,
+    pb.AssignerService_DeactivateTeam_FullMethodName:    scopeAuthed,
+    pb.AssignerService_SetUserActive_FullMethodName:     scopeAuthed,
+    pb.AssignerService_GetUserReviews_FullMethodName:    auth.ScopeRead,
+    pb.AssignerService_CreatePullRequest_FullMethodName: auth.ScopeWritePRs,
+    pb.AssignerService_MergePullRequest_FullMethodName:  auth.ScopeWritePRs,
+    pb.AssignerService_ReassignReviewer_FullMethodName:  auth.ScopeWritePRs,
+    pb.AssignerService_GetStats_FullMethodName:          auth.ScopeRead,
+    pb.AssignerService_WatchAssignments_FullMethodName:  auth.ScopeRead,
+}
+
+func unaryAuth(authn auth.Authenticator) grpc.UnaryServerInterceptor {
+    return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+        ctx, err := authenticate(ctx, authn, info.FullMethod)
+        if err != nil {
+            return nil, err
+        }
+        return handler(ctx, req)
+    }
+}
+
+func streamAuth(authn auth.Authenticator) grpc.StreamServerInterceptor {
+    return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+        ctx, err := authenticate(ss.Context(), authn, info.FullMethod)
+        if err != nil {
+            return err
+        }
+        return handler(srv, &authedStream{ServerStream: ss, ctx: ctx})
+    }
+}
+
+// authenticate checks the bearer token from "authorization" metadata and the method scope
+func authenticate(ctx context.Context, authn auth.Authenticator, method string) (context.Context, error) {
+    scope, known := methodScopes[method]
+    if !known {
+        return nil, status.Error(codes.PermissionDenied, "method is not exposed")
+    }
+
+    var token string
+    if md, ok := metadata.FromIncomingContext(ctx); ok {
+        for _, v := range md.Get("authorization") {
+            if len(v) > 7 && strings.EqualFold(v[:7], "bearer ") {
+                token = strings.TrimSpace(v[7:])
+            }
+        }
+    }
+    if token == "" {
+        return nil, status.Error(codes.Unauthenticated, "missing bearer token")
+    }
+
+    p, err := authn.Authenticate(ctx, token)
+    if err != nil {
+        if errors.Is(err, auth.ErrUnauthorized) {
+            return nil, status.Error(codes.Unauthenticated, err.Error())
+        }
+        // A token store failure: the cause goes to the log only, as in toStatus
+        slog.ErrorContext(ctx, "grpc authentication failed", "method", method, "error", err)
+        return nil, status.Error(codes.Internal, "internal error")
+    }
+    if scope != scopeAuthed && !p.HasScope(scope) {
+        return nil, status.Error(codes.PermissionDenied, "token lacks scope "+scope)
+    }
+
+    return auth.WithPrincipal(ctx, p), nil
+}
+
+type authedStream struct {
+    grpc.ServerStream
+    ctx context.Context
+}
+
+func (s *authedStream) Context() context.Context {
+    return s.ctx
+}
@@ -0,0 +1,225 @@
+// Package grpcapi exposes service.Service over gRPC (api/assigner/v1)
+package grpcapi
+
+import (
+    "context"
+    "errors"
+    "log/slog"
+
+    "google.golang.org/grpc"
+    "google.golang.org/grpc/codes"
+    "google.golang.org/grpc/status"
+    "google.golang.org/protobuf/types/known/timestamppb"
+
+    pb "pr-review-assigner/api/assigner/v1"
+    "pr-review-assigner/internal/auth"
+    "pr-review-assigner/internal/events"
+    "pr-review-assigner/internal/repo"
+    "pr-review-assigner/internal/service"
+)
+
+type Server struct {
+    pb.UnimplementedAssignerServiceServer
+    svc *service.Service
+}
+
+// NewServer builds a gRPC server with authentication and the assigner service registered
+func NewServer(svc *service.Service, authn auth.Authenticator, opts ...grpc.ServerOption) *grpc.Server {
+    opts = append(opts,
+        grpc.ChainUnaryInterceptor(unaryAuth(authn)),
+        grpc.ChainStreamInterceptor(streamAuth(authn)),
+    )
+    s := grpc.NewServer(opts...)
+    pb.RegisterAssignerServiceServer(s, &Server{svc: svc})
+    return s
+}
+
+// Teams
+
+func (s *Server) CreateTeam(ctx context.Context, req *pb.CreateTeamRequest) (*pb.Team, error) {
+    if req.TeamName == "" {
+        return nil, status.Error(codes.InvalidArgument, "team_name is required")
+    }
+
+    members := make([]repo.TeamMember, len(req.Members))
+    for i, m := range req.Members {
+        members[i] = repo.TeamMember{UserID: m.UserId, Username: m.Username, IsActive: m.IsActive, IsLead: m.IsLead}
+    }
+    if err := s.svc.CreateTeam(ctx, req.TeamName, members); err != nil {
+        return nil, toStatus(ctx, err)
+    }
+
+    return s.GetTeam(ctx, &pb.GetTeamRequest{TeamName: req.TeamName})
+}
+
+func (s *Server) GetTeam(ctx context.Context, req *pb.GetTeamRequest) (*pb.Team, error) {
+    team, members, err := s.svc.GetTeam(ctx, req.TeamName)
+    if err != nil {
+        return nil, toStatus(ctx, err)
+    }
+
+    resp := &pb.Team{TeamName: team.Name, Members: make([]*pb.TeamMember, len(members))}
+    for i, m := range members {
+        resp.Members[i] = &pb.TeamMember{UserId: m.ID, Username: m.Name, IsActive: m.IsActive, IsLead: m.IsLead}
+    }
+    return resp, nil
+}
+
+func (s *Server) DeactivateTeam(ctx context.Context, req *pb.DeactivateTeamRequest) (*pb.DeactivateTeamResponse, error) {
+    if err := s.svc.BulkDeactivateTeam(ctx, req.TeamName, req.ReassignOpenPrs); err != nil {
+        return nil, toStatus(ctx, err)
+    }
+    return &pb.DeactivateTeamResponse{}, nil
+}
+
+// Users
+
+func (s *Server) SetUserActive(ctx context.Context, req *pb.SetUserActiveRequest) (*pb.User, error) {
+    user, err := s.svc.SetUserActive(ctx, req.UserId, req.IsActive)
+    if err != nil {
+        return nil, toStatus(ctx, err)
+    }
+    return &pb.User{UserId: user.ID, Username: user.Name, TeamName: user.TeamName, IsActive: user.IsActive}, nil
+}
+
+func (s *Server) GetUserReviews(ctx context.Context, req *pb.GetUserReviewsRequest) (*pb.GetUserReviewsResponse, error) {
+    prs, err := s.svc.GetUserReviews(ctx, req.UserId)
+    if err != nil {
+        return nil, toStatus(ctx, err)
+    }
+
+    resp := &pb.GetUserReviewsResponse{UserId: req.UserId, PullRequests: make([]*pb.PullRequest, len(prs))}
+    for i := range prs {
+        resp.PullRequests[i] = toPullRequest(&prs[i])
+    }
+    return resp, nil
+}
+
+// Pull requests
+
+func (s *Server) CreatePullRequest(ctx context.Context, req *pb.CreatePullRequestRequest) (*pb.PullRequest, error) {
+    pr, err := s.svc.CreatePR(ctx, req.PullRequestId, req.PullRequestName, req.AuthorId)
+    if err != nil {
+        return nil, toStatus(ctx, err)
+    }
+    return toPullRequest(pr), nil
+}
+
+func (s *Server) MergePullRequest(ctx context.Context, req *pb.MergePullRequestRequest) (*pb.PullRequest, error) {
+    pr, err := s.svc.MergePR(ctx, req.PullRequestId)
+    if err != nil {
+        return nil, toStatus(ctx, err)
+    }
+    return toPullRequest(pr), nil
+}
+
+func (s *Server) ReassignReviewer(ctx context.Context, req *pb.ReassignReviewerRequest) (*pb.ReassignReviewerResponse, error) {
+    pr, newUserID, err := s.svc.ReassignReviewer(ctx, req.PullRequestId, req.OldUserId)
+    if err != nil {
+        return nil, toStatus(ctx, err)
+    }
+    return &pb.ReassignReviewerResponse{PullRequest: toPullRequest(pr), ReplacedBy: newUserID}, nil
+}
+
+// Stats
+
+func (s *Server) GetStats(ctx context.Context, req *pb.GetStatsRequest) (*pb.GetStatsResponse, error) {
+    stats, err := s.svc.GetStats(ctx)
+    if err != nil {
+        return nil, toStatus(ctx, err)
+    }
+
+    resp := &pb.GetStatsResponse{
+        AssignmentStats: make(map[string]int64, len(stats.AssignmentStats)),
+        Timestamp:       timestamppb.New(stats.Timestamp),
+    }
+    for userID, count := range stats.AssignmentStats {
+        resp.AssignmentStats[userID] = int64(count)
+    }
+    return resp, nil
+}
+
+// WatchAssignments streams assignment events until the client disconnects
+func (s *Server) WatchAssignments(req *pb.WatchAssignmentsRequest, stream grpc.ServerStreamingServer[pb.AssignmentEvent]) error {
+    ch, unsubscribe := s.svc.Events.Subscribe()
+    defer unsubscribe()
+
+    // Headers tell the client the subscription is active before the first event
+    if err := stream.SendHeader(nil); err != nil {
+        return err
+    }
+
+    for {
+        select {
+        case <-stream.Context().Done():
+            return nil
+        case e, ok := <-ch:
+            if !ok {
+                if s.svc.Events.Closed() {
+                    return status.Error(codes.Unavailable, "server is shutting down")
+                }
+                return status.Error(codes.Unavailable, "subscriber fell behind the event stream, reconnect")
+            }
+            if e.Type != events.TypeReviewerAssigned && e.Type != events.TypeReviewerReplaced {
+                continue
+            }
+            if req.PullRequestId != "" && e.PRID != req.PullRequestId {
+                continue
+            }
+            if req.ReviewerId != "" && e.ReviewerID != req.ReviewerId {
+                continue
+            }
+
+            err := stream.Send(&pb.AssignmentEvent{
+                PullRequestId:  e.PRID,
+                ReviewerId:     e.ReviewerID,
+                ReplacedUserId: e.ReplacedUserID,
+                Timestamp:      timestamppb.New(e.Timestamp),
+            })
+            if err != nil {
+                return err
+            }
+        }
+    }
+}
+
+func toPullRequest(pr *repo.PR) *pb.PullRequest {
+    resp := &pb.PullRequest{
+        PullRequestId:     pr.ID,
+        PullRequestName:   pr.Title,
+        AuthorId:          pr.AuthorID,
+        AssignedReviewers: make([]string, len(pr.Reviewers)),
+    }
+    switch pr.Status {
+    case "OPEN":
+        resp.Status = pb.PullRequestStatus_PULL_REQUEST_STATUS_OPEN
+    case "MERGED":
+        resp.Status = pb.PullRequestStatus_PULL_REQUEST_STATUS_MERGED
+    }
+    for i, reviewer := range pr.Reviewers {
+        resp.AssignedReviewers[i] = reviewer.ID
+    }
+    return resp
+}
+
+// codeByKind maps service error kinds to gRPC status codes
+var codeByKind = map[service.Kind]codes.Code{
+    service.KindInvalid:       codes.InvalidArgument,
+    service.KindNotFound:      codes.NotFound,
+    service.KindExists:        codes.AlreadyExists,
+    service.KindConflict:      codes.FailedPrecondition,
+    service.KindForbidden:     codes.PermissionDenied,
+    service.KindUnprocessable: codes.FailedPrecondition,
+    service.KindPrecondition:  codes.Aborted,
+}
+
+// toStatus maps service errors to gRPC status codes; the stable error code is
+// prepended to the message. Other errors are logged and reported as a bare Internal.
+func toStatus(ctx context.Context, err error) error {
+    var se *service.Error
+    if !errors.As(err, &se) || se.Kind == service.KindInternal {
+        slog.ErrorContext(ctx, "grpc request failed", "error", err)
+        return status.Error(codes.Internal, "internal error")
+    }
+    return status.Error(codeByKind[se.Kind], se.Code+": "+err.Error())
+}
@@ -0,0 +1,165 @@
+package grpcapi
+
+import (
+    "context"
+    "errors"
+    "net"
+    "testing"
+    "time"
+
+    "google.golang.org/grpc"
+    "google.golang.org/grpc/codes"
+    "google.golang.org/grpc/credentials/insecure"
+    "google.golang.org/grpc/metadata"
+    "google.golang.org/grpc/status"
+    "google.golang.org/grpc/test/bufconn"
+
+    pb "pr-review-assigner/api/assigner/v1"
+    "pr-review-assigner/internal/auth"
+    "pr-review-assigner/internal/repo/memory"
+    "pr-review-assigner/internal/service"
+)
+
+// stubAuthenticator выдает принципала по заранее известному токену
+type stubAuthenticator map[string]*auth.Principal
+
+func (a stubAuthenticator) Authenticate(ctx context.Context, token string) (*auth.Principal, error) {
+    if p, ok := a[token]; ok {
+        return p, nil
+    }
+    return nil, auth.ErrUnauthorized
+}
+
+func newTestClient(t *testing.T) pb.AssignerServiceClient {
+    t.Helper()
+
+    authn := stubAuthenticator{
+        "admin":  {Subject: "admin", Scopes: []string{auth.ScopeAdmin}},
+        "reader": {Subject: "reader", Scopes: []string{auth.ScopeRead}},
+    }
+    srv := NewServer(service.New(memory.New()), authn)
+
+    lis := bufconn.Listen(1 << 20)
+    go srv.Serve(lis)
+    t.Cleanup(srv.Stop)
+
+    conn, err := grpc.NewClient("passthrough:///bufnet",
+        grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+            return lis.DialContext(ctx)
+        }),
+        grpc.WithTransportCredentials(insecure.NewCredentials()),
+    )
+    if err != nil {
+        t.Fatalf("dial: %v", err)
+    }
+    t.Cleanup(func() { conn.Close() })
+
+    return pb.NewAssignerServiceClient(conn)
+}
+
+func withToken(ctx context.Context, token string) context.Context {
+    return metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+token)
+}
+
+func TestServer(t *testing.T) {
+    client := newTestClient(t)
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+    admin := withToken(ctx, "admin")
+
+    t.Run("Unauthenticated", func(t *testing.T) {
+        _, err := client.GetTeam(ctx, &pb.GetTeamRequest{TeamName: "backend"})
+        if status.Code(err) != codes.Unauthenticated {
+            t.Errorf("expected Unauthenticated, got %v", err)
+        }
+
+        _, err = client.GetTeam(withToken(ctx, "bogus"), &pb.GetTeamRequest{TeamName: "backend"})
+        if status.Code(err) != codes.Unauthenticated {
+            t.Errorf("expected Unauthenticated for unknown token, got %v", err)
+        }
+    })
+
+    t.Run("MissingScope", func(t *testing.T) {
+        _, err := client.CreateTeam(withToken(ctx, "reader"), &pb.CreateTeamRequest{TeamName: "backend"})
+        if status.Code(err) != codes.PermissionDenied {
+            t.Errorf("expected PermissionDenied, got %v", err)
+        }
+    })
+
+    t.Run("CreateTeam", func(t *testing.T) {
+        team, err := client.CreateTeam(admin, &pb.CreateTeamRequest{
+            TeamName: "backend",
+            Members: []*pb.TeamMember{
+                {UserId: "u1", Username: "Alice", IsActive: true},
+                {UserId: "u2", Username: "Bob", IsActive: true},
+            },
+        })
+        if err != nil {
+            t.Fatalf("CreateTeam: %v", err)
+        }
+        if len(team.Members) != 2 {
+            t.Errorf("expected 2 members, got %d", len(team.Members))
+        }
+
+        _, err = client.CreateTeam(admin, &pb.CreateTeamRequest{TeamName: "backend"})
+        if status.Code(err) != codes.AlreadyExists {
+            t.Errorf("expected AlreadyExists, got %v", err)
+        }
+    })
+
+    t.Run("GetTeamNotFound", func(t *testing.T) {
+        _, err := client.GetTeam(withToken(ctx, "reader"), &pb.GetTeamRequest{TeamName: "missing"})
+        if status.Code(err) != codes.NotFound {
+            t.Errorf("expected NotFound, got %v", err)
+        }
+    })
+
+    t.Run("WatchAssignments", func(t *testing.T) {
+        stream, err := client.WatchAssignments(withToken(ctx, "reader"), &pb.WatchAssignmentsRequest{PullRequestId: "pr-1"})
+        if err != nil {
+            t.Fatalf("WatchAssignments: %v", err)
+        }
+        // Дожидаемся заголовков, чтобы подписка была активна до создания PR
+        if _, err := stream.Header(); err != nil {
+            t.Fatalf("header: %v", err)
+        }
+
+        pr, err := client.CreatePullRequest(admin, &pb.CreatePullRequestRequest{
+            PullRequestId:   "pr-1",
+            PullRequestName: "Add search",
+            AuthorId:        "u1",
+        })
+        if err != nil {
+            t.Fatalf("CreatePullRequest: %v", err)
+        }
+        if pr.Status != pb.PullRequestStatus_PULL_REQUEST_STATUS_OPEN {
+            t.Errorf("expected OPEN status, got %v", pr.Status)
+        }
+        if len(pr.AssignedReviewers) != 1 || pr.AssignedReviewers[0] != "u2" {
+            t.Fatalf("expected reviewer u2, got %v", pr.AssignedReviewers)
+        }
+
+        event, err := stream.Recv()
+        if err != nil {
+            t.Fatalf("Recv: %v", err)
+        }
+        if event.PullRequestId != "pr-1" || event.ReviewerId != "u2" {
+            t.Errorf("unexpected event %+v", event)
+        }
+    })
+}
+
+// failingAuthenticator имитирует недоступное хранилище токенов
+type failingAuthenticator struct{}
+
+func (failingAuthenticator) Authenticate(ctx context.Context, token string) (*auth.Principal, error) {
+    return nil, errors.New("dial tcp 10.0.0.5:5432: connection refused")
+}
+
+func TestAuthenticateHidesInternalErrors(t *testing.T) {
+    ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", "Bearer admin"))
+    _, err := authenticate(ctx, failingAuthenticator{}, pb.AssignerService_GetTeam_FullMethodName)
+    if st, _ := status.FromError(err); st.Code() != codes.Internal || st.Message() != "internal error" {
+        t.Errorf("expected a generic Internal status, got %v", err)
+    }
+}
@@ -0,0 +1,268 @@
+package handlers
+
+import (
+    "encoding/json"
+    "time"
+
+    "pr-review-assigner/internal/events"
+    "pr-review-assigner/internal/repo"
+    "pr-review-assigner/internal/service"
+)
+
+// Request and response bodies of the HTTP API. The OpenAPI document is
+// generated from these types, so every handler must encode one of them.
+
+type HealthResponse struct {
+    Status string `json:"status"`
+}
+
+// Teams
+
+type TeamMember struct {
+    UserID   string `json:"user_id"`
+    Username string `json:"username"`
+    IsActive bool   `json:"is_active"`
+    IsLead   bool   `json:"is_lead,omitempty"`
+}
+
+type Team struct {
+    TeamName string       `json:"team_name"`
+    Members  []TeamMember `json:"members"`
+}
+
+type TeamResponse struct {
+    Team Team `json:"team"`
+}
+
+type DeactivateTeamRequest struct {
+    Reassign bool `json:"reassign_open_prs"`
+}
+
+type SyncResponse struct {
+    Plan *service.SyncPlan `json:"plan"`
+}
+
+// Users
+
+type User struct {
+    UserID   string `json:"user_id"`
+    Username string `json:"username"`
+    TeamName string `json:"team_name,omitempty"`
+    IsActive bool   `json:"is_active"`
+}
+
+type SetUserActiveRequest struct {
+    UserID   string `json:"user_id"`
+    IsActive bool   `json:"is_active"`
+}
+
+type UserResponse struct {
+    User User `json:"user"`
+}
+
+type UserReviewsResponse struct {
+    UserID       string             `json:"user_id"`
+    PullRequests []PullRequestShort `json:"pull_requests"`
+}
+
+// Pull requests
+
+type PullRequest struct {
+    PullRequestID     string     `json:"pull_request_id"`
+    PullRequestName   string     `json:"pull_request_name"`
+    AuthorID          string     `json:"author_id"`
+    Status            string     `json:"status" enum:"OPEN,MERGED"`
+    AssignedReviewers []string   `json:"assigned_reviewers"`
+    CreatedAt         *time.Time `json:"createdAt"`
+    MergedAt          *time.Time `json:"mergedAt"`
+}
+
+type PullRequestShort struct {
+    PullRequestID   string `json:"pull_request_id"`
+    PullRequestName string `json:"pull_request_name"`
+    AuthorID        string `json:"author_id"`
+    Status          string `json:"status" enum:"OPEN,MERGED"`
+}
+
+type CreatePRRequest struct {
+    PullRequestID   string `json:"pull_request_id"`
+    PullRequestName string `json:"pull_request_name"`
+    AuthorID        string `json:"author_id"`
+}
+
+type MergePRRequest struct {
+    PullRequestID string `json:"pull_request_id"`
+}
+
+type ReassignRequest struct {
+    PullRequestID string `json:"pull_request_id"`
+    OldUserID     string `json:"old_user_id"`
+}
+
+type PullRequestResponse struct {
+    PR PullRequest `json:"pr"`
+}
+
+type ReassignResponse struct {
+    PR         PullRequest `json:"pr"`
+    ReplacedBy string      `json:"replaced_by"`
+}
+
+type StatsResponse struct {
+    AssignmentStats map[string]int `json:"assignment_stats"`
+    Timestamp       time.Time      `json:"timestamp"`
+}
+
+// API tokens
+
+type CreateTokenRequest struct {
+    Name   string   `json:"name"`
+    Scopes []string `json:"scopes"`
+    UserID string   `json:"user_id,omitempty"`
+}
+
+type APIToken struct {
+    ID        int64      `json:"id"`
+    Name      string     `json:"name"`
+    Scopes    string     `json:"scopes"` // space-separated
+    UserID    *string    `json:"user_id,omitempty"`
+    CreatedAt time.Time  `json:"created_at"`
+    RevokedAt *time.Time `json:"revoked_at,omitempty"`
+}
+
+type CreateTokenResponse struct {
+    Token  APIToken `json:"token"`
+    Secret string   `json:"secret"` // shown only once
+}
+
+type TokenListResponse struct {
+    Tokens []APIToken `json:"tokens"`
+}
+
+// Audit log
+
+type AuditEntry struct {
+    ID         int64           `json:"id"`
+    CreatedAt  time.Time       `json:"created_at"`
+    Actor      string          `json:"actor"`
+    Action     string          `json:"action"`
+    TargetType string          `json:"target_type"`
+    TargetID   string          `json:"target_id"`
+    Before     json.RawMessage `json:"before"`
+    After      json.RawMessage `json:"after"`
+    RequestID  string          `json:"request_id,omitempty"`
+    SourceIP   string          `json:"source_ip,omitempty"`
+}
+
+type AuditListResponse struct {
+    Entries []AuditEntry `json:"entries"`
+}
+
+// Export / import
+
+type ImportResponse struct {
+    Import *service.ImportResult `json:"import"`
+}
+
+// Event stream
+
+// Event is the data of one Server-Sent Event; the SSE id and event fields repeat ID and Type
+type Event struct {
+    ID             int64     `json:"id"`
+    Type           string    `json:"type" enum:"pr.created,reviewer.assigned,reviewer.replaced,pr.merged"`
+    PullRequestID  string    `json:"pull_request_id"`
+    TeamName       string    `json:"team_name,omitempty"`
+    AuthorID       string    `json:"author_id"`
+    ReviewerID     string    `json:"reviewer_id,omitempty"`
+    ReplacedUserID string    `json:"replaced_user_id,omitempty"`
+    Timestamp      time.Time `json:"timestamp"`
+}
+
+// Conversions from domain types
+
+func toTeam(name string, members []repo.User) Team {
+    team := Team{TeamName: name, Members: make([]TeamMember, len(members))}
+    for i, m := range members {
+        team.Members[i] = TeamMember{UserID: m.ID, Username: m.Name, IsActive: m.IsActive, IsLead: m.IsLead}
+    }
+    return team
+}
+
+func fromTeamMembers(members []TeamMember) []repo.TeamMember {
+    result := make([]repo.TeamMember, len(members))
+    for i, m := range members {
+        result[i] = repo.TeamMember{UserID: m.UserID, Username: m.Username, IsActive: m.IsActive, IsLead: m.IsLead}
+    }
+    return result
+}
+
+func toUser(u *repo.User) User {
+    return User{UserID: u.ID, Username: u.Name, TeamName: u.TeamName, IsActive: u.IsActive}
+}
+
+func toPullRequest(pr *repo.PR) PullRequest {
+    reviewerIDs := make([]string, len(pr.Reviewers))
+    for i, reviewer := range pr.Reviewers {
+        reviewerIDs[i] = reviewer.ID
+    }
+    return PullRequest{
+        PullRequestID:     pr.ID,
+        PullRequestName:   pr.Title,
+        AuthorID:          pr.AuthorID,
+        Status:            pr.Status,
+        AssignedReviewers: reviewerIDs,
+    }
+}
+
+func toPullRequestShort(pr repo.PR) PullRequestShort {
+    return PullRequestShort{
+        PullRequestID:   pr.ID,
+        PullRequestName: pr.Title,
+        AuthorID:        pr.AuthorID,
+        Status:          pr.Status,
+    }
+}
+
+func toAPIToken(t *repo.APIToken) APIToken {
+    return APIToken{
+        ID:        t.ID,
+        Name:      t.Name,
+        Scopes:    t.Scopes,
+        UserID:    t.UserID,
+        CreatedAt: t.CreatedAt,
+        RevokedAt: t.RevokedAt,
+    }
+}
+
+func toAuditEntry(e repo.AuditEntry) AuditEntry {
+    entry := AuditEntry{
+        ID:         e.ID,
+        CreatedAt:  e.CreatedAt,
+        Actor:      e.Actor,
+        Action:     e.Action,
+        TargetType: e.TargetType,
+        TargetID:   e.TargetID,
+        RequestID:  e.RequestID,
+        SourceIP:   e.SourceIP,
+    }
+    if len(e.Before) > 0 {
+        entry.Before = json.RawMessage(e.Before)
+    }
+    if len(e.After) > 0 {
+        entry.After = json.RawMessage(e.After)
+    }
+    return entry
+}
+
+func toEvent(e events.Event) Event {
+    return Event{
+        ID:             e.ID,
+        Type:           e.Type,
+        PullRequestID:  e.PRID,
+        TeamName:       e.TeamName,
+        AuthorID:       e.AuthorID,
+        ReviewerID:     e.ReviewerID,
+        ReplacedUserID: e.ReplacedUserID,
+        Timestamp:      e.Timestamp.UTC(),
+    }
+}
@@ -0,0 +1,62 @@
+package handlers
+
+import (
+    "net/http"
+    "strconv"
+    "strings"
+
+    "pr-review-assigner/internal/service"
+)
+
+var ifMatchHeader = param{
+    name: "If-Match", typ: "string",
+    description: "ETag of the resource as last read; the change is rejected with 412 if the resource was modified since",
+}
+
+// setETag exposes the version of a PR or team; it is what clients send back in If-Match
+func setETag(w http.ResponseWriter, version int64) {
+    if version > 0 {
+        w.Header().Set("ETag", `"`+strconv.FormatInt(version, 10)+`"`)
+    }
+}
+
+// conditional makes a mutation conditional on If-Match. Without the header, or with "*",
+// the request runs unconditionally as before.
+func (h *Handler) conditional(next http.HandlerFunc) http.HandlerFunc {
+    return func(w http.ResponseWriter, r *http.Request) {
+        values := r.Header.Values("If-Match")
+        if len(values) == 0 {
+            next(w, r)
+            return
+        }
+        tag := strings.TrimSpace(values[0])
+        if len(values) > 1 || strings.Contains(tag, ",") {
+            h.sendError(w, r, service.InvalidField("If-Match", "must be a single entity tag or *"))
+            return
+        }
+        if tag == "*" {
+            next(w, r)
+            return
+        }
+
+        version, err := parseETag(tag)
+        if err != nil {
+            h.sendError(w, r, service.InvalidField("If-Match", "must be a strong entity tag from the ETag header or *"))
+            return
+        }
+        next(w, r.WithContext(service.WithExpectedVersion(r.Context(), version)))
+    }
+}
+
+// parseETag accepts only strong tags in the form produced by setETag
+func parseETag(tag string) (int64, error) {
+    unquoted, err := strconv.Unquote(tag)
+    if err != nil || !strings.HasPrefix(tag, `"`) {
+        return 0, strconv.ErrSyntax
+    }
+    version, err := strconv.ParseInt(unquoted, 10, 64)
+    if err != nil || version <= 0 {
+        return 0, strconv.ErrSyntax
+    }
+    return version, nil
+}
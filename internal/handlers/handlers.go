@@ -2,361 +2,487 @@ package handlers
 
 import (
     "encoding/json"
+    "errors"
+    "fmt"
+    "io"
+    "log/slog"
     "net/http"
+    "reflect"
+    "strconv"
+    "strings"
+    "time"
 
     "github.com/go-chi/chi/v5"
+    "pr-review-assigner/internal/auth"
+    "pr-review-assigner/internal/config"
+    "pr-review-assigner/internal/health"
+    "pr-review-assigner/internal/problem"
     "pr-review-assigner/internal/repo"
     "pr-review-assigner/internal/service"
 )
 
+// DefaultBodyLimit caps JSON and YAML request bodies unless SetBodyLimit says otherwise
+const DefaultBodyLimit = 1 << 20
+
 type Handler struct {
-    svc *service.Service
+    svc       *service.Service
+    authn     auth.Authenticator
+    config    *config.Config
+    health    *health.Checker
+    bodyLimit int64
 }
 
-func NewHandler(svc *service.Service) *Handler {
-    return &Handler{svc: svc}
+func NewHandler(svc *service.Service, authn auth.Authenticator) *Handler {
+    return &Handler{svc: svc, authn: authn, bodyLimit: DefaultBodyLimit}
 }
 
-func (h *Handler) RegisterRoutes(r *chi.Mux) {
-    r.Get("/health", h.HealthCheck)
-    
-    // Teams
-    r.Post("/team/add", h.CreateTeam)
-    r.Get("/team/get", h.GetTeam)
-    
-    // Users
-    r.Post("/users/setIsActive", h.SetUserActive)
-    r.Get("/users/getReview", h.GetUserReviews)
-    
-    // Pull Requests
-    r.Post("/pullRequest/create", h.CreatePR)
-    r.Post("/pullRequest/merge", h.MergePR)
-    r.Post("/pullRequest/reassign", h.ReassignReviewer)
-    
-    // Additional endpoints
-    r.Get("/stats", h.GetStats)
-    r.Post("/teams/{team}/deactivate", h.BulkDeactivateTeam)
+// SetConfig makes the effective configuration available at /admin/config
+func (h *Handler) SetConfig(cfg *config.Config) {
+    h.config = cfg
 }
 
+// SetBodyLimit caps request bodies at n bytes; larger ones get 413.
+// Snapshot imports are exempt: a full export is expected to be large.
+func (h *Handler) SetBodyLimit(n int64) {
+    h.bodyLimit = n
+}
+
+// SetHealth makes /readyz run the given dependency checks
+func (h *Handler) SetHealth(checker *health.Checker) {
+    h.health = checker
+}
+
+// HealthCheck reports that the process is alive; it never touches dependencies,
+// so a database outage does not get the instance restarted
 func (h *Handler) HealthCheck(w http.ResponseWriter, r *http.Request) {
-    w.Header().Set("Content-Type", "application/json")
-    json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+    h.writeJSON(w, http.StatusOK, HealthResponse{Status: "ok"})
 }
 
-func (h *Handler) CreateTeam(w http.ResponseWriter, r *http.Request) {
-    var req struct {
-        TeamName string              `json:"team_name"`
-        Members  []repo.TeamMember   `json:"members"`
+// ReadinessCheck runs the dependency checks and answers 503 if any of them fails,
+// so the orchestrator stops routing traffic to this instance
+func (h *Handler) ReadinessCheck(w http.ResponseWriter, r *http.Request) {
+    report := health.Report{Status: health.StatusOK, Checks: map[string]health.Result{}}
+    if h.health != nil {
+        report = h.health.Run(r.Context())
+    }
+    status := http.StatusOK
+    if report.Status != health.StatusOK {
+        status = http.StatusServiceUnavailable
+    }
+    w.Header().Set("Cache-Control", "no-store")
+    h.writeJSON(w, status, report)
+}
+
+// GetConfig returns the effective configuration with secrets redacted
+func (h *Handler) GetConfig(w http.ResponseWriter, r *http.Request) {
+    if h.config == nil {
+        h.sendError(w, r, &service.Error{Kind: service.KindNotFound, Code: service.CodeNotFound, Message: "configuration is not available"})
+        return
     }
+    h.writeJSON(w, http.StatusOK, h.config.Redacted())
+}
+
+func (h *Handler) CreateTeam(w http.ResponseWriter, r *http.Request) {
+    var req Team
     
-    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-        h.sendError(w, "BAD_REQUEST", "Invalid request body", http.StatusBadRequest)
+    if err := h.decode(w, r, &req); err != nil {
+        h.sendError(w, r, err)
         return
     }
     
-    if err := h.svc.CreateTeam(r.Context(), req.TeamName, req.Members); err != nil {
-        switch err {
-        case service.ErrTeamExists:
-            h.sendError(w, "TEAM_EXISTS", "team_name already exists", http.StatusBadRequest)
-        default:
-            h.sendError(w, "INTERNAL_ERROR", err.Error(), http.StatusInternalServerError)
-        }
+    if err := h.svc.CreateTeam(r.Context(), req.TeamName, fromTeamMembers(req.Members)); err != nil {
+        h.sendError(w, r, err)
         return
     }
     
     team, members, err := h.svc.GetTeam(r.Context(), req.TeamName)
     if err != nil {
-        h.sendError(w, "INTERNAL_ERROR", err.Error(), http.StatusInternalServerError)
+        h.sendError(w, r, err)
         return
     }
     
-    response := map[string]interface{}{
-        "team": map[string]interface{}{
-            "team_name": team.Name,
-            "members":   members,
-        },
-    }
-    
-    w.Header().Set("Content-Type", "application/json")
-    w.WriteHeader(http.StatusCreated)
-    json.NewEncoder(w).Encode(response)
+    setETag(w, team.Version)
+    h.writeJSON(w, http.StatusCreated, TeamResponse{Team: toTeam(team.Name, members)})
 }
 
 func (h *Handler) GetTeam(w http.ResponseWriter, r *http.Request) {
     teamName := r.URL.Query().Get("team_name")
     if teamName == "" {
-        h.sendError(w, "BAD_REQUEST", "team_name is required", http.StatusBadRequest)
+        h.sendError(w, r, service.InvalidField("team_name", "is required"))
         return
     }
     
     team, members, err := h.svc.GetTeam(r.Context(), teamName)
     if err != nil {
-        switch err {
-        case service.ErrNotFound:
-            h.sendError(w, "NOT_FOUND", "team not found", http.StatusNotFound)
-        default:
-            h.sendError(w, "INTERNAL_ERROR", err.Error(), http.StatusInternalServerError)
-        }
+        h.sendError(w, r, err)
         return
     }
     
-    response := map[string]interface{}{
-        "team_name": team.Name,
-        "members":   members,
-    }
-    
-    w.Header().Set("Content-Type", "application/json")
-    json.NewEncoder(w).Encode(response)
+    setETag(w, team.Version)
+    h.writeJSON(w, http.StatusOK, toTeam(team.Name, members))
 }
 
 func (h *Handler) SetUserActive(w http.ResponseWriter, r *http.Request) {
-    var req struct {
-        UserID   string `json:"user_id"`
-        IsActive bool   `json:"is_active"`
-    }
+    var req SetUserActiveRequest
     
-    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-        h.sendError(w, "BAD_REQUEST", "Invalid request body", http.StatusBadRequest)
+    if err := h.decode(w, r, &req); err != nil {
+        h.sendError(w, r, err)
         return
     }
     
     user, err := h.svc.SetUserActive(r.Context(), req.UserID, req.IsActive)
     if err != nil {
-        switch err {
-        case service.ErrNotFound:
-            h.sendError(w, "NOT_FOUND", "user not found", http.StatusNotFound)
-        default:
-            h.sendError(w, "INTERNAL_ERROR", err.Error(), http.StatusInternalServerError)
-        }
+        h.sendError(w, r, err)
         return
     }
     
-    response := map[string]interface{}{
-        "user": user,
-    }
-    
-    w.Header().Set("Content-Type", "application/json")
-    json.NewEncoder(w).Encode(response)
+    h.writeJSON(w, http.StatusOK, UserResponse{User: toUser(user)})
 }
 
 func (h *Handler) CreatePR(w http.ResponseWriter, r *http.Request) {
-    var req struct {
-        PullRequestID   string `json:"pull_request_id"`
-        PullRequestName string `json:"pull_request_name"`
-        AuthorID        string `json:"author_id"`
-    }
+    var req CreatePRRequest
     
-    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-        h.sendError(w, "BAD_REQUEST", "Invalid request body", http.StatusBadRequest)
+    if err := h.decode(w, r, &req); err != nil {
+        h.sendError(w, r, err)
         return
     }
     
     pr, err := h.svc.CreatePR(r.Context(), req.PullRequestID, req.PullRequestName, req.AuthorID)
     if err != nil {
-        switch err {
-        case service.ErrPRExists:
-            h.sendError(w, "PR_EXISTS", "PR id already exists", http.StatusConflict)
-        case service.ErrNotFound:
-            h.sendError(w, "NOT_FOUND", "author/team not found", http.StatusNotFound)
-        default:
-            h.sendError(w, "INTERNAL_ERROR", err.Error(), http.StatusInternalServerError)
-        }
+        h.sendError(w, r, err)
         return
     }
     
-    // Convert reviewers to user IDs
-    reviewerIDs := make([]string, len(pr.Reviewers))
-    for i, reviewer := range pr.Reviewers {
-        reviewerIDs[i] = reviewer.ID
+    setETag(w, pr.Version)
+    h.writeJSON(w, http.StatusCreated, PullRequestResponse{PR: toPullRequest(pr)})
+}
+
+func (h *Handler) GetPR(w http.ResponseWriter, r *http.Request) {
+    prID := r.URL.Query().Get("pull_request_id")
+    if prID == "" {
+        h.sendError(w, r, service.InvalidField("pull_request_id", "is required"))
+        return
     }
-    
-    response := map[string]interface{}{
-        "pr": map[string]interface{}{
-            "pull_request_id":   pr.ID,
-            "pull_request_name": pr.Title,
-            "author_id":         pr.AuthorID,
-            "status":            pr.Status,
-            "assigned_reviewers": reviewerIDs,
-            "createdAt":         nil, // Можно добавить при необходимости
-        },
+
+    pr, err := h.svc.GetPR(r.Context(), prID)
+    if err != nil {
+        h.sendError(w, r, err)
+        return
     }
-    
-    w.Header().Set("Content-Type", "application/json")
-    w.WriteHeader(http.StatusCreated)
-    json.NewEncoder(w).Encode(response)
+
+    setETag(w, pr.Version)
+    h.writeJSON(w, http.StatusOK, PullRequestResponse{PR: toPullRequest(pr)})
 }
 
 func (h *Handler) MergePR(w http.ResponseWriter, r *http.Request) {
-    var req struct {
-        PullRequestID string `json:"pull_request_id"`
-    }
+    var req MergePRRequest
     
-    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-        h.sendError(w, "BAD_REQUEST", "Invalid request body", http.StatusBadRequest)
+    if err := h.decode(w, r, &req); err != nil {
+        h.sendError(w, r, err)
         return
     }
     
     pr, err := h.svc.MergePR(r.Context(), req.PullRequestID)
     if err != nil {
-        switch err {
-        case service.ErrNotFound:
-            h.sendError(w, "NOT_FOUND", "PR not found", http.StatusNotFound)
-        default:
-            h.sendError(w, "INTERNAL_ERROR", err.Error(), http.StatusInternalServerError)
-        }
+        h.sendError(w, r, err)
         return
     }
     
-    // Convert reviewers to user IDs
-    reviewerIDs := make([]string, len(pr.Reviewers))
-    for i, reviewer := range pr.Reviewers {
-        reviewerIDs[i] = reviewer.ID
-    }
-    
-    response := map[string]interface{}{
-        "pr": map[string]interface{}{
-            "pull_request_id":   pr.ID,
-            "pull_request_name": pr.Title,
-            "author_id":         pr.AuthorID,
-            "status":            pr.Status,
-            "assigned_reviewers": reviewerIDs,
-            "mergedAt":          nil, // Можно добавить при необходимости
-        },
-    }
-    
-    w.Header().Set("Content-Type", "application/json")
-    json.NewEncoder(w).Encode(response)
+    setETag(w, pr.Version)
+    h.writeJSON(w, http.StatusOK, PullRequestResponse{PR: toPullRequest(pr)})
 }
 
 func (h *Handler) ReassignReviewer(w http.ResponseWriter, r *http.Request) {
-    var req struct {
-        PullRequestID string `json:"pull_request_id"`
-        OldUserID     string `json:"old_user_id"`
-    }
+    var req ReassignRequest
     
-    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-        h.sendError(w, "BAD_REQUEST", "Invalid request body", http.StatusBadRequest)
+    if err := h.decode(w, r, &req); err != nil {
+        h.sendError(w, r, err)
         return
     }
     
     pr, newUserID, err := h.svc.ReassignReviewer(r.Context(), req.PullRequestID, req.OldUserID)
     if err != nil {
-        switch err {
-        case service.ErrNotFound:
-            h.sendError(w, "NOT_FOUND", "PR or user not found", http.StatusNotFound)
-        case service.ErrPRMerged:
-            h.sendError(w, "PR_MERGED", "cannot reassign on merged PR", http.StatusConflict)
-        case service.ErrNotAssigned:
-            h.sendError(w, "NOT_ASSIGNED", "reviewer is not assigned to this PR", http.StatusConflict)
-        case service.ErrNoCandidate:
-            h.sendError(w, "NO_CANDIDATE", "no active replacement candidate in team", http.StatusConflict)
-        default:
-            h.sendError(w, "INTERNAL_ERROR", err.Error(), http.StatusInternalServerError)
-        }
+        h.sendError(w, r, err)
         return
     }
     
-    // Convert reviewers to user IDs
-    reviewerIDs := make([]string, len(pr.Reviewers))
-    for i, reviewer := range pr.Reviewers {
-        reviewerIDs[i] = reviewer.ID
-    }
-    
-    response := map[string]interface{}{
-        "pr": map[string]interface{}{
-            "pull_request_id":   pr.ID,
-            "pull_request_name": pr.Title,
-            "author_id":         pr.AuthorID,
-            "status":            pr.Status,
-            "assigned_reviewers": reviewerIDs,
-        },
-        "replaced_by": newUserID,
-    }
-    
-    w.Header().Set("Content-Type", "application/json")
-    json.NewEncoder(w).Encode(response)
+    setETag(w, pr.Version)
+    h.writeJSON(w, http.StatusOK, ReassignResponse{PR: toPullRequest(pr), ReplacedBy: newUserID})
 }
 
 func (h *Handler) GetUserReviews(w http.ResponseWriter, r *http.Request) {
     userID := r.URL.Query().Get("user_id")
     if userID == "" {
-        h.sendError(w, "BAD_REQUEST", "user_id is required", http.StatusBadRequest)
+        h.sendError(w, r, service.InvalidField("user_id", "is required"))
         return
     }
     
     prs, err := h.svc.GetUserReviews(r.Context(), userID)
     if err != nil {
-        switch err {
-        case service.ErrNotFound:
-            h.sendError(w, "NOT_FOUND", "user not found", http.StatusNotFound)
-        default:
-            h.sendError(w, "INTERNAL_ERROR", err.Error(), http.StatusInternalServerError)
-        }
+        h.sendError(w, r, err)
         return
     }
     
     // Convert to short PR format
-    prShorts := make([]map[string]interface{}, len(prs))
+    response := UserReviewsResponse{UserID: userID, PullRequests: make([]PullRequestShort, len(prs))}
     for i, pr := range prs {
-        prShorts[i] = map[string]interface{}{
-            "pull_request_id":   pr.ID,
-            "pull_request_name": pr.Title,
-            "author_id":         pr.AuthorID,
-            "status":            pr.Status,
-        }
-    }
-    
-    response := map[string]interface{}{
-        "user_id":        userID,
-        "pull_requests": prShorts,
+        response.PullRequests[i] = toPullRequestShort(pr)
     }
     
-    w.Header().Set("Content-Type", "application/json")
-    json.NewEncoder(w).Encode(response)
+    h.writeJSON(w, http.StatusOK, response)
 }
 
 func (h *Handler) GetStats(w http.ResponseWriter, r *http.Request) {
     stats, err := h.svc.GetStats(r.Context())
     if err != nil {
-        h.sendError(w, "INTERNAL_ERROR", err.Error(), http.StatusInternalServerError)
+        h.sendError(w, r, err)
         return
     }
     
-    w.Header().Set("Content-Type", "application/json")
-    json.NewEncoder(w).Encode(stats)
+    h.writeJSON(w, http.StatusOK, StatsResponse{
+        AssignmentStats: stats.AssignmentStats,
+        Timestamp:       stats.Timestamp.UTC().Truncate(time.Second),
+    })
 }
 
 func (h *Handler) BulkDeactivateTeam(w http.ResponseWriter, r *http.Request) {
     teamName := chi.URLParam(r, "team")
-    var req struct {
-        Reassign bool `json:"reassign_open_prs"`
-    }
+    var req DeactivateTeamRequest
     
-    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-        h.sendError(w, "BAD_REQUEST", "Invalid request body", http.StatusBadRequest)
+    if err := h.decode(w, r, &req); err != nil {
+        h.sendError(w, r, err)
         return
     }
     
     if err := h.svc.BulkDeactivateTeam(r.Context(), teamName, req.Reassign); err != nil {
-        switch err {
-        case service.ErrNotFound:
-            h.sendError(w, "NOT_FOUND", "team not found", http.StatusNotFound)
-        default:
-            h.sendError(w, "INTERNAL_ERROR", err.Error(), http.StatusInternalServerError)
+        h.sendError(w, r, err)
+        return
+    }
+    
+    w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) SyncTeams(w http.ResponseWriter, r *http.Request) {
+    dryRun := false
+    if v := r.URL.Query().Get("dry_run"); v != "" {
+        parsed, err := strconv.ParseBool(v)
+        if err != nil {
+            h.sendError(w, r, service.InvalidField("dry_run", "must be a boolean"))
+            return
         }
+        dryRun = parsed
+    }
+    
+    // Body may be either JSON or YAML
+    manifest, err := service.ParseTeamManifest(http.MaxBytesReader(w, r.Body, h.bodyLimit))
+    if err != nil {
+        h.sendError(w, r, err)
         return
     }
     
+    plan, err := h.svc.SyncTeams(r.Context(), manifest, dryRun)
+    if err != nil {
+        h.sendError(w, r, err)
+        return
+    }
+    
+    h.writeJSON(w, http.StatusOK, SyncResponse{Plan: plan})
+}
+
+func (h *Handler) CreateAPIToken(w http.ResponseWriter, r *http.Request) {
+    var req CreateTokenRequest
+
+    if err := h.decode(w, r, &req); err != nil {
+        h.sendError(w, r, err)
+        return
+    }
+
+    token, secret, err := h.svc.CreateAPIToken(r.Context(), req.Name, req.Scopes, req.UserID)
+    if err != nil {
+        h.sendError(w, r, err)
+        return
+    }
+
+    // The secret is shown only once; only its hash is stored
+    h.writeJSON(w, http.StatusCreated, CreateTokenResponse{Token: toAPIToken(token), Secret: secret})
+}
+
+func (h *Handler) ListAPITokens(w http.ResponseWriter, r *http.Request) {
+    tokens, err := h.svc.ListAPITokens(r.Context())
+    if err != nil {
+        h.sendError(w, r, err)
+        return
+    }
+    response := TokenListResponse{Tokens: make([]APIToken, len(tokens))}
+    for i := range tokens {
+        response.Tokens[i] = toAPIToken(&tokens[i])
+    }
+
+    h.writeJSON(w, http.StatusOK, response)
+}
+
+func (h *Handler) RevokeAPIToken(w http.ResponseWriter, r *http.Request) {
+    id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+    if err != nil {
+        h.sendError(w, r, service.InvalidField("id", "must be an integer"))
+        return
+    }
+
+    if err := h.svc.RevokeAPIToken(r.Context(), id); err != nil {
+        h.sendError(w, r, err)
+        return
+    }
+
     w.WriteHeader(http.StatusNoContent)
 }
 
-func (h *Handler) sendError(w http.ResponseWriter, code, message string, status int) {
+// statusByKind maps service error kinds to HTTP statuses
+var statusByKind = map[service.Kind]int{
+    service.KindInvalid:       http.StatusBadRequest,
+    service.KindNotFound:      http.StatusNotFound,
+    service.KindExists:        http.StatusConflict,
+    service.KindConflict:      http.StatusConflict,
+    service.KindForbidden:     http.StatusForbidden,
+    service.KindUnprocessable: http.StatusUnprocessableEntity,
+    service.KindPrecondition:  http.StatusPreconditionFailed,
+}
+
+// codeBodyTooLarge is reported when a body exceeds the limit set by SetBodyLimit
+const codeBodyTooLarge = "BODY_TOO_LARGE"
+
+// statusByCode pins statuses fixed by the original API specification where they differ from the kind
+var statusByCode = map[string]int{
+    service.CodeTeamExists: http.StatusBadRequest,
+}
+
+// sendError is the only place where errors become responses. Service errors are rendered
+// as problem details with their stable code and field errors; anything else is a database
+// failure or a bug, so the cause is logged and the client gets a generic 500.
+func (h *Handler) sendError(w http.ResponseWriter, r *http.Request, err error) {
+    var tooLarge *http.MaxBytesError
+    if errors.As(err, &tooLarge) {
+        detail := fmt.Sprintf("request body exceeds %d bytes", tooLarge.Limit)
+        problem.Write(w, r, problem.New(http.StatusRequestEntityTooLarge, codeBodyTooLarge, detail))
+        return
+    }
+
+    var se *service.Error
+    if !errors.As(err, &se) || se.Kind == service.KindInternal {
+        slog.ErrorContext(r.Context(), "request failed", "error", err)
+        problem.Write(w, r, problem.New(http.StatusInternalServerError, service.CodeInternal, "internal error"))
+        return
+    }
+
+    status, ok := statusByCode[se.Code]
+    if !ok {
+        status = statusByKind[se.Kind]
+    }
+    p := problem.New(status, se.Code, err.Error())
+    for _, f := range se.Fields {
+        p.Errors = append(p.Errors, problem.FieldError{Field: f.Field, Message: f.Message})
+    }
+    problem.Write(w, r, p)
+}
+
+// decode reads a single JSON value into dst. Unknown fields, type mismatches
+// and trailing data are client errors pointing at the field where possible;
+// a body over the limit surfaces as *http.MaxBytesError.
+func (h *Handler) decode(w http.ResponseWriter, r *http.Request, dst interface{}) error {
+    dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, h.bodyLimit))
+    dec.DisallowUnknownFields()
+    err := dec.Decode(dst)
+    if err == nil {
+        if dec.Decode(&json.RawMessage{}) != io.EOF {
+            return service.Invalid("request body must contain a single JSON object", nil)
+        }
+        return nil
+    }
+
+    var typeErr *json.UnmarshalTypeError
+    var tooLarge *http.MaxBytesError
+    switch {
+    case errors.As(err, &tooLarge):
+        return err
+    case errors.Is(err, io.EOF):
+        return service.Invalid("request body is required", err)
+    case errors.As(err, &typeErr) && typeErr.Field != "":
+        return service.InvalidField(typeErr.Field, "must be "+jsonType(typeErr.Type.Kind()))
+    case strings.HasPrefix(err.Error(), "json: unknown field "):
+        // encoding/json has no typed error for this case
+        field := strings.Trim(strings.TrimPrefix(err.Error(), "json: unknown field "), `"`)
+        return service.InvalidField(field, "is not a known field")
+    default:
+        return service.Invalid("invalid request body: "+err.Error(), err)
+    }
+}
+
+// jsonType names the JSON type expected for a Go kind in error messages
+func jsonType(k reflect.Kind) string {
+    switch k {
+    case reflect.String:
+        return "a string"
+    case reflect.Bool:
+        return "a boolean"
+    case reflect.Slice, reflect.Array:
+        return "an array"
+    case reflect.Struct, reflect.Map:
+        return "an object"
+    case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+        reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+        return "an integer"
+    default:
+        return "a number"
+    }
+}
+
+func (h *Handler) writeJSON(w http.ResponseWriter, status int, body interface{}) {
     w.Header().Set("Content-Type", "application/json")
     w.WriteHeader(status)
-    json.NewEncoder(w).Encode(map[string]interface{}{
-        "error": map[string]interface{}{
-            "code":    code,
-            "message": message,
-        },
-    })
-}
\ No newline at end of file
+    json.NewEncoder(w).Encode(body)
+}
+
+// ListAudit returns audit entries filtered by actor, target and time range (RFC 3339)
+func (h *Handler) ListAudit(w http.ResponseWriter, r *http.Request) {
+    q := r.URL.Query()
+    filter := repo.AuditFilter{
+        Actor:      q.Get("actor"),
+        TargetType: q.Get("target_type"),
+        TargetID:   q.Get("target"),
+    }
+
+    for _, p := range []struct {
+        name string
+        dst  **time.Time
+    }{{"from", &filter.From}, {"to", &filter.To}} {
+        if v := q.Get(p.name); v != "" {
+            t, err := time.Parse(time.RFC3339, v)
+            if err != nil {
+                h.sendError(w, r, service.InvalidField(p.name, "must be an RFC 3339 timestamp"))
+                return
+            }
+            *p.dst = &t
+        }
+    }
+
+    if v := q.Get("limit"); v != "" {
+        limit, err := strconv.Atoi(v)
+        if err != nil || limit <= 0 {
+            h.sendError(w, r, service.InvalidField("limit", "must be a positive integer"))
+            return
+        }
+        filter.Limit = limit
+    }
+
+    entries, err := h.svc.ListAudit(r.Context(), filter)
+    if err != nil {
+        h.sendError(w, r, err)
+        return
+    }
+
+    response := AuditListResponse{Entries: make([]AuditEntry, len(entries))}
+    for i, e := range entries {
+        response.Entries[i] = toAuditEntry(e)
+    }
+
+    h.writeJSON(w, http.StatusOK, response)
+}
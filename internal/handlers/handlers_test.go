@@ -0,0 +1,856 @@
+package handlers
+
+import (
+    "bufio"
+    "bytes"
+    "context"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "net/http"
+    "net/http/httptest"
+    "sort"
+    "strconv"
+    "strings"
+    "testing"
+    "time"
+
+    "github.com/go-chi/chi/v5"
+    "pr-review-assigner/internal/auth"
+    "pr-review-assigner/internal/config"
+    "pr-review-assigner/internal/health"
+    "pr-review-assigner/internal/problem"
+    "pr-review-assigner/internal/repo"
+    "pr-review-assigner/internal/repo/memory"
+    "pr-review-assigner/internal/service"
+)
+
+const testAdminToken = "test-admin-token"
+
+func newTestRouter() http.Handler {
+    store := memory.New()
+    h := NewHandler(service.New(store), auth.NewTokenAuthenticator(store, testAdminToken))
+    h.SetConfig(config.Default())
+    r := chi.NewRouter()
+    h.RegisterRoutes(r)
+    return r
+}
+
+func do(t *testing.T, router http.Handler, method, path, token string, body interface{}) *httptest.ResponseRecorder {
+    t.Helper()
+    var buf bytes.Buffer
+    if body != nil {
+        if s, ok := body.(string); ok {
+            buf.WriteString(s)
+        } else {
+            json.NewEncoder(&buf).Encode(body)
+        }
+    }
+    req := httptest.NewRequest(method, path, &buf)
+    if token != "" {
+        req.Header.Set("Authorization", "Bearer "+token)
+    }
+    rec := httptest.NewRecorder()
+    router.ServeHTTP(rec, req)
+    return rec
+}
+
+// TestOpenAPIContract проверяет ответы всех обработчиков по документу из /openapi.json:
+// статус должен быть описан, тело - соответствовать схеме, а каждая операция - быть вызвана
+func TestOpenAPIContract(t *testing.T) {
+    router := newTestRouter()
+
+    rec := do(t, router, http.MethodGet, "/openapi.json", "", nil)
+    if rec.Code != http.StatusOK {
+        t.Fatalf("GET /openapi.json: status %d", rec.Code)
+    }
+    var spec map[string]interface{}
+    if err := json.Unmarshal(rec.Body.Bytes(), &spec); err != nil {
+        t.Fatalf("spec is not JSON: %v", err)
+    }
+    v := &validator{spec: spec}
+
+    admin := testAdminToken
+    steps := []struct {
+        method, path, template string
+        token                  string
+        body                   interface{}
+        status                 int
+    }{
+        {"GET", "/health", "/health", "", nil, 200},
+        {"GET", "/livez", "/livez", "", nil, 200},
+        {"GET", "/readyz", "/readyz", "", nil, 200},
+        {"POST", "/team/add", "/team/add", admin, Team{TeamName: "backend", Members: []TeamMember{
+            {UserID: "u1", Username: "Alice", IsActive: true, IsLead: true},
+            {UserID: "u2", Username: "Bob", IsActive: true},
+            {UserID: "u3", Username: "Carol", IsActive: true},
+            {UserID: "u4", Username: "Dave", IsActive: true},
+        }}, 201},
+        {"POST", "/team/add", "/team/add", admin, Team{TeamName: "backend"}, 400},
+        {"POST", "/team/add", "/team/add", admin, Team{TeamName: "", Members: []TeamMember{{UserID: "u9", Username: "Eve"}}}, 400},
+        {"POST", "/team/add", "/team/add", admin, `{"team_name": "qa", "members": [], "owner": "u1"}`, 400},
+        {"POST", "/pullRequest/create", "/pullRequest/create", admin, `{"pull_request_name": "` + strings.Repeat("x", DefaultBodyLimit) + `"}`, 413},
+        {"POST", "/team/add", "/team/add", "", Team{TeamName: "x"}, 401},
+        {"GET", "/team/get?team_name=backend", "/team/get", admin, nil, 200},
+        {"GET", "/team/get?team_name=missing", "/team/get", admin, nil, 404},
+        {"POST", "/users/setIsActive", "/users/setIsActive", admin, SetUserActiveRequest{UserID: "u4", IsActive: false}, 200},
+        {"POST", "/users/setIsActive", "/users/setIsActive", admin, SetUserActiveRequest{UserID: "nobody"}, 404},
+        {"POST", "/pullRequest/create", "/pullRequest/create", admin, CreatePRRequest{PullRequestID: "pr-1", PullRequestName: "Add feature", AuthorID: "u1"}, 201},
+        {"POST", "/pullRequest/create", "/pullRequest/create", admin, CreatePRRequest{PullRequestID: "pr-1", PullRequestName: "Add feature", AuthorID: "u1"}, 409},
+        {"POST", "/pullRequest/create", "/pullRequest/create", admin, "{", 400},
+        {"POST", "/pullRequest/create", "/pullRequest/create", admin, CreatePRRequest{PullRequestID: "pr-2", PullRequestName: "Fix bug", AuthorID: "u1"}, 201},
+        // u4 неактивен, поэтому ревьюверы pr-1 - u2 и u3
+        {"POST", "/pullRequest/reassign", "/pullRequest/reassign", admin, ReassignRequest{PullRequestID: "pr-1", OldUserID: "u2"}, 200},
+        {"POST", "/pullRequest/reassign", "/pullRequest/reassign", admin, ReassignRequest{PullRequestID: "pr-1", OldUserID: "u4"}, 409},
+        {"GET", "/pullRequest/get?pull_request_id=pr-1", "/pullRequest/get", admin, nil, 200},
+        {"GET", "/pullRequest/get?pull_request_id=missing", "/pullRequest/get", admin, nil, 404},
+        {"GET", "/pullRequest/get", "/pullRequest/get", admin, nil, 400},
+        {"GET", "/users/getReview?user_id=u2", "/users/getReview", admin, nil, 200},
+        {"GET", "/users/getReview", "/users/getReview", admin, nil, 400},
+        {"POST", "/pullRequest/merge", "/pullRequest/merge", admin, MergePRRequest{PullRequestID: "pr-2"}, 200},
+        {"POST", "/pullRequest/merge", "/pullRequest/merge", admin, MergePRRequest{PullRequestID: "missing"}, 404},
+        {"GET", "/stats", "/stats", admin, nil, 200},
+        {"POST", "/teams/sync?dry_run=true", "/teams/sync", admin, "teams:\n  - team_name: backend\n    members:\n      - {user_id: u1, username: Alice, is_active: true}\n", 200},
+        {"POST", "/teams/sync", "/teams/sync", admin, "teams: [{team_name: ''}]", 400},
+        {"POST", "/auth/tokens", "/auth/tokens", admin, CreateTokenRequest{Name: "ci", Scopes: []string{auth.ScopeRead}}, 201},
+        {"POST", "/auth/tokens", "/auth/tokens", admin, CreateTokenRequest{Name: "ci", Scopes: []string{"root"}}, 400},
+        {"GET", "/auth/tokens", "/auth/tokens", admin, nil, 200},
+        {"DELETE", "/auth/tokens/1", "/auth/tokens/{id}", admin, nil, 204},
+        {"DELETE", "/auth/tokens/1", "/auth/tokens/{id}", admin, nil, 404},
+        {"DELETE", "/auth/tokens/abc", "/auth/tokens/{id}", admin, nil, 400},
+        {"GET", "/audit?actor=bootstrap", "/audit", admin, nil, 200},
+        {"GET", "/audit?from=yesterday", "/audit", admin, nil, 400},
+        {"GET", "/admin/config", "/admin/config", admin, nil, 200},
+        {"GET", "/events/stream?last_event_id=abc", "/events/stream", admin, nil, 400},
+        {"POST", "/teams/backend/deactivate", "/teams/{team}/deactivate", admin, DeactivateTeamRequest{}, 204},
+        {"POST", "/teams/missing/deactivate", "/teams/{team}/deactivate", admin, DeactivateTeamRequest{}, 404},
+    }
+
+    covered := map[string]bool{}
+    verify := func(rec *httptest.ResponseRecorder, method, path, template string, status int) {
+        name := method + " " + path
+        if rec.Code != status {
+            t.Errorf("%s: expected status %d, got %d: %s", name, status, rec.Code, rec.Body)
+            return
+        }
+        for _, err := range v.response(template, method, rec) {
+            t.Errorf("%s: %v", name, err)
+        }
+        if status < 300 {
+            covered[strings.ToLower(method)+" "+template] = true
+        }
+    }
+    check := func(method, path, template, token string, body interface{}, status int) {
+        verify(do(t, router, method, path, token, body), method, path, template, status)
+    }
+
+    for _, s := range steps {
+        check(s.method, s.path, s.template, s.token, s.body, s.status)
+    }
+
+    // Статусы, которые спецификация выводит из scope, If-Match и Idempotency-Key, описаны и соответствуют схеме
+    var reader CreateTokenResponse
+    json.NewDecoder(do(t, router, http.MethodPost, "/auth/tokens", admin, CreateTokenRequest{Name: "reader", Scopes: []string{auth.ScopeRead}}).Body).Decode(&reader)
+    check(http.MethodPost, "/team/add", "/team/add", reader.Secret, Team{TeamName: "qa"}, http.StatusForbidden)
+    checkHeader := func(method, path, template, header, value string, body interface{}, status int) {
+        var buf bytes.Buffer
+        json.NewEncoder(&buf).Encode(body)
+        req := httptest.NewRequest(method, path, &buf)
+        req.Header.Set("Authorization", "Bearer "+admin)
+        req.Header.Set(header, value)
+        rec := httptest.NewRecorder()
+        router.ServeHTTP(rec, req)
+        verify(rec, method, path, template, status)
+    }
+    checkHeader(http.MethodPost, "/pullRequest/merge", "/pullRequest/merge", "If-Match", `"999"`, MergePRRequest{PullRequestID: "pr-1"}, http.StatusPreconditionFailed)
+    checkHeader(http.MethodPost, "/teams/backend/deactivate", "/teams/{team}/deactivate", "If-Match", `"999"`, DeactivateTeamRequest{}, http.StatusPreconditionFailed)
+    checkHeader(http.MethodPost, "/users/setIsActive", "/users/setIsActive", HeaderIdempotencyKey, "contract-1", SetUserActiveRequest{UserID: "u4", IsActive: true}, http.StatusOK)
+    checkHeader(http.MethodPost, "/users/setIsActive", "/users/setIsActive", HeaderIdempotencyKey, "contract-1", SetUserActiveRequest{UserID: "u3", IsActive: true}, http.StatusUnprocessableEntity)
+    checkHeader(http.MethodPost, "/team/add", "/team/add", HeaderIdempotencyKey, strings.Repeat("k", service.MaxIdempotencyKeyLength+1), Team{TeamName: "qa"}, http.StatusBadRequest)
+
+    // Поток событий отдает историю после Last-Event-ID и ждет новых событий до отмены запроса
+    ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+    defer cancel()
+    req := httptest.NewRequest(http.MethodGet, "/events/stream?team_name=backend", nil).WithContext(ctx)
+    req.Header.Set("Authorization", "Bearer "+admin)
+    req.Header.Set("Last-Event-ID", "0")
+    rec = httptest.NewRecorder()
+    router.ServeHTTP(rec, req)
+    if !strings.Contains(rec.Body.String(), "event: pr.merged") {
+        t.Errorf("GET /events/stream: history was not replayed: %s", rec.Body)
+    }
+    verify(rec, http.MethodGet, "/events/stream", "/events/stream", http.StatusOK)
+
+    // Выгрузка построчно соответствует схеме и загружается обратно без изменений статистики
+    rec = do(t, router, http.MethodGet, "/admin/export", admin, nil)
+    verify(rec, http.MethodGet, "/admin/export", "/admin/export", http.StatusOK)
+    snapshot := rec.Body.String()
+    before := do(t, router, http.MethodGet, "/stats", admin, nil).Body.String()
+    check(http.MethodPost, "/admin/import", "/admin/import", admin, snapshot, http.StatusOK)
+    check(http.MethodPost, "/admin/import?mode=overwrite", "/admin/import", admin, snapshot, http.StatusBadRequest)
+    check(http.MethodPost, "/admin/import", "/admin/import", admin, strings.SplitN(snapshot, "\n", 3)[1], http.StatusBadRequest)
+    var statsBefore, statsAfter StatsResponse
+    json.Unmarshal([]byte(before), &statsBefore)
+    json.NewDecoder(do(t, router, http.MethodGet, "/stats", admin, nil).Body).Decode(&statsAfter)
+    if fmt.Sprint(statsBefore.AssignmentStats) != fmt.Sprint(statsAfter.AssignmentStats) {
+        t.Errorf("import of an unchanged snapshot changed stats: %v -> %v", statsBefore.AssignmentStats, statsAfter.AssignmentStats)
+    }
+
+    // Каждая операция из спецификации должна быть вызвана хотя бы раз успешно
+    paths := spec["paths"].(map[string]interface{})
+    var missing []string
+    for path, item := range paths {
+        for method := range item.(map[string]interface{}) {
+            if !covered[method+" "+path] {
+                missing = append(missing, method+" "+path)
+            }
+        }
+    }
+    sort.Strings(missing)
+    if len(missing) > 0 {
+        t.Errorf("operations without a successful contract check: %v", missing)
+    }
+}
+
+// TestOpenAPIDerivedResponses проверяет, что ответы аутентификации, Idempotency-Key, If-Match и лимита тела
+// описаны у каждого маршрута, к которому они относятся
+func TestOpenAPIDerivedResponses(t *testing.T) {
+    h := NewHandler(service.New(memory.New()), nil)
+    paths := buildSpec(h.routes())["paths"].(map[string]interface{})
+    for _, rt := range h.routes() {
+        op := paths[rt.path].(map[string]interface{})[strings.ToLower(rt.method)].(map[string]interface{})
+        documented := op["responses"].(map[string]interface{})
+        want := []int{http.StatusInternalServerError}
+        if rt.scope != scopePublic {
+            want = append(want, http.StatusUnauthorized, http.StatusForbidden)
+        }
+        if rt.idempotent {
+            want = append(want, http.StatusConflict, http.StatusUnprocessableEntity)
+        }
+        if rt.conditional {
+            want = append(want, http.StatusPreconditionFailed)
+        }
+        if rt.request != nil && !rt.ndjson {
+            want = append(want, http.StatusRequestEntityTooLarge)
+        }
+        for _, status := range want {
+            if _, ok := documented[strconv.Itoa(status)]; !ok {
+                t.Errorf("%s %s: status %d is not documented", rt.method, rt.path, status)
+            }
+        }
+    }
+}
+
+// TestReadiness проверяет, что упавшая зависимость дает 503 с разбором по проверкам, а liveness остается 200
+func TestReadiness(t *testing.T) {
+    store := memory.New()
+    h := NewHandler(service.New(store), auth.NewTokenAuthenticator(store, testAdminToken))
+    checker := health.NewChecker()
+    checker.Add("database", func(ctx context.Context) error { return errors.New("connection refused") })
+    checker.Worker("notifier").Started()
+    h.SetHealth(checker)
+    router := chi.NewRouter()
+    h.RegisterRoutes(router)
+
+    rec := do(t, router, http.MethodGet, "/readyz", "", nil)
+    var report health.Report
+    json.Unmarshal(rec.Body.Bytes(), &report)
+    if rec.Code != http.StatusServiceUnavailable || report.Status != health.StatusFail {
+        t.Fatalf("expected 503, got %d: %s", rec.Code, rec.Body)
+    }
+    if report.Checks["database"].Error != "connection refused" || report.Checks["worker:notifier"].Status != health.StatusOK {
+        t.Errorf("unexpected checks %+v", report.Checks)
+    }
+    if rec := do(t, router, http.MethodGet, "/livez", "", nil); rec.Code != http.StatusOK {
+        t.Errorf("expected liveness to ignore dependencies, got %d", rec.Code)
+    }
+}
+
+// TestRequestValidation проверяет, что все ошибки полей приходят одним ответом и ничего не создается
+func TestRequestValidation(t *testing.T) {
+    router := newTestRouter()
+    rec := do(t, router, http.MethodPost, "/team/add", testAdminToken, Team{TeamName: " ", Members: []TeamMember{
+        {UserID: "u1", Username: "Alice"},
+        {UserID: "u 2", Username: ""},
+        {UserID: "u1", Username: "Alice"},
+    }})
+    var p problem.Problem
+    if err := json.NewDecoder(rec.Body).Decode(&p); err != nil {
+        t.Fatal(err)
+    }
+    var fields []string
+    for _, f := range p.Errors {
+        fields = append(fields, f.Field)
+    }
+    want := "team_name,members[1].user_id,members[1].username,members[2].user_id"
+    if rec.Code != http.StatusBadRequest || p.Code != service.CodeBadRequest || strings.Join(fields, ",") != want {
+        t.Errorf("expected 400 with fields %s, got %d %+v", want, rec.Code, p)
+    }
+
+    rec = do(t, router, http.MethodPost, "/pullRequest/create", testAdminToken, `{"pull_request_id": 42}`)
+    if err := json.NewDecoder(rec.Body).Decode(&p); err != nil {
+        t.Fatal(err)
+    }
+    if rec.Code != http.StatusBadRequest || len(p.Errors) != 1 || p.Errors[0].Field != "pull_request_id" {
+        t.Errorf("expected a type error on pull_request_id, got %d %+v", rec.Code, p)
+    }
+}
+
+// TestIdempotencyKey проверяет, что повтор запроса с тем же ключом возвращает сохраненный ответ,
+// а не выполняет операцию снова, и что ключ нельзя использовать для другого запроса
+func TestIdempotencyKey(t *testing.T) {
+    router := newTestRouter()
+    send := func(path, key string, body interface{}) *httptest.ResponseRecorder {
+        t.Helper()
+        var buf bytes.Buffer
+        json.NewEncoder(&buf).Encode(body)
+        req := httptest.NewRequest(http.MethodPost, path, &buf)
+        req.Header.Set("Authorization", "Bearer "+testAdminToken)
+        req.Header.Set(HeaderIdempotencyKey, key)
+        rec := httptest.NewRecorder()
+        router.ServeHTTP(rec, req)
+        return rec
+    }
+
+    do(t, router, http.MethodPost, "/team/add", testAdminToken, Team{TeamName: "backend", Members: []TeamMember{
+        {UserID: "u1", Username: "Alice", IsActive: true},
+        {UserID: "u2", Username: "Bob", IsActive: true},
+        {UserID: "u3", Username: "Carol", IsActive: true},
+        {UserID: "u4", Username: "Dave", IsActive: true},
+    }})
+
+    create := CreatePRRequest{PullRequestID: "pr-1", PullRequestName: "Add search", AuthorID: "u1"}
+    first := send("/pullRequest/create", "ci-build-1", create)
+    retry := send("/pullRequest/create", "ci-build-1", create)
+    if first.Code != http.StatusCreated || retry.Code != http.StatusCreated || retry.Body.String() != first.Body.String() {
+        t.Fatalf("expected the retried create to replay 201, got %d then %d: %s", first.Code, retry.Code, retry.Body)
+    }
+    if first.Header().Get(headerIdempotentReplayed) != "" || retry.Header().Get(headerIdempotentReplayed) != "true" {
+        t.Errorf("expected only the retry to be marked as replayed")
+    }
+    // Повтор возвращает ETag первого ответа, чтобы клиент мог продолжить с If-Match
+    if etag := first.Header().Get("ETag"); etag == "" || retry.Header().Get("ETag") != etag {
+        t.Errorf("expected the retry to replay ETag %q, got %q", etag, retry.Header().Get("ETag"))
+    }
+
+    var created PullRequestResponse
+    if err := json.NewDecoder(first.Body).Decode(&created); err != nil {
+        t.Fatal(err)
+    }
+    reassign := ReassignRequest{PullRequestID: "pr-1", OldUserID: created.PR.AssignedReviewers[0]}
+    first = send("/pullRequest/reassign", "ci-reassign-1", reassign)
+    retry = send("/pullRequest/reassign", "ci-reassign-1", reassign)
+    // Без ключа повтор получил бы NOT_ASSIGNED: старый ревьювер уже снят
+    if first.Code != http.StatusOK || retry.Code != http.StatusOK || retry.Body.String() != first.Body.String() {
+        t.Fatalf("expected the retried reassign to replay the same reviewer, got %d then %d: %s", first.Code, retry.Code, retry.Body)
+    }
+
+    reassign.OldUserID = created.PR.AssignedReviewers[1]
+    rec := send("/pullRequest/reassign", "ci-reassign-1", reassign)
+    var p problem.Problem
+    if err := json.NewDecoder(rec.Body).Decode(&p); err != nil {
+        t.Fatal(err)
+    }
+    if rec.Code != http.StatusUnprocessableEntity || p.Code != service.CodeIdempotencyReused {
+        t.Errorf("expected 422 for the key reused with another payload, got %d %+v", rec.Code, p)
+    }
+    if rec := send("/pullRequest/merge", "ci-reassign-1", MergePRRequest{PullRequestID: "pr-1"}); rec.Code != http.StatusUnprocessableEntity {
+        t.Errorf("expected 422 for the key reused on another endpoint, got %d", rec.Code)
+    }
+}
+
+// Обработчик с Idempotency-Key ограничен арендой ключа: после нее повтор может выполниться заново
+func TestIdempotencyLease(t *testing.T) {
+    svc := service.New(memory.New())
+    svc.IdempotencyLease = time.Minute
+    h := NewHandler(svc, nil)
+
+    var deadline time.Time
+    handler := h.idempotent(func(w http.ResponseWriter, r *http.Request) {
+        deadline, _ = r.Context().Deadline()
+        w.WriteHeader(http.StatusNoContent)
+    })
+    req := httptest.NewRequest(http.MethodPost, "/pullRequest/merge", strings.NewReader("{}"))
+    req.Header.Set(HeaderIdempotencyKey, "k1")
+    handler(httptest.NewRecorder(), req)
+
+    if deadline.IsZero() || time.Until(deadline) > time.Minute {
+        t.Errorf("expected the handler context to end with the lease, got deadline %v", deadline)
+    }
+}
+
+// failingCompleteRepo не может сохранить ответ на ключ идемпотентности
+type failingCompleteRepo struct {
+    *memory.Repo
+}
+
+func (r failingCompleteRepo) CompleteIdempotencyKey(ctx context.Context, key *repo.IdempotencyKey) (bool, error) {
+    return false, errors.New("connection reset")
+}
+
+// Если ответ не удалось сохранить после выполненной операции, ключ остается занятым и повтор ее не выполняет
+func TestIdempotencyKeyKeptWhenStoreFails(t *testing.T) {
+    h := NewHandler(service.New(failingCompleteRepo{memory.New()}), nil)
+    runs := 0
+    handler := h.idempotent(func(w http.ResponseWriter, r *http.Request) {
+        runs++
+        w.WriteHeader(http.StatusCreated)
+    })
+    send := func() *httptest.ResponseRecorder {
+        req := httptest.NewRequest(http.MethodPost, "/pullRequest/create", strings.NewReader("{}"))
+        req.Header.Set(HeaderIdempotencyKey, "k1")
+        rec := httptest.NewRecorder()
+        handler(rec, req)
+        return rec
+    }
+
+    if rec := send(); rec.Code != http.StatusCreated {
+        t.Fatalf("expected the first request to run, got %d", rec.Code)
+    }
+    if rec := send(); rec.Code != http.StatusConflict || runs != 1 {
+        t.Errorf("expected the retry to get 409 without running again, got %d after %d runs", rec.Code, runs)
+    }
+}
+
+func TestIfMatch(t *testing.T) {
+    router := newTestRouter()
+    send := func(path, ifMatch string, body interface{}) *httptest.ResponseRecorder {
+        t.Helper()
+        var buf bytes.Buffer
+        json.NewEncoder(&buf).Encode(body)
+        req := httptest.NewRequest(http.MethodPost, path, &buf)
+        req.Header.Set("Authorization", "Bearer "+testAdminToken)
+        req.Header.Set("If-Match", ifMatch)
+        rec := httptest.NewRecorder()
+        router.ServeHTTP(rec, req)
+        return rec
+    }
+
+    do(t, router, http.MethodPost, "/team/add", testAdminToken, Team{TeamName: "backend", Members: []TeamMember{
+        {UserID: "u1", Username: "Alice", IsActive: true},
+        {UserID: "u2", Username: "Bob", IsActive: true},
+        {UserID: "u3", Username: "Carol", IsActive: true},
+        {UserID: "u4", Username: "Dave", IsActive: true},
+    }})
+    do(t, router, http.MethodPost, "/pullRequest/create", testAdminToken, CreatePRRequest{PullRequestID: "pr-1", PullRequestName: "Add search", AuthorID: "u1"})
+
+    // Инструмент прочитал PR и показывает этот список ревьюверов
+    rec := do(t, router, http.MethodGet, "/pullRequest/get?pull_request_id=pr-1", testAdminToken, nil)
+    stale := rec.Header().Get("ETag")
+    if stale == "" {
+        t.Fatal("expected an ETag on GET")
+    }
+    var shown PullRequestResponse
+    if err := json.NewDecoder(rec.Body).Decode(&shown); err != nil {
+        t.Fatal(err)
+    }
+    replaced := shown.PR.AssignedReviewers[0]
+
+    // Кто-то другой уже заменил ревьювера
+    rec = do(t, router, http.MethodPost, "/pullRequest/reassign", testAdminToken, ReassignRequest{PullRequestID: "pr-1", OldUserID: replaced})
+    if rec.Code != http.StatusOK || rec.Header().Get("ETag") == stale {
+        t.Fatalf("expected the reassign to succeed with a new ETag, got %d %q", rec.Code, rec.Header().Get("ETag"))
+    }
+    current := rec.Header().Get("ETag")
+
+    // По устаревшему списку нельзя заменить второго ревьювера вслепую
+    rec = send("/pullRequest/reassign", stale, ReassignRequest{PullRequestID: "pr-1", OldUserID: shown.PR.AssignedReviewers[1]})
+    var p problem.Problem
+    if err := json.NewDecoder(rec.Body).Decode(&p); err != nil {
+        t.Fatal(err)
+    }
+    if rec.Code != http.StatusPreconditionFailed || p.Code != service.CodePreconditionFailed {
+        t.Fatalf("expected 412 for a stale If-Match, got %d %+v", rec.Code, p)
+    }
+    // И даже уже замененного: ответом должен быть 412, а не NOT_ASSIGNED
+    if rec := send("/pullRequest/reassign", stale, ReassignRequest{PullRequestID: "pr-1", OldUserID: replaced}); rec.Code != http.StatusPreconditionFailed {
+        t.Errorf("expected 412 for the already replaced reviewer, got %d: %s", rec.Code, rec.Body)
+    }
+
+    rec = send("/pullRequest/reassign", current, ReassignRequest{PullRequestID: "pr-1", OldUserID: shown.PR.AssignedReviewers[1]})
+    if rec.Code != http.StatusOK || rec.Header().Get("ETag") == current {
+        t.Fatalf("expected the reassign with the current ETag to succeed with a new ETag, got %d: %s", rec.Code, rec.Body)
+    }
+    current = rec.Header().Get("ETag")
+    if rec := send("/pullRequest/merge", stale, MergePRRequest{PullRequestID: "pr-1"}); rec.Code != http.StatusPreconditionFailed {
+        t.Errorf("expected 412 for a merge with a stale If-Match, got %d", rec.Code)
+    }
+    if rec := send("/pullRequest/merge", current, MergePRRequest{PullRequestID: "pr-1"}); rec.Code != http.StatusOK {
+        t.Errorf("expected the merge with the current ETag to succeed, got %d: %s", rec.Code, rec.Body)
+    }
+
+    rec = do(t, router, http.MethodGet, "/team/get?team_name=backend", testAdminToken, nil)
+    team := rec.Header().Get("ETag")
+    do(t, router, http.MethodPost, "/users/setIsActive", testAdminToken, SetUserActiveRequest{UserID: "u4", IsActive: false})
+    if rec := send("/teams/backend/deactivate", team, DeactivateTeamRequest{}); rec.Code != http.StatusPreconditionFailed {
+        t.Errorf("expected 412 for deactivating a team whose members changed, got %d", rec.Code)
+    }
+    if rec := send("/teams/backend/deactivate", "*", DeactivateTeamRequest{}); rec.Code != http.StatusNoContent {
+        t.Errorf("expected If-Match: * to deactivate unconditionally, got %d: %s", rec.Code, rec.Body)
+    }
+
+    for _, tag := range []string{"3", `W/"3"`, `"abc"`, `"1", "2"`} {
+        if rec := send("/pullRequest/merge", tag, MergePRRequest{PullRequestID: "pr-1"}); rec.Code != http.StatusBadRequest {
+            t.Errorf("If-Match %s: expected 400, got %d", tag, rec.Code)
+        }
+    }
+}
+
+// statsFailure имитирует сбой базы при подсчете статистики
+type statsFailure struct {
+    repo.RepoInterface
+}
+
+func (statsFailure) GetAssignmentStats(ctx context.Context) (map[string]int, error) {
+    return nil, errors.New("pq: password authentication failed for user \"assigner\"")
+}
+
+// TestProblemDetails проверяет тело application/problem+json: код и поля для ошибок клиента,
+// обезличенный 500 для сбоев
+func TestProblemDetails(t *testing.T) {
+    router := newTestRouter()
+    rec := do(t, router, http.MethodPost, "/auth/tokens", testAdminToken, CreateTokenRequest{Name: "ci", Scopes: []string{"read", "root"}})
+    var p problem.Problem
+    if err := json.NewDecoder(rec.Body).Decode(&p); err != nil {
+        t.Fatal(err)
+    }
+    if rec.Code != http.StatusBadRequest || rec.Header().Get("Content-Type") != problem.ContentType {
+        t.Fatalf("expected 400 problem+json, got %d %q", rec.Code, rec.Header().Get("Content-Type"))
+    }
+    if p.Code != service.CodeInvalidTokenRequest || p.Type != "/problems/invalid-token-request" || p.Status != 400 || p.Instance != "/auth/tokens" {
+        t.Errorf("unexpected problem %+v", p)
+    }
+    if len(p.Errors) != 1 || p.Errors[0].Field != "scopes[1]" {
+        t.Errorf("expected the unknown scope to be pointed at, got %+v", p.Errors)
+    }
+
+    store := memory.New()
+    h := NewHandler(service.New(statsFailure{store}), auth.NewTokenAuthenticator(store, testAdminToken))
+    failing := chi.NewRouter()
+    h.RegisterRoutes(failing)
+    rec = do(t, failing, http.MethodGet, "/stats", testAdminToken, nil)
+    if rec.Code != http.StatusInternalServerError || strings.Contains(rec.Body.String(), "password") {
+        t.Errorf("expected a 500 without the database error, got %d: %s", rec.Code, rec.Body)
+    }
+}
+
+// TestStreamEvents проверяет фильтр по пользователю, догон по Last-Event-ID и доставку новых событий
+func TestStreamEvents(t *testing.T) {
+    srv := httptest.NewServer(newTestRouter())
+    defer srv.Close()
+
+    post := func(path string, body interface{}) {
+        t.Helper()
+        var buf bytes.Buffer
+        json.NewEncoder(&buf).Encode(body)
+        req, _ := http.NewRequest(http.MethodPost, srv.URL+path, &buf)
+        req.Header.Set("Authorization", "Bearer "+testAdminToken)
+        resp, err := http.DefaultClient.Do(req)
+        if err != nil {
+            t.Fatalf("POST %s: %v", path, err)
+        }
+        resp.Body.Close()
+        if resp.StatusCode >= 300 {
+            t.Fatalf("POST %s: status %d", path, resp.StatusCode)
+        }
+    }
+
+    post("/team/add", Team{TeamName: "backend", Members: []TeamMember{
+        {UserID: "u1", Username: "Alice", IsActive: true},
+        {UserID: "u2", Username: "Bob", IsActive: true},
+        {UserID: "u3", Username: "Carol", IsActive: true},
+    }})
+    post("/team/add", Team{TeamName: "frontend", Members: []TeamMember{
+        {UserID: "u5", Username: "Eve", IsActive: true},
+        {UserID: "u6", Username: "Frank", IsActive: true},
+    }})
+    // id 1 - pr.created, 2 и 3 - назначения u2 и u3
+    post("/pullRequest/create", CreatePRRequest{PullRequestID: "pr-1", PullRequestName: "Add search", AuthorID: "u1"})
+
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+    req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"/events/stream?user_id=u2", nil)
+    req.Header.Set("Authorization", "Bearer "+testAdminToken)
+    req.Header.Set("Last-Event-ID", "1")
+    resp, err := http.DefaultClient.Do(req)
+    if err != nil {
+        t.Fatalf("GET /events/stream: %v", err)
+    }
+    defer resp.Body.Close()
+    if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+        t.Fatalf("unexpected content type %q", ct)
+    }
+
+    reader := bufio.NewReader(resp.Body)
+    next := func() Event {
+        t.Helper()
+        var event Event
+        for {
+            line, err := reader.ReadString('\n')
+            if err != nil {
+                t.Fatalf("read event: %v", err)
+            }
+            line = strings.TrimSpace(line)
+            if strings.HasPrefix(line, "data: ") {
+                if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &event); err != nil {
+                    t.Fatalf("event data: %v", err)
+                }
+            }
+            if line == "" && event.ID != 0 {
+                return event
+            }
+        }
+    }
+
+    // Из истории приходит только назначение u2
+    if e := next(); e.Type != "reviewer.assigned" || e.PullRequestID != "pr-1" || e.ReviewerID != "u2" || e.TeamName != "backend" {
+        t.Errorf("unexpected replayed event %+v", e)
+    }
+
+    // PR другой команды не касается u2; первым живым событием должно быть назначение u2 на pr-3
+    post("/pullRequest/create", CreatePRRequest{PullRequestID: "pr-2", PullRequestName: "Fix layout", AuthorID: "u5"})
+    post("/pullRequest/create", CreatePRRequest{PullRequestID: "pr-3", PullRequestName: "Add cache", AuthorID: "u3"})
+    if e := next(); e.Type != "reviewer.assigned" || e.PullRequestID != "pr-3" || e.ReviewerID != "u2" {
+        t.Errorf("unexpected live event %+v", e)
+    }
+}
+
+// TestStreamEventsReplaysAllPages: клиент, отставший больше чем на страницу истории, получает все пропущенные события
+func TestStreamEventsReplaysAllPages(t *testing.T) {
+    router := newTestRouter()
+    do(t, router, http.MethodPost, "/team/add", testAdminToken, Team{TeamName: "backend", Members: []TeamMember{
+        {UserID: "u1", Username: "Alice", IsActive: true},
+        {UserID: "u2", Username: "Bob", IsActive: true},
+        {UserID: "u3", Username: "Carol", IsActive: true},
+    }})
+    // Каждый PR - три события: создание и два назначения
+    prs := replayPageSize/3 + 10
+    for i := 0; i < prs; i++ {
+        req := CreatePRRequest{PullRequestID: fmt.Sprintf("pr-%d", i), PullRequestName: "Change", AuthorID: "u1"}
+        if rec := do(t, router, http.MethodPost, "/pullRequest/create", testAdminToken, req); rec.Code != http.StatusCreated {
+            t.Fatalf("create PR: %d %s", rec.Code, rec.Body)
+        }
+    }
+
+    srv := httptest.NewServer(router)
+    defer srv.Close()
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+    req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"/events/stream", nil)
+    req.Header.Set("Authorization", "Bearer "+testAdminToken)
+    req.Header.Set("Last-Event-ID", "0")
+    resp, err := http.DefaultClient.Do(req)
+    if err != nil {
+        t.Fatalf("GET /events/stream: %v", err)
+    }
+    defer resp.Body.Close()
+
+    reader := bufio.NewReader(resp.Body)
+    for want := int64(1); want <= int64(prs*3); want++ {
+        var line string
+        for !strings.HasPrefix(line, "id: ") {
+            if line, err = reader.ReadString('\n'); err != nil {
+                t.Fatalf("read event %d: %v", want, err)
+            }
+        }
+        if got := strings.TrimSpace(strings.TrimPrefix(line, "id: ")); got != strconv.FormatInt(want, 10) {
+            t.Fatalf("expected event %d, got %s", want, got)
+        }
+    }
+}
+
+// validator проверяет JSON по подмножеству OpenAPI 3.0, которое порождает buildSpec.
+// Свойства, не описанные в схеме, считаются расхождением.
+type validator struct {
+    spec map[string]interface{}
+}
+
+func (v *validator) response(template, method string, rec *httptest.ResponseRecorder) []error {
+    paths := v.spec["paths"].(map[string]interface{})
+    item, ok := paths[template].(map[string]interface{})
+    if !ok {
+        return []error{fmt.Errorf("path %s is not in the spec", template)}
+    }
+    op, ok := item[strings.ToLower(method)].(map[string]interface{})
+    if !ok {
+        return []error{fmt.Errorf("operation %s %s is not in the spec", method, template)}
+    }
+    resp, ok := op["responses"].(map[string]interface{})[fmt.Sprint(rec.Code)].(map[string]interface{})
+    if !ok {
+        return []error{fmt.Errorf("status %d is not documented", rec.Code)}
+    }
+
+    content, hasBody := resp["content"].(map[string]interface{})
+    if !hasBody {
+        if rec.Body.Len() != 0 {
+            return []error{fmt.Errorf("status %d must not have a body", rec.Code)}
+        }
+        return nil
+    }
+    ct := rec.Header().Get("Content-Type")
+    if strings.HasPrefix(ct, "text/event-stream") {
+        media, ok := content["text/event-stream"].(map[string]interface{})
+        if !ok {
+            return []error{fmt.Errorf("unexpected content type %q", ct)}
+        }
+        return v.events(media["schema"].(map[string]interface{}), rec.Body.String())
+    } else if strings.HasPrefix(ct, "application/x-ndjson") {
+        media, ok := content["application/x-ndjson"].(map[string]interface{})
+        if !ok {
+            return []error{fmt.Errorf("unexpected content type %q", ct)}
+        }
+        return v.lines(media["schema"].(map[string]interface{}), rec.Body.String())
+    }
+    mediaType := "application/json"
+    if strings.HasPrefix(ct, problem.ContentType) {
+        mediaType = problem.ContentType
+    } else if !strings.HasPrefix(ct, mediaType) {
+        return []error{fmt.Errorf("unexpected content type %q", ct)}
+    }
+    media, ok := content[mediaType].(map[string]interface{})
+    if !ok {
+        return []error{fmt.Errorf("content type %q is not documented for status %d", ct, rec.Code)}
+    }
+
+    var body interface{}
+    dec := json.NewDecoder(rec.Body)
+    dec.UseNumber()
+    if err := dec.Decode(&body); err != nil {
+        return []error{fmt.Errorf("invalid JSON: %v", err)}
+    }
+    return v.validate(media["schema"].(map[string]interface{}), body, "$")
+}
+
+// events проверяет data каждого события SSE; комментарии (keep-alive) пропускаются
+func (v *validator) events(schema map[string]interface{}, stream string) []error {
+    var errs []error
+    for i, block := range strings.Split(strings.TrimSpace(stream), "\n\n") {
+        var data []string
+        for _, line := range strings.Split(block, "\n") {
+            if strings.HasPrefix(line, "data: ") {
+                data = append(data, strings.TrimPrefix(line, "data: "))
+            }
+        }
+        if len(data) == 0 {
+            continue
+        }
+
+        var body interface{}
+        dec := json.NewDecoder(strings.NewReader(strings.Join(data, "\n")))
+        dec.UseNumber()
+        if err := dec.Decode(&body); err != nil {
+            errs = append(errs, fmt.Errorf("event %d: invalid JSON: %v", i, err))
+            continue
+        }
+        errs = append(errs, v.validate(schema, body, fmt.Sprintf("$[%d]", i))...)
+    }
+    return errs
+}
+
+// lines проверяет каждую строку JSON Lines
+func (v *validator) lines(schema map[string]interface{}, body string) []error {
+    var errs []error
+    for i, line := range strings.Split(strings.TrimSpace(body), "\n") {
+        var value interface{}
+        dec := json.NewDecoder(strings.NewReader(line))
+        dec.UseNumber()
+        if err := dec.Decode(&value); err != nil {
+            errs = append(errs, fmt.Errorf("line %d: invalid JSON: %v", i+1, err))
+            continue
+        }
+        errs = append(errs, v.validate(schema, value, fmt.Sprintf("$[%d]", i))...)
+    }
+    return errs
+}
+
+func (v *validator) validate(schema map[string]interface{}, value interface{}, at string) []error {
+    if ref, ok := schema["$ref"].(string); ok {
+        name := strings.TrimPrefix(ref, schemaRef)
+        schemas := v.spec["components"].(map[string]interface{})["schemas"].(map[string]interface{})
+        return v.validate(schemas[name].(map[string]interface{}), value, at)
+    }
+    if value == nil {
+        if schema["nullable"] == true {
+            return nil
+        }
+        return []error{fmt.Errorf("%s: null is not allowed", at)}
+    }
+    if allOf, ok := schema["allOf"].([]interface{}); ok {
+        var errs []error
+        for _, s := range allOf {
+            errs = append(errs, v.validate(s.(map[string]interface{}), value, at)...)
+        }
+        return errs
+    }
+
+    switch schema["type"] {
+    case "object":
+        obj, ok := value.(map[string]interface{})
+        if !ok {
+            return []error{fmt.Errorf("%s: expected object", at)}
+        }
+        var errs []error
+        props, _ := schema["properties"].(map[string]interface{})
+        required, _ := schema["required"].([]interface{})
+        for _, name := range required {
+            if _, ok := obj[name.(string)]; !ok {
+                errs = append(errs, fmt.Errorf("%s: missing required property %s", at, name))
+            }
+        }
+        for name, val := range obj {
+            if additional, ok := schema["additionalProperties"].(map[string]interface{}); ok {
+                errs = append(errs, v.validate(additional, val, at+"."+name)...)
+                continue
+            }
+            prop, ok := props[name].(map[string]interface{})
+            if !ok {
+                errs = append(errs, fmt.Errorf("%s: undocumented property %s", at, name))
+                continue
+            }
+            errs = append(errs, v.validate(prop, val, at+"."+name)...)
+        }
+        return errs
+    case "array":
+        arr, ok := value.([]interface{})
+        if !ok {
+            return []error{fmt.Errorf("%s: expected array", at)}
+        }
+        var errs []error
+        for i, item := range arr {
+            errs = append(errs, v.validate(schema["items"].(map[string]interface{}), item, fmt.Sprintf("%s[%d]", at, i))...)
+        }
+        return errs
+    case "string":
+        s, ok := value.(string)
+        if !ok {
+            return []error{fmt.Errorf("%s: expected string", at)}
+        }
+        if schema["format"] == "date-time" {
+            if _, err := time.Parse(time.RFC3339, s); err != nil {
+                return []error{fmt.Errorf("%s: invalid date-time %q", at, s)}
+            }
+        }
+        if enum, ok := schema["enum"].([]interface{}); ok {
+            for _, e := range enum {
+                if e == s {
+                    return nil
+                }
+            }
+            return []error{fmt.Errorf("%s: %q is not one of %v", at, s, enum)}
+        }
+    case "boolean":
+        if _, ok := value.(bool); !ok {
+            return []error{fmt.Errorf("%s: expected boolean", at)}
+        }
+    case "integer":
+        n, ok := value.(json.Number)
+        if _, err := n.Int64(); !ok || err != nil {
+            return []error{fmt.Errorf("%s: expected integer", at)}
+        }
+    case "number":
+        if _, ok := value.(json.Number); !ok {
+            return []error{fmt.Errorf("%s: expected number", at)}
+        }
+    }
+    return nil
+}
@@ -0,0 +1,133 @@
+package handlers
+
+import (
+    "bytes"
+    "context"
+    "crypto/sha256"
+    "encoding/hex"
+    "io"
+    "log/slog"
+    "net/http"
+
+    "pr-review-assigner/internal/service"
+)
+
+const (
+    // HeaderIdempotencyKey lets a client retry a mutating request without applying it twice
+    HeaderIdempotencyKey = "Idempotency-Key"
+    // headerIdempotentReplayed marks a response served from the stored copy
+    headerIdempotentReplayed = "Idempotent-Replayed"
+)
+
+var idempotencyHeader = param{
+    name: HeaderIdempotencyKey, typ: "string",
+    description: "retries with the same key and payload replay the stored response instead of repeating the operation",
+}
+
+// idempotent wraps a mutating handler. Without the header the request runs as usual.
+// With it, the first request runs and its response is stored; a retry with the same key,
+// method, path, query and body gets the stored response, while the same key with another
+// request is rejected with 422. Server errors are not stored, so they can be retried.
+func (h *Handler) idempotent(next http.HandlerFunc) http.HandlerFunc {
+    return func(w http.ResponseWriter, r *http.Request) {
+        key, ok := r.Header[HeaderIdempotencyKey]
+        if !ok {
+            next(w, r)
+            return
+        }
+
+        body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, h.bodyLimit))
+        if err != nil {
+            h.sendError(w, r, err)
+            return
+        }
+        r.Body = io.NopCloser(bytes.NewReader(body))
+
+        stored, res, err := h.svc.BeginIdempotentRequest(r.Context(), key[0], requestHash(r, body))
+        if err != nil {
+            h.sendError(w, r, err)
+            return
+        }
+        if stored != nil {
+            if stored.ContentType != "" {
+                w.Header().Set("Content-Type", stored.ContentType)
+            }
+            if stored.ETag != "" {
+                w.Header().Set("ETag", stored.ETag)
+            }
+            w.Header().Set(headerIdempotentReplayed, "true")
+            w.WriteHeader(stored.Status)
+            w.Write(stored.Body)
+            return
+        }
+
+        // The outcome is saved even if the client has gone away: that is exactly when it retries
+        ctx := context.WithoutCancel(r.Context())
+        rec := &recordingWriter{ResponseWriter: w}
+        ran := false
+        defer func() {
+            // A panic or a server error means nothing was committed: the key is released so that a retry runs again
+            if ran {
+                return
+            }
+            if err := h.svc.AbortIdempotentRequest(ctx, res); err != nil {
+                slog.WarnContext(ctx, "failed to release idempotency key", "error", err)
+            }
+        }()
+
+        // The handler must finish within the lease: after it a retry may reserve the key and run again
+        leaseCtx, cancel := context.WithDeadline(r.Context(), res.Deadline)
+        defer cancel()
+        next(rec, r.WithContext(leaseCtx))
+
+        if rec.status == 0 {
+            rec.status = http.StatusOK
+        }
+        if rec.status >= http.StatusInternalServerError {
+            return
+        }
+        // The operation has committed: from here on the key is never released, or a retry would repeat it
+        ran = true
+        resp := service.StoredResponse{
+            Status: rec.status, ContentType: rec.Header().Get("Content-Type"), ETag: rec.Header().Get("ETag"), Body: rec.body.Bytes(),
+        }
+        if err := h.svc.CompleteIdempotentRequest(ctx, res, resp); err != nil {
+            // The client already has the response; retries get 409 until the lease expires
+            slog.ErrorContext(ctx, "failed to store idempotent response, keeping the key reserved", "error", err)
+        }
+    }
+}
+
+// requestHash identifies the request a key was used for. If-Match is part of it:
+// a retry with a refreshed ETag is a new request, not a replay of the old 412.
+func requestHash(r *http.Request, body []byte) string {
+    sum := sha256.New()
+    for _, part := range []string{r.Method, r.URL.Path, r.URL.RawQuery, r.Header.Get("If-Match")} {
+        io.WriteString(sum, part)
+        sum.Write([]byte{0})
+    }
+    sum.Write(body)
+    return hex.EncodeToString(sum.Sum(nil))
+}
+
+// recordingWriter passes the response through while keeping a copy of the status and body
+type recordingWriter struct {
+    http.ResponseWriter
+    status int
+    body   bytes.Buffer
+}
+
+func (w *recordingWriter) WriteHeader(status int) {
+    if w.status == 0 {
+        w.status = status
+    }
+    w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *recordingWriter) Write(b []byte) (int, error) {
+    if w.status == 0 {
+        w.status = http.StatusOK
+    }
+    w.body.Write(b)
+    return w.ResponseWriter.Write(b)
+}
@@ -0,0 +1,254 @@
+package handlers
+
+import (
+    "encoding"
+    "encoding/json"
+    "net/http"
+    "reflect"
+    "regexp"
+    "strconv"
+    "strings"
+    "sync"
+    "time"
+)
+
+const schemaRef = "#/components/schemas/"
+
+var (
+    specOnce sync.Once
+    specJSON []byte
+)
+
+// OpenAPI serves the OpenAPI 3 document generated from the route table
+func (h *Handler) OpenAPI(w http.ResponseWriter, r *http.Request) {
+    specOnce.Do(func() {
+        specJSON, _ = json.MarshalIndent(buildSpec(h.routes()), "", "  ")
+    })
+    w.Header().Set("Content-Type", "application/json")
+    w.Write(specJSON)
+}
+
+var pathParamRe = regexp.MustCompile(`\{([^}]+)\}`)
+
+// buildSpec describes routes as an OpenAPI 3.0 document; schemas come from the DTO types
+func buildSpec(routes []route) map[string]interface{} {
+    g := &schemaGen{schemas: map[string]interface{}{}, names: map[reflect.Type]string{}}
+    paths := map[string]interface{}{}
+
+    for _, rt := range routes {
+        op := map[string]interface{}{
+            "summary":     rt.summary,
+            "tags":        []string{rt.tag},
+            "operationId": operationID(rt),
+        }
+
+        var params []interface{}
+        for _, m := range pathParamRe.FindAllStringSubmatch(rt.path, -1) {
+            params = append(params, map[string]interface{}{
+                "name": m[1], "in": "path", "required": true,
+                "schema": map[string]interface{}{"type": "string"},
+            })
+        }
+        headers := rt.headers
+        if rt.idempotent {
+            headers = append(headers, idempotencyHeader)
+        }
+        if rt.conditional {
+            headers = append(headers, ifMatchHeader)
+        }
+        for _, in := range []struct {
+            name   string
+            params []param
+        }{{"query", rt.query}, {"header", headers}} {
+            for _, p := range in.params {
+                schema := map[string]interface{}{"type": p.typ}
+                if p.format != "" {
+                    schema["format"] = p.format
+                }
+                param := map[string]interface{}{"name": p.name, "in": in.name, "required": p.required, "schema": schema}
+                if p.description != "" {
+                    param["description"] = p.description
+                }
+                params = append(params, param)
+            }
+        }
+        if params != nil {
+            op["parameters"] = params
+        }
+
+        if rt.request != nil {
+            schema := g.schema(reflect.TypeOf(rt.request))
+            content := map[string]interface{}{"application/json": map[string]interface{}{"schema": schema}}
+            if rt.ndjson {
+                content = map[string]interface{}{"application/x-ndjson": map[string]interface{}{"schema": schema}}
+            }
+            if rt.yaml {
+                content["application/yaml"] = map[string]interface{}{"schema": schema}
+            }
+            op["requestBody"] = map[string]interface{}{"required": true, "content": content}
+        }
+
+        responses := map[string]interface{}{}
+        if rt.scope != scopePublic && rt.scope != scopeAuthed {
+            op["description"] = "Requires scope `" + rt.scope + "`."
+        }
+        for _, resp := range rt.allResponses() {
+            key := strconv.Itoa(resp.status)
+            if _, exists := responses[key]; exists {
+                continue
+            }
+            entry := map[string]interface{}{"description": resp.description}
+            if resp.body != nil {
+                contentType := resp.contentType
+                if contentType == "" {
+                    contentType = "application/json"
+                }
+                entry["content"] = map[string]interface{}{
+                    contentType: map[string]interface{}{"schema": g.schema(reflect.TypeOf(resp.body))},
+                }
+            }
+            responses[key] = entry
+        }
+        op["responses"] = responses
+
+        if rt.scope != scopePublic {
+            op["security"] = []interface{}{map[string]interface{}{"bearerAuth": []string{}}}
+        }
+
+        item, _ := paths[rt.path].(map[string]interface{})
+        if item == nil {
+            item = map[string]interface{}{}
+            paths[rt.path] = item
+        }
+        item[strings.ToLower(rt.method)] = op
+    }
+
+    return map[string]interface{}{
+        "openapi": "3.0.3",
+        "info": map[string]interface{}{
+            "title":   "PR Reviewer Assignment Service",
+            "version": "1.0.0",
+        },
+        "paths": paths,
+        "components": map[string]interface{}{
+            "schemas": g.schemas,
+            "securitySchemes": map[string]interface{}{
+                "bearerAuth": map[string]interface{}{
+                    "type":        "http",
+                    "scheme":      "bearer",
+                    "description": "API token (pra_...) or SSO JWT",
+                },
+            },
+        },
+    }
+}
+
+// operationID turns "POST /pullRequest/create" into "postPullRequestCreate"
+func operationID(rt route) string {
+    var b strings.Builder
+    b.WriteString(strings.ToLower(rt.method))
+    for _, part := range strings.FieldsFunc(rt.path, func(r rune) bool { return r == '/' || r == '{' || r == '}' }) {
+        b.WriteString(strings.ToUpper(part[:1]) + part[1:])
+    }
+    return b.String()
+}
+
+// schemaGen converts Go types to OpenAPI schemas following encoding/json rules
+type schemaGen struct {
+    schemas map[string]interface{}
+    names   map[reflect.Type]string
+}
+
+var (
+    timeType          = reflect.TypeOf(time.Time{})
+    rawJSONType       = reflect.TypeOf(json.RawMessage{})
+    textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+func (g *schemaGen) schema(t reflect.Type) map[string]interface{} {
+    switch {
+    case t == timeType:
+        return map[string]interface{}{"type": "string", "format": "date-time"}
+    case t == rawJSONType:
+        return map[string]interface{}{"nullable": true, "description": "arbitrary JSON"}
+    case t.Kind() != reflect.Ptr && t.Implements(textMarshalerType):
+        // encoding/json writes such values as strings, e.g. durations as "30s"
+        return map[string]interface{}{"type": "string"}
+    }
+
+    switch t.Kind() {
+    case reflect.Ptr:
+        inner := g.schema(t.Elem())
+        if _, isRef := inner["$ref"]; isRef {
+            return map[string]interface{}{"allOf": []interface{}{inner}, "nullable": true}
+        }
+        inner["nullable"] = true
+        return inner
+    case reflect.Struct:
+        name, seen := g.names[t]
+        if !seen {
+            name = t.Name()
+            if _, taken := g.schemas[name]; taken {
+                // Same name in another package, e.g. repo.TeamMember
+                pkg := t.PkgPath()[strings.LastIndex(t.PkgPath(), "/")+1:]
+                name = strings.ToUpper(pkg[:1]) + pkg[1:] + name
+            }
+            g.names[t] = name
+            g.schemas[name] = nil // reserve the name for recursive types
+            g.schemas[name] = g.object(t)
+        }
+        return map[string]interface{}{"$ref": schemaRef + name}
+    case reflect.Slice, reflect.Array:
+        return map[string]interface{}{"type": "array", "items": g.schema(t.Elem())}
+    case reflect.Map:
+        return map[string]interface{}{"type": "object", "additionalProperties": g.schema(t.Elem())}
+    case reflect.String:
+        return map[string]interface{}{"type": "string"}
+    case reflect.Bool:
+        return map[string]interface{}{"type": "boolean"}
+    case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+        return map[string]interface{}{"type": "integer", "format": "int32"}
+    case reflect.Int64, reflect.Uint64:
+        return map[string]interface{}{"type": "integer", "format": "int64"}
+    case reflect.Float32, reflect.Float64:
+        return map[string]interface{}{"type": "number"}
+    default:
+        return map[string]interface{}{}
+    }
+}
+
+func (g *schemaGen) object(t reflect.Type) map[string]interface{} {
+    properties := map[string]interface{}{}
+    var required []string
+
+    for i := 0; i < t.NumField(); i++ {
+        f := t.Field(i)
+        if !f.IsExported() {
+            continue
+        }
+        tag := f.Tag.Get("json")
+        if tag == "-" {
+            continue
+        }
+        name, opts, _ := strings.Cut(tag, ",")
+        if name == "" {
+            name = f.Name
+        }
+
+        prop := g.schema(f.Type)
+        if enum := f.Tag.Get("enum"); enum != "" {
+            prop["enum"] = strings.Split(enum, ",")
+        }
+        properties[name] = prop
+
+        if !strings.Contains(opts, "omitempty") && f.Type.Kind() != reflect.Ptr && f.Type != rawJSONType {
+            required = append(required, name)
+        }
+    }
+
+    schema := map[string]interface{}{"type": "object", "properties": properties}
+    if required != nil {
+        schema["required"] = required
+    }
+    return schema
+}
@@ -0,0 +1,304 @@
+package handlers
+
+import (
+    "net/http"
+
+    "github.com/go-chi/chi/v5"
+    "pr-review-assigner/internal/auth"
+    "pr-review-assigner/internal/config"
+    "pr-review-assigner/internal/health"
+    "pr-review-assigner/internal/problem"
+    "pr-review-assigner/internal/service"
+)
+
+const (
+    scopePublic = ""  // no token required
+    scopeAuthed = "*" // any valid token; the service checks admin scopes, or write:prs plus the role (team lead, member)
+)
+
+// route describes one endpoint. The table below is used both to register
+// handlers and to generate the OpenAPI document, so the two cannot drift.
+type route struct {
+    method      string
+    path        string
+    summary     string
+    tag         string
+    scope       string
+    handler     http.HandlerFunc
+    query       []param
+    headers     []param
+    request     interface{} // zero value of the request body type, nil if none
+    yaml        bool        // request body may also be YAML
+    ndjson      bool        // request body is JSON Lines of the request type instead of JSON
+    idempotent  bool        // accepts Idempotency-Key, see (*Handler).idempotent
+    conditional bool        // accepts If-Match, see (*Handler).conditional
+    responses   []response
+}
+
+type param struct {
+    name        string
+    typ         string // string, boolean, integer
+    format      string
+    required    bool
+    description string
+}
+
+type response struct {
+    status      int
+    description string
+    body        interface{} // nil for responses without body
+    contentType string      // defaults to application/json
+}
+
+func ok(body interface{}) response {
+    return response{status: http.StatusOK, description: "OK", body: body}
+}
+
+func created(body interface{}) response {
+    return response{status: http.StatusCreated, description: "Created", body: body}
+}
+
+// eventStream is a text/event-stream response; body describes the data of each event
+func eventStream(body interface{}) response {
+    return response{status: http.StatusOK, description: "Event stream", body: body, contentType: "text/event-stream"}
+}
+
+// jsonLines is an application/x-ndjson response; body describes each line
+func jsonLines(body interface{}) response {
+    return response{status: http.StatusOK, description: "JSON Lines", body: body, contentType: "application/x-ndjson"}
+}
+
+func noContent() response {
+    return response{status: http.StatusNoContent, description: "No Content"}
+}
+
+// fail lists error responses; all of them are RFC 7807 problem details
+func fail(statuses ...int) []response {
+    result := make([]response, len(statuses))
+    for i, status := range statuses {
+        result[i] = response{status: status, description: http.StatusText(status), body: problem.Problem{}, contentType: problem.ContentType}
+    }
+    return result
+}
+
+// allResponses adds to the route's own responses those that follow from how it is wrapped:
+// authentication, Idempotency-Key, If-Match and the body limit. Earlier entries win on duplicate statuses.
+func (rt route) allResponses() []response {
+    all := append([]response(nil), rt.responses...)
+    if rt.scope != scopePublic {
+        // scopeAuthed routes are checked by role in the service, the rest by the token scope
+        all = append(all, fail(http.StatusUnauthorized, http.StatusForbidden)...)
+    }
+    if rt.idempotent {
+        // Idempotency-Key that is too long, of a request still running, or reused with another payload
+        all = append(all, fail(http.StatusBadRequest, http.StatusConflict, http.StatusUnprocessableEntity)...)
+    }
+    if rt.conditional {
+        // If-Match is malformed or no longer matches the ETag of the resource
+        all = append(all, fail(http.StatusBadRequest, http.StatusPreconditionFailed)...)
+    }
+    if rt.request != nil && !rt.ndjson {
+        // Bodies over the limit of SetBodyLimit; snapshot imports are exempt
+        all = append(all, fail(http.StatusRequestEntityTooLarge)...)
+    }
+    return append(all, fail(http.StatusInternalServerError)...)
+}
+
+func (h *Handler) routes() []route {
+    return []route{
+        {
+            method: http.MethodGet, path: "/livez", tag: "System", scope: scopePublic,
+            summary: "Liveness check: the process is up, dependencies are not checked", handler: h.HealthCheck,
+            responses: []response{ok(HealthResponse{})},
+        },
+        {
+            method: http.MethodGet, path: "/readyz", tag: "System", scope: scopePublic,
+            summary: "Readiness check: database, schema version and background workers", handler: h.ReadinessCheck,
+            responses: []response{
+                ok(health.Report{}),
+                {status: http.StatusServiceUnavailable, description: "Not ready", body: health.Report{}},
+            },
+        },
+        {
+            method: http.MethodGet, path: "/health", tag: "System", scope: scopePublic,
+            summary: "Deprecated alias of /livez", handler: h.HealthCheck,
+            responses: []response{ok(HealthResponse{})},
+        },
+
+        // Teams
+        {
+            method: http.MethodPost, path: "/team/add", tag: "Teams", scope: auth.ScopeAdminTeams,
+            summary: "Create a team with members (users are created or updated)", handler: h.CreateTeam,
+            request: Team{}, idempotent: true,
+            responses: append([]response{created(TeamResponse{})}, fail(http.StatusBadRequest)...),
+        },
+        {
+            method: http.MethodGet, path: "/team/get", tag: "Teams", scope: auth.ScopeRead,
+            summary: "Get a team with members", handler: h.GetTeam,
+            query:     []param{{name: "team_name", typ: "string", required: true}},
+            responses: append([]response{ok(Team{})}, fail(http.StatusBadRequest, http.StatusNotFound)...),
+        },
+        {
+            method: http.MethodPost, path: "/teams/{team}/deactivate", tag: "Teams", scope: scopeAuthed,
+            summary: "Deactivate all team members, optionally reassigning their open reviews", handler: h.BulkDeactivateTeam,
+            request: DeactivateTeamRequest{}, idempotent: true, conditional: true,
+            responses: append([]response{noContent()}, fail(http.StatusBadRequest, http.StatusForbidden, http.StatusNotFound)...),
+        },
+        {
+            method: http.MethodPost, path: "/teams/sync", tag: "Teams", scope: auth.ScopeAdminTeams,
+            summary: "Apply a declarative team manifest", handler: h.SyncTeams,
+            query: []param{{name: "dry_run", typ: "boolean", description: "only return the planned diff"}},
+            request: service.TeamManifest{}, yaml: true, idempotent: true,
+            responses: append([]response{ok(SyncResponse{})}, fail(http.StatusBadRequest, http.StatusPreconditionFailed)...),
+        },
+
+        // Users
+        {
+            method: http.MethodPost, path: "/users/setIsActive", tag: "Users", scope: scopeAuthed,
+            summary: "Set user activity flag", handler: h.SetUserActive,
+            request: SetUserActiveRequest{}, idempotent: true,
+            responses: append([]response{ok(UserResponse{})}, fail(http.StatusBadRequest, http.StatusForbidden, http.StatusNotFound)...),
+        },
+        {
+            method: http.MethodGet, path: "/users/getReview", tag: "Users", scope: auth.ScopeRead,
+            summary: "List pull requests where the user is a reviewer", handler: h.GetUserReviews,
+            query:     []param{{name: "user_id", typ: "string", required: true}},
+            responses: append([]response{ok(UserReviewsResponse{})}, fail(http.StatusBadRequest, http.StatusNotFound)...),
+        },
+
+        // Pull requests
+        {
+            method: http.MethodPost, path: "/pullRequest/create", tag: "PullRequests", scope: auth.ScopeWritePRs,
+            summary: "Create a pull request and assign reviewers from the author's team (two by default, see reviewers.count)", handler: h.CreatePR,
+            request: CreatePRRequest{}, idempotent: true,
+            responses: append([]response{created(PullRequestResponse{})}, fail(http.StatusBadRequest, http.StatusNotFound, http.StatusConflict, http.StatusUnprocessableEntity)...),
+        },
+        {
+            method: http.MethodGet, path: "/pullRequest/get", tag: "PullRequests", scope: auth.ScopeRead,
+            summary: "Get a pull request with its reviewers", handler: h.GetPR,
+            query:     []param{{name: "pull_request_id", typ: "string", required: true}},
+            responses: append([]response{ok(PullRequestResponse{})}, fail(http.StatusBadRequest, http.StatusNotFound)...),
+        },
+        {
+            method: http.MethodPost, path: "/pullRequest/merge", tag: "PullRequests", scope: auth.ScopeWritePRs,
+            summary: "Mark a pull request as merged (idempotent)", handler: h.MergePR,
+            request: MergePRRequest{}, idempotent: true, conditional: true,
+            responses: append([]response{ok(PullRequestResponse{})}, fail(http.StatusBadRequest, http.StatusNotFound)...),
+        },
+        {
+            method: http.MethodPost, path: "/pullRequest/reassign", tag: "PullRequests", scope: auth.ScopeWritePRs,
+            summary: "Replace a reviewer with another active member of their team", handler: h.ReassignReviewer,
+            request: ReassignRequest{}, idempotent: true, conditional: true,
+            responses: append([]response{ok(ReassignResponse{})}, fail(http.StatusBadRequest, http.StatusForbidden, http.StatusNotFound, http.StatusConflict, http.StatusUnprocessableEntity)...),
+        },
+
+        // Stats
+        {
+            method: http.MethodGet, path: "/stats", tag: "Stats", scope: auth.ScopeRead,
+            summary: "Number of assignments per user", handler: h.GetStats,
+            responses: []response{ok(StatsResponse{})},
+        },
+
+        // API tokens
+        {
+            method: http.MethodPost, path: "/auth/tokens", tag: "Auth", scope: auth.ScopeAdmin,
+            summary: "Issue an API token", handler: h.CreateAPIToken,
+            request:   CreateTokenRequest{},
+            responses: append([]response{created(CreateTokenResponse{})}, fail(http.StatusBadRequest, http.StatusNotFound)...),
+        },
+        {
+            method: http.MethodGet, path: "/auth/tokens", tag: "Auth", scope: auth.ScopeAdmin,
+            summary: "List API tokens", handler: h.ListAPITokens,
+            responses: []response{ok(TokenListResponse{})},
+        },
+        {
+            method: http.MethodDelete, path: "/auth/tokens/{id}", tag: "Auth", scope: auth.ScopeAdmin,
+            summary: "Revoke an API token", handler: h.RevokeAPIToken,
+            responses: append([]response{noContent()}, fail(http.StatusBadRequest, http.StatusNotFound)...),
+        },
+
+        // Audit log
+        {
+            method: http.MethodGet, path: "/audit", tag: "Audit", scope: auth.ScopeAdmin,
+            summary: "List audit entries, newest first", handler: h.ListAudit,
+            query: []param{
+                {name: "actor", typ: "string"},
+                {name: "target_type", typ: "string"},
+                {name: "target", typ: "string", description: "target id"},
+                {name: "from", typ: "string", format: "date-time"},
+                {name: "to", typ: "string", format: "date-time"},
+                {name: "limit", typ: "integer", description: "default 100, maximum 1000"},
+            },
+            responses: append([]response{ok(AuditListResponse{})}, fail(http.StatusBadRequest)...),
+        },
+
+        // Admin
+        {
+            method: http.MethodGet, path: "/admin/config", tag: "Admin", scope: auth.ScopeAdmin,
+            summary: "Effective configuration with secrets redacted", handler: h.GetConfig,
+            responses: append([]response{ok(config.Config{})}, fail(http.StatusNotFound)...),
+        },
+
+        // Backup / restore
+        {
+            method: http.MethodGet, path: "/admin/export", tag: "Admin", scope: auth.ScopeAdmin,
+            summary: "Export teams, users, memberships, PRs, reviewers and assignment history as versioned JSON Lines", handler: h.ExportState,
+            responses: []response{jsonLines(service.SnapshotRecord{})},
+        },
+        {
+            method: http.MethodPost, path: "/admin/import", tag: "Admin", scope: auth.ScopeAdmin,
+            summary: "Import a snapshot produced by /admin/export", handler: h.ImportState,
+            query: []param{{name: "mode", typ: "string", description: "merge (default) overwrites matching records, replace deletes the current state first"}},
+            request: service.SnapshotRecord{}, ndjson: true,
+            responses: append([]response{ok(ImportResponse{})}, fail(http.StatusBadRequest)...),
+        },
+
+        // Event stream
+        {
+            method: http.MethodGet, path: "/events/stream", tag: "Events", scope: auth.ScopeRead,
+            summary: "Server-Sent Events for created and merged PRs and reviewer assignments", handler: h.StreamEvents,
+            query: []param{
+                {name: "team_name", typ: "string", description: "only PRs of this team"},
+                {name: "user_id", typ: "string", description: "only events where the user is the author, the new or the replaced reviewer"},
+                {name: "last_event_id", typ: "integer", description: "same as the Last-Event-ID header"},
+            },
+            headers: []param{
+                {name: "Last-Event-ID", typ: "integer", description: "replay persisted events after this id before streaming live ones"},
+            },
+            responses: append([]response{eventStream(Event{})}, fail(http.StatusBadRequest)...),
+        },
+    }
+}
+
+func (h *Handler) RegisterRoutes(r chi.Router) {
+    r.Get("/openapi.json", h.OpenAPI)
+
+    routes := h.routes()
+    for i, rt := range routes {
+        if rt.conditional {
+            routes[i].handler = h.conditional(routes[i].handler)
+        }
+        if rt.idempotent {
+            routes[i].handler = h.idempotent(routes[i].handler)
+        }
+    }
+    for _, rt := range routes {
+        if rt.scope == scopePublic {
+            r.Method(rt.method, rt.path, rt.handler)
+        }
+    }
+
+    // Everything else requires a bearer token
+    r.Group(func(r chi.Router) {
+        r.Use(auth.Middleware(h.authn))
+        for _, rt := range routes {
+            switch rt.scope {
+            case scopePublic:
+            case scopeAuthed:
+                r.Method(rt.method, rt.path, rt.handler)
+            default:
+                r.With(auth.Require(rt.scope)).Method(rt.method, rt.path, rt.handler)
+            }
+        }
+    })
+}
@@ -0,0 +1,57 @@
+package handlers
+
+import (
+    "log/slog"
+    "net/http"
+    "time"
+
+    "pr-review-assigner/internal/service"
+)
+
+// ExportState streams the whole state as JSON Lines; the header line carries
+// the format version and record counts so a truncated file is rejected on import
+func (h *Handler) ExportState(w http.ResponseWriter, r *http.Request) {
+    snap, err := h.svc.ExportSnapshot(r.Context())
+    if err != nil {
+        h.sendError(w, r, err)
+        return
+    }
+
+    // Large exports may take longer than the server write timeout
+    http.NewResponseController(w).SetWriteDeadline(time.Time{})
+
+    filename := "pr-review-assigner-" + snap.Header.ExportedAt.Format("20060102-150405") + ".jsonl"
+    w.Header().Set("Content-Type", "application/x-ndjson")
+    w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+    w.WriteHeader(http.StatusOK)
+    if err := service.WriteSnapshot(w, snap); err != nil {
+        // Headers are already sent; the client sees a short file and import will reject it
+        slog.ErrorContext(r.Context(), "export: write snapshot", "error", err)
+    }
+}
+
+// ImportState loads a snapshot in a single transaction; nothing is applied if any check fails
+func (h *Handler) ImportState(w http.ResponseWriter, r *http.Request) {
+    mode := r.URL.Query().Get("mode")
+    if mode == "" {
+        mode = service.ImportMerge
+    }
+    if mode != service.ImportMerge && mode != service.ImportReplace {
+        h.sendError(w, r, service.InvalidField("mode", "must be merge or replace"))
+        return
+    }
+
+    snap, err := service.ReadSnapshot(r.Body)
+    if err != nil {
+        h.sendError(w, r, err)
+        return
+    }
+
+    result, err := h.svc.ImportSnapshot(r.Context(), snap, mode)
+    if err != nil {
+        h.sendError(w, r, err)
+        return
+    }
+
+    h.writeJSON(w, http.StatusOK, ImportResponse{Import: result})
+}
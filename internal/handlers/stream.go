@@ -0,0 +1,135 @@
+package handlers
+
+import (
+    "encoding/json"
+    "errors"
+    "fmt"
+    "log/slog"
+    "net/http"
+    "strconv"
+    "time"
+
+    "pr-review-assigner/internal/events"
+    "pr-review-assigner/internal/service"
+)
+
+const (
+    // keepAliveInterval keeps idle connections open through proxies that drop silent streams
+    keepAliveInterval = 15 * time.Second
+    // replayPageSize is how many persisted events are read at a time when a client resumes
+    replayPageSize = 1000
+)
+
+// StreamEvents pushes PR events as Server-Sent Events, optionally filtered by
+// team_name and user_id. A client that sends Last-Event-ID (or last_event_id)
+// first receives the persisted events it missed, then live ones.
+func (h *Handler) StreamEvents(w http.ResponseWriter, r *http.Request) {
+    flusher, ok := w.(http.Flusher)
+    if !ok {
+        h.sendError(w, r, errors.New("streaming is not supported by the response writer"))
+        return
+    }
+
+    q := r.URL.Query()
+    teamName, userID := q.Get("team_name"), q.Get("user_id")
+
+    lastEventID := r.Header.Get("Last-Event-ID")
+    if lastEventID == "" {
+        lastEventID = q.Get("last_event_id")
+    }
+    resume := lastEventID != ""
+    var lastID int64
+    if resume {
+        var err error
+        lastID, err = strconv.ParseInt(lastEventID, 10, 64)
+        if err != nil || lastID < 0 {
+            h.sendError(w, r, service.InvalidField("Last-Event-ID", "must be a non-negative integer"))
+            return
+        }
+    }
+
+    // Subscribe before reading the history so nothing committed in between is lost.
+    // Events up to published were sent before the subscription and cannot arrive live.
+    published := h.svc.Events.LastID()
+    ch, unsubscribe := h.svc.Events.Subscribe()
+    defer unsubscribe()
+
+    filter := service.EventFilter{AfterID: lastID, TeamName: teamName, UserID: userID, Limit: replayPageSize}
+    var page []events.Event
+    if resume {
+        var err error
+        page, err = h.svc.ListEvents(r.Context(), filter)
+        if err != nil {
+            h.sendError(w, r, err)
+            return
+        }
+    }
+
+    // The stream outlives the server write timeout by design
+    http.NewResponseController(w).SetWriteDeadline(time.Time{})
+
+    w.Header().Set("Content-Type", "text/event-stream")
+    w.Header().Set("Cache-Control", "no-cache")
+    w.Header().Set("X-Accel-Buffering", "no")
+    w.WriteHeader(http.StatusOK)
+
+    // The history is replayed page by page until it is exhausted. IDs are not guaranteed to commit
+    // in order, so live events are skipped by the IDs actually replayed, not by the highest one:
+    // an event with a lower ID committed after its page was read still arrives live. Only IDs the
+    // live channel can still deliver are kept, so resuming from an old ID does not hold the history.
+    delivered := map[int64]struct{}{}
+    for {
+        for _, e := range page {
+            writeEvent(w, e)
+            if e.ID > published {
+                delivered[e.ID] = struct{}{}
+            }
+        }
+        flusher.Flush()
+        if len(page) < replayPageSize {
+            break
+        }
+
+        filter.AfterID = page[len(page)-1].ID
+        var err error
+        page, err = h.svc.ListEvents(r.Context(), filter)
+        if err != nil {
+            // The status is already sent; the client reconnects with the last delivered id
+            slog.WarnContext(r.Context(), "failed to replay events", "error", err)
+            return
+        }
+    }
+
+    keepAlive := time.NewTicker(keepAliveInterval)
+    defer keepAlive.Stop()
+
+    for {
+        select {
+        case <-r.Context().Done():
+            return
+        case <-keepAlive.C:
+            fmt.Fprint(w, ": keep-alive\n\n")
+            flusher.Flush()
+        case e, ok := <-ch:
+            if !ok {
+                // Shutdown, or the client fell behind: it reconnects with Last-Event-ID and catches up from the history
+                return
+            }
+            if _, replayed := delivered[e.ID]; replayed {
+                // Every event is published once, so the id is not needed any more
+                delete(delivered, e.ID)
+                continue
+            }
+            if !e.Matches(teamName, userID) {
+                continue
+            }
+            writeEvent(w, e)
+            flusher.Flush()
+        }
+    }
+}
+
+func writeEvent(w http.ResponseWriter, e events.Event) {
+    data, _ := json.Marshal(toEvent(e))
+    fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", e.ID, e.Type, data)
+}
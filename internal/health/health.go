@@ -0,0 +1,166 @@
+// Package health собирает проверки готовности: доступность базы, версию схемы и состояние фоновых задач.
+// Оркестратор снимает трафик с экземпляра, пока хотя бы одна проверка не проходит.
+package health
+
+import (
+    "context"
+    "errors"
+    "sync"
+    "time"
+)
+
+const (
+    StatusOK   = "ok"
+    StatusFail = "fail"
+)
+
+// defaultTimeout ограничивает каждую проверку, чтобы зависшая база не держала запрос оркестратора
+const defaultTimeout = 2 * time.Second
+
+// ErrShuttingDown - экземпляр останавливается и новых запросов не ждет
+var ErrShuttingDown = errors.New("shutting down")
+
+// Check возвращает nil, если зависимость готова
+type Check func(ctx context.Context) error
+
+// Result - итог одной проверки
+type Result struct {
+    Status     string `json:"status" enum:"ok,fail"`
+    Error      string `json:"error,omitempty"`
+    DurationMS int64  `json:"duration_ms"`
+}
+
+// Report - итог всех проверок; Status равен ok, только если прошли все
+type Report struct {
+    Status string            `json:"status" enum:"ok,fail"`
+    Checks map[string]Result `json:"checks"`
+}
+
+type named struct {
+    name  string
+    check Check
+}
+
+// Checker выполняет зарегистрированные проверки параллельно
+type Checker struct {
+    Timeout time.Duration
+
+    mu           sync.Mutex
+    checks       []named
+    shuttingDown bool
+}
+
+func NewChecker() *Checker {
+    return &Checker{Timeout: defaultTimeout}
+}
+
+// Add регистрирует проверку под именем, которое появится в отчете
+func (c *Checker) Add(name string, check Check) {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    c.checks = append(c.checks, named{name, check})
+}
+
+// Worker регистрирует фоновую задачу и возвращает ее состояние; проверка проходит, пока задача запущена
+func (c *Checker) Worker(name string) *Worker {
+    w := &Worker{}
+    c.Add("worker:"+name, w.check)
+    return w
+}
+
+// ShutDown отмечает начало остановки: дальше экземпляр сообщает, что не готов
+func (c *Checker) ShutDown() {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    c.shuttingDown = true
+}
+
+// Run выполняет все проверки с таймаутом Timeout каждая
+func (c *Checker) Run(ctx context.Context) Report {
+    c.mu.Lock()
+    checks := append([]named(nil), c.checks...)
+    shuttingDown := c.shuttingDown
+    c.mu.Unlock()
+
+    report := Report{Status: StatusOK, Checks: make(map[string]Result, len(checks)+1)}
+    if shuttingDown {
+        report.Checks["shutdown"] = Result{Status: StatusFail, Error: ErrShuttingDown.Error()}
+    }
+
+    results := make([]Result, len(checks))
+    var wg sync.WaitGroup
+    for i, nc := range checks {
+        wg.Add(1)
+        go func(i int, check Check) {
+            defer wg.Done()
+            results[i] = c.run(ctx, check)
+        }(i, nc.check)
+    }
+    wg.Wait()
+
+    for i, nc := range checks {
+        report.Checks[nc.name] = results[i]
+    }
+    for _, r := range report.Checks {
+        if r.Status != StatusOK {
+            report.Status = StatusFail
+        }
+    }
+    return report
+}
+
+func (c *Checker) run(ctx context.Context, check Check) Result {
+    ctx, cancel := context.WithTimeout(ctx, c.Timeout)
+    defer cancel()
+
+    start := time.Now()
+    errc := make(chan error, 1)
+    // Проверка может не уважать контекст; ответ оркестратору все равно уходит по таймауту
+    go func() { errc <- check(ctx) }()
+    var err error
+    select {
+    case err = <-errc:
+    case <-ctx.Done():
+        err = ctx.Err()
+    }
+
+    r := Result{Status: StatusOK, DurationMS: time.Since(start).Milliseconds()}
+    if err != nil {
+        r.Status, r.Error = StatusFail, err.Error()
+    }
+    return r
+}
+
+// Worker - состояние фоновой задачи для проверки готовности
+type Worker struct {
+    mu      sync.Mutex
+    running bool
+    err     error
+}
+
+// Started отмечает, что задача работает
+func (w *Worker) Started() {
+    w.mu.Lock()
+    defer w.mu.Unlock()
+    w.running, w.err = true, nil
+}
+
+// Stopped отмечает завершение задачи; err - причина, если она упала
+func (w *Worker) Stopped(err error) {
+    w.mu.Lock()
+    defer w.mu.Unlock()
+    w.running, w.err = false, err
+}
+
+func (w *Worker) check(context.Context) error {
+    w.mu.Lock()
+    defer w.mu.Unlock()
+    switch {
+    case w.running:
+        return nil
+    case w.err != nil:
+        return w.err
+    default:
+        return errors.New("not running")
+    }
+}
@@ -0,0 +1,63 @@
+package health
+
+import (
+    "context"
+    "errors"
+    "testing"
+    "time"
+)
+
+func TestRun(t *testing.T) {
+    c := NewChecker()
+    c.Timeout = 50 * time.Millisecond
+    c.Add("database", func(ctx context.Context) error { return nil })
+
+    if r := c.Run(context.Background()); r.Status != StatusOK || r.Checks["database"].Status != StatusOK {
+        t.Fatalf("expected ok, got %+v", r)
+    }
+
+    // Зависшая проверка завершается по таймауту, даже если не смотрит на контекст
+    block := make(chan struct{})
+    defer close(block)
+    c.Add("slow", func(ctx context.Context) error { <-block; return nil })
+    c.Add("migrations", func(ctx context.Context) error { return errors.New("database at version 4, binary expects 5") })
+
+    start := time.Now()
+    r := c.Run(context.Background())
+    if time.Since(start) > time.Second {
+        t.Error("expected checks to run in parallel with a timeout")
+    }
+    if r.Status != StatusFail || r.Checks["database"].Status != StatusOK {
+        t.Errorf("unexpected report %+v", r)
+    }
+    if r.Checks["slow"].Error != context.DeadlineExceeded.Error() {
+        t.Errorf("expected timeout for slow check, got %+v", r.Checks["slow"])
+    }
+    if r.Checks["migrations"].Error != "database at version 4, binary expects 5" {
+        t.Errorf("expected the check error in the report, got %+v", r.Checks["migrations"])
+    }
+}
+
+func TestWorkerAndShutdown(t *testing.T) {
+    c := NewChecker()
+    w := c.Worker("notifier")
+    ctx := context.Background()
+
+    if r := c.Run(ctx); r.Checks["worker:notifier"].Error != "not running" {
+        t.Errorf("expected worker not running before start, got %+v", r)
+    }
+    w.Started()
+    if r := c.Run(ctx); r.Status != StatusOK {
+        t.Errorf("expected ok with a running worker, got %+v", r)
+    }
+    w.Stopped(errors.New("broker closed"))
+    if r := c.Run(ctx); r.Checks["worker:notifier"].Error != "broker closed" {
+        t.Errorf("expected the stop reason, got %+v", r)
+    }
+
+    w.Started()
+    c.ShutDown()
+    if r := c.Run(ctx); r.Status != StatusFail || r.Checks["shutdown"].Error != ErrShuttingDown.Error() {
+        t.Errorf("expected not ready during shutdown, got %+v", r)
+    }
+}
@@ -0,0 +1,120 @@
+// Package logging настраивает структурированные логи slog: каждая запись, сделанная с контекстом запроса,
+// получает его request_id (и trace_id, если включена трассировка), поэтому строки хендлера, сервиса
+// и репозитория одного запроса связываются между собой.
+package logging
+
+import (
+    "context"
+    "fmt"
+    "io"
+    "log/slog"
+    "net/http"
+    "strings"
+    "time"
+
+    "github.com/go-chi/chi/v5"
+    "github.com/go-chi/chi/v5/middleware"
+    "go.opentelemetry.io/otel/trace"
+
+    "pr-review-assigner/internal/reqmeta"
+)
+
+const (
+    FormatJSON = "json"
+    FormatText = "text"
+)
+
+// Levels и Formats - допустимые значения настроек
+var (
+    Levels  = []string{"debug", "info", "warn", "error"}
+    Formats = []string{FormatJSON, FormatText}
+)
+
+// ParseLevel разбирает уровень из настроек: debug, info, warn или error
+func ParseLevel(s string) (slog.Level, error) {
+    var l slog.Level
+    if err := l.UnmarshalText([]byte(s)); err != nil {
+        return 0, fmt.Errorf("unknown log level %q, expected %s", s, strings.Join(Levels, ", "))
+    }
+    return l, nil
+}
+
+// New создает логгер, пишущий в w в формате json или text
+func New(w io.Writer, level, format string) (*slog.Logger, error) {
+    l, err := ParseLevel(level)
+    if err != nil {
+        return nil, err
+    }
+    opts := &slog.HandlerOptions{Level: l}
+    var h slog.Handler
+    switch format {
+    case FormatJSON:
+        h = slog.NewJSONHandler(w, opts)
+    case FormatText:
+        h = slog.NewTextHandler(w, opts)
+    default:
+        return nil, fmt.Errorf("unknown log format %q, expected %s", format, strings.Join(Formats, " or "))
+    }
+    return slog.New(contextHandler{h}), nil
+}
+
+// contextHandler добавляет к записи request_id и trace_id из контекста
+type contextHandler struct {
+    slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, r slog.Record) error {
+    if id := reqmeta.FromContext(ctx).RequestID; id != "" {
+        r.AddAttrs(slog.String("request_id", id))
+    }
+    if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+        r.AddAttrs(slog.String("trace_id", sc.TraceID().String()))
+    }
+    return h.Handler.Handle(ctx, r)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+    return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+    return contextHandler{h.Handler.WithGroup(name)}
+}
+
+// AccessLog пишет строку на каждый запрос: маршрут, статус, длительность и размер ответа.
+// Ставится после reqmeta.Middleware, чтобы в строке был request_id; 5xx пишутся как error, 4xx - как warn.
+func AccessLog(logger *slog.Logger) func(http.Handler) http.Handler {
+    return func(next http.Handler) http.Handler {
+        return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+            start := time.Now()
+            ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+            next.ServeHTTP(ww, r)
+
+            status := ww.Status()
+            if status == 0 {
+                status = http.StatusOK
+            }
+            level := slog.LevelInfo
+            switch {
+            case status >= 500:
+                level = slog.LevelError
+            case status >= 400:
+                level = slog.LevelWarn
+            }
+            // Шаблон маршрута известен только после роутинга; по нему удобно группировать в отличие от пути
+            route := ""
+            if rc := chi.RouteContext(r.Context()); rc != nil {
+                route = rc.RoutePattern()
+            }
+            logger.LogAttrs(r.Context(), level, "request",
+                slog.String("method", r.Method),
+                slog.String("route", route),
+                slog.String("path", r.URL.Path),
+                slog.Int("status", status),
+                slog.Float64("duration_ms", float64(time.Since(start).Microseconds())/1000),
+                slog.Int("bytes", ww.BytesWritten()),
+                slog.String("ip", reqmeta.FromContext(r.Context()).SourceIP),
+            )
+        })
+    }
+}
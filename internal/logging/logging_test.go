@@ -0,0 +1,64 @@
+package logging
+
+import (
+    "bytes"
+    "encoding/json"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "testing"
+
+    "github.com/go-chi/chi/v5"
+
+    "pr-review-assigner/internal/reqmeta"
+)
+
+// Строка из хендлера и строка access-лога одного запроса связаны общим request_id
+func TestAccessLogCarriesRequestID(t *testing.T) {
+    var buf bytes.Buffer
+    logger, err := New(&buf, "info", FormatJSON)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    r := chi.NewRouter()
+    r.Use(reqmeta.Middleware, AccessLog(logger))
+    r.Get("/pullRequest/{id}", func(w http.ResponseWriter, r *http.Request) {
+        logger.InfoContext(r.Context(), "looking up PR")
+        http.Error(w, "not found", http.StatusNotFound)
+    })
+
+    req := httptest.NewRequest(http.MethodGet, "/pullRequest/pr-1", nil)
+    req.Header.Set(reqmeta.HeaderRequestID, "req-42")
+    r.ServeHTTP(httptest.NewRecorder(), req)
+
+    lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+    if len(lines) != 2 {
+        t.Fatalf("expected 2 log lines, got %q", buf.String())
+    }
+    var inner, access map[string]interface{}
+    if err := json.Unmarshal([]byte(lines[0]), &inner); err != nil {
+        t.Fatal(err)
+    }
+    if err := json.Unmarshal([]byte(lines[1]), &access); err != nil {
+        t.Fatal(err)
+    }
+    if inner["request_id"] != "req-42" || access["request_id"] != "req-42" {
+        t.Errorf("expected request_id on both lines, got %v and %v", inner, access)
+    }
+    if access["route"] != "/pullRequest/{id}" || access["path"] != "/pullRequest/pr-1" || access["status"] != float64(404) || access["level"] != "WARN" {
+        t.Errorf("unexpected access log %v", access)
+    }
+    if _, ok := access["duration_ms"]; !ok {
+        t.Errorf("expected duration_ms in %v", access)
+    }
+}
+
+func TestNewRejectsUnknownSettings(t *testing.T) {
+    if _, err := New(&bytes.Buffer{}, "verbose", FormatJSON); err == nil {
+        t.Error("expected unknown level error")
+    }
+    if _, err := New(&bytes.Buffer{}, "debug", "xml"); err == nil {
+        t.Error("expected unknown format error")
+    }
+}
@@ -0,0 +1,278 @@
+// Package migrate применяет встроенные SQL-миграции вида NNNN_name.up.sql / NNNN_name.down.sql.
+// Версия хранится в таблице schema_migrations в том же формате, что у migrate/migrate,
+// поэтому базы, мигрированные контейнером, продолжают обновляться без ручных шагов.
+package migrate
+
+import (
+    "context"
+    "database/sql"
+    "errors"
+    "fmt"
+    "io/fs"
+    "path"
+    "sort"
+    "strconv"
+    "strings"
+
+    "github.com/jackc/pgx/v5/pgconn"
+    "github.com/jmoiron/sqlx"
+)
+
+// ErrDirty - предыдущий запуск migrate/migrate упал посреди миграции; схему нужно поправить вручную
+var ErrDirty = errors.New("database is in a dirty migration state")
+
+// lockKey - ключ pg_advisory_lock, общий для всех реплик сервиса
+const lockKey = 7402113
+
+// Migration - одна версия схемы
+type Migration struct {
+    Version int64
+    Name    string
+    Up      string
+    Down    string
+}
+
+// Status - состояние схемы относительно встроенных миграций
+type Status struct {
+    Current int64       `json:"current"`
+    Latest  int64       `json:"latest"`
+    Dirty   bool        `json:"dirty"`
+    Pending []Migration `json:"-"`
+}
+
+// UpToDate сообщает, что применены все миграции бинарника и ни одна не прервана
+func (s Status) UpToDate() bool {
+    return !s.Dirty && s.Current == s.Latest
+}
+
+// Runner применяет миграции к одной базе
+type Runner struct {
+    db         *sqlx.DB
+    migrations []Migration
+}
+
+// New читает миграции из корня fsys
+func New(db *sqlx.DB, fsys fs.FS) (*Runner, error) {
+    migrations, err := Load(fsys)
+    if err != nil {
+        return nil, err
+    }
+    return &Runner{db: db, migrations: migrations}, nil
+}
+
+// Load читает и проверяет миграции из корня fsys, упорядочивая их по версии
+func Load(fsys fs.FS) ([]Migration, error) {
+    files, err := fs.Glob(fsys, "*.sql")
+    if err != nil {
+        return nil, err
+    }
+    byVersion := map[int64]*Migration{}
+    for _, file := range files {
+        base := path.Base(file)
+        prefix, rest, ok := strings.Cut(base, "_")
+        version, err := strconv.ParseInt(prefix, 10, 64)
+        if !ok || err != nil || version <= 0 {
+            return nil, fmt.Errorf("migration %s: name must start with a positive version", base)
+        }
+        name, direction, ok := strings.Cut(strings.TrimSuffix(rest, ".sql"), ".")
+        if !ok || (direction != "up" && direction != "down") {
+            return nil, fmt.Errorf("migration %s: expected .up.sql or .down.sql", base)
+        }
+        data, err := fs.ReadFile(fsys, file)
+        if err != nil {
+            return nil, err
+        }
+
+        m := byVersion[version]
+        if m == nil {
+            m = &Migration{Version: version, Name: name}
+            byVersion[version] = m
+        }
+        if direction == "up" {
+            m.Up = string(data)
+        } else {
+            m.Down = string(data)
+        }
+    }
+
+    migrations := make([]Migration, 0, len(byVersion))
+    for _, m := range byVersion {
+        if m.Up == "" {
+            return nil, fmt.Errorf("migration %d_%s: missing up script", m.Version, m.Name)
+        }
+        migrations = append(migrations, *m)
+    }
+    sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+    return migrations, nil
+}
+
+// Latest - версия последней встроенной миграции
+func (r *Runner) Latest() int64 {
+    if len(r.migrations) == 0 {
+        return 0
+    }
+    return r.migrations[len(r.migrations)-1].Version
+}
+
+// Status возвращает текущую версию и еще не примененные миграции; схему не меняет,
+// поэтому подходит и для пользователя базы только на чтение
+func (r *Runner) Status(ctx context.Context) (Status, error) {
+    var st Status
+    err := r.withConn(ctx, false, func(conn *sqlx.Conn) error {
+        var err error
+        st, err = r.status(ctx, conn)
+        return err
+    })
+    return st, err
+}
+
+// Check возвращает ошибку, если версия схемы не совпадает с миграциями бинарника; подходит для проверки готовности
+func (r *Runner) Check(ctx context.Context) error {
+    st, err := r.Status(ctx)
+    if err != nil {
+        return err
+    }
+    if st.Dirty {
+        return fmt.Errorf("%w at version %d", ErrDirty, st.Current)
+    }
+    if st.Current != st.Latest {
+        return fmt.Errorf("database schema is at version %d, binary expects %d", st.Current, st.Latest)
+    }
+    return nil
+}
+
+// Up применяет все недостающие миграции и возвращает примененные
+func (r *Runner) Up(ctx context.Context) ([]Migration, error) {
+    var applied []Migration
+    err := r.withConn(ctx, true, func(conn *sqlx.Conn) error {
+        st, err := r.status(ctx, conn)
+        if err != nil {
+            return err
+        }
+        if st.Dirty {
+            return fmt.Errorf("%w at version %d", ErrDirty, st.Current)
+        }
+        for _, m := range st.Pending {
+            if err := r.apply(ctx, conn, m.Up, m.Version); err != nil {
+                return fmt.Errorf("migration %d_%s up: %w", m.Version, m.Name, err)
+            }
+            applied = append(applied, m)
+        }
+        return nil
+    })
+    return applied, err
+}
+
+// Down откатывает одну последнюю примененную миграцию; nil, если откатывать нечего
+func (r *Runner) Down(ctx context.Context) (*Migration, error) {
+    var reverted *Migration
+    err := r.withConn(ctx, true, func(conn *sqlx.Conn) error {
+        st, err := r.status(ctx, conn)
+        if err != nil {
+            return err
+        }
+        if st.Dirty {
+            return fmt.Errorf("%w at version %d", ErrDirty, st.Current)
+        }
+        if st.Current == 0 {
+            return nil
+        }
+
+        var previous int64
+        for i, m := range r.migrations {
+            if m.Version != st.Current {
+                continue
+            }
+            if m.Down == "" {
+                return fmt.Errorf("migration %d_%s has no down script", m.Version, m.Name)
+            }
+            if i > 0 {
+                previous = r.migrations[i-1].Version
+            }
+            if err := r.apply(ctx, conn, m.Down, previous); err != nil {
+                return fmt.Errorf("migration %d_%s down: %w", m.Version, m.Name, err)
+            }
+            reverted = &m
+            return nil
+        }
+        return fmt.Errorf("database version %d is not known to this binary", st.Current)
+    })
+    return reverted, err
+}
+
+// withConn выполняет fn на одном соединении; с lock в Postgres берет advisory lock,
+// чтобы реплики, стартующие одновременно, применяли миграции по очереди, и создает schema_migrations
+func (r *Runner) withConn(ctx context.Context, lock bool, fn func(conn *sqlx.Conn) error) error {
+    conn, err := r.db.Connx(ctx)
+    if err != nil {
+        return err
+    }
+    defer conn.Close()
+
+    if lock && r.postgres() {
+        if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", lockKey); err != nil {
+            return fmt.Errorf("advisory lock: %w", err)
+        }
+        // Блокировка сессионная: снимаем ее, даже если контекст уже отменен
+        defer conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", lockKey)
+    }
+
+    if lock {
+        if _, err := conn.ExecContext(ctx,
+            "CREATE TABLE IF NOT EXISTS schema_migrations (version BIGINT NOT NULL PRIMARY KEY, dirty BOOLEAN NOT NULL)"); err != nil {
+            return err
+        }
+    }
+    return fn(conn)
+}
+
+func (r *Runner) postgres() bool {
+    return r.db.DriverName() == "pgx" || r.db.DriverName() == "postgres"
+}
+
+func (r *Runner) status(ctx context.Context, conn *sqlx.Conn) (Status, error) {
+    st := Status{Latest: r.Latest()}
+    err := conn.QueryRowxContext(ctx, "SELECT version, dirty FROM schema_migrations LIMIT 1").Scan(&st.Current, &st.Dirty)
+    // Нет таблицы - миграции еще не запускались: версия 0
+    if err != nil && !errors.Is(err, sql.ErrNoRows) && !undefinedTable(err) {
+        return st, err
+    }
+    for _, m := range r.migrations {
+        if m.Version > st.Current {
+            st.Pending = append(st.Pending, m)
+        }
+    }
+    return st, nil
+}
+
+// undefinedTable распознает отсутствующую таблицу: код 42P01 в Postgres, текст ошибки в SQLite
+func undefinedTable(err error) bool {
+    var pgErr *pgconn.PgError
+    if errors.As(err, &pgErr) {
+        return pgErr.Code == "42P01"
+    }
+    return strings.Contains(err.Error(), "no such table")
+}
+
+// apply выполняет скрипт и записывает новую версию в одной транзакции:
+// при ошибке схема и версия остаются прежними
+func (r *Runner) apply(ctx context.Context, conn *sqlx.Conn, script string, version int64) error {
+    tx, err := conn.BeginTxx(ctx, nil)
+    if err != nil {
+        return err
+    }
+    defer tx.Rollback()
+
+    if _, err := tx.ExecContext(ctx, script); err != nil {
+        return err
+    }
+    if _, err := tx.ExecContext(ctx, "DELETE FROM schema_migrations"); err != nil {
+        return err
+    }
+    if version > 0 {
+        if _, err := tx.ExecContext(ctx, "INSERT INTO schema_migrations (version, dirty) VALUES ($1, $2)", version, false); err != nil {
+            return err
+        }
+    }
+    return tx.Commit()
+}
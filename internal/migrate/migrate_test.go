@@ -0,0 +1,146 @@
+package migrate
+
+import (
+    "context"
+    "errors"
+    "path/filepath"
+    "testing"
+    "testing/fstest"
+
+    "github.com/jmoiron/sqlx"
+    _ "modernc.org/sqlite"
+)
+
+func openDB(t *testing.T) *sqlx.DB {
+    t.Helper()
+    db, err := sqlx.Open("sqlite", "file:"+filepath.Join(t.TempDir(), "test.db"))
+    if err != nil {
+        t.Fatal(err)
+    }
+    t.Cleanup(func() { db.Close() })
+    return db
+}
+
+var testMigrations = fstest.MapFS{
+    "0001_items.up.sql":   {Data: []byte("CREATE TABLE items (id INTEGER PRIMARY KEY);")},
+    "0001_items.down.sql": {Data: []byte("DROP TABLE items;")},
+    "0002_names.up.sql":   {Data: []byte("ALTER TABLE items ADD COLUMN name TEXT; CREATE INDEX idx_items_name ON items(name);")},
+    "0002_names.down.sql": {Data: []byte("DROP INDEX idx_items_name; ALTER TABLE items DROP COLUMN name;")},
+    "0010_tags.up.sql":    {Data: []byte("CREATE TABLE tags (item_id INTEGER REFERENCES items(id));")},
+    "0010_tags.down.sql":  {Data: []byte("DROP TABLE tags;")},
+}
+
+func TestUpDownStatus(t *testing.T) {
+    ctx := context.Background()
+    db := openDB(t)
+    r, err := New(db, testMigrations)
+    if err != nil {
+        t.Fatalf("New: %v", err)
+    }
+
+    st, err := r.Status(ctx)
+    if err != nil || st.Current != 0 || st.Latest != 10 || len(st.Pending) != 3 || st.UpToDate() {
+        t.Fatalf("unexpected initial status %+v, %v", st, err)
+    }
+
+    if err := r.Check(ctx); err == nil {
+        t.Error("expected Check to fail before migrations are applied")
+    }
+    // Status и Check только читают: таблица версий появляется лишь при Up
+    var tables int
+    if err := db.Get(&tables, "SELECT count(*) FROM sqlite_master WHERE name = 'schema_migrations'"); err != nil || tables != 0 {
+        t.Errorf("expected Status not to create schema_migrations, got %d tables, %v", tables, err)
+    }
+
+    applied, err := r.Up(ctx)
+    if err != nil || len(applied) != 3 || applied[2].Version != 10 {
+        t.Fatalf("expected three migrations applied, got %+v, %v", applied, err)
+    }
+    if _, err := db.Exec("INSERT INTO items (id, name) VALUES (1, 'a')"); err != nil {
+        t.Fatalf("schema not applied: %v", err)
+    }
+
+    // Повторный запуск ничего не делает
+    if applied, err := r.Up(ctx); err != nil || len(applied) != 0 {
+        t.Fatalf("expected no-op, got %+v, %v", applied, err)
+    }
+    if st, _ := r.Status(ctx); !st.UpToDate() || st.Current != 10 {
+        t.Errorf("expected up to date at 10, got %+v", st)
+    }
+    if err := r.Check(ctx); err != nil {
+        t.Errorf("expected Check to pass, got %v", err)
+    }
+
+    // Down откатывает ровно одну миграцию
+    reverted, err := r.Down(ctx)
+    if err != nil || reverted == nil || reverted.Version != 10 {
+        t.Fatalf("expected 0010 to be reverted, got %+v, %v", reverted, err)
+    }
+    if st, _ := r.Status(ctx); st.Current != 2 || len(st.Pending) != 1 {
+        t.Errorf("expected version 2 with one pending, got %+v", st)
+    }
+    r.Down(ctx)
+    r.Down(ctx)
+    if reverted, err := r.Down(ctx); err != nil || reverted != nil {
+        t.Errorf("expected nothing to revert, got %+v, %v", reverted, err)
+    }
+    var count int
+    db.Get(&count, "SELECT COUNT(*) FROM schema_migrations")
+    if count != 0 {
+        t.Errorf("expected no version row after full rollback, got %d", count)
+    }
+}
+
+func TestFailedMigrationKeepsVersion(t *testing.T) {
+    ctx := context.Background()
+    db := openDB(t)
+    fsys := fstest.MapFS{
+        "0001_items.up.sql":  testMigrations["0001_items.up.sql"],
+        "0002_broken.up.sql": {Data: []byte("CREATE TABLE other (id INTEGER); SELECT * FROM missing;")},
+    }
+    r, err := New(db, fsys)
+    if err != nil {
+        t.Fatalf("New: %v", err)
+    }
+
+    if _, err := r.Up(ctx); err == nil {
+        t.Fatal("expected broken migration to fail")
+    }
+    if st, _ := r.Status(ctx); st.Current != 1 || st.Dirty {
+        t.Errorf("expected clean version 1 after failure, got %+v", st)
+    }
+    var count int
+    db.Get(&count, "SELECT COUNT(*) FROM sqlite_master WHERE name = 'other'")
+    if count != 0 {
+        t.Error("expected partial migration to be rolled back")
+    }
+}
+
+func TestDirtyDatabase(t *testing.T) {
+    ctx := context.Background()
+    db := openDB(t)
+    r, _ := New(db, testMigrations)
+    db.MustExec("CREATE TABLE schema_migrations (version BIGINT NOT NULL PRIMARY KEY, dirty BOOLEAN NOT NULL)")
+
+    // Так оставляет базу migrate/migrate после упавшей миграции
+    db.MustExec("INSERT INTO schema_migrations (version, dirty) VALUES (2, TRUE)")
+    if _, err := r.Up(ctx); !errors.Is(err, ErrDirty) {
+        t.Errorf("expected ErrDirty from Up, got %v", err)
+    }
+    if _, err := r.Down(ctx); !errors.Is(err, ErrDirty) {
+        t.Errorf("expected ErrDirty from Down, got %v", err)
+    }
+}
+
+func TestInvalidNames(t *testing.T) {
+    for name, fsys := range map[string]fstest.MapFS{
+        "no version":    {"items.up.sql": {}},
+        "zero version":  {"0000_items.up.sql": {}},
+        "bad direction": {"0001_items.sideways.sql": {}},
+        "down only":     {"0001_items.down.sql": {Data: []byte("DROP TABLE items;")}},
+    } {
+        if _, err := New(nil, fsys); err == nil {
+            t.Errorf("%s: expected error", name)
+        }
+    }
+}
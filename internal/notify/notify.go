@@ -0,0 +1,137 @@
+// Package notify пересылает события по PR во внешние системы (чат-боты, CI) через вебхуки
+package notify
+
+import (
+    "bytes"
+    "context"
+    "crypto/hmac"
+    "crypto/sha256"
+    "encoding/hex"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "log/slog"
+    "net/http"
+    "net/url"
+    "time"
+
+    "pr-review-assigner/internal/events"
+)
+
+// SignatureHeader содержит HMAC-SHA256 тела запроса, если у цели задан секрет
+const SignatureHeader = "X-Signature-256"
+
+// Target - адрес, на который отправляются события
+type Target struct {
+    URL    string   `yaml:"url" json:"url"`
+    Secret string   `yaml:"secret" json:"secret,omitempty"` // ключ подписи, пустой - без подписи
+    Events []string `yaml:"events" json:"events,omitempty"` // типы событий, пустой список - все
+}
+
+func (t Target) wants(eventType string) bool {
+    if len(t.Events) == 0 {
+        return true
+    }
+    for _, e := range t.Events {
+        if e == eventType {
+            return true
+        }
+    }
+    return false
+}
+
+func (t Target) host() string {
+    u, err := url.Parse(t.URL)
+    if err != nil {
+        return ""
+    }
+    return u.Host
+}
+
+// redactURL убирает адрес из ошибки http.Client, чтобы он не попал в лог вместе с токеном
+func redactURL(err error) error {
+    var uerr *url.Error
+    if errors.As(err, &uerr) {
+        return fmt.Errorf("%s: %w", uerr.Op, uerr.Err)
+    }
+    return err
+}
+
+// Notifier отправляет каждое событие брокера всем подходящим целям; доставка без повторов,
+// ошибки только логируются, чтобы недоступный получатель не влиял на назначение ревьюверов
+type Notifier struct {
+    targets []Target
+    client  *http.Client
+}
+
+func New(targets []Target, timeout time.Duration) *Notifier {
+    return &Notifier{targets: targets, client: &http.Client{Timeout: timeout}}
+}
+
+// Run отправляет события до отмены ctx или закрытия брокера. Если получатели отвечают медленно
+// и брокер отключил подписку, она оформляется заново: пропущенные события не отправляются,
+// как и при любой другой ошибке доставки.
+func (n *Notifier) Run(ctx context.Context, broker *events.Broker) {
+    for n.drain(ctx, broker) && !broker.Closed() {
+        slog.WarnContext(ctx, "notify: fell behind the event stream, some events were not delivered")
+    }
+}
+
+// drain отправляет события одной подписки; false - ctx отменен
+func (n *Notifier) drain(ctx context.Context, broker *events.Broker) bool {
+    ch, unsubscribe := broker.Subscribe()
+    defer unsubscribe()
+
+    for {
+        select {
+        case <-ctx.Done():
+            return false
+        case e, ok := <-ch:
+            if !ok {
+                return true
+            }
+            n.Send(ctx, e)
+        }
+    }
+}
+
+// Send отправляет событие подходящим целям по очереди
+func (n *Notifier) Send(ctx context.Context, e events.Event) {
+    body, err := json.Marshal(e)
+    if err != nil {
+        slog.ErrorContext(ctx, "notify: encode event", "event_id", e.ID, "error", err)
+        return
+    }
+    for _, t := range n.targets {
+        if !t.wants(e.Type) {
+            continue
+        }
+        if err := n.post(ctx, t, body); err != nil {
+            // В пути адреса часто лежит токен чата, поэтому в лог попадает только хост
+            slog.WarnContext(ctx, "notify: delivery failed", "event_id", e.ID, "host", t.host(), "error", redactURL(err))
+        }
+    }
+}
+
+func (n *Notifier) post(ctx context.Context, t Target, body []byte) error {
+    req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.URL, bytes.NewReader(body))
+    if err != nil {
+        return err
+    }
+    req.Header.Set("Content-Type", "application/json")
+    if t.Secret != "" {
+        mac := hmac.New(sha256.New, []byte(t.Secret))
+        mac.Write(body)
+        req.Header.Set(SignatureHeader, "sha256="+hex.EncodeToString(mac.Sum(nil)))
+    }
+
+    resp, err := n.client.Do(req)
+    if err != nil {
+        return err
+    }
+    resp.Body.Close()
+    if resp.StatusCode >= 300 {
+        return fmt.Errorf("status %d", resp.StatusCode)
+    }
+    return nil
+}
@@ -0,0 +1,81 @@
+package notify
+
+import (
+    "context"
+    "crypto/hmac"
+    "crypto/sha256"
+    "encoding/hex"
+    "encoding/json"
+    "io"
+    "net/http"
+    "net/http/httptest"
+    "testing"
+    "time"
+
+    "pr-review-assigner/internal/events"
+)
+
+func TestSendFiltersAndSigns(t *testing.T) {
+    type delivery struct {
+        path, signature string
+        body            []byte
+    }
+    received := make(chan delivery, 10)
+    srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        body, _ := io.ReadAll(r.Body)
+        received <- delivery{r.URL.Path, r.Header.Get(SignatureHeader), body}
+    }))
+    defer srv.Close()
+
+    n := New([]Target{
+        {URL: srv.URL + "/all"},
+        {URL: srv.URL + "/merged", Secret: "s3cret", Events: []string{events.TypePRMerged}},
+    }, time.Second)
+    ctx := context.Background()
+    n.Send(ctx, events.Event{ID: 1, Type: events.TypePRCreated, PRID: "pr-1"})
+    n.Send(ctx, events.Event{ID: 2, Type: events.TypePRMerged, PRID: "pr-1"})
+    close(received)
+
+    // Фильтрованная цель получает только pr.merged, с подписью тела
+    got := map[string][]int64{}
+    for d := range received {
+        var e events.Event
+        if err := json.Unmarshal(d.body, &e); err != nil {
+            t.Fatalf("body is not an event: %v", err)
+        }
+        got[d.path] = append(got[d.path], e.ID)
+
+        want := ""
+        if d.path == "/merged" {
+            mac := hmac.New(sha256.New, []byte("s3cret"))
+            mac.Write(d.body)
+            want = "sha256=" + hex.EncodeToString(mac.Sum(nil))
+        }
+        if d.signature != want {
+            t.Errorf("%s: expected signature %q, got %q", d.path, want, d.signature)
+        }
+    }
+    if len(got["/all"]) != 2 || len(got["/merged"]) != 1 || got["/merged"][0] != 2 {
+        t.Errorf("unexpected deliveries %v", got)
+    }
+}
+
+// Недоступный получатель не останавливает рассылку, а закрытие брокера завершает Run
+func TestRunStopsWithBroker(t *testing.T) {
+    broker := events.NewBroker()
+    n := New([]Target{{URL: "http://127.0.0.1:1/unreachable"}}, 100*time.Millisecond)
+
+    done := make(chan struct{})
+    go func() {
+        n.Run(context.Background(), broker)
+        close(done)
+    }()
+    broker.Publish(events.Event{ID: 1, Type: events.TypePRCreated})
+    broker.Close()
+
+    select {
+    case <-done:
+    case <-time.After(5 * time.Second):
+        t.Fatal("Run did not return after the broker was closed")
+    }
+}
@@ -0,0 +1,54 @@
+// Package problem описывает ответ об ошибке HTTP API по RFC 7807 (application/problem+json).
+// Пакет без зависимостей от сервиса, чтобы им пользовались и хендлеры, и middleware аутентификации.
+package problem
+
+import (
+    "encoding/json"
+    "net/http"
+    "strings"
+
+    "pr-review-assigner/internal/reqmeta"
+)
+
+// ContentType - тип содержимого ответа об ошибке
+const ContentType = "application/problem+json"
+
+// FieldError описывает ошибку в одном поле запроса
+type FieldError struct {
+    Field   string `json:"field"`
+    Message string `json:"message"`
+}
+
+// Problem - тело ответа об ошибке. Поля type, title, status, detail и instance определены RFC 7807,
+// code, request_id и errors - расширения: стабильный код ошибки, id запроса для поиска в логах
+// и ошибки по полям.
+type Problem struct {
+    Type      string       `json:"type"`
+    Title     string       `json:"title"`
+    Status    int          `json:"status"`
+    Detail    string       `json:"detail,omitempty"`
+    Instance  string       `json:"instance,omitempty"`
+    Code      string       `json:"code"`
+    RequestID string       `json:"request_id,omitempty"`
+    Errors    []FieldError `json:"errors,omitempty"`
+}
+
+// New заполняет type и title по коду и статусу: type - относительная ссылка вида /problems/not-found
+func New(status int, code, detail string) *Problem {
+    return &Problem{
+        Type:   "/problems/" + strings.ToLower(strings.ReplaceAll(code, "_", "-")),
+        Title:  http.StatusText(status),
+        Status: status,
+        Detail: detail,
+        Code:   code,
+    }
+}
+
+// Write отправляет p, дополнив его путем запроса и request id
+func Write(w http.ResponseWriter, r *http.Request, p *Problem) {
+    p.Instance = r.URL.Path
+    p.RequestID = reqmeta.FromContext(r.Context()).RequestID
+    w.Header().Set("Content-Type", ContentType)
+    w.WriteHeader(p.Status)
+    json.NewEncoder(w).Encode(p)
+}
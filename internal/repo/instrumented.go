@@ -0,0 +1,110 @@
+package repo
+
+import (
+    "context"
+    "database/sql"
+    "log/slog"
+    "strings"
+    "time"
+
+    "github.com/jmoiron/sqlx"
+    "go.opentelemetry.io/otel"
+    "go.opentelemetry.io/otel/attribute"
+    "go.opentelemetry.io/otel/trace"
+
+    "pr-review-assigner/internal/tracing"
+)
+
+// slowQuery - порог, после которого запрос пишется в лог как warn даже без debug
+const slowQuery = 200 * time.Millisecond
+
+var tracer = otel.Tracer("pr-review-assigner/internal/repo")
+
+// instrumented открывает спан на каждый запрос и пишет его с длительностью в лог на уровне debug,
+// а медленные - на уровне warn. Контекст запроса передается дальше, поэтому спан вложен в спан
+// операции сервиса, а строка лога связана с request_id вызвавшего хендлера.
+type instrumented struct {
+    sqlx.ExtContext
+}
+
+func (q instrumented) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+    ctx, done := q.start(ctx, query)
+    rows, err := q.ExtContext.QueryContext(ctx, query, args...)
+    done(err)
+    return rows, err
+}
+
+func (q instrumented) QueryxContext(ctx context.Context, query string, args ...interface{}) (*sqlx.Rows, error) {
+    ctx, done := q.start(ctx, query)
+    rows, err := q.ExtContext.QueryxContext(ctx, query, args...)
+    done(err)
+    return rows, err
+}
+
+func (q instrumented) QueryRowxContext(ctx context.Context, query string, args ...interface{}) *sqlx.Row {
+    ctx, done := q.start(ctx, query)
+    row := q.ExtContext.QueryRowxContext(ctx, query, args...)
+    done(row.Err())
+    return row
+}
+
+func (q instrumented) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+    ctx, done := q.start(ctx, query)
+    res, err := q.ExtContext.ExecContext(ctx, query, args...)
+    done(err)
+    return res, err
+}
+
+// start не пишет аргументы ни в спан, ни в лог: в них бывают хеши токенов и персональные данные
+func (q instrumented) start(ctx context.Context, query string) (context.Context, func(error)) {
+    text := strings.Join(strings.Fields(query), " ")
+    ctx, span := tracer.Start(ctx, operation(text), trace.WithSpanKind(trace.SpanKindClient),
+        trace.WithAttributes(
+            attribute.String("db.system", dbSystem(q.DriverName())),
+            attribute.String("db.query.text", text),
+        ))
+    start := time.Now()
+    return ctx, func(err error) {
+        tracing.End(span, err)
+
+        elapsed := time.Since(start)
+        level := slog.LevelDebug
+        if elapsed >= slowQuery {
+            level = slog.LevelWarn
+        }
+        logger := slog.Default()
+        if !logger.Enabled(ctx, level) {
+            return
+        }
+        logger.LogAttrs(ctx, level, "sql query",
+            slog.String("query", text),
+            slog.Float64("duration_ms", float64(elapsed.Microseconds())/1000),
+        )
+    }
+}
+
+// operation возвращает имя спана - команду и первую таблицу: "SELECT teams", "INSERT pull_requests"
+func operation(query string) string {
+    words := strings.Fields(query)
+    if len(words) == 0 {
+        return "query"
+    }
+    op := strings.ToUpper(words[0])
+    for i, w := range words[:len(words)-1] {
+        switch strings.ToUpper(w) {
+        case "FROM", "INTO", "UPDATE", "JOIN":
+            table := strings.Trim(words[i+1], "(),;")
+            if table != "" && !strings.HasPrefix(table, "$") && !strings.EqualFold(table, "SELECT") {
+                return op + " " + table
+            }
+        }
+    }
+    return op
+}
+
+func dbSystem(driver string) string {
+    if driver == "pgx" {
+        return "postgresql"
+    }
+    return driver
+}
@@ -0,0 +1,1045 @@
+// Package memory - реализация repo.RepoInterface в памяти процесса для локального запуска и тестов.
+// Семантика повторяет SQL-реализацию: sql.ErrNoRows для отсутствующих строк, ON CONFLICT,
+// внешние ключи и каскадные удаления; транзакция при ошибке откатывается целиком.
+package memory
+
+import (
+    "context"
+    "database/sql"
+    "errors"
+    "fmt"
+    "math/rand"
+    "sort"
+    "sync"
+    "time"
+
+    "pr-review-assigner/internal/repo"
+)
+
+// ErrConstraint - нарушение уникальности или внешнего ключа, как ошибка ограничения в Postgres
+var ErrConstraint = errors.New("memory: constraint violation")
+
+// store - общее состояние; все Repo одного New работают с ним под одной блокировкой
+type store struct {
+    mu    sync.Mutex
+    state *state
+}
+
+type member struct {
+    userID string
+    isLead bool
+}
+
+type idempotencyID struct {
+    owner, key string
+}
+
+type state struct {
+    users       map[string]repo.User
+    teams       map[int64]string
+    members     map[int64][]member        // в порядке добавления
+    prs         map[string]repo.PRRecord
+    reviewers   map[string][]string       // PR -> ревьюверы в порядке добавления
+    assignments []repo.Assignment
+    tokens      []repo.APIToken
+    audit       []repo.AuditEntry
+    events      []repo.PREvent
+    idempotency map[idempotencyID]repo.IdempotencyKey
+    versions    map[string]int64          // версии строк prs и teams, ключи "pr:<id>" и "team:<id>"
+
+    teamSeq, tokenSeq, auditSeq, eventSeq int64
+}
+
+func newState() *state {
+    return &state{
+        users:       map[string]repo.User{},
+        teams:       map[int64]string{},
+        members:     map[int64][]member{},
+        prs:         map[string]repo.PRRecord{},
+        reviewers:   map[string][]string{},
+        idempotency: map[idempotencyID]repo.IdempotencyKey{},
+        versions:    map[string]int64{},
+    }
+}
+
+// clone копирует состояние для отката транзакции
+func (s *state) clone() *state {
+    c := *s
+    c.users = make(map[string]repo.User, len(s.users))
+    for k, v := range s.users {
+        c.users[k] = v
+    }
+    c.teams = make(map[int64]string, len(s.teams))
+    for k, v := range s.teams {
+        c.teams[k] = v
+    }
+    c.members = make(map[int64][]member, len(s.members))
+    for k, v := range s.members {
+        c.members[k] = append([]member(nil), v...)
+    }
+    c.prs = make(map[string]repo.PRRecord, len(s.prs))
+    for k, v := range s.prs {
+        c.prs[k] = v
+    }
+    c.reviewers = make(map[string][]string, len(s.reviewers))
+    for k, v := range s.reviewers {
+        c.reviewers[k] = append([]string(nil), v...)
+    }
+    c.assignments = append([]repo.Assignment(nil), s.assignments...)
+    c.tokens = append([]repo.APIToken(nil), s.tokens...)
+    c.audit = append([]repo.AuditEntry(nil), s.audit...)
+    c.events = append([]repo.PREvent(nil), s.events...)
+    c.idempotency = make(map[idempotencyID]repo.IdempotencyKey, len(s.idempotency))
+    for k, v := range s.idempotency {
+        c.idempotency[k] = v
+    }
+    c.versions = make(map[string]int64, len(s.versions))
+    for k, v := range s.versions {
+        c.versions[k] = v
+    }
+    return &c
+}
+
+// Repo безопасен для одновременного использования; внутри WithTx блокировка уже захвачена
+type Repo struct {
+    store *store
+    inTx  bool
+}
+
+var _ repo.RepoInterface = (*Repo)(nil)
+
+func New() *Repo {
+    return &Repo{store: &store{state: newState()}}
+}
+
+// do выполняет fn над состоянием под блокировкой, если вызов не внутри транзакции
+func (r *Repo) do(fn func(s *state) error) error {
+    if !r.inTx {
+        r.store.mu.Lock()
+        defer r.store.mu.Unlock()
+    }
+    return fn(r.store.state)
+}
+
+// WithTx сериализует транзакции: блокировка держится до конца fn, при ошибке состояние восстанавливается
+func (r *Repo) WithTx(ctx context.Context, fn func(tx repo.RepoInterface) error) error {
+    if r.inTx {
+        return fn(r)
+    }
+
+    r.store.mu.Lock()
+    defer r.store.mu.Unlock()
+
+    backup := r.store.state.clone()
+    if err := fn(&Repo{store: r.store, inTx: true}); err != nil {
+        r.store.state = backup
+        return err
+    }
+    return nil
+}
+
+func constraint(format string, args ...interface{}) error {
+    return fmt.Errorf("%w: %s", ErrConstraint, fmt.Sprintf(format, args...))
+}
+
+// Users
+func (r *Repo) CreateUser(ctx context.Context, userID, username string) error {
+    return r.do(func(s *state) error {
+        u, ok := s.users[userID]
+        if !ok {
+            u = repo.User{ID: userID, IsActive: true}
+        }
+        u.Name = username
+        s.users[userID] = u
+        return nil
+    })
+}
+
+func (r *Repo) GetUserByID(ctx context.Context, userID string) (*repo.User, error) {
+    var user *repo.User
+    err := r.do(func(s *state) error {
+        u, ok := s.users[userID]
+        if !ok {
+            return sql.ErrNoRows
+        }
+        user = &u
+        return nil
+    })
+    return user, err
+}
+
+func (r *Repo) SetUserActive(ctx context.Context, userID string, active bool) error {
+    return r.do(func(s *state) error {
+        if u, ok := s.users[userID]; ok {
+            if u.IsActive != active {
+                for _, id := range s.userTeamIDs(userID) {
+                    s.bump(teamKey(id))
+                }
+            }
+            u.IsActive = active
+            s.users[userID] = u
+        }
+        return nil
+    })
+}
+
+func (r *Repo) ListUsers(ctx context.Context) ([]repo.User, error) {
+    var users []repo.User
+    err := r.do(func(s *state) error {
+        for _, u := range s.users {
+            users = append(users, u)
+        }
+        sort.Slice(users, func(i, j int) bool { return users[i].ID < users[j].ID })
+        return nil
+    })
+    return users, err
+}
+
+// Teams
+func prKey(prID string) string {
+    return "pr:" + prID
+}
+
+func teamKey(teamID int64) string {
+    return fmt.Sprintf("team:%d", teamID)
+}
+
+// bump увеличивает версию строки; новая строка начинает с 1, как DEFAULT в миграции
+func (s *state) bump(key string) {
+    if s.versions[key] == 0 {
+        s.versions[key] = 1
+    }
+    s.versions[key]++
+}
+
+func (s *state) teamID(name string) (int64, bool) {
+    for id, n := range s.teams {
+        if n == name {
+            return id, true
+        }
+    }
+    return 0, false
+}
+
+func (s *state) memberIndex(teamID int64, userID string) int {
+    for i, m := range s.members[teamID] {
+        if m.userID == userID {
+            return i
+        }
+    }
+    return -1
+}
+
+// userTeamIDs - команды пользователя по возрастанию id
+func (s *state) userTeamIDs(userID string) []int64 {
+    var ids []int64
+    for id := range s.teams {
+        if s.memberIndex(id, userID) >= 0 {
+            ids = append(ids, id)
+        }
+    }
+    sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+    return ids
+}
+
+func (s *state) teamMembers(teamName string) []repo.User {
+    id, ok := s.teamID(teamName)
+    if !ok {
+        return nil
+    }
+    var users []repo.User
+    for _, m := range s.members[id] {
+        u := s.users[m.userID]
+        u.IsLead = m.isLead
+        users = append(users, u)
+    }
+    return users
+}
+
+func (r *Repo) TeamExists(ctx context.Context, name string) (bool, error) {
+    var exists bool
+    err := r.do(func(s *state) error {
+        _, exists = s.teamID(name)
+        return nil
+    })
+    return exists, err
+}
+
+func (r *Repo) CreateTeam(ctx context.Context, name string) (int64, error) {
+    var id int64
+    err := r.do(func(s *state) error {
+        if _, exists := s.teamID(name); exists {
+            return constraint("team %q already exists", name)
+        }
+        s.teamSeq++
+        id = s.teamSeq
+        s.teams[id] = name
+        s.versions[teamKey(id)] = 1
+        return nil
+    })
+    return id, err
+}
+
+func (r *Repo) AddMember(ctx context.Context, teamID int64, userID string) error {
+    return r.do(func(s *state) error {
+        if _, ok := s.teams[teamID]; !ok {
+            return constraint("team %d does not exist", teamID)
+        }
+        if _, ok := s.users[userID]; !ok {
+            return constraint("user %q does not exist", userID)
+        }
+        // ON CONFLICT DO NOTHING
+        if s.memberIndex(teamID, userID) < 0 {
+            s.members[teamID] = append(s.members[teamID], member{userID: userID})
+            s.bump(teamKey(teamID))
+        }
+        return nil
+    })
+}
+
+func (r *Repo) GetTeamByName(ctx context.Context, name string) (*repo.Team, error) {
+    var team *repo.Team
+    err := r.do(func(s *state) error {
+        id, ok := s.teamID(name)
+        if !ok {
+            return sql.ErrNoRows
+        }
+        team = &repo.Team{ID: id, Name: name, Version: s.versions[teamKey(id)]}
+        return nil
+    })
+    return team, err
+}
+
+func (r *Repo) GetTeamMembers(ctx context.Context, teamName string) ([]repo.User, error) {
+    var users []repo.User
+    err := r.do(func(s *state) error {
+        users = s.teamMembers(teamName)
+        return nil
+    })
+    return users, err
+}
+
+func (r *Repo) GetActiveTeamMembersExcept(ctx context.Context, teamName string, excludeUserID string) ([]repo.User, error) {
+    var users []repo.User
+    err := r.do(func(s *state) error {
+        for _, u := range s.teamMembers(teamName) {
+            if u.IsActive && u.ID != excludeUserID {
+                u.IsLead = false // колонка не выбирается в SQL-версии
+                users = append(users, u)
+            }
+        }
+        return nil
+    })
+    return users, err
+}
+
+func (r *Repo) RemoveMember(ctx context.Context, teamID int64, userID string) error {
+    return r.do(func(s *state) error {
+        if i := s.memberIndex(teamID, userID); i >= 0 {
+            s.members[teamID] = append(s.members[teamID][:i:i], s.members[teamID][i+1:]...)
+            s.bump(teamKey(teamID))
+        }
+        return nil
+    })
+}
+
+func (r *Repo) SetTeamLead(ctx context.Context, teamID int64, userID string, isLead bool) error {
+    return r.do(func(s *state) error {
+        if i := s.memberIndex(teamID, userID); i >= 0 && s.members[teamID][i].isLead != isLead {
+            s.members[teamID][i].isLead = isLead
+            s.bump(teamKey(teamID))
+        }
+        return nil
+    })
+}
+
+func (r *Repo) RenameTeam(ctx context.Context, teamID int64, name string) error {
+    return r.do(func(s *state) error {
+        if current, ok := s.teams[teamID]; !ok || current == name {
+            return nil
+        }
+        if id, exists := s.teamID(name); exists && id != teamID {
+            return constraint("team %q already exists", name)
+        }
+        s.teams[teamID] = name
+        s.bump(teamKey(teamID))
+        return nil
+    })
+}
+
+func (r *Repo) MatchTeamVersion(ctx context.Context, teamID int64, version int64) (bool, error) {
+    matched := false
+    err := r.do(func(s *state) error {
+        _, ok := s.teams[teamID]
+        matched = ok && s.versions[teamKey(teamID)] == version
+        return nil
+    })
+    return matched, err
+}
+
+func (r *Repo) GetTeamByID(ctx context.Context, teamID int64) (*repo.Team, error) {
+    var team *repo.Team
+    err := r.do(func(s *state) error {
+        name, ok := s.teams[teamID]
+        if !ok {
+            return sql.ErrNoRows
+        }
+        team = &repo.Team{ID: teamID, Name: name, Version: s.versions[teamKey(teamID)]}
+        return nil
+    })
+    return team, err
+}
+
+func (r *Repo) ListTeams(ctx context.Context) ([]repo.Team, error) {
+    var teams []repo.Team
+    err := r.do(func(s *state) error {
+        for id, name := range s.teams {
+            teams = append(teams, repo.Team{ID: id, Name: name})
+        }
+        sort.Slice(teams, func(i, j int) bool { return teams[i].ID < teams[j].ID })
+        return nil
+    })
+    return teams, err
+}
+
+func (r *Repo) DeleteTeam(ctx context.Context, teamID int64) error {
+    return r.do(func(s *state) error {
+        // ON DELETE CASCADE для team_members
+        delete(s.teams, teamID)
+        delete(s.members, teamID)
+        delete(s.versions, teamKey(teamID))
+        return nil
+    })
+}
+
+func (r *Repo) GetUserTeams(ctx context.Context, userID string) ([]repo.Team, error) {
+    var teams []repo.Team
+    err := r.do(func(s *state) error {
+        for _, id := range s.userTeamIDs(userID) {
+            teams = append(teams, repo.Team{ID: id, Name: s.teams[id]})
+        }
+        return nil
+    })
+    return teams, err
+}
+
+// PRs
+func toPR(p repo.PRRecord) repo.PR {
+    return repo.PR{ID: p.ID, Title: p.Title, AuthorID: p.AuthorID, Status: p.Status}
+}
+
+// sortedPRs - PR, для которых keep возвращает true, по времени создания и id
+func (s *state) sortedPRs(keep func(p repo.PRRecord) bool) []repo.PRRecord {
+    var prs []repo.PRRecord
+    for _, p := range s.prs {
+        if keep(p) {
+            prs = append(prs, p)
+        }
+    }
+    sort.Slice(prs, func(i, j int) bool {
+        a, b := prs[i].CreatedAt, prs[j].CreatedAt
+        if !a.Equal(*b) {
+            return a.Before(*b)
+        }
+        return prs[i].ID < prs[j].ID
+    })
+    return prs
+}
+
+func (s *state) isReviewer(prID, userID string) bool {
+    for _, id := range s.reviewers[prID] {
+        if id == userID {
+            return true
+        }
+    }
+    return false
+}
+
+func (r *Repo) PRExists(ctx context.Context, prID string) (bool, error) {
+    var exists bool
+    err := r.do(func(s *state) error {
+        _, exists = s.prs[prID]
+        return nil
+    })
+    return exists, err
+}
+
+func (r *Repo) CreatePRWithID(ctx context.Context, prID, title, authorID string) error {
+    return r.do(func(s *state) error {
+        if _, exists := s.prs[prID]; exists {
+            return constraint("PR %q already exists", prID)
+        }
+        if _, ok := s.users[authorID]; !ok {
+            return constraint("user %q does not exist", authorID)
+        }
+        now := time.Now()
+        s.prs[prID] = repo.PRRecord{ID: prID, Title: title, AuthorID: authorID, Status: "OPEN", CreatedAt: &now}
+        s.versions[prKey(prID)] = 1
+        return nil
+    })
+}
+
+func (r *Repo) GetPRByID(ctx context.Context, prID string) (*repo.PR, error) {
+    var pr *repo.PR
+    err := r.do(func(s *state) error {
+        p, ok := s.prs[prID]
+        if !ok {
+            return sql.ErrNoRows
+        }
+        result := toPR(p)
+        result.Version = s.versions[prKey(prID)]
+        pr = &result
+        return nil
+    })
+    return pr, err
+}
+
+func (r *Repo) MatchPRVersion(ctx context.Context, prID string, version int64) (bool, error) {
+    matched := false
+    err := r.do(func(s *state) error {
+        _, ok := s.prs[prID]
+        matched = ok && s.versions[prKey(prID)] == version
+        return nil
+    })
+    return matched, err
+}
+
+func (r *Repo) AddReviewer(ctx context.Context, prID, userID string) error {
+    return r.do(func(s *state) error {
+        if _, ok := s.prs[prID]; !ok {
+            return constraint("PR %q does not exist", prID)
+        }
+        if _, ok := s.users[userID]; !ok {
+            return constraint("user %q does not exist", userID)
+        }
+        // ON CONFLICT DO NOTHING
+        if !s.isReviewer(prID, userID) {
+            s.reviewers[prID] = append(s.reviewers[prID], userID)
+            s.bump(prKey(prID))
+        }
+        return nil
+    })
+}
+
+func (r *Repo) RemoveReviewer(ctx context.Context, prID, userID string) error {
+    return r.do(func(s *state) error {
+        ids := s.reviewers[prID]
+        for i, id := range ids {
+            if id == userID {
+                s.reviewers[prID] = append(ids[:i:i], ids[i+1:]...)
+                s.bump(prKey(prID))
+                break
+            }
+        }
+        return nil
+    })
+}
+
+func (r *Repo) GetPRReviewers(ctx context.Context, prID string) ([]repo.User, error) {
+    var users []repo.User
+    err := r.do(func(s *state) error {
+        for _, id := range s.reviewers[prID] {
+            users = append(users, s.users[id])
+        }
+        return nil
+    })
+    return users, err
+}
+
+func (r *Repo) SetPRStatus(ctx context.Context, prID string, status string) error {
+    return r.do(func(s *state) error {
+        if status != "OPEN" && status != "MERGED" {
+            return constraint("invalid pr_status %q", status)
+        }
+        if p, ok := s.prs[prID]; ok && p.Status != status {
+            p.Status, p.MergedAt = status, nil
+            if status == "MERGED" {
+                now := time.Now()
+                p.MergedAt = &now
+            }
+            s.prs[prID] = p
+            s.bump(prKey(prID))
+        }
+        return nil
+    })
+}
+
+func (r *Repo) GetPRsByReviewer(ctx context.Context, userID string) ([]repo.PR, error) {
+    var prs []repo.PR
+    err := r.do(func(s *state) error {
+        for _, p := range s.sortedPRs(func(p repo.PRRecord) bool { return s.isReviewer(p.ID, userID) }) {
+            prs = append(prs, toPR(p))
+        }
+        return nil
+    })
+    return prs, err
+}
+
+// GetOpenPRsByTeam возвращает открытые PR, авторы которых состоят в команде
+func (r *Repo) GetOpenPRsByTeam(ctx context.Context, teamName string) ([]repo.PR, error) {
+    prs := []repo.PR{}
+    err := r.do(func(s *state) error {
+        id, ok := s.teamID(teamName)
+        if !ok {
+            return nil
+        }
+        for _, p := range s.sortedPRs(func(p repo.PRRecord) bool {
+            return p.Status == "OPEN" && s.memberIndex(id, p.AuthorID) >= 0
+        }) {
+            pr := toPR(p)
+            pr.Version = s.versions[prKey(p.ID)]
+            prs = append(prs, pr)
+        }
+        return nil
+    })
+    return prs, err
+}
+
+func (r *Repo) GetUserTeam(ctx context.Context, userID string) (string, error) {
+    var name string
+    err := r.do(func(s *state) error {
+        ids := s.userTeamIDs(userID)
+        if len(ids) == 0 {
+            return sql.ErrNoRows
+        }
+        name = s.teams[ids[0]]
+        return nil
+    })
+    return name, err
+}
+
+func (r *Repo) GetRandomActiveTeamMember(ctx context.Context, teamName, excludeUserID string) (*repo.User, error) {
+    candidates, err := r.GetActiveTeamMembersExcept(ctx, teamName, excludeUserID)
+    if err != nil {
+        return nil, err
+    }
+    if len(candidates) == 0 {
+        return nil, sql.ErrNoRows
+    }
+    return &candidates[rand.Intn(len(candidates))], nil
+}
+
+// Assignment events
+func (r *Repo) AddAssignmentEvent(ctx context.Context, prID, userID string) error {
+    return r.do(func(s *state) error {
+        if _, ok := s.prs[prID]; !ok {
+            return constraint("PR %q does not exist", prID)
+        }
+        if _, ok := s.users[userID]; !ok {
+            return constraint("user %q does not exist", userID)
+        }
+        s.assignments = append(s.assignments, repo.Assignment{PRID: prID, UserID: userID, EventTime: time.Now()})
+        return nil
+    })
+}
+
+func (r *Repo) GetAssignmentStats(ctx context.Context) (map[string]int, error) {
+    stats := make(map[string]int)
+    err := r.do(func(s *state) error {
+        for _, a := range s.assignments {
+            stats[a.UserID]++
+        }
+        return nil
+    })
+    return stats, err
+}
+
+// Bulk operations
+func (r *Repo) DeactivateTeamMembers(ctx context.Context, teamID int64) error {
+    return r.do(func(s *state) error {
+        changed := map[int64]bool{}
+        for _, m := range s.members[teamID] {
+            u := s.users[m.userID]
+            if u.IsActive {
+                for _, id := range s.userTeamIDs(m.userID) {
+                    changed[id] = true
+                }
+            }
+            u.IsActive = false
+            s.users[m.userID] = u
+        }
+        for id := range changed {
+            s.bump(teamKey(id))
+        }
+        return nil
+    })
+}
+
+func (r *Repo) GetOpenPRsWithReviewersByUserIDs(ctx context.Context, userIDs []string) ([]repo.PR, error) {
+    prs := []repo.PR{}
+    err := r.do(func(s *state) error {
+        wanted := make(map[string]bool, len(userIDs))
+        for _, id := range userIDs {
+            wanted[id] = true
+        }
+        for _, p := range s.sortedPRs(func(p repo.PRRecord) bool { return p.Status == "OPEN" }) {
+            pr := toPR(p)
+            for _, id := range s.reviewers[p.ID] {
+                if wanted[id] {
+                    pr.Reviewers = append(pr.Reviewers, s.users[id])
+                }
+            }
+            if len(pr.Reviewers) == 0 {
+                continue
+            }
+            sort.Slice(pr.Reviewers, func(i, j int) bool { return pr.Reviewers[i].ID < pr.Reviewers[j].ID })
+            prs = append(prs, pr)
+        }
+        return nil
+    })
+    return prs, err
+}
+
+// API tokens
+func (r *Repo) CreateAPIToken(ctx context.Context, token *repo.APIToken) (int64, error) {
+    var id int64
+    err := r.do(func(s *state) error {
+        for _, t := range s.tokens {
+            if t.TokenHash == token.TokenHash {
+                return constraint("token hash already exists")
+            }
+        }
+        if token.UserID != nil {
+            if _, ok := s.users[*token.UserID]; !ok {
+                return constraint("user %q does not exist", *token.UserID)
+            }
+        }
+        s.tokenSeq++
+        id = s.tokenSeq
+        stored := *token
+        stored.ID, stored.CreatedAt, stored.RevokedAt = id, time.Now(), nil
+        s.tokens = append(s.tokens, stored)
+        return nil
+    })
+    return id, err
+}
+
+func (r *Repo) GetAPITokenByHash(ctx context.Context, tokenHash string) (*repo.APIToken, error) {
+    var token *repo.APIToken
+    err := r.do(func(s *state) error {
+        for _, t := range s.tokens {
+            if t.TokenHash == tokenHash {
+                token = &t
+                return nil
+            }
+        }
+        return sql.ErrNoRows
+    })
+    return token, err
+}
+
+func (r *Repo) ListAPITokens(ctx context.Context) ([]repo.APIToken, error) {
+    var tokens []repo.APIToken
+    err := r.do(func(s *state) error {
+        tokens = append(tokens, s.tokens...)
+        return nil
+    })
+    return tokens, err
+}
+
+func (r *Repo) RevokeAPIToken(ctx context.Context, id int64) (bool, error) {
+    revoked := false
+    err := r.do(func(s *state) error {
+        for i := range s.tokens {
+            if s.tokens[i].ID == id && s.tokens[i].RevokedAt == nil {
+                now := time.Now()
+                s.tokens[i].RevokedAt = &now
+                revoked = true
+            }
+        }
+        return nil
+    })
+    return revoked, err
+}
+
+// Audit log
+func (r *Repo) AddAuditEntry(ctx context.Context, entry *repo.AuditEntry) error {
+    return r.do(func(s *state) error {
+        s.auditSeq++
+        entry.ID, entry.CreatedAt = s.auditSeq, time.Now()
+        s.audit = append(s.audit, *entry)
+        return nil
+    })
+}
+
+func (r *Repo) ListAuditEntries(ctx context.Context, filter repo.AuditFilter) ([]repo.AuditEntry, error) {
+    entries := []repo.AuditEntry{}
+    err := r.do(func(s *state) error {
+        // Записи добавляются по возрастанию времени, поэтому обратный порядок - created_at DESC, id DESC
+        for i := len(s.audit) - 1; i >= 0; i-- {
+            e := s.audit[i]
+            switch {
+            case filter.Actor != "" && e.Actor != filter.Actor,
+                filter.TargetType != "" && e.TargetType != filter.TargetType,
+                filter.TargetID != "" && e.TargetID != filter.TargetID,
+                filter.From != nil && e.CreatedAt.Before(*filter.From),
+                filter.To != nil && !e.CreatedAt.Before(*filter.To):
+                continue
+            }
+            entries = append(entries, e)
+            if filter.Limit > 0 && len(entries) == filter.Limit {
+                break
+            }
+        }
+        return nil
+    })
+    return entries, err
+}
+
+// PR event history
+func (r *Repo) AddPREvent(ctx context.Context, event *repo.PREvent) error {
+    return r.do(func(s *state) error {
+        s.eventSeq++
+        event.ID, event.CreatedAt = s.eventSeq, time.Now()
+        s.events = append(s.events, *event)
+        return nil
+    })
+}
+
+func (r *Repo) ListPREvents(ctx context.Context, filter repo.PREventFilter) ([]repo.PREvent, error) {
+    events := []repo.PREvent{}
+    err := r.do(func(s *state) error {
+        for _, e := range s.events {
+            if e.ID <= filter.AfterID || (filter.TeamName != "" && e.TeamName != filter.TeamName) {
+                continue
+            }
+            if filter.UserID != "" && e.AuthorID != filter.UserID && e.ReviewerID != filter.UserID && e.ReplacedUserID != filter.UserID {
+                continue
+            }
+            events = append(events, e)
+            if filter.Limit > 0 && len(events) == filter.Limit {
+                break
+            }
+        }
+        return nil
+    })
+    return events, err
+}
+
+// Idempotency keys
+func (r *Repo) CreateIdempotencyKey(ctx context.Context, key *repo.IdempotencyKey) (bool, error) {
+    created := false
+    err := r.do(func(s *state) error {
+        id := idempotencyID{key.Owner, key.Key}
+        if _, ok := s.idempotency[id]; ok {
+            return nil
+        }
+        key.CreatedAt = time.Now()
+        stored := *key
+        stored.Status, stored.ContentType, stored.ETag, stored.Body = 0, "", "", nil
+        s.idempotency[id] = stored
+        created = true
+        return nil
+    })
+    return created, err
+}
+
+func (r *Repo) GetIdempotencyKey(ctx context.Context, owner, key string) (*repo.IdempotencyKey, error) {
+    var found *repo.IdempotencyKey
+    err := r.do(func(s *state) error {
+        k, ok := s.idempotency[idempotencyID{owner, key}]
+        if !ok {
+            return sql.ErrNoRows
+        }
+        k.Body = append([]byte(nil), k.Body...)
+        found = &k
+        return nil
+    })
+    return found, err
+}
+
+func (r *Repo) CompleteIdempotencyKey(ctx context.Context, key *repo.IdempotencyKey) (bool, error) {
+    completed := false
+    err := r.do(func(s *state) error {
+        id := idempotencyID{key.Owner, key.Key}
+        k, ok := s.idempotency[id]
+        if !ok || !k.CreatedAt.Equal(key.CreatedAt) || k.Status != 0 {
+            return nil
+        }
+        k.Status, k.ContentType, k.ETag, k.Body = key.Status, key.ContentType, key.ETag, append([]byte(nil), key.Body...)
+        k.ExpiresAt = key.ExpiresAt
+        s.idempotency[id] = k
+        completed = true
+        return nil
+    })
+    return completed, err
+}
+
+func (r *Repo) DeleteIdempotencyKey(ctx context.Context, owner, key string, createdAt time.Time) error {
+    return r.do(func(s *state) error {
+        id := idempotencyID{owner, key}
+        if k, ok := s.idempotency[id]; ok && k.CreatedAt.Equal(createdAt) {
+            delete(s.idempotency, id)
+        }
+        return nil
+    })
+}
+
+func (r *Repo) DeleteExpiredIdempotencyKeys(ctx context.Context, before time.Time) (int64, error) {
+    var n int64
+    err := r.do(func(s *state) error {
+        for id, k := range s.idempotency {
+            if !k.ExpiresAt.After(before) {
+                delete(s.idempotency, id)
+                n++
+            }
+        }
+        return nil
+    })
+    return n, err
+}
+
+// Export / import
+func (r *Repo) ListMemberships(ctx context.Context) ([]repo.Membership, error) {
+    memberships := []repo.Membership{}
+    err := r.do(func(s *state) error {
+        for id, name := range s.teams {
+            for _, m := range s.members[id] {
+                memberships = append(memberships, repo.Membership{TeamName: name, UserID: m.userID, IsLead: m.isLead})
+            }
+        }
+        sort.Slice(memberships, func(i, j int) bool {
+            a, b := memberships[i], memberships[j]
+            if a.TeamName != b.TeamName {
+                return a.TeamName < b.TeamName
+            }
+            return a.UserID < b.UserID
+        })
+        return nil
+    })
+    return memberships, err
+}
+
+func (r *Repo) ListPRRecords(ctx context.Context) ([]repo.PRRecord, error) {
+    prs := []repo.PRRecord{}
+    err := r.do(func(s *state) error {
+        prs = append(prs, s.sortedPRs(func(repo.PRRecord) bool { return true })...)
+        return nil
+    })
+    return prs, err
+}
+
+func (r *Repo) ListReviewers(ctx context.Context) ([]repo.Reviewer, error) {
+    reviewers := []repo.Reviewer{}
+    err := r.do(func(s *state) error {
+        for prID, ids := range s.reviewers {
+            for _, id := range ids {
+                reviewers = append(reviewers, repo.Reviewer{PRID: prID, UserID: id})
+            }
+        }
+        sort.Slice(reviewers, func(i, j int) bool {
+            a, b := reviewers[i], reviewers[j]
+            if a.PRID != b.PRID {
+                return a.PRID < b.PRID
+            }
+            return a.UserID < b.UserID
+        })
+        return nil
+    })
+    return reviewers, err
+}
+
+func (r *Repo) ListAssignments(ctx context.Context) ([]repo.Assignment, error) {
+    assignments := []repo.Assignment{}
+    err := r.do(func(s *state) error {
+        assignments = append(assignments, s.assignments...)
+        return nil
+    })
+    return assignments, err
+}
+
+// UpsertPR создает PR или перезаписывает все его поля, включая время создания и merge
+func (r *Repo) UpsertPR(ctx context.Context, pr repo.PRRecord) error {
+    return r.do(func(s *state) error {
+        if _, ok := s.users[pr.AuthorID]; !ok {
+            return constraint("user %q does not exist", pr.AuthorID)
+        }
+        if pr.Status != "OPEN" && pr.Status != "MERGED" {
+            return constraint("invalid pr_status %q", pr.Status)
+        }
+        createdAt := time.Now()
+        if pr.CreatedAt != nil {
+            createdAt = *pr.CreatedAt
+        }
+        pr.CreatedAt = &createdAt
+        if pr.MergedAt != nil {
+            mergedAt := *pr.MergedAt
+            pr.MergedAt = &mergedAt
+        }
+        if _, exists := s.prs[pr.ID]; exists {
+            s.bump(prKey(pr.ID))
+        } else {
+            s.versions[prKey(pr.ID)] = 1
+        }
+        s.prs[pr.ID] = pr
+        return nil
+    })
+}
+
+// RestoreAssignment добавляет запись истории, если такой же (PR, пользователь, время) еще нет
+func (r *Repo) RestoreAssignment(ctx context.Context, a repo.Assignment) error {
+    return r.do(func(s *state) error {
+        if _, ok := s.prs[a.PRID]; !ok {
+            return constraint("PR %q does not exist", a.PRID)
+        }
+        if _, ok := s.users[a.UserID]; !ok {
+            return constraint("user %q does not exist", a.UserID)
+        }
+        for _, existing := range s.assignments {
+            if existing.PRID == a.PRID && existing.UserID == a.UserID && existing.EventTime.Equal(a.EventTime) {
+                return nil
+            }
+        }
+        s.assignments = append(s.assignments, a)
+        return nil
+    })
+}
+
+// ResetState удаляет команды, PR, назначения и всех пользователей, кроме keepUserIDs, вместе с их токенами;
+// возвращает наибольшую версию удаленных команд и PR
+func (r *Repo) ResetState(ctx context.Context, keepUserIDs []string) (int64, error) {
+    var maxVersion int64
+    err := r.do(func(s *state) error {
+        for _, v := range s.versions {
+            if v > maxVersion {
+                maxVersion = v
+            }
+        }
+
+        keep := make(map[string]bool, len(keepUserIDs))
+        for _, id := range keepUserIDs {
+            keep[id] = true
+        }
+
+        s.assignments = nil
+        s.reviewers = map[string][]string{}
+        s.prs = map[string]repo.PRRecord{}
+        s.members = map[int64][]member{}
+        s.teams = map[int64]string{}
+        s.versions = map[string]int64{}
+        for id := range s.users {
+            if !keep[id] {
+                delete(s.users, id)
+            }
+        }
+
+        tokens := s.tokens[:0:0]
+        for _, t := range s.tokens {
+            if t.UserID == nil || keep[*t.UserID] {
+                tokens = append(tokens, t)
+            }
+        }
+        s.tokens = tokens
+        return nil
+    })
+    return maxVersion, err
+}
+
+func (r *Repo) ShiftVersions(ctx context.Context, by int64) error {
+    return r.do(func(s *state) error {
+        for key := range s.versions {
+            s.versions[key] += by
+        }
+        return nil
+    })
+}
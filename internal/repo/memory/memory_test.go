@@ -0,0 +1,107 @@
+package memory
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "sync"
+    "testing"
+
+    "pr-review-assigner/internal/repo"
+    "pr-review-assigner/internal/repo/repotest"
+)
+
+func seed(t *testing.T, r *Repo) int64 {
+    t.Helper()
+    ctx := context.Background()
+    for _, id := range []string{"u1", "u2", "u3"} {
+        if err := r.CreateUser(ctx, id, "User "+id); err != nil {
+            t.Fatalf("CreateUser: %v", err)
+        }
+    }
+    teamID, err := r.CreateTeam(ctx, "backend")
+    if err != nil {
+        t.Fatalf("CreateTeam: %v", err)
+    }
+    for _, id := range []string{"u1", "u2", "u3"} {
+        if err := r.AddMember(ctx, teamID, id); err != nil {
+            t.Fatalf("AddMember: %v", err)
+        }
+    }
+    if err := r.CreatePRWithID(ctx, "pr-1", "Feature", "u1"); err != nil {
+        t.Fatalf("CreatePRWithID: %v", err)
+    }
+    return teamID
+}
+
+// Нарушения ограничений распознаются через ErrConstraint, как ошибки ограничений Postgres
+func TestConstraintErrors(t *testing.T) {
+    r := New()
+    ctx := context.Background()
+    seed(t, r)
+
+    if _, err := r.CreateTeam(ctx, "backend"); !errors.Is(err, ErrConstraint) {
+        t.Errorf("expected unique violation for team name, got %v", err)
+    }
+    if err := r.CreatePRWithID(ctx, "pr-1", "Again", "u1"); !errors.Is(err, ErrConstraint) {
+        t.Errorf("expected unique violation for PR id, got %v", err)
+    }
+    if err := r.AddReviewer(ctx, "pr-1", "nobody"); !errors.Is(err, ErrConstraint) {
+        t.Errorf("expected foreign key violation for reviewer, got %v", err)
+    }
+    if err := r.SetPRStatus(ctx, "pr-1", "CLOSED"); !errors.Is(err, ErrConstraint) {
+        t.Errorf("expected enum violation for status, got %v", err)
+    }
+    if _, err := r.CreateAPIToken(ctx, &repo.APIToken{Name: "ci", TokenHash: "h1", Scopes: "read"}); err != nil {
+        t.Fatalf("CreateAPIToken: %v", err)
+    }
+    if _, err := r.CreateAPIToken(ctx, &repo.APIToken{Name: "ci", TokenHash: "h1", Scopes: "read"}); !errors.Is(err, ErrConstraint) {
+        t.Errorf("expected unique violation for token hash, got %v", err)
+    }
+}
+
+// Возвращенные значения - копии: их изменение не затрагивает хранилище
+func TestReturnsCopies(t *testing.T) {
+    r := New()
+    ctx := context.Background()
+    seed(t, r)
+
+    u, _ := r.GetUserByID(ctx, "u1")
+    u.IsActive = false
+    members, _ := r.GetTeamMembers(ctx, "backend")
+    members[0].Name = "changed"
+    if u, _ := r.GetUserByID(ctx, "u1"); !u.IsActive || u.Name != "User u1" {
+        t.Errorf("expected stored user to stay unchanged, got %+v", u)
+    }
+}
+
+func TestConcurrentAccess(t *testing.T) {
+    r := New()
+    ctx := context.Background()
+    seed(t, r)
+
+    var wg sync.WaitGroup
+    for i := 0; i < 20; i++ {
+        wg.Add(1)
+        go func(i int) {
+            defer wg.Done()
+            prID := fmt.Sprintf("pr-%d", i+2)
+            r.WithTx(ctx, func(tx repo.RepoInterface) error {
+                if err := tx.CreatePRWithID(ctx, prID, "Parallel", "u1"); err != nil {
+                    return err
+                }
+                return tx.AddAssignmentEvent(ctx, prID, "u2")
+            })
+            r.GetAssignmentStats(ctx)
+        }(i)
+    }
+    wg.Wait()
+
+    if stats, _ := r.GetAssignmentStats(ctx); stats["u2"] != 20 {
+        t.Errorf("expected 20 assignments, got %v", stats)
+    }
+}
+
+func TestConformance(t *testing.T) {
+    repotest.Run(t, func(t *testing.T) repo.RepoInterface { return New() })
+}
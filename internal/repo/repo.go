@@ -2,7 +2,18 @@ package repo
 
 import (
     "context"
+    "database/sql"
+    "database/sql/driver"
+    "encoding/json"
+    "fmt"
+    "log/slog"
+    "math/rand"
+    "strings"
+    "time"
+
     "github.com/jmoiron/sqlx"
+
+    "pr-review-assigner/internal/tracing"
 )
 
 // RepoInterface определяет контракт для репозитория
@@ -11,6 +22,7 @@ type RepoInterface interface {
     CreateUser(ctx context.Context, userID, username string) error
     GetUserByID(ctx context.Context, userID string) (*User, error)
     SetUserActive(ctx context.Context, userID string, active bool) error
+    ListUsers(ctx context.Context) ([]User, error)
     
     // Teams
     TeamExists(ctx context.Context, name string) (bool, error)
@@ -19,16 +31,26 @@ type RepoInterface interface {
     GetTeamByName(ctx context.Context, name string) (*Team, error)
     GetTeamMembers(ctx context.Context, teamName string) ([]User, error)
     GetActiveTeamMembersExcept(ctx context.Context, teamName string, excludeUserID string) ([]User, error)
+    RemoveMember(ctx context.Context, teamID int64, userID string) error
+    SetTeamLead(ctx context.Context, teamID int64, userID string, isLead bool) error
+    RenameTeam(ctx context.Context, teamID int64, name string) error
+    GetTeamByID(ctx context.Context, teamID int64) (*Team, error)
+    MatchTeamVersion(ctx context.Context, teamID int64, version int64) (bool, error)
+    ListTeams(ctx context.Context) ([]Team, error)
+    DeleteTeam(ctx context.Context, teamID int64) error
+    GetUserTeams(ctx context.Context, userID string) ([]Team, error)
     
     // PRs
     PRExists(ctx context.Context, prID string) (bool, error)
     CreatePRWithID(ctx context.Context, prID, title, authorID string) error
     GetPRByID(ctx context.Context, prID string) (*PR, error)
+    MatchPRVersion(ctx context.Context, prID string, version int64) (bool, error)
     AddReviewer(ctx context.Context, prID, userID string) error
     RemoveReviewer(ctx context.Context, prID, userID string) error
     GetPRReviewers(ctx context.Context, prID string) ([]User, error)
     SetPRStatus(ctx context.Context, prID string, status string) error
     GetPRsByReviewer(ctx context.Context, userID string) ([]PR, error)
+    GetOpenPRsByTeam(ctx context.Context, teamName string) ([]PR, error)
     GetUserTeam(ctx context.Context, userID string) (string, error)
     GetRandomActiveTeamMember(ctx context.Context, teamName, excludeUserID string) (*User, error)
     
@@ -38,15 +60,106 @@ type RepoInterface interface {
     
     // Bulk operations
     DeactivateTeamMembers(ctx context.Context, teamID int64) error
+    // GetOpenPRsWithReviewersByUserIDs - открытые PR, где ревьювер кто-то из userIDs; Reviewers - только эти пользователи
     GetOpenPRsWithReviewersByUserIDs(ctx context.Context, userIDs []string) ([]PR, error)
+    
+    // API tokens
+    CreateAPIToken(ctx context.Context, token *APIToken) (int64, error)
+    GetAPITokenByHash(ctx context.Context, tokenHash string) (*APIToken, error)
+    ListAPITokens(ctx context.Context) ([]APIToken, error)
+    RevokeAPIToken(ctx context.Context, id int64) (bool, error)
+    
+    // Audit log
+    AddAuditEntry(ctx context.Context, entry *AuditEntry) error
+    ListAuditEntries(ctx context.Context, filter AuditFilter) ([]AuditEntry, error)
+    
+    // PR event history
+    AddPREvent(ctx context.Context, event *PREvent) error
+    ListPREvents(ctx context.Context, filter PREventFilter) ([]PREvent, error)
+    
+    // Idempotency keys
+    CreateIdempotencyKey(ctx context.Context, key *IdempotencyKey) (bool, error)
+    GetIdempotencyKey(ctx context.Context, owner, key string) (*IdempotencyKey, error)
+    CompleteIdempotencyKey(ctx context.Context, key *IdempotencyKey) (bool, error)
+    DeleteIdempotencyKey(ctx context.Context, owner, key string, createdAt time.Time) error
+    DeleteExpiredIdempotencyKeys(ctx context.Context, before time.Time) (int64, error)
+    
+    // Export / import
+    ListMemberships(ctx context.Context) ([]Membership, error)
+    ListPRRecords(ctx context.Context) ([]PRRecord, error)
+    ListReviewers(ctx context.Context) ([]Reviewer, error)
+    ListAssignments(ctx context.Context) ([]Assignment, error)
+    UpsertPR(ctx context.Context, pr PRRecord) error
+    RestoreAssignment(ctx context.Context, a Assignment) error
+    ResetState(ctx context.Context, keepUserIDs []string) (int64, error)
+    ShiftVersions(ctx context.Context, by int64) error
+    
+    // Transactions
+    WithTx(ctx context.Context, fn func(tx RepoInterface) error) error
 }
 
 type Repo struct {
     db *sqlx.DB
+    tx *sqlx.Tx        // текущая транзакция, nil вне WithTx
+    q  sqlx.ExtContext // db или tx, обернутые спанами и логированием запросов
 }
 
+// New работает с Postgres и SQLite: запросы используют только общий для них SQL,
+// а время и случайный выбор вычисляются в Go
 func New(db *sqlx.DB) *Repo {
-    return &Repo{db: db}
+    return &Repo{db: db, q: instrumented{db}}
+}
+
+// now - время для записи в базу: в UTC, чтобы в SQLite значения сравнивались как строки,
+// и с точностью Postgres, чтобы записанное значение совпадало с возвращенным
+func now() time.Time {
+    return time.Now().UTC().Truncate(time.Microsecond)
+}
+
+// bumpIfChanged увеличивает версию строки table, если запрос, вернувший res, изменил хотя бы одну строку
+func (r *Repo) bumpIfChanged(ctx context.Context, res sql.Result, err error, table string, id interface{}) error {
+    if err != nil {
+        return err
+    }
+    n, err := res.RowsAffected()
+    if err != nil || n == 0 {
+        return err
+    }
+    _, err = r.q.ExecContext(ctx, "UPDATE "+table+" SET version = version + 1 WHERE id = $1", id)
+    return err
+}
+
+// placeholders возвращает "$from, $from+1, ..." для n аргументов списка IN
+func placeholders(from, n int) string {
+    list := make([]string, n)
+    for i := range list {
+        list[i] = fmt.Sprintf("$%d", from+i)
+    }
+    return strings.Join(list, ", ")
+}
+
+// WithTx выполняет fn в транзакции; вложенные вызовы переиспользуют текущую транзакцию
+func (r *Repo) WithTx(ctx context.Context, fn func(tx RepoInterface) error) (err error) {
+    if r.tx != nil {
+        return fn(r)
+    }
+
+    ctx, span := tracer.Start(ctx, "Repo.WithTx")
+    defer func() { tracing.End(span, err) }()
+
+    tx, err := r.db.BeginTxx(ctx, nil)
+    if err != nil {
+        return err
+    }
+
+    if err := fn(&Repo{db: r.db, tx: tx, q: instrumented{tx}}); err != nil {
+        if rbErr := tx.Rollback(); rbErr != nil {
+            slog.WarnContext(ctx, "transaction rollback failed", "error", rbErr, "cause", err)
+        }
+        return err
+    }
+
+    return tx.Commit()
 }
 
 
@@ -56,17 +169,21 @@ type User struct {
     Name     string `json:"username" db:"name"`
     IsActive bool   `json:"is_active" db:"is_active"`
     TeamName string `json:"team_name,omitempty" db:"-"`
+    IsLead   bool   `json:"is_lead,omitempty" db:"is_lead"` // только в контексте команды
 }
 
+// Team и PR несут версию строки: она растет при каждом изменении и отдается клиентам как ETag
 type Team struct {
-    ID   int64  `json:"-" db:"id"`
-    Name string `json:"team_name" db:"name"`
+    ID      int64  `json:"-" db:"id"`
+    Name    string `json:"team_name" db:"name"`
+    Version int64  `json:"-" db:"version"`
 }
 
 type TeamMember struct {
     UserID   string `json:"user_id" db:"user_id"`
     Username string `json:"username" db:"username"`
     IsActive bool   `json:"is_active" db:"is_active"`
+    IsLead   bool   `json:"is_lead,omitempty" db:"is_lead"`
 }
 
 type PR struct {
@@ -74,12 +191,150 @@ type PR struct {
     Title     string `json:"pull_request_name" db:"title"`
     AuthorID  string `json:"author_id" db:"author_id"`
     Status    string `json:"status" db:"status"`
+    Version   int64  `json:"-" db:"version"`
     Reviewers []User `json:"assigned_reviewers,omitempty" db:"-"`
 }
 
+type APIToken struct {
+    ID        int64      `json:"id" db:"id"`
+    Name      string     `json:"name" db:"name"`
+    TokenHash string     `json:"-" db:"token_hash"`
+    Scopes    string     `json:"scopes" db:"scopes"` // через пробел
+    UserID    *string    `json:"user_id,omitempty" db:"user_id"`
+    CreatedAt time.Time  `json:"created_at" db:"created_at"`
+    RevokedAt *time.Time `json:"revoked_at,omitempty" db:"revoked_at"`
+}
+
+type AuditEntry struct {
+    ID         int64     `json:"id" db:"id"`
+    CreatedAt  time.Time `json:"created_at" db:"created_at"`
+    Actor      string    `json:"actor" db:"actor"`
+    Action     string    `json:"action" db:"action"`
+    TargetType string    `json:"target_type" db:"target_type"`
+    TargetID   string    `json:"target_id" db:"target_id"`
+    Before     JSONB     `json:"before" db:"before"`
+    After      JSONB     `json:"after" db:"after"`
+    RequestID  string    `json:"request_id,omitempty" db:"request_id"`
+    SourceIP   string    `json:"source_ip,omitempty" db:"source_ip"`
+}
+
+// AuditFilter - условия выборки журнала; пустые поля не ограничивают выборку
+type AuditFilter struct {
+    Actor      string
+    TargetType string
+    TargetID   string
+    From       *time.Time
+    To         *time.Time
+    Limit      int
+}
+
+// PREvent - запись истории изменений PR (создание, назначение, замена ревьювера, merge)
+type PREvent struct {
+    ID             int64     `db:"id"`
+    CreatedAt      time.Time `db:"created_at"`
+    Type           string    `db:"type"`
+    PRID           string    `db:"pr_id"`
+    TeamName       string    `db:"team_name"`
+    AuthorID       string    `db:"author_id"`
+    ReviewerID     string    `db:"reviewer_id"`
+    ReplacedUserID string    `db:"replaced_user_id"`
+}
+
+// PREventFilter - условия выборки истории; UserID совпадает с автором, ревьювером или снятым ревьювером
+type PREventFilter struct {
+    AfterID  int64
+    TeamName string
+    UserID   string
+    Limit    int
+}
+
+// IdempotencyKey - сохраненный ответ на запрос с заголовком Idempotency-Key. Status 0 означает,
+// что запрос еще выполняется и ответа пока нет.
+type IdempotencyKey struct {
+    Owner       string    `db:"owner"`
+    Key         string    `db:"key"`
+    RequestHash string    `db:"request_hash"`
+    Status      int       `db:"status"`
+    ContentType string    `db:"content_type"`
+    ETag        string    `db:"etag"`
+    Body        []byte    `db:"body"`
+    CreatedAt   time.Time `db:"created_at"`
+    ExpiresAt   time.Time `db:"expires_at"`
+}
+
+// Membership - участие пользователя в команде
+type Membership struct {
+    TeamName string `json:"team_name" db:"team_name"`
+    UserID   string `json:"user_id" db:"user_id"`
+    IsLead   bool   `json:"is_lead" db:"is_lead"`
+}
+
+// PRRecord - PR вместе со временем создания и merge, как он хранится в таблице
+type PRRecord struct {
+    ID        string     `json:"pull_request_id" db:"id"`
+    Title     string     `json:"pull_request_name" db:"title"`
+    AuthorID  string     `json:"author_id" db:"author_id"`
+    Status    string     `json:"status" db:"status" enum:"OPEN,MERGED"`
+    CreatedAt *time.Time `json:"created_at" db:"created_at"`
+    MergedAt  *time.Time `json:"merged_at" db:"merged_at"`
+}
+
+// Reviewer - назначение ревьювера на PR
+type Reviewer struct {
+    PRID   string `json:"pull_request_id" db:"pr_id"`
+    UserID string `json:"user_id" db:"user_id"`
+}
+
+// Assignment - запись истории назначений, по которой считается статистика
+type Assignment struct {
+    PRID      string    `json:"pull_request_id" db:"pr_id"`
+    UserID    string    `json:"user_id" db:"user_id"`
+    EventTime time.Time `json:"event_time" db:"event_time"`
+}
+
+// JSONB - снимок состояния в колонке jsonb; пустое значение хранится как NULL
+type JSONB json.RawMessage
+
+func (j JSONB) Value() (driver.Value, error) {
+    if len(j) == 0 {
+        return nil, nil
+    }
+    return string(j), nil
+}
+
+func (j *JSONB) Scan(src interface{}) error {
+    switch v := src.(type) {
+    case nil:
+        *j = nil
+    case []byte:
+        *j = append(JSONB(nil), v...)
+    case string:
+        *j = JSONB(v)
+    default:
+        return fmt.Errorf("unsupported jsonb source %T", src)
+    }
+    return nil
+}
+
+func (j JSONB) MarshalJSON() ([]byte, error) {
+    if len(j) == 0 {
+        return []byte("null"), nil
+    }
+    return j, nil
+}
+
+func (j *JSONB) UnmarshalJSON(data []byte) error {
+    if string(data) == "null" {
+        *j = nil
+        return nil
+    }
+    *j = append(JSONB(nil), data...)
+    return nil
+}
+
 // Users
 func (r *Repo) CreateUser(ctx context.Context, userID, username string) error {
-    _, err := r.db.ExecContext(ctx, 
+    _, err := r.q.ExecContext(ctx, 
         "INSERT INTO users (id, name) VALUES ($1, $2) ON CONFLICT (id) DO UPDATE SET name = $2", 
         userID, username)
     return err
@@ -87,41 +342,56 @@ func (r *Repo) CreateUser(ctx context.Context, userID, username string) error {
 
 func (r *Repo) GetUserByID(ctx context.Context, userID string) (*User, error) {
     var u User
-    err := r.db.GetContext(ctx, &u, "SELECT id, name, is_active FROM users WHERE id=$1", userID)
+    err := sqlx.GetContext(ctx, r.q, &u, "SELECT id, name, is_active FROM users WHERE id=$1", userID)
     if err != nil {
         return nil, err
     }
     return &u, nil
 }
 
+// SetUserActive меняет активность; если она действительно меняется, версии команд пользователя растут
 func (r *Repo) SetUserActive(ctx context.Context, userID string, active bool) error {
-    _, err := r.db.ExecContext(ctx, "UPDATE users SET is_active=$1 WHERE id=$2", active, userID)
+    _, err := r.q.ExecContext(ctx, `
+        UPDATE teams SET version = version + 1 
+        WHERE id IN (SELECT team_id FROM team_members WHERE user_id = $1) 
+            AND EXISTS (SELECT 1 FROM users WHERE id = $1 AND is_active <> $2)
+    `, userID, active)
+    if err != nil {
+        return err
+    }
+    _, err = r.q.ExecContext(ctx, "UPDATE users SET is_active=$1 WHERE id=$2", active, userID)
     return err
 }
 
+func (r *Repo) ListUsers(ctx context.Context) ([]User, error) {
+    var users []User
+    err := sqlx.SelectContext(ctx, r.q, &users, "SELECT id, name, is_active FROM users ORDER BY id")
+    return users, err
+}
+
 // Teams
 func (r *Repo) TeamExists(ctx context.Context, name string) (bool, error) {
     var count int
-    err := r.db.GetContext(ctx, &count, "SELECT COUNT(*) FROM teams WHERE name = $1", name)
+    err := sqlx.GetContext(ctx, r.q, &count, "SELECT COUNT(*) FROM teams WHERE name = $1", name)
     return count > 0, err
 }
 
 func (r *Repo) CreateTeam(ctx context.Context, name string) (int64, error) {
     var id int64
-    err := r.db.QueryRowContext(ctx, "INSERT INTO teams (name) VALUES ($1) RETURNING id", name).Scan(&id)
+    err := r.q.QueryRowxContext(ctx, "INSERT INTO teams (name) VALUES ($1) RETURNING id", name).Scan(&id)
     return id, err
 }
 
 func (r *Repo) AddMember(ctx context.Context, teamID int64, userID string) error {
-    _, err := r.db.ExecContext(ctx, 
+    res, err := r.q.ExecContext(ctx, 
         "INSERT INTO team_members (team_id, user_id) VALUES ($1, $2) ON CONFLICT DO NOTHING", 
         teamID, userID)
-    return err
+    return r.bumpIfChanged(ctx, res, err, "teams", teamID)
 }
 
 func (r *Repo) GetTeamByName(ctx context.Context, name string) (*Team, error) {
     var t Team
-    err := r.db.GetContext(ctx, &t, "SELECT id, name FROM teams WHERE name=$1", name)
+    err := sqlx.GetContext(ctx, r.q, &t, "SELECT id, name, version FROM teams WHERE name=$1", name)
     if err != nil {
         return nil, err
     }
@@ -130,8 +400,8 @@ func (r *Repo) GetTeamByName(ctx context.Context, name string) (*Team, error) {
 
 func (r *Repo) GetTeamMembers(ctx context.Context, teamName string) ([]User, error) {
     var users []User
-    err := r.db.SelectContext(ctx, &users, `
-        SELECT u.id, u.name, u.is_active 
+    err := sqlx.SelectContext(ctx, r.q, &users, `
+        SELECT u.id, u.name, u.is_active, tm.is_lead 
         FROM users u 
         JOIN team_members tm ON u.id = tm.user_id 
         JOIN teams t ON t.id = tm.team_id 
@@ -142,7 +412,7 @@ func (r *Repo) GetTeamMembers(ctx context.Context, teamName string) ([]User, err
 
 func (r *Repo) GetActiveTeamMembersExcept(ctx context.Context, teamName string, excludeUserID string) ([]User, error) {
     var users []User
-    err := r.db.SelectContext(ctx, &users, `
+    err := sqlx.SelectContext(ctx, r.q, &users, `
         SELECT u.id, u.name, u.is_active 
         FROM users u 
         JOIN team_members tm ON u.id = tm.user_id 
@@ -152,24 +422,86 @@ func (r *Repo) GetActiveTeamMembersExcept(ctx context.Context, teamName string,
     return users, err
 }
 
+func (r *Repo) RemoveMember(ctx context.Context, teamID int64, userID string) error {
+    res, err := r.q.ExecContext(ctx, 
+        "DELETE FROM team_members WHERE team_id = $1 AND user_id = $2", 
+        teamID, userID)
+    return r.bumpIfChanged(ctx, res, err, "teams", teamID)
+}
+
+func (r *Repo) SetTeamLead(ctx context.Context, teamID int64, userID string, isLead bool) error {
+    res, err := r.q.ExecContext(ctx, 
+        "UPDATE team_members SET is_lead = $1 WHERE team_id = $2 AND user_id = $3 AND is_lead <> $1", 
+        isLead, teamID, userID)
+    return r.bumpIfChanged(ctx, res, err, "teams", teamID)
+}
+
+func (r *Repo) RenameTeam(ctx context.Context, teamID int64, name string) error {
+    _, err := r.q.ExecContext(ctx, "UPDATE teams SET name=$1, version = version + 1 WHERE id=$2 AND name <> $1", name, teamID)
+    return err
+}
+
+// MatchTeamVersion сверяет версию команды и блокирует ее строку до конца транзакции:
+// параллельное изменение дождется коммита и увидит уже новую версию
+func (r *Repo) MatchTeamVersion(ctx context.Context, teamID int64, version int64) (bool, error) {
+    res, err := r.q.ExecContext(ctx, "UPDATE teams SET version = version WHERE id = $1 AND version = $2", teamID, version)
+    if err != nil {
+        return false, err
+    }
+    n, err := res.RowsAffected()
+    return n == 1, err
+}
+
+func (r *Repo) GetTeamByID(ctx context.Context, teamID int64) (*Team, error) {
+    var t Team
+    err := sqlx.GetContext(ctx, r.q, &t, "SELECT id, name, version FROM teams WHERE id=$1", teamID)
+    if err != nil {
+        return nil, err
+    }
+    return &t, nil
+}
+
+func (r *Repo) ListTeams(ctx context.Context) ([]Team, error) {
+    var teams []Team
+    err := sqlx.SelectContext(ctx, r.q, &teams, "SELECT id, name FROM teams ORDER BY id")
+    return teams, err
+}
+
+func (r *Repo) DeleteTeam(ctx context.Context, teamID int64) error {
+    _, err := r.q.ExecContext(ctx, "DELETE FROM teams WHERE id=$1", teamID)
+    return err
+}
+
+func (r *Repo) GetUserTeams(ctx context.Context, userID string) ([]Team, error) {
+    var teams []Team
+    err := sqlx.SelectContext(ctx, r.q, &teams, `
+        SELECT t.id, t.name 
+        FROM teams t 
+        JOIN team_members tm ON t.id = tm.team_id 
+        WHERE tm.user_id = $1 
+        ORDER BY t.id
+    `, userID)
+    return teams, err
+}
+
 // PRs
 func (r *Repo) PRExists(ctx context.Context, prID string) (bool, error) {
     var count int
-    err := r.db.GetContext(ctx, &count, "SELECT COUNT(*) FROM prs WHERE id = $1", prID)
+    err := sqlx.GetContext(ctx, r.q, &count, "SELECT COUNT(*) FROM prs WHERE id = $1", prID)
     return count > 0, err
 }
 
 func (r *Repo) CreatePRWithID(ctx context.Context, prID, title, authorID string) error {
-    _, err := r.db.ExecContext(ctx, 
-        "INSERT INTO prs (id, title, author_id) VALUES ($1, $2, $3)", 
-        prID, title, authorID)
+    _, err := r.q.ExecContext(ctx, 
+        "INSERT INTO prs (id, title, author_id, created_at) VALUES ($1, $2, $3, $4)", 
+        prID, title, authorID, now())
     return err
 }
 
 func (r *Repo) GetPRByID(ctx context.Context, prID string) (*PR, error) {
     var p PR
-    err := r.db.GetContext(ctx, &p, 
-        "SELECT id, title, author_id, status FROM prs WHERE id = $1", prID)
+    err := sqlx.GetContext(ctx, r.q, &p, 
+        "SELECT id, title, author_id, status, version FROM prs WHERE id = $1", prID)
     if err != nil {
         return nil, err
     }
@@ -177,22 +509,32 @@ func (r *Repo) GetPRByID(ctx context.Context, prID string) (*PR, error) {
 }
 
 func (r *Repo) AddReviewer(ctx context.Context, prID, userID string) error {
-    _, err := r.db.ExecContext(ctx, 
+    res, err := r.q.ExecContext(ctx, 
         "INSERT INTO pr_reviewers (pr_id, user_id) VALUES ($1, $2) ON CONFLICT DO NOTHING", 
         prID, userID)
-    return err
+    return r.bumpIfChanged(ctx, res, err, "prs", prID)
 }
 
 func (r *Repo) RemoveReviewer(ctx context.Context, prID, userID string) error {
-    _, err := r.db.ExecContext(ctx, 
+    res, err := r.q.ExecContext(ctx, 
         "DELETE FROM pr_reviewers WHERE pr_id = $1 AND user_id = $2", 
         prID, userID)
-    return err
+    return r.bumpIfChanged(ctx, res, err, "prs", prID)
+}
+
+// MatchPRVersion сверяет версию PR и блокирует его строку до конца транзакции, как MatchTeamVersion
+func (r *Repo) MatchPRVersion(ctx context.Context, prID string, version int64) (bool, error) {
+    res, err := r.q.ExecContext(ctx, "UPDATE prs SET version = version WHERE id = $1 AND version = $2", prID, version)
+    if err != nil {
+        return false, err
+    }
+    n, err := res.RowsAffected()
+    return n == 1, err
 }
 
 func (r *Repo) GetPRReviewers(ctx context.Context, prID string) ([]User, error) {
     var users []User
-    err := r.db.SelectContext(ctx, &users, `
+    err := sqlx.SelectContext(ctx, r.q, &users, `
         SELECT u.id, u.name, u.is_active 
         FROM pr_reviewers pr 
         JOIN users u ON u.id = pr.user_id 
@@ -201,14 +543,22 @@ func (r *Repo) GetPRReviewers(ctx context.Context, prID string) ([]User, error)
     return users, err
 }
 
+// SetPRStatus меняет статус PR; при переходе в MERGED запоминается время мержа, при возврате в OPEN оно сбрасывается
 func (r *Repo) SetPRStatus(ctx context.Context, prID string, status string) error {
-    _, err := r.db.ExecContext(ctx, "UPDATE prs SET status=$1 WHERE id=$2", status, prID)
+    var mergedAt *time.Time
+    if status == "MERGED" {
+        t := now()
+        mergedAt = &t
+    }
+    _, err := r.q.ExecContext(ctx, 
+        "UPDATE prs SET status = $1, merged_at = $2, version = version + 1 WHERE id = $3 AND status <> $1", 
+        status, mergedAt, prID)
     return err
 }
 
 func (r *Repo) GetPRsByReviewer(ctx context.Context, userID string) ([]PR, error) {
     var prs []PR
-    err := r.db.SelectContext(ctx, &prs, `
+    err := sqlx.SelectContext(ctx, r.q, &prs, `
         SELECT p.id, p.title, p.author_id, p.status 
         FROM prs p 
         JOIN pr_reviewers pr ON p.id = pr.pr_id 
@@ -217,13 +567,28 @@ func (r *Repo) GetPRsByReviewer(ctx context.Context, userID string) ([]PR, error
     return prs, err
 }
 
+// GetOpenPRsByTeam возвращает открытые PR, авторы которых состоят в команде
+func (r *Repo) GetOpenPRsByTeam(ctx context.Context, teamName string) ([]PR, error) {
+    prs := []PR{}
+    err := sqlx.SelectContext(ctx, r.q, &prs, `
+        SELECT p.id, p.title, p.author_id, p.status, p.version 
+        FROM prs p 
+        JOIN team_members tm ON p.author_id = tm.user_id 
+        JOIN teams t ON t.id = tm.team_id 
+        WHERE t.name = $1 AND p.status = 'OPEN' 
+        ORDER BY p.created_at, p.id
+    `, teamName)
+    return prs, err
+}
+
 func (r *Repo) GetUserTeam(ctx context.Context, userID string) (string, error) {
     var teamName string
-    err := r.db.GetContext(ctx, &teamName, `
+    err := sqlx.GetContext(ctx, r.q, &teamName, `
         SELECT t.name 
         FROM teams t 
         JOIN team_members tm ON t.id = tm.team_id 
         WHERE tm.user_id = $1 
+        ORDER BY t.id 
         LIMIT 1
     `, userID)
     if err != nil {
@@ -233,27 +598,21 @@ func (r *Repo) GetUserTeam(ctx context.Context, userID string) (string, error) {
 }
 
 func (r *Repo) GetRandomActiveTeamMember(ctx context.Context, teamName, excludeUserID string) (*User, error) {
-    var user User
-    err := r.db.GetContext(ctx, &user, `
-        SELECT u.id, u.name, u.is_active 
-        FROM users u 
-        JOIN team_members tm ON u.id = tm.user_id 
-        JOIN teams t ON t.id = tm.team_id 
-        WHERE t.name = $1 AND u.is_active = true AND u.id != $2
-        ORDER BY RANDOM()
-        LIMIT 1
-    `, teamName, excludeUserID)
+    candidates, err := r.GetActiveTeamMembersExcept(ctx, teamName, excludeUserID)
     if err != nil {
         return nil, err
     }
-    return &user, nil
+    if len(candidates) == 0 {
+        return nil, sql.ErrNoRows
+    }
+    return &candidates[rand.Intn(len(candidates))], nil
 }
 
 // Assignment events
 func (r *Repo) AddAssignmentEvent(ctx context.Context, prID, userID string) error {
-    _, err := r.db.ExecContext(ctx, 
-        "INSERT INTO assignment_events (pr_id, user_id) VALUES ($1, $2)", 
-        prID, userID)
+    _, err := r.q.ExecContext(ctx, 
+        "INSERT INTO assignment_events (pr_id, user_id, event_time) VALUES ($1, $2, $3)", 
+        prID, userID, now())
     return err
 }
 
@@ -266,7 +625,7 @@ func (r *Repo) GetAssignmentStats(ctx context.Context) (map[string]int, error) {
     }
     var userStatsList []userStats
     
-    err := r.db.SelectContext(ctx, &userStatsList, `
+    err := sqlx.SelectContext(ctx, r.q, &userStatsList, `
         SELECT user_id, COUNT(*) as assignment_count 
         FROM assignment_events 
         GROUP BY user_id
@@ -283,8 +642,20 @@ func (r *Repo) GetAssignmentStats(ctx context.Context) (map[string]int, error) {
 }
 
 // Bulk operations
+// DeactivateTeamMembers деактивирует участников команды; растут версии всех команд, где были активные из них
 func (r *Repo) DeactivateTeamMembers(ctx context.Context, teamID int64) error {
-    _, err := r.db.ExecContext(ctx, 
+    _, err := r.q.ExecContext(ctx, `
+        UPDATE teams SET version = version + 1 
+        WHERE id IN (
+            SELECT tm.team_id FROM team_members tm 
+            JOIN users u ON u.id = tm.user_id 
+            WHERE u.is_active = true AND tm.user_id IN (SELECT user_id FROM team_members WHERE team_id = $1)
+        )
+    `, teamID)
+    if err != nil {
+        return err
+    }
+    _, err = r.q.ExecContext(ctx, 
         "UPDATE users SET is_active = false WHERE id IN (SELECT user_id FROM team_members WHERE team_id=$1)", 
         teamID)
     return err
@@ -295,18 +666,345 @@ func (r *Repo) GetOpenPRsWithReviewersByUserIDs(ctx context.Context, userIDs []s
         return []PR{}, nil
     }
     
-    query, args, err := sqlx.In(`
-        SELECT DISTINCT p.id, p.title, p.author_id, p.status 
+    args := make([]interface{}, len(userIDs))
+    for i, id := range userIDs {
+        args[i] = id
+    }
+    // Строка на пару PR-ревьювер; строки одного PR идут подряд и собираются в один PR
+    var rows []struct {
+        PR
+        ReviewerID     string `db:"reviewer_id"`
+        ReviewerName   string `db:"reviewer_name"`
+        ReviewerActive bool   `db:"reviewer_active"`
+    }
+    err := sqlx.SelectContext(ctx, r.q, &rows, `
+        SELECT p.id, p.title, p.author_id, p.status, 
+               u.id AS reviewer_id, u.name AS reviewer_name, u.is_active AS reviewer_active 
         FROM prs p 
         JOIN pr_reviewers pr ON p.id = pr.pr_id 
-        WHERE p.status = 'OPEN' AND pr.user_id IN (?)
-    `, userIDs)
+        JOIN users u ON u.id = pr.user_id 
+        WHERE p.status = 'OPEN' AND pr.user_id IN (`+placeholders(1, len(args))+`) 
+        ORDER BY p.created_at, p.id, u.id
+    `, args...)
     if err != nil {
         return nil, err
     }
-    
-    query = r.db.Rebind(query)
-    var prs []PR
-    err = r.db.SelectContext(ctx, &prs, query, args...)
+
+    prs := []PR{}
+    for _, row := range rows {
+        if len(prs) == 0 || prs[len(prs)-1].ID != row.ID {
+            prs = append(prs, row.PR)
+        }
+        last := &prs[len(prs)-1]
+        last.Reviewers = append(last.Reviewers, User{ID: row.ReviewerID, Name: row.ReviewerName, IsActive: row.ReviewerActive})
+    }
+    return prs, nil
+}
+
+// API tokens
+func (r *Repo) CreateAPIToken(ctx context.Context, token *APIToken) (int64, error) {
+    var id int64
+    err := r.q.QueryRowxContext(ctx, 
+        "INSERT INTO api_tokens (name, token_hash, scopes, user_id, created_at) VALUES ($1, $2, $3, $4, $5) RETURNING id", 
+        token.Name, token.TokenHash, token.Scopes, token.UserID, now()).Scan(&id)
+    return id, err
+}
+
+func (r *Repo) GetAPITokenByHash(ctx context.Context, tokenHash string) (*APIToken, error) {
+    var t APIToken
+    err := sqlx.GetContext(ctx, r.q, &t, `
+        SELECT id, name, token_hash, scopes, user_id, created_at, revoked_at 
+        FROM api_tokens 
+        WHERE token_hash = $1
+    `, tokenHash)
+    if err != nil {
+        return nil, err
+    }
+    return &t, nil
+}
+
+func (r *Repo) ListAPITokens(ctx context.Context) ([]APIToken, error) {
+    var tokens []APIToken
+    err := sqlx.SelectContext(ctx, r.q, &tokens, `
+        SELECT id, name, token_hash, scopes, user_id, created_at, revoked_at 
+        FROM api_tokens 
+        ORDER BY id
+    `)
+    return tokens, err
+}
+
+// RevokeAPIToken отзывает токен; false - токена нет или он уже отозван
+func (r *Repo) RevokeAPIToken(ctx context.Context, id int64) (bool, error) {
+    res, err := r.q.ExecContext(ctx, 
+        "UPDATE api_tokens SET revoked_at = $1 WHERE id = $2 AND revoked_at IS NULL", 
+        now(), id)
+    if err != nil {
+        return false, err
+    }
+    n, err := res.RowsAffected()
+    return n == 1, err
+}
+
+// Audit log
+func (r *Repo) AddAuditEntry(ctx context.Context, entry *AuditEntry) error {
+    entry.CreatedAt = now()
+    return r.q.QueryRowxContext(ctx, `
+        INSERT INTO audit_log (actor, action, target_type, target_id, before, after, request_id, source_ip, created_at) 
+        VALUES ($1, $2, $3, $4, $5, $6, NULLIF($7, ''), NULLIF($8, ''), $9) 
+        RETURNING id
+    `, entry.Actor, entry.Action, entry.TargetType, entry.TargetID, entry.Before, entry.After, 
+        entry.RequestID, entry.SourceIP, entry.CreatedAt).Scan(&entry.ID)
+}
+
+func (r *Repo) ListAuditEntries(ctx context.Context, filter AuditFilter) ([]AuditEntry, error) {
+    var conds []string
+    var args []interface{}
+    add := func(cond string, arg interface{}) {
+        args = append(args, arg)
+        conds = append(conds, fmt.Sprintf(cond, len(args)))
+    }
+
+    if filter.Actor != "" {
+        add("actor = $%d", filter.Actor)
+    }
+    if filter.TargetType != "" {
+        add("target_type = $%d", filter.TargetType)
+    }
+    if filter.TargetID != "" {
+        add("target_id = $%d", filter.TargetID)
+    }
+    if filter.From != nil {
+        add("created_at >= $%d", filter.From.UTC())
+    }
+    if filter.To != nil {
+        add("created_at < $%d", filter.To.UTC())
+    }
+
+    query := `
+        SELECT id, created_at, actor, action, target_type, target_id, before, after, 
+            COALESCE(request_id, '') AS request_id, COALESCE(source_ip, '') AS source_ip 
+        FROM audit_log`
+    if len(conds) > 0 {
+        query += " WHERE " + strings.Join(conds, " AND ")
+    }
+    query += " ORDER BY created_at DESC, id DESC"
+    if filter.Limit > 0 {
+        args = append(args, filter.Limit)
+        query += fmt.Sprintf(" LIMIT $%d", len(args))
+    }
+
+    entries := []AuditEntry{}
+    err := sqlx.SelectContext(ctx, r.q, &entries, query, args...)
+    return entries, err
+}
+
+func (r *Repo) AddPREvent(ctx context.Context, event *PREvent) error {
+    event.CreatedAt = now()
+    return r.q.QueryRowxContext(ctx, `
+        INSERT INTO pr_events (type, pr_id, team_name, author_id, reviewer_id, replaced_user_id, created_at) 
+        VALUES ($1, $2, NULLIF($3, ''), $4, NULLIF($5, ''), NULLIF($6, ''), $7) 
+        RETURNING id
+    `, event.Type, event.PRID, event.TeamName, event.AuthorID, event.ReviewerID, 
+        event.ReplacedUserID, event.CreatedAt).Scan(&event.ID)
+}
+
+func (r *Repo) ListPREvents(ctx context.Context, filter PREventFilter) ([]PREvent, error) {
+    args := []interface{}{filter.AfterID}
+    conds := []string{"id > $1"}
+    if filter.TeamName != "" {
+        args = append(args, filter.TeamName)
+        conds = append(conds, fmt.Sprintf("team_name = $%d", len(args)))
+    }
+    if filter.UserID != "" {
+        args = append(args, filter.UserID)
+        conds = append(conds, fmt.Sprintf("(author_id = $%[1]d OR reviewer_id = $%[1]d OR replaced_user_id = $%[1]d)", len(args)))
+    }
+
+    query := `
+        SELECT id, created_at, type, pr_id, COALESCE(team_name, '') AS team_name, author_id, 
+            COALESCE(reviewer_id, '') AS reviewer_id, COALESCE(replaced_user_id, '') AS replaced_user_id 
+        FROM pr_events 
+        WHERE ` + strings.Join(conds, " AND ") + `
+        ORDER BY id`
+    if filter.Limit > 0 {
+        args = append(args, filter.Limit)
+        query += fmt.Sprintf(" LIMIT $%d", len(args))
+    }
+
+    events := []PREvent{}
+    err := sqlx.SelectContext(ctx, r.q, &events, query, args...)
+    return events, err
+}
+
+// Idempotency keys
+
+// CreateIdempotencyKey резервирует ключ; false - ключ этого владельца уже есть (возможно, истекший)
+func (r *Repo) CreateIdempotencyKey(ctx context.Context, key *IdempotencyKey) (bool, error) {
+    key.CreatedAt = now()
+    key.ExpiresAt = key.ExpiresAt.UTC().Truncate(time.Microsecond)
+    res, err := r.q.ExecContext(ctx, `
+        INSERT INTO idempotency_keys (owner, key, request_hash, created_at, expires_at) 
+        VALUES ($1, $2, $3, $4, $5) 
+        ON CONFLICT (owner, key) DO NOTHING
+    `, key.Owner, key.Key, key.RequestHash, key.CreatedAt, key.ExpiresAt)
+    if err != nil {
+        return false, err
+    }
+    n, err := res.RowsAffected()
+    return n == 1, err
+}
+
+func (r *Repo) GetIdempotencyKey(ctx context.Context, owner, key string) (*IdempotencyKey, error) {
+    var k IdempotencyKey
+    err := sqlx.GetContext(ctx, r.q, &k, `
+        SELECT owner, key, request_hash, status, COALESCE(content_type, '') AS content_type, COALESCE(etag, '') AS etag, 
+            body, created_at, expires_at 
+        FROM idempotency_keys 
+        WHERE owner = $1 AND key = $2
+    `, owner, key)
+    if err != nil {
+        return nil, err
+    }
+    return &k, nil
+}
+
+// CompleteIdempotencyKey сохраняет ответ на резервацию key.CreatedAt и продлевает ее хранение до key.ExpiresAt;
+// false - резервации уже нет (ключ освобожден или занят заново после истечения аренды)
+func (r *Repo) CompleteIdempotencyKey(ctx context.Context, key *IdempotencyKey) (bool, error) {
+    res, err := r.q.ExecContext(ctx, `
+        UPDATE idempotency_keys SET status = $1, content_type = $2, etag = $3, body = $4, expires_at = $5 
+        WHERE owner = $6 AND key = $7 AND created_at = $8 AND status = 0
+    `, key.Status, key.ContentType, key.ETag, key.Body, key.ExpiresAt.UTC(), key.Owner, key.Key, key.CreatedAt.UTC())
+    if err != nil {
+        return false, err
+    }
+    n, err := res.RowsAffected()
+    return n == 1, err
+}
+
+// DeleteIdempotencyKey удаляет резервацию createdAt; более новую резервацию того же ключа не трогает
+func (r *Repo) DeleteIdempotencyKey(ctx context.Context, owner, key string, createdAt time.Time) error {
+    _, err := r.q.ExecContext(ctx, "DELETE FROM idempotency_keys WHERE owner = $1 AND key = $2 AND created_at = $3", 
+        owner, key, createdAt.UTC())
+    return err
+}
+
+// DeleteExpiredIdempotencyKeys удаляет ключи, истекшие к моменту before, и возвращает их число
+func (r *Repo) DeleteExpiredIdempotencyKeys(ctx context.Context, before time.Time) (int64, error) {
+    res, err := r.q.ExecContext(ctx, "DELETE FROM idempotency_keys WHERE expires_at <= $1", before.UTC())
+    if err != nil {
+        return 0, err
+    }
+    return res.RowsAffected()
+}
+
+// Export / import
+func (r *Repo) ListMemberships(ctx context.Context) ([]Membership, error) {
+    memberships := []Membership{}
+    err := sqlx.SelectContext(ctx, r.q, &memberships, `
+        SELECT t.name AS team_name, tm.user_id, tm.is_lead 
+        FROM team_members tm 
+        JOIN teams t ON t.id = tm.team_id 
+        ORDER BY t.name, tm.user_id
+    `)
+    return memberships, err
+}
+
+func (r *Repo) ListPRRecords(ctx context.Context) ([]PRRecord, error) {
+    prs := []PRRecord{}
+    err := sqlx.SelectContext(ctx, r.q, &prs,
+        "SELECT id, title, author_id, status, created_at, merged_at FROM prs ORDER BY created_at, id")
     return prs, err
-}
\ No newline at end of file
+}
+
+func (r *Repo) ListReviewers(ctx context.Context) ([]Reviewer, error) {
+    reviewers := []Reviewer{}
+    err := sqlx.SelectContext(ctx, r.q, &reviewers, "SELECT pr_id, user_id FROM pr_reviewers ORDER BY pr_id, user_id")
+    return reviewers, err
+}
+
+func (r *Repo) ListAssignments(ctx context.Context) ([]Assignment, error) {
+    assignments := []Assignment{}
+    err := sqlx.SelectContext(ctx, r.q, &assignments, "SELECT pr_id, user_id, event_time FROM assignment_events ORDER BY id")
+    return assignments, err
+}
+
+// UpsertPR создает PR или перезаписывает все его поля, включая время создания и merge
+func (r *Repo) UpsertPR(ctx context.Context, pr PRRecord) error {
+    createdAt := now()
+    if pr.CreatedAt != nil {
+        createdAt = pr.CreatedAt.UTC()
+    }
+    var mergedAt *time.Time
+    if pr.MergedAt != nil {
+        t := pr.MergedAt.UTC()
+        mergedAt = &t
+    }
+    _, err := r.q.ExecContext(ctx, `
+        INSERT INTO prs (id, title, author_id, status, created_at, merged_at) 
+        VALUES ($1, $2, $3, $4, $5, $6) 
+        ON CONFLICT (id) DO UPDATE SET 
+            title = EXCLUDED.title, author_id = EXCLUDED.author_id, status = EXCLUDED.status, 
+            created_at = EXCLUDED.created_at, merged_at = EXCLUDED.merged_at, version = prs.version + 1
+    `, pr.ID, pr.Title, pr.AuthorID, pr.Status, createdAt, mergedAt)
+    return err
+}
+
+// RestoreAssignment добавляет запись истории, если такой же (PR, пользователь, время) еще нет,
+// поэтому повторный импорт не удваивает статистику
+func (r *Repo) RestoreAssignment(ctx context.Context, a Assignment) error {
+    _, err := r.q.ExecContext(ctx, `
+        INSERT INTO assignment_events (pr_id, user_id, event_time) 
+        SELECT $1, $2, $3 
+        WHERE NOT EXISTS (
+            SELECT 1 FROM assignment_events WHERE pr_id = $1 AND user_id = $2 AND event_time = $3
+        )
+    `, a.PRID, a.UserID, a.EventTime.UTC())
+    return err
+}
+
+// ResetState удаляет команды, PR, назначения и всех пользователей, кроме keepUserIDs;
+// токены удаленных пользователей удаляются каскадно, журнал аудита и история событий остаются.
+// Возвращает наибольшую версию удаленных команд и PR: восстановленные строки сдвигаются выше нее (ShiftVersions).
+func (r *Repo) ResetState(ctx context.Context, keepUserIDs []string) (int64, error) {
+    var maxVersion int64
+    err := sqlx.GetContext(ctx, r.q, &maxVersion, 
+        "SELECT COALESCE(MAX(version), 0) FROM (SELECT version FROM prs UNION ALL SELECT version FROM teams) v")
+    if err != nil {
+        return 0, err
+    }
+
+    for _, stmt := range []string{
+        "DELETE FROM assignment_events",
+        "DELETE FROM pr_reviewers",
+        "DELETE FROM prs",
+        "DELETE FROM team_members",
+        "DELETE FROM teams",
+    } {
+        if _, err := r.q.ExecContext(ctx, stmt); err != nil {
+            return 0, err
+        }
+    }
+
+    if len(keepUserIDs) == 0 {
+        _, err := r.q.ExecContext(ctx, "DELETE FROM users")
+        return maxVersion, err
+    }
+    args := make([]interface{}, len(keepUserIDs))
+    for i, id := range keepUserIDs {
+        args[i] = id
+    }
+    _, err = r.q.ExecContext(ctx, "DELETE FROM users WHERE id NOT IN ("+placeholders(1, len(args))+")", args...)
+    return maxVersion, err
+}
+
+// ShiftVersions увеличивает версии всех команд и PR на by, чтобы ETag, выданные до ResetState, не совпали
+// с версиями восстановленных строк
+func (r *Repo) ShiftVersions(ctx context.Context, by int64) error {
+    for _, table := range []string{"prs", "teams"} {
+        if _, err := r.q.ExecContext(ctx, "UPDATE "+table+" SET version = version + $1", by); err != nil {
+            return err
+        }
+    }
+    return nil
+}
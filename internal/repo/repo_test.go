@@ -0,0 +1,35 @@
+package repo_test
+
+import (
+    "os"
+    "testing"
+
+    _ "github.com/jackc/pgx/v5/stdlib"
+    "github.com/jmoiron/sqlx"
+
+    "pr-review-assigner/internal/repo"
+    "pr-review-assigner/internal/repo/repotest"
+)
+
+// TestConformance прогоняет общий набор на Postgres из TEST_DATABASE_URL с примененными миграциями;
+// перед каждым сценарием все таблицы очищаются, поэтому нужна отдельная тестовая база
+func TestConformance(t *testing.T) {
+    dsn := os.Getenv("TEST_DATABASE_URL")
+    if dsn == "" {
+        t.Skip("TEST_DATABASE_URL is not set")
+    }
+    db, err := sqlx.Connect("pgx", dsn)
+    if err != nil {
+        t.Fatalf("db connect: %v", err)
+    }
+    defer db.Close()
+
+    repotest.Run(t, func(t *testing.T) repo.RepoInterface {
+        _, err := db.Exec(`TRUNCATE teams, users, team_members, prs, pr_reviewers, assignment_events, 
+            api_tokens, audit_log, pr_events, idempotency_keys RESTART IDENTITY CASCADE`)
+        if err != nil {
+            t.Fatalf("truncate: %v", err)
+        }
+        return repo.New(db)
+    })
+}
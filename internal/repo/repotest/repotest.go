@@ -0,0 +1,790 @@
+// Package repotest - общий набор тестов, который должна проходить любая реализация repo.RepoInterface.
+// Сценарии проверяют наблюдаемое поведение SQL-версии, поэтому реализации не расходятся между собой.
+package repotest
+
+import (
+    "context"
+    "database/sql"
+    "errors"
+    "sort"
+    "testing"
+    "time"
+
+    "pr-review-assigner/internal/repo"
+)
+
+// Factory возвращает пустое хранилище для одного подтеста
+type Factory func(t *testing.T) repo.RepoInterface
+
+// Run запускает все сценарии; каждый получает собственное хранилище от newRepo
+func Run(t *testing.T, newRepo Factory) {
+    tests := []struct {
+        name string
+        fn   func(t *testing.T, r repo.RepoInterface)
+    }{
+        {"NotFound", testNotFound},
+        {"Users", testUsers},
+        {"TeamUniqueness", testTeamUniqueness},
+        {"Membership", testMembership},
+        {"ActivityFiltering", testActivityFiltering},
+        {"PRs", testPRs},
+        {"Reviewers", testReviewers},
+        {"OpenPRsByReviewers", testOpenPRsByReviewers},
+        {"Stats", testStats},
+        {"Tokens", testTokens},
+        {"Audit", testAudit},
+        {"PREvents", testPREvents},
+        {"IdempotencyKeys", testIdempotencyKeys},
+        {"Versions", testVersions},
+        {"Transactions", testTransactions},
+        {"ExportImport", testExportImport},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            tt.fn(t, newRepo(t))
+        })
+    }
+}
+
+var ctx = context.Background()
+
+func must(t *testing.T, err error) {
+    t.Helper()
+    if err != nil {
+        t.Fatal(err)
+    }
+}
+
+// seedTeam создает пользователей и команду из них
+func seedTeam(t *testing.T, r repo.RepoInterface, name string, userIDs ...string) int64 {
+    t.Helper()
+    for _, id := range userIDs {
+        must(t, r.CreateUser(ctx, id, "User "+id))
+    }
+    teamID, err := r.CreateTeam(ctx, name)
+    must(t, err)
+    for _, id := range userIDs {
+        must(t, r.AddMember(ctx, teamID, id))
+    }
+    return teamID
+}
+
+func userIDs(users []repo.User) []string {
+    ids := make([]string, len(users))
+    for i, u := range users {
+        ids[i] = u.ID
+    }
+    sort.Strings(ids)
+    return ids
+}
+
+func prIDs(prs []repo.PR) []string {
+    ids := make([]string, len(prs))
+    for i, p := range prs {
+        ids[i] = p.ID
+    }
+    sort.Strings(ids)
+    return ids
+}
+
+func equal(a, b []string) bool {
+    if len(a) != len(b) {
+        return false
+    }
+    for i := range a {
+        if a[i] != b[i] {
+            return false
+        }
+    }
+    return true
+}
+
+func testNotFound(t *testing.T, r repo.RepoInterface) {
+    if _, err := r.GetUserByID(ctx, "nobody"); !errors.Is(err, sql.ErrNoRows) {
+        t.Errorf("GetUserByID: expected sql.ErrNoRows, got %v", err)
+    }
+    if _, err := r.GetTeamByName(ctx, "missing"); !errors.Is(err, sql.ErrNoRows) {
+        t.Errorf("GetTeamByName: expected sql.ErrNoRows, got %v", err)
+    }
+    if _, err := r.GetTeamByID(ctx, 42); !errors.Is(err, sql.ErrNoRows) {
+        t.Errorf("GetTeamByID: expected sql.ErrNoRows, got %v", err)
+    }
+    if _, err := r.GetPRByID(ctx, "missing"); !errors.Is(err, sql.ErrNoRows) {
+        t.Errorf("GetPRByID: expected sql.ErrNoRows, got %v", err)
+    }
+    if _, err := r.GetUserTeam(ctx, "nobody"); !errors.Is(err, sql.ErrNoRows) {
+        t.Errorf("GetUserTeam: expected sql.ErrNoRows, got %v", err)
+    }
+    if _, err := r.GetAPITokenByHash(ctx, "missing"); !errors.Is(err, sql.ErrNoRows) {
+        t.Errorf("GetAPITokenByHash: expected sql.ErrNoRows, got %v", err)
+    }
+    if exists, err := r.TeamExists(ctx, "missing"); err != nil || exists {
+        t.Errorf("TeamExists: expected false, got %v, %v", exists, err)
+    }
+    if exists, err := r.PRExists(ctx, "missing"); err != nil || exists {
+        t.Errorf("PRExists: expected false, got %v, %v", exists, err)
+    }
+    if members, err := r.GetTeamMembers(ctx, "missing"); err != nil || len(members) != 0 {
+        t.Errorf("GetTeamMembers: expected no members, got %+v, %v", members, err)
+    }
+}
+
+func testUsers(t *testing.T, r repo.RepoInterface) {
+    must(t, r.CreateUser(ctx, "u2", "Bob"))
+    must(t, r.CreateUser(ctx, "u1", "Alice"))
+
+    u, err := r.GetUserByID(ctx, "u1")
+    if err != nil || u.Name != "Alice" || !u.IsActive {
+        t.Fatalf("expected new user to be active, got %+v, %v", u, err)
+    }
+
+    // ON CONFLICT (id) DO UPDATE меняет только имя
+    must(t, r.SetUserActive(ctx, "u1", false))
+    must(t, r.CreateUser(ctx, "u1", "Alice Smith"))
+    if u, _ := r.GetUserByID(ctx, "u1"); u.Name != "Alice Smith" || u.IsActive {
+        t.Errorf("expected upsert to rename and keep activity, got %+v", u)
+    }
+
+    // Обновление несуществующего пользователя не ошибка
+    must(t, r.SetUserActive(ctx, "nobody", true))
+
+    users, err := r.ListUsers(ctx)
+    must(t, err)
+    if len(users) != 2 || users[0].ID != "u1" || users[1].ID != "u2" {
+        t.Errorf("expected users ordered by id, got %+v", users)
+    }
+}
+
+func testTeamUniqueness(t *testing.T, r repo.RepoInterface) {
+    first, err := r.CreateTeam(ctx, "backend")
+    must(t, err)
+    if _, err := r.CreateTeam(ctx, "backend"); err == nil {
+        t.Error("expected duplicate team name to be rejected")
+    }
+    second, err := r.CreateTeam(ctx, "frontend")
+    must(t, err)
+    if second <= first {
+        t.Errorf("expected increasing team ids, got %d then %d", first, second)
+    }
+
+    if err := r.RenameTeam(ctx, second, "backend"); err == nil {
+        t.Error("expected rename onto an existing name to be rejected")
+    }
+    must(t, r.RenameTeam(ctx, second, "web"))
+    if team, err := r.GetTeamByID(ctx, second); err != nil || team.Name != "web" {
+        t.Errorf("expected renamed team, got %+v, %v", team, err)
+    }
+    if exists, _ := r.TeamExists(ctx, "frontend"); exists {
+        t.Error("expected old name to be free after rename")
+    }
+
+    teams, err := r.ListTeams(ctx)
+    must(t, err)
+    if len(teams) != 2 || teams[0].Name != "backend" || teams[1].Name != "web" {
+        t.Errorf("expected teams ordered by id, got %+v", teams)
+    }
+}
+
+func testMembership(t *testing.T, r repo.RepoInterface) {
+    backend := seedTeam(t, r, "backend", "u1", "u2")
+    frontend := seedTeam(t, r, "frontend", "u3")
+
+    // ON CONFLICT DO NOTHING: повторное добавление не дублирует и не сбрасывает лида
+    must(t, r.SetTeamLead(ctx, backend, "u1", true))
+    must(t, r.AddMember(ctx, backend, "u1"))
+    members, err := r.GetTeamMembers(ctx, "backend")
+    must(t, err)
+    if !equal(userIDs(members), []string{"u1", "u2"}) {
+        t.Fatalf("expected u1, u2 in backend, got %+v", members)
+    }
+    for _, m := range members {
+        if m.IsLead != (m.ID == "u1") {
+            t.Errorf("expected only u1 to lead, got %+v", m)
+        }
+    }
+
+    if err := r.AddMember(ctx, backend, "nobody"); err == nil {
+        t.Error("expected membership of an unknown user to be rejected")
+    }
+
+    // Пользователь может состоять в нескольких командах; GetUserTeam берет самую раннюю
+    must(t, r.AddMember(ctx, frontend, "u1"))
+    teams, err := r.GetUserTeams(ctx, "u1")
+    must(t, err)
+    if len(teams) != 2 || teams[0].Name != "backend" || teams[1].Name != "frontend" {
+        t.Errorf("expected u1 in backend and frontend, got %+v", teams)
+    }
+    if name, err := r.GetUserTeam(ctx, "u1"); err != nil || name != "backend" {
+        t.Errorf("expected backend as u1's team, got %q, %v", name, err)
+    }
+
+    must(t, r.RemoveMember(ctx, backend, "u1"))
+    must(t, r.RemoveMember(ctx, backend, "u1"))
+    if members, _ := r.GetTeamMembers(ctx, "backend"); !equal(userIDs(members), []string{"u2"}) {
+        t.Errorf("expected only u2 after removal, got %+v", members)
+    }
+
+    // Удаление команды каскадно удаляет участие, но не пользователей
+    must(t, r.DeleteTeam(ctx, frontend))
+    if teams, _ := r.GetUserTeams(ctx, "u3"); len(teams) != 0 {
+        t.Errorf("expected no teams for u3, got %+v", teams)
+    }
+    if _, err := r.GetUserByID(ctx, "u3"); err != nil {
+        t.Errorf("expected u3 to survive team deletion: %v", err)
+    }
+}
+
+func testActivityFiltering(t *testing.T, r repo.RepoInterface) {
+    backend := seedTeam(t, r, "backend", "u1", "u2", "u3", "u4")
+    seedTeam(t, r, "frontend", "u5")
+    must(t, r.SetUserActive(ctx, "u4", false))
+
+    active, err := r.GetActiveTeamMembersExcept(ctx, "backend", "u1")
+    must(t, err)
+    if !equal(userIDs(active), []string{"u2", "u3"}) {
+        t.Errorf("expected active u2, u3, got %+v", active)
+    }
+
+    for i := 0; i < 20; i++ {
+        u, err := r.GetRandomActiveTeamMember(ctx, "backend", "u2")
+        must(t, err)
+        if u.ID != "u1" && u.ID != "u3" {
+            t.Fatalf("expected an active member other than u2, got %+v", u)
+        }
+    }
+    if _, err := r.GetRandomActiveTeamMember(ctx, "frontend", "u5"); !errors.Is(err, sql.ErrNoRows) {
+        t.Errorf("expected sql.ErrNoRows without candidates, got %v", err)
+    }
+
+    must(t, r.DeactivateTeamMembers(ctx, backend))
+    if active, _ := r.GetActiveTeamMembersExcept(ctx, "backend", ""); len(active) != 0 {
+        t.Errorf("expected no active members after deactivation, got %+v", active)
+    }
+    if u, _ := r.GetUserByID(ctx, "u5"); !u.IsActive {
+        t.Error("expected other teams to stay active")
+    }
+}
+
+func testPRs(t *testing.T, r repo.RepoInterface) {
+    seedTeam(t, r, "backend", "u1", "u2")
+    seedTeam(t, r, "frontend", "u3")
+
+    if err := r.CreatePRWithID(ctx, "pr-1", "Feature", "nobody"); err == nil {
+        t.Error("expected PR of an unknown author to be rejected")
+    }
+    must(t, r.CreatePRWithID(ctx, "pr-1", "Feature", "u1"))
+    if err := r.CreatePRWithID(ctx, "pr-1", "Again", "u2"); err == nil {
+        t.Error("expected duplicate PR id to be rejected")
+    }
+    must(t, r.CreatePRWithID(ctx, "pr-2", "Fix", "u2"))
+    must(t, r.CreatePRWithID(ctx, "pr-3", "Styles", "u3"))
+
+    pr, err := r.GetPRByID(ctx, "pr-1")
+    if err != nil || pr.Title != "Feature" || pr.AuthorID != "u1" || pr.Status != "OPEN" {
+        t.Fatalf("expected open pr-1, got %+v, %v", pr, err)
+    }
+    if exists, _ := r.PRExists(ctx, "pr-1"); !exists {
+        t.Error("expected pr-1 to exist")
+    }
+
+    if err := r.SetPRStatus(ctx, "pr-1", "CLOSED"); err == nil {
+        t.Error("expected unknown status to be rejected")
+    }
+    before := time.Now().Add(-time.Second)
+    must(t, r.SetPRStatus(ctx, "pr-1", "MERGED"))
+    if pr, _ := r.GetPRByID(ctx, "pr-1"); pr.Status != "MERGED" {
+        t.Errorf("expected merged pr-1, got %+v", pr)
+    }
+    // Время мержа попадает в экспорт
+    records, err := r.ListPRRecords(ctx)
+    must(t, err)
+    for _, p := range records {
+        merged := p.MergedAt != nil && p.MergedAt.After(before) && p.MergedAt.Before(time.Now().Add(time.Second))
+        if (p.ID == "pr-1") != merged {
+            t.Errorf("expected merged_at only on merged pr-1, got %s %v", p.ID, p.MergedAt)
+        }
+    }
+
+    open, err := r.GetOpenPRsByTeam(ctx, "backend")
+    must(t, err)
+    if !equal(prIDs(open), []string{"pr-2"}) {
+        t.Errorf("expected only open backend PRs, got %+v", open)
+    }
+    if open, err := r.GetOpenPRsByTeam(ctx, "missing"); err != nil || open == nil || len(open) != 0 {
+        t.Errorf("expected empty non-nil list for unknown team, got %#v, %v", open, err)
+    }
+}
+
+func testReviewers(t *testing.T, r repo.RepoInterface) {
+    seedTeam(t, r, "backend", "u1", "u2", "u3")
+    must(t, r.CreatePRWithID(ctx, "pr-1", "Feature", "u1"))
+    must(t, r.CreatePRWithID(ctx, "pr-2", "Fix", "u1"))
+
+    // Повторное назначение и снятие идемпотентны
+    must(t, r.AddReviewer(ctx, "pr-1", "u2"))
+    must(t, r.AddReviewer(ctx, "pr-1", "u2"))
+    must(t, r.AddReviewer(ctx, "pr-1", "u3"))
+    must(t, r.AddReviewer(ctx, "pr-2", "u2"))
+    reviewers, err := r.GetPRReviewers(ctx, "pr-1")
+    must(t, err)
+    if !equal(userIDs(reviewers), []string{"u2", "u3"}) {
+        t.Fatalf("expected u2, u3 on pr-1, got %+v", reviewers)
+    }
+
+    if err := r.AddReviewer(ctx, "pr-1", "nobody"); err == nil {
+        t.Error("expected unknown reviewer to be rejected")
+    }
+    if err := r.AddReviewer(ctx, "missing", "u2"); err == nil {
+        t.Error("expected reviewer of an unknown PR to be rejected")
+    }
+
+    must(t, r.RemoveReviewer(ctx, "pr-1", "u2"))
+    must(t, r.RemoveReviewer(ctx, "pr-1", "u2"))
+    must(t, r.RemoveReviewer(ctx, "pr-1", "nobody"))
+    if reviewers, _ := r.GetPRReviewers(ctx, "pr-1"); !equal(userIDs(reviewers), []string{"u3"}) {
+        t.Errorf("expected only u3 after removal, got %+v", reviewers)
+    }
+
+    prs, err := r.GetPRsByReviewer(ctx, "u2")
+    must(t, err)
+    if !equal(prIDs(prs), []string{"pr-2"}) {
+        t.Errorf("expected u2 to review pr-2 only, got %+v", prs)
+    }
+}
+
+func testOpenPRsByReviewers(t *testing.T, r repo.RepoInterface) {
+    seedTeam(t, r, "backend", "u1", "u2", "u3", "u4")
+    for _, id := range []string{"pr-1", "pr-2", "pr-3"} {
+        must(t, r.CreatePRWithID(ctx, id, "PR "+id, "u1"))
+    }
+    must(t, r.AddReviewer(ctx, "pr-1", "u2"))
+    must(t, r.AddReviewer(ctx, "pr-1", "u3"))
+    must(t, r.AddReviewer(ctx, "pr-2", "u3"))
+    must(t, r.AddReviewer(ctx, "pr-3", "u2"))
+    must(t, r.SetPRStatus(ctx, "pr-3", "MERGED"))
+
+    // PR с несколькими подходящими ревьюверами возвращается один раз, merged - не возвращаются
+    prs, err := r.GetOpenPRsWithReviewersByUserIDs(ctx, []string{"u2", "u3"})
+    must(t, err)
+    if !equal(prIDs(prs), []string{"pr-1", "pr-2"}) {
+        t.Errorf("expected pr-1 and pr-2 once each, got %+v", prs)
+    }
+    // Reviewers - только запрошенные пользователи
+    for _, pr := range prs {
+        want := map[string][]string{"pr-1": {"u2", "u3"}, "pr-2": {"u3"}}[pr.ID]
+        if !equal(userIDs(pr.Reviewers), want) {
+            t.Errorf("expected %s reviewers %v, got %v", pr.ID, want, userIDs(pr.Reviewers))
+        }
+    }
+    if prs, err := r.GetOpenPRsWithReviewersByUserIDs(ctx, []string{"u2"}); err != nil || len(prs) != 1 || !equal(userIDs(prs[0].Reviewers), []string{"u2"}) {
+        t.Errorf("expected pr-1 with reviewer u2 only, got %+v, %v", prs, err)
+    }
+    if prs, err := r.GetOpenPRsWithReviewersByUserIDs(ctx, []string{"u4"}); err != nil || len(prs) != 0 {
+        t.Errorf("expected no PRs for u4, got %+v, %v", prs, err)
+    }
+    if prs, err := r.GetOpenPRsWithReviewersByUserIDs(ctx, nil); err != nil || prs == nil || len(prs) != 0 {
+        t.Errorf("expected empty non-nil list for no users, got %#v, %v", prs, err)
+    }
+}
+
+func testStats(t *testing.T, r repo.RepoInterface) {
+    stats, err := r.GetAssignmentStats(ctx)
+    if err != nil || stats == nil || len(stats) != 0 {
+        t.Fatalf("expected empty non-nil stats, got %#v, %v", stats, err)
+    }
+
+    seedTeam(t, r, "backend", "u1", "u2", "u3")
+    must(t, r.CreatePRWithID(ctx, "pr-1", "Feature", "u1"))
+    must(t, r.CreatePRWithID(ctx, "pr-2", "Fix", "u1"))
+    must(t, r.AddAssignmentEvent(ctx, "pr-1", "u2"))
+    must(t, r.AddAssignmentEvent(ctx, "pr-2", "u2"))
+    must(t, r.AddAssignmentEvent(ctx, "pr-1", "u3"))
+    if err := r.AddAssignmentEvent(ctx, "missing", "u2"); err == nil {
+        t.Error("expected assignment to an unknown PR to be rejected")
+    }
+
+    // История не зависит от текущих ревьюверов
+    must(t, r.RemoveReviewer(ctx, "pr-1", "u2"))
+    stats, err = r.GetAssignmentStats(ctx)
+    must(t, err)
+    if len(stats) != 2 || stats["u2"] != 2 || stats["u3"] != 1 {
+        t.Errorf("expected u2=2 u3=1, got %v", stats)
+    }
+}
+
+func testTokens(t *testing.T, r repo.RepoInterface) {
+    must(t, r.CreateUser(ctx, "u1", "Alice"))
+    userID := "u1"
+
+    first, err := r.CreateAPIToken(ctx, &repo.APIToken{Name: "ci", TokenHash: "h1", Scopes: "read"})
+    must(t, err)
+    second, err := r.CreateAPIToken(ctx, &repo.APIToken{Name: "bot", TokenHash: "h2", Scopes: "read write:prs", UserID: &userID})
+    must(t, err)
+    if second <= first {
+        t.Errorf("expected increasing token ids, got %d then %d", first, second)
+    }
+    if _, err := r.CreateAPIToken(ctx, &repo.APIToken{Name: "dup", TokenHash: "h1", Scopes: "read"}); err == nil {
+        t.Error("expected duplicate token hash to be rejected")
+    }
+
+    token, err := r.GetAPITokenByHash(ctx, "h2")
+    must(t, err)
+    if token.ID != second || token.Scopes != "read write:prs" || token.UserID == nil || *token.UserID != "u1" ||
+        token.CreatedAt.IsZero() || token.RevokedAt != nil {
+        t.Errorf("unexpected token %+v", token)
+    }
+
+    if ok, err := r.RevokeAPIToken(ctx, first); err != nil || !ok {
+        t.Fatalf("expected the token to be revoked, got %v %v", ok, err)
+    }
+    revoked, _ := r.GetAPITokenByHash(ctx, "h1")
+    if revoked.RevokedAt == nil {
+        t.Fatal("expected token to be revoked")
+    }
+    // Повторный отзыв не меняет время отзыва и сообщает, что отзывать нечего
+    if ok, err := r.RevokeAPIToken(ctx, first); err != nil || ok {
+        t.Errorf("expected a repeated revoke to change nothing, got %v %v", ok, err)
+    }
+    if ok, err := r.RevokeAPIToken(ctx, first+second+100); err != nil || ok {
+        t.Errorf("expected revoking a missing token to change nothing, got %v %v", ok, err)
+    }
+    if again, _ := r.GetAPITokenByHash(ctx, "h1"); !again.RevokedAt.Equal(*revoked.RevokedAt) {
+        t.Errorf("expected revoked_at to stay %v, got %v", revoked.RevokedAt, again.RevokedAt)
+    }
+
+    tokens, err := r.ListAPITokens(ctx)
+    must(t, err)
+    if len(tokens) != 2 || tokens[0].ID != first || tokens[1].ID != second {
+        t.Errorf("expected tokens ordered by id, got %+v", tokens)
+    }
+}
+
+func testVersions(t *testing.T, r repo.RepoInterface) {
+    teamID := seedTeam(t, r, "backend", "u1", "u2", "u3")
+    other := seedTeam(t, r, "frontend", "u4")
+    must(t, r.AddMember(ctx, other, "u2"))
+    must(t, r.CreatePRWithID(ctx, "pr-1", "Add search", "u1"))
+
+    teamVersion := func(id int64) int64 {
+        t.Helper()
+        team, err := r.GetTeamByID(ctx, id)
+        must(t, err)
+        return team.Version
+    }
+    prVersion := func() int64 {
+        t.Helper()
+        pr, err := r.GetPRByID(ctx, "pr-1")
+        must(t, err)
+        return pr.Version
+    }
+    // changes проверяет, что op меняет версию, а повтор без изменения данных - нет
+    changes := func(name string, version func() int64, op func() error) {
+        t.Helper()
+        before := version()
+        must(t, op())
+        after := version()
+        if after == before {
+            t.Errorf("%s: expected the version to change from %d", name, before)
+        }
+        must(t, op())
+        if again := version(); again != after {
+            t.Errorf("%s: expected a no-op to keep version %d, got %d", name, after, again)
+        }
+    }
+
+    if v := prVersion(); v < 1 {
+        t.Errorf("expected a new PR to have a version, got %d", v)
+    }
+    changes("add reviewer", prVersion, func() error { return r.AddReviewer(ctx, "pr-1", "u2") })
+    changes("remove reviewer", prVersion, func() error { return r.RemoveReviewer(ctx, "pr-1", "u2") })
+    changes("merge", prVersion, func() error { return r.SetPRStatus(ctx, "pr-1", "MERGED") })
+
+    backend := func() int64 { return teamVersion(teamID) }
+    changes("add member", backend, func() error { return r.AddMember(ctx, teamID, "u4") })
+    changes("remove member", backend, func() error { return r.RemoveMember(ctx, teamID, "u4") })
+    changes("set lead", backend, func() error { return r.SetTeamLead(ctx, teamID, "u1", true) })
+    changes("deactivate user", backend, func() error { return r.SetUserActive(ctx, "u3", false) })
+    changes("rename", backend, func() error { return r.RenameTeam(ctx, teamID, "platform") })
+
+    // Деактивация участников меняет и другие команды, где они состоят
+    frontend := teamVersion(other)
+    must(t, r.DeactivateTeamMembers(ctx, teamID))
+    if teamVersion(other) == frontend {
+        t.Error("expected deactivating a shared member to change the other team's version")
+    }
+
+    current := prVersion()
+    if ok, err := r.MatchPRVersion(ctx, "pr-1", current); err != nil || !ok {
+        t.Errorf("expected version %d to match, got %v %v", current, ok, err)
+    }
+    if ok, err := r.MatchPRVersion(ctx, "pr-1", current-1); err != nil || ok {
+        t.Errorf("expected a stale version not to match, got %v %v", ok, err)
+    }
+    if ok, err := r.MatchPRVersion(ctx, "missing", 1); err != nil || ok {
+        t.Errorf("expected an unknown PR not to match, got %v %v", ok, err)
+    }
+    if ok, err := r.MatchTeamVersion(ctx, teamID, backend()); err != nil || !ok {
+        t.Errorf("expected the current team version to match, got %v %v", ok, err)
+    }
+    if prVersion() != current {
+        t.Error("expected a match not to change the version")
+    }
+}
+
+func testIdempotencyKeys(t *testing.T, r repo.RepoInterface) {
+    now := time.Now()
+    key := &repo.IdempotencyKey{Owner: "ci", Key: "k1", RequestHash: "h1", ExpiresAt: now.Add(time.Hour)}
+    created, err := r.CreateIdempotencyKey(ctx, key)
+    must(t, err)
+    if !created || key.CreatedAt.IsZero() {
+        t.Fatalf("expected the key to be reserved, got created=%v %+v", created, key)
+    }
+    // Повторная резервация того же ключа не перезаписывает первую
+    if created, err := r.CreateIdempotencyKey(ctx, &repo.IdempotencyKey{Owner: "ci", Key: "k1", RequestHash: "h2",
+        ExpiresAt: now.Add(time.Hour)}); err != nil || created {
+        t.Errorf("expected the duplicate key to be ignored, got created=%v err=%v", created, err)
+    }
+    // Ключи разных владельцев независимы
+    if created, err := r.CreateIdempotencyKey(ctx, &repo.IdempotencyKey{Owner: "bot", Key: "k1", RequestHash: "h2",
+        ExpiresAt: now.Add(-time.Minute)}); err != nil || !created {
+        t.Errorf("expected the key of another owner to be reserved, got created=%v err=%v", created, err)
+    }
+
+    got, err := r.GetIdempotencyKey(ctx, "ci", "k1")
+    must(t, err)
+    if got.RequestHash != "h1" || got.Status != 0 || got.Body != nil || !got.ExpiresAt.Equal(key.ExpiresAt) ||
+        !got.CreatedAt.Equal(key.CreatedAt) {
+        t.Errorf("unexpected reserved key %+v", got)
+    }
+
+    // Ответ сохраняется только для своей резервации и хранится дольше нее
+    kept := now.Add(24 * time.Hour)
+    stale := &repo.IdempotencyKey{Owner: "ci", Key: "k1", CreatedAt: key.CreatedAt.Add(-time.Second), Status: 500, ExpiresAt: kept}
+    if completed, err := r.CompleteIdempotencyKey(ctx, stale); err != nil || completed {
+        t.Errorf("expected another reservation not to be completed, got completed=%v err=%v", completed, err)
+    }
+    completed, err := r.CompleteIdempotencyKey(ctx, &repo.IdempotencyKey{Owner: "ci", Key: "k1", CreatedAt: key.CreatedAt,
+        Status: 201, ContentType: "application/json", ETag: `"1"`, Body: []byte(`{"ok":true}`), ExpiresAt: kept})
+    if err != nil || !completed {
+        t.Fatalf("expected the reservation to be completed, got completed=%v err=%v", completed, err)
+    }
+    if completed, err := r.CompleteIdempotencyKey(ctx, &repo.IdempotencyKey{Owner: "ci", Key: "k1", CreatedAt: key.CreatedAt,
+        Status: 200, ExpiresAt: kept}); err != nil || completed {
+        t.Errorf("expected the completed key not to be overwritten, got completed=%v err=%v", completed, err)
+    }
+    got, err = r.GetIdempotencyKey(ctx, "ci", "k1")
+    must(t, err)
+    if got.Status != 201 || got.ContentType != "application/json" || got.ETag != `"1"` || string(got.Body) != `{"ok":true}` || !got.ExpiresAt.Equal(kept) {
+        t.Errorf("unexpected completed key %+v", got)
+    }
+
+    n, err := r.DeleteExpiredIdempotencyKeys(ctx, now)
+    must(t, err)
+    if n != 1 {
+        t.Errorf("expected one expired key to be deleted, got %d", n)
+    }
+    if _, err := r.GetIdempotencyKey(ctx, "bot", "k1"); !errors.Is(err, sql.ErrNoRows) {
+        t.Errorf("expected the expired key to be gone, got %v", err)
+    }
+
+    must(t, r.DeleteIdempotencyKey(ctx, "ci", "k1", key.CreatedAt.Add(-time.Second)))
+    if _, err := r.GetIdempotencyKey(ctx, "ci", "k1"); err != nil {
+        t.Errorf("expected another reservation's delete to keep the key, got %v", err)
+    }
+    must(t, r.DeleteIdempotencyKey(ctx, "ci", "k1", key.CreatedAt))
+    if _, err := r.GetIdempotencyKey(ctx, "ci", "k1"); !errors.Is(err, sql.ErrNoRows) {
+        t.Errorf("expected sql.ErrNoRows after delete, got %v", err)
+    }
+}
+
+func testAudit(t *testing.T, r repo.RepoInterface) {
+    add := func(actor, targetType, targetID string) *repo.AuditEntry {
+        e := &repo.AuditEntry{Actor: actor, Action: "test", TargetType: targetType, TargetID: targetID,
+            After: repo.JSONB(`{"ok":true}`), RequestID: "req-" + targetID}
+        must(t, r.AddAuditEntry(ctx, e))
+        if e.ID == 0 || e.CreatedAt.IsZero() {
+            t.Fatalf("expected id and time to be set, got %+v", e)
+        }
+        return e
+    }
+    first := add("ops", "team", "backend")
+    add("ci", "pr", "pr-1")
+    last := add("ops", "pr", "pr-2")
+
+    entries, err := r.ListAuditEntries(ctx, repo.AuditFilter{})
+    must(t, err)
+    if len(entries) != 3 || entries[0].ID != last.ID || entries[2].ID != first.ID {
+        t.Fatalf("expected newest first, got %+v", entries)
+    }
+    if e := entries[0]; string(e.After) != `{"ok":true}` || e.Before != nil || e.RequestID != "req-pr-2" || e.SourceIP != "" {
+        t.Errorf("unexpected stored entry %+v", e)
+    }
+
+    if entries, _ := r.ListAuditEntries(ctx, repo.AuditFilter{Actor: "ops", TargetType: "pr"}); len(entries) != 1 || entries[0].ID != last.ID {
+        t.Errorf("expected actor and target filters to combine, got %+v", entries)
+    }
+    if entries, _ := r.ListAuditEntries(ctx, repo.AuditFilter{Limit: 2}); len(entries) != 2 {
+        t.Errorf("expected limit to apply, got %+v", entries)
+    }
+
+    // Границы в любой зоне: From включительно, To исключительно
+    zone := time.FixedZone("UTC+3", 3*60*60)
+    from := last.CreatedAt.In(zone)
+    if entries, _ := r.ListAuditEntries(ctx, repo.AuditFilter{From: &from}); len(entries) == 0 || entries[0].ID != last.ID {
+        t.Errorf("expected entries from %v, got %+v", from, entries)
+    }
+    to := first.CreatedAt.In(zone)
+    if entries, _ := r.ListAuditEntries(ctx, repo.AuditFilter{To: &to}); len(entries) != 0 {
+        t.Errorf("expected no entries before %v, got %+v", to, entries)
+    }
+}
+
+func testPREvents(t *testing.T, r repo.RepoInterface) {
+    add := func(typ, team, reviewer, replaced string) int64 {
+        e := &repo.PREvent{Type: typ, PRID: "pr-1", TeamName: team, AuthorID: "u1", ReviewerID: reviewer, ReplacedUserID: replaced}
+        must(t, r.AddPREvent(ctx, e))
+        return e.ID
+    }
+    created := add("pr.created", "backend", "", "")
+    assigned := add("reviewer.assigned", "backend", "u2", "")
+    reassigned := add("reviewer.reassigned", "backend", "u3", "u2")
+    add("pr.created", "frontend", "", "")
+
+    events, err := r.ListPREvents(ctx, repo.PREventFilter{AfterID: created, TeamName: "backend"})
+    must(t, err)
+    if len(events) != 2 || events[0].ID != assigned || events[1].ID != reassigned {
+        t.Fatalf("expected events after %d in id order, got %+v", created, events)
+    }
+    if e := events[1]; e.ReviewerID != "u3" || e.ReplacedUserID != "u2" || e.CreatedAt.IsZero() {
+        t.Errorf("unexpected stored event %+v", e)
+    }
+
+    // Пользователь совпадает с автором, ревьювером или снятым ревьювером
+    if events, _ := r.ListPREvents(ctx, repo.PREventFilter{UserID: "u2"}); len(events) != 2 {
+        t.Errorf("expected two events for u2, got %+v", events)
+    }
+    if events, _ := r.ListPREvents(ctx, repo.PREventFilter{Limit: 1}); len(events) != 1 || events[0].ID != created {
+        t.Errorf("expected the first event with limit 1, got %+v", events)
+    }
+    if events, err := r.ListPREvents(ctx, repo.PREventFilter{AfterID: 1 << 40}); err != nil || events == nil || len(events) != 0 {
+        t.Errorf("expected empty non-nil list, got %#v, %v", events, err)
+    }
+}
+
+func testTransactions(t *testing.T, r repo.RepoInterface) {
+    seedTeam(t, r, "backend", "u1", "u2")
+    must(t, r.CreatePRWithID(ctx, "pr-1", "Feature", "u1"))
+
+    boom := errors.New("boom")
+    err := r.WithTx(ctx, func(tx repo.RepoInterface) error {
+        must(t, tx.AddReviewer(ctx, "pr-1", "u2"))
+        must(t, tx.SetUserActive(ctx, "u2", false))
+        // Вложенный WithTx видит незафиксированные изменения и откатывается вместе с внешним
+        return tx.WithTx(ctx, func(inner repo.RepoInterface) error {
+            if reviewers, _ := inner.GetPRReviewers(ctx, "pr-1"); len(reviewers) != 1 {
+                t.Errorf("expected nested call to see the reviewer, got %+v", reviewers)
+            }
+            return boom
+        })
+    })
+    if !errors.Is(err, boom) {
+        t.Fatalf("expected tx error, got %v", err)
+    }
+    if reviewers, _ := r.GetPRReviewers(ctx, "pr-1"); len(reviewers) != 0 {
+        t.Errorf("expected reviewer insert to roll back, got %+v", reviewers)
+    }
+    if u, _ := r.GetUserByID(ctx, "u2"); !u.IsActive {
+        t.Error("expected user update to roll back")
+    }
+
+    must(t, r.WithTx(ctx, func(tx repo.RepoInterface) error {
+        return tx.AddReviewer(ctx, "pr-1", "u2")
+    }))
+    if reviewers, _ := r.GetPRReviewers(ctx, "pr-1"); !equal(userIDs(reviewers), []string{"u2"}) {
+        t.Errorf("expected committed reviewer, got %+v", reviewers)
+    }
+}
+
+func testExportImport(t *testing.T, r repo.RepoInterface) {
+    teamID := seedTeam(t, r, "backend", "u1", "u2", "u3")
+    must(t, r.SetTeamLead(ctx, teamID, "u1", true))
+    must(t, r.CreatePRWithID(ctx, "pr-1", "Feature", "u1"))
+    must(t, r.AddReviewer(ctx, "pr-1", "u2"))
+    must(t, r.AddAssignmentEvent(ctx, "pr-1", "u2"))
+
+    memberships, err := r.ListMemberships(ctx)
+    must(t, err)
+    if len(memberships) != 3 || memberships[0] != (repo.Membership{TeamName: "backend", UserID: "u1", IsLead: true}) {
+        t.Errorf("unexpected memberships %+v", memberships)
+    }
+    if reviewers, _ := r.ListReviewers(ctx); len(reviewers) != 1 || reviewers[0] != (repo.Reviewer{PRID: "pr-1", UserID: "u2"}) {
+        t.Errorf("unexpected reviewers %+v", reviewers)
+    }
+
+    // UpsertPR перезаписывает все поля, включая время
+    created := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+    merged := created.Add(time.Hour)
+    must(t, r.UpsertPR(ctx, repo.PRRecord{ID: "pr-1", Title: "Renamed", AuthorID: "u3", Status: "MERGED", CreatedAt: &created, MergedAt: &merged}))
+    must(t, r.UpsertPR(ctx, repo.PRRecord{ID: "pr-0", Title: "Imported", AuthorID: "u1", Status: "OPEN"}))
+    prs, err := r.ListPRRecords(ctx)
+    must(t, err)
+    if len(prs) != 2 || prs[0].ID != "pr-1" {
+        t.Fatalf("expected PRs ordered by creation time, got %+v", prs)
+    }
+    if p := prs[0]; p.Title != "Renamed" || p.AuthorID != "u3" || p.Status != "MERGED" ||
+        !p.CreatedAt.Equal(created) || p.MergedAt == nil || !p.MergedAt.Equal(merged) {
+        t.Errorf("unexpected upserted PR %+v", p)
+    }
+    if p := prs[1]; p.CreatedAt == nil || p.MergedAt != nil {
+        t.Errorf("expected default creation time and no merge time, got %+v", p)
+    }
+
+    // Восстановление истории идемпотентно
+    history, err := r.ListAssignments(ctx)
+    must(t, err)
+    if len(history) != 1 {
+        t.Fatalf("expected one assignment, got %+v", history)
+    }
+    restored := repo.Assignment{PRID: "pr-0", UserID: "u3", EventTime: created}
+    for i := 0; i < 2; i++ {
+        must(t, r.RestoreAssignment(ctx, history[0]))
+        must(t, r.RestoreAssignment(ctx, restored))
+    }
+    if stats, _ := r.GetAssignmentStats(ctx); stats["u2"] != 1 || stats["u3"] != 1 {
+        t.Errorf("expected restore to skip existing events, got %v", stats)
+    }
+
+    userID := "u2"
+    _, err = r.CreateAPIToken(ctx, &repo.APIToken{Name: "bot", TokenHash: "h-u2", Scopes: "read", UserID: &userID})
+    must(t, err)
+    pr1, err := r.GetPRByID(ctx, "pr-1")
+    must(t, err)
+    replaced, err := r.ResetState(ctx, []string{"u1"})
+    must(t, err)
+    if replaced < pr1.Version {
+        t.Errorf("expected reset to report at least the version %d of pr-1, got %d", pr1.Version, replaced)
+    }
+    if users, _ := r.ListUsers(ctx); len(users) != 1 || users[0].ID != "u1" {
+        t.Errorf("expected only u1 after reset, got %+v", users)
+    }
+    if teams, _ := r.ListTeams(ctx); len(teams) != 0 {
+        t.Errorf("expected no teams after reset, got %+v", teams)
+    }
+    if prs, _ := r.ListPRRecords(ctx); len(prs) != 0 {
+        t.Errorf("expected no PRs after reset, got %+v", prs)
+    }
+    if _, err := r.GetAPITokenByHash(ctx, "h-u2"); !errors.Is(err, sql.ErrNoRows) {
+        t.Errorf("expected tokens of removed users to be deleted, got %v", err)
+    }
+
+    // Восстановленные строки поднимаются выше версий удаленных
+    newTeam := seedTeam(t, r, "restored", "u1")
+    must(t, r.CreatePRWithID(ctx, "pr-1", "Feature", "u1"))
+    must(t, r.ShiftVersions(ctx, replaced))
+    if pr, _ := r.GetPRByID(ctx, "pr-1"); pr.Version != replaced+1 {
+        t.Errorf("expected pr-1 version %d, got %d", replaced+1, pr.Version)
+    }
+    if team, _ := r.GetTeamByName(ctx, "restored"); team.ID != newTeam || team.Version <= replaced {
+        t.Errorf("expected the restored team above version %d, got %+v", replaced, team)
+    }
+}
@@ -0,0 +1,45 @@
+-- Схема повторяет migrations/0001 для Postgres; вместо enum pr_status - CHECK,
+-- время хранится текстом в UTC в формате драйвера (_time_format=sqlite)
+CREATE TABLE teams (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  name TEXT UNIQUE NOT NULL
+);
+
+CREATE TABLE users (
+  id TEXT PRIMARY KEY,
+  name TEXT NOT NULL,
+  is_active BOOLEAN NOT NULL DEFAULT TRUE
+);
+
+CREATE TABLE team_members (
+  team_id INTEGER NOT NULL REFERENCES teams(id) ON DELETE CASCADE,
+  user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  PRIMARY KEY (team_id, user_id)
+);
+
+CREATE TABLE prs (
+  id TEXT PRIMARY KEY,
+  title TEXT NOT NULL,
+  author_id TEXT NOT NULL REFERENCES users(id) ON DELETE RESTRICT,
+  status TEXT NOT NULL DEFAULT 'OPEN' CHECK (status IN ('OPEN', 'MERGED')),
+  created_at TIMESTAMP DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')),
+  merged_at TIMESTAMP
+);
+
+CREATE TABLE pr_reviewers (
+  pr_id TEXT NOT NULL REFERENCES prs(id) ON DELETE CASCADE,
+  user_id TEXT NOT NULL REFERENCES users(id) ON DELETE RESTRICT,
+  PRIMARY KEY (pr_id, user_id)
+);
+
+CREATE TABLE assignment_events (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  pr_id TEXT NOT NULL REFERENCES prs(id) ON DELETE CASCADE,
+  user_id TEXT NOT NULL REFERENCES users(id) ON DELETE RESTRICT,
+  event_time TIMESTAMP DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now'))
+);
+
+CREATE INDEX idx_team_members_team ON team_members(team_id);
+CREATE INDEX idx_users_active ON users(is_active);
+CREATE INDEX idx_pr_reviewers_pr ON pr_reviewers(pr_id);
+CREATE INDEX idx_prs_status ON prs(status);
@@ -0,0 +1,12 @@
+CREATE TABLE pr_events (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  created_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')),
+  type TEXT NOT NULL,
+  pr_id TEXT NOT NULL,
+  team_name TEXT,
+  author_id TEXT NOT NULL,
+  reviewer_id TEXT,
+  replaced_user_id TEXT
+);
+
+CREATE INDEX idx_pr_events_team ON pr_events(team_name, id);
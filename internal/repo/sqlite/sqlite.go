@@ -0,0 +1,67 @@
+// Package sqlite - хранилище в одном файле SQLite, чтобы запускать сервис одним бинарником без Postgres.
+// Драйвер modernc.org/sqlite написан на чистом Go и не требует cgo; запросы выполняет тот же repo.Repo,
+// что и для Postgres, а схема описана собственными миграциями в migrations/.
+package sqlite
+
+import (
+    "context"
+    "embed"
+    "fmt"
+    "io/fs"
+    "net/url"
+
+    "github.com/jmoiron/sqlx"
+    _ "modernc.org/sqlite"
+
+    "pr-review-assigner/internal/migrate"
+)
+
+//go:embed migrations/*.sql
+var migrations embed.FS
+
+// Migrations - схема SQLite для internal/migrate
+var Migrations, _ = fs.Sub(migrations, "migrations")
+
+// Open открывает базу в файле path, создавая его при необходимости, и применяет недостающие миграции:
+// у файловой базы нет отдельного шага развертывания, поэтому схема обновляется при каждом запуске
+func Open(ctx context.Context, path string) (*sqlx.DB, error) {
+    db, err := Connect(ctx, path)
+    if err != nil {
+        return nil, err
+    }
+    runner, err := migrate.New(db, Migrations)
+    if err == nil {
+        _, err = runner.Up(ctx)
+    }
+    if err != nil {
+        db.Close()
+        return nil, fmt.Errorf("sqlite migrate: %w", err)
+    }
+    return db, nil
+}
+
+// Connect открывает базу в файле path, не трогая схему
+func Connect(ctx context.Context, path string) (*sqlx.DB, error) {
+    db, err := sqlx.Open("sqlite", dsn(path))
+    if err != nil {
+        return nil, err
+    }
+    if err := db.PingContext(ctx); err != nil {
+        db.Close()
+        return nil, err
+    }
+    return db, nil
+}
+
+// dsn включает внешние ключи (в SQLite они выключены по умолчанию) и WAL, ждет блокировку вместо SQLITE_BUSY
+// и берет блокировку на запись в начале транзакции, чтобы параллельные WithTx не падали при ее повышении.
+// Время пишется в формате с зоной, который сравнивается как строка, пока все значения в UTC.
+func dsn(path string) string {
+    q := url.Values{}
+    q.Add("_pragma", "foreign_keys(1)")
+    q.Add("_pragma", "busy_timeout(5000)")
+    q.Add("_pragma", "journal_mode(WAL)")
+    q.Set("_time_format", "sqlite")
+    q.Set("_txlock", "immediate")
+    return "file:" + path + "?" + q.Encode()
+}
@@ -0,0 +1,130 @@
+package sqlite
+
+import (
+    "context"
+    "path/filepath"
+    "testing"
+
+    "go.opentelemetry.io/otel"
+    "go.opentelemetry.io/otel/attribute"
+    sdktrace "go.opentelemetry.io/otel/sdk/trace"
+    "go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+    "pr-review-assigner/internal/migrate"
+    "pr-review-assigner/internal/repo"
+    "pr-review-assigner/internal/repo/repotest"
+    "pr-review-assigner/internal/service"
+    pgmigrations "pr-review-assigner/migrations"
+)
+
+func open(t *testing.T, path string) *repo.Repo {
+    t.Helper()
+    db, err := Open(context.Background(), path)
+    if err != nil {
+        t.Fatalf("Open: %v", err)
+    }
+    t.Cleanup(func() { db.Close() })
+    return repo.New(db)
+}
+
+func TestOpenMigratesOnce(t *testing.T) {
+    path := filepath.Join(t.TempDir(), "assigner.db")
+    ctx := context.Background()
+
+    r := open(t, path)
+    if err := r.CreateUser(ctx, "u1", "Alice"); err != nil {
+        t.Fatalf("CreateUser: %v", err)
+    }
+
+    // Повторное открытие не применяет миграции заново и не теряет данные
+    r = open(t, path)
+    if u, err := r.GetUserByID(ctx, "u1"); err != nil || u.Name != "Alice" || !u.IsActive {
+        t.Fatalf("expected u1 to survive reopen, got %+v, %v", u, err)
+    }
+}
+
+func TestConformance(t *testing.T) {
+    repotest.Run(t, func(t *testing.T) repo.RepoInterface {
+        return open(t, filepath.Join(t.TempDir(), "assigner.db"))
+    })
+}
+
+// Схемы Postgres и SQLite развиваются вместе: у каждой миграции Postgres есть пара с той же версией
+func TestMigrationsInStepWithPostgres(t *testing.T) {
+    pg, err := migrate.Load(pgmigrations.FS)
+    if err != nil {
+        t.Fatalf("postgres migrations: %v", err)
+    }
+    lite, err := migrate.Load(Migrations)
+    if err != nil {
+        t.Fatalf("sqlite migrations: %v", err)
+    }
+    if len(pg) != len(lite) {
+        t.Fatalf("expected the same number of migrations, got %d and %d", len(pg), len(lite))
+    }
+    for i, m := range pg {
+        l := lite[i]
+        if m.Version != l.Version || m.Name != l.Name {
+            t.Errorf("migration %d_%s has no SQLite counterpart (got %d_%s)", m.Version, m.Name, l.Version, l.Name)
+        }
+        if m.Down == "" || l.Down == "" {
+            t.Errorf("migration %d_%s: missing down script", m.Version, m.Name)
+        }
+    }
+}
+
+// Спан CreatePR несет команду и число кандидатов, а каждый запрос к базе - отдельный дочерний спан
+func TestCreatePRSpans(t *testing.T) {
+    rec := tracetest.NewSpanRecorder()
+    otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(rec)))
+    ctx := context.Background()
+
+    svc := service.New(open(t, filepath.Join(t.TempDir(), "assigner.db")))
+    err := svc.CreateTeam(ctx, "backend", []repo.TeamMember{
+        {UserID: "u1", Username: "Alice", IsActive: true},
+        {UserID: "u2", Username: "Bob", IsActive: true},
+        {UserID: "u3", Username: "Carol", IsActive: true},
+        {UserID: "u4", Username: "Dave", IsActive: true},
+    })
+    if err != nil {
+        t.Fatalf("CreateTeam: %v", err)
+    }
+    if _, err := svc.CreatePR(ctx, "pr-1", "Add search", "u1"); err != nil {
+        t.Fatalf("CreatePR: %v", err)
+    }
+
+    var op sdktrace.ReadOnlySpan
+    for _, s := range rec.Ended() {
+        if s.Name() == "Service.CreatePR" {
+            op = s
+        }
+    }
+    if op == nil {
+        t.Fatal("expected a Service.CreatePR span")
+    }
+    attrs := map[attribute.Key]attribute.Value{}
+    for _, kv := range op.Attributes() {
+        attrs[kv.Key] = kv.Value
+    }
+    if attrs["pr.id"].AsString() != "pr-1" || attrs["team.name"].AsString() != "backend" ||
+        attrs["reviewers.candidates"].AsInt64() != 3 || attrs["reviewers.assigned"].AsInt64() != 2 {
+        t.Errorf("unexpected CreatePR attributes %v", op.Attributes())
+    }
+
+    queries := map[string]bool{}
+    for _, s := range rec.Ended() {
+        if s.SpanContext().TraceID() != op.SpanContext().TraceID() {
+            continue
+        }
+        for _, kv := range s.Attributes() {
+            if kv.Key == "db.system" && kv.Value.AsString() == "sqlite" {
+                queries[s.Name()] = true
+            }
+        }
+    }
+    for _, name := range []string{"SELECT prs", "INSERT prs", "INSERT pr_reviewers", "INSERT audit_log"} {
+        if !queries[name] {
+            t.Errorf("expected a %q span in the CreatePR trace, got %v", name, queries)
+        }
+    }
+}
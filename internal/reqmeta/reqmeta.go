@@ -0,0 +1,54 @@
+// Package reqmeta переносит через контекст сведения о входящем запросе (request id, IP клиента)
+package reqmeta
+
+import (
+    "context"
+    "crypto/rand"
+    "encoding/hex"
+    "net"
+    "net/http"
+)
+
+// HeaderRequestID - заголовок, в котором принимается и возвращается request id
+const HeaderRequestID = "X-Request-ID"
+
+type Meta struct {
+    RequestID string
+    SourceIP  string
+}
+
+type metaKey struct{}
+
+func With(ctx context.Context, m Meta) context.Context {
+    return context.WithValue(ctx, metaKey{}, m)
+}
+
+// FromContext возвращает сведения о запросе; для внутренних вызовов поля пустые
+func FromContext(ctx context.Context) Meta {
+    m, _ := ctx.Value(metaKey{}).(Meta)
+    return m
+}
+
+// Middleware назначает запросу request id (или берет его из заголовка) и запоминает IP клиента
+func Middleware(next http.Handler) http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        id := r.Header.Get(HeaderRequestID)
+        if id == "" || len(id) > 128 {
+            id = newID()
+        }
+        w.Header().Set(HeaderRequestID, id)
+
+        ip, _, err := net.SplitHostPort(r.RemoteAddr)
+        if err != nil {
+            ip = r.RemoteAddr
+        }
+
+        next.ServeHTTP(w, r.WithContext(With(r.Context(), Meta{RequestID: id, SourceIP: ip})))
+    })
+}
+
+func newID() string {
+    buf := make([]byte, 16)
+    rand.Read(buf)
+    return hex.EncodeToString(buf)
+}
@@ -0,0 +1,80 @@
+package scim
+
+import (
+    "fmt"
+    "regexp"
+    "strings"
+)
+
+// filter - разобранный SCIM-фильтр вида `userName eq "alice" and active eq true`.
+// Поддерживаются операторы eq, ne, co, sw, ew, pr, объединенные через and.
+type filter []condition
+
+type condition struct {
+    attr  string
+    op    string
+    value string
+}
+
+var conditionRe = regexp.MustCompile(`^([A-Za-z][\w.]*)\s+(eq|ne|co|sw|ew|pr)(?:\s+(.+))?$`)
+var andRe = regexp.MustCompile(`(?i)\s+and\s+`)
+
+func parseFilter(expr string) (filter, error) {
+    expr = strings.TrimSpace(expr)
+    if expr == "" {
+        return nil, nil
+    }
+
+    var f filter
+    for _, part := range andRe.Split(expr, -1) {
+        m := conditionRe.FindStringSubmatch(strings.TrimSpace(part))
+        if m == nil {
+            return nil, fmt.Errorf("unsupported filter expression %q", part)
+        }
+
+        c := condition{attr: strings.ToLower(m[1]), op: strings.ToLower(m[2])}
+        if c.op != "pr" {
+            if m[3] == "" {
+                return nil, fmt.Errorf("operator %s requires a value", c.op)
+            }
+            c.value = strings.Trim(strings.TrimSpace(m[3]), `"`)
+        }
+        f = append(f, c)
+    }
+
+    return f, nil
+}
+
+// match проверяет атрибуты ресурса; имена атрибутов сравниваются без учета регистра
+func (f filter) match(attrs map[string]string) bool {
+    for _, c := range f {
+        v, ok := attrs[c.attr]
+        switch c.op {
+        case "pr":
+            if !ok || v == "" {
+                return false
+            }
+        case "eq":
+            if !ok || !strings.EqualFold(v, c.value) {
+                return false
+            }
+        case "ne":
+            if ok && strings.EqualFold(v, c.value) {
+                return false
+            }
+        case "co":
+            if !ok || !strings.Contains(strings.ToLower(v), strings.ToLower(c.value)) {
+                return false
+            }
+        case "sw":
+            if !ok || !strings.HasPrefix(strings.ToLower(v), strings.ToLower(c.value)) {
+                return false
+            }
+        case "ew":
+            if !ok || !strings.HasSuffix(strings.ToLower(v), strings.ToLower(c.value)) {
+                return false
+            }
+        }
+    }
+    return true
+}
@@ -0,0 +1,484 @@
+package scim
+
+import (
+    "context"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io"
+    "log/slog"
+    "net/http"
+    "strconv"
+    "strings"
+
+    "github.com/go-chi/chi/v5"
+    "pr-review-assigner/internal/auth"
+    "pr-review-assigner/internal/service"
+)
+
+// DefaultBodyLimit ограничивает тело запроса, пока SetBodyLimit не задал другое значение
+const DefaultBodyLimit = 1 << 20
+
+type Handler struct {
+    svc       *service.Service
+    basePath  string
+    bodyLimit int64
+}
+
+// NewHandler создает SCIM-обработчик; basePath используется в meta.location
+func NewHandler(svc *service.Service, basePath string) *Handler {
+    return &Handler{svc: svc, basePath: strings.TrimSuffix(basePath, "/"), bodyLimit: DefaultBodyLimit}
+}
+
+// SetBodyLimit ограничивает тело запроса n байтами, как server.max_body_bytes для JSON API; больше - 413
+func (h *Handler) SetBodyLimit(n int64) {
+    h.bodyLimit = n
+}
+
+// Routes ожидает принципала в контексте (auth.Middleware): пользователи требуют scope admin:users,
+// группы - admin:teams, как /team/add и /teams/sync
+func (h *Handler) Routes() chi.Router {
+    r := chi.NewRouter()
+
+    r.Group(func(r chi.Router) {
+        r.Use(auth.Require(auth.ScopeAdminUsers))
+        r.Get("/Users", h.ListUsers)
+        r.Post("/Users", h.CreateUser)
+        r.Get("/Users/{id}", h.GetUser)
+        r.Patch("/Users/{id}", h.PatchUser)
+        r.Delete("/Users/{id}", h.DeleteUser)
+    })
+
+    r.Group(func(r chi.Router) {
+        r.Use(auth.Require(auth.ScopeAdminTeams))
+        r.Get("/Groups", h.ListGroups)
+        r.Post("/Groups", h.CreateGroup)
+        r.Get("/Groups/{id}", h.GetGroup)
+        r.Patch("/Groups/{id}", h.PatchGroup)
+        r.Delete("/Groups/{id}", h.DeleteGroup)
+    })
+
+    return r
+}
+
+func (h *Handler) ListUsers(w http.ResponseWriter, r *http.Request) {
+    f, err := parseFilter(r.URL.Query().Get("filter"))
+    if err != nil {
+        h.sendError(w, http.StatusBadRequest, "invalidFilter", err.Error())
+        return
+    }
+
+    users, err := h.svc.ListUsers(r.Context())
+    if err != nil {
+        h.sendServiceError(w, r, err)
+        return
+    }
+
+    var resources []interface{}
+    for _, u := range users {
+        if f.match(userAttrs(u)) {
+            resources = append(resources, userResource(u, h.basePath))
+        }
+    }
+
+    h.sendList(w, r, resources)
+}
+
+func (h *Handler) GetUser(w http.ResponseWriter, r *http.Request) {
+    user, err := h.svc.GetUser(r.Context(), chi.URLParam(r, "id"))
+    if err != nil {
+        h.sendServiceError(w, r, err)
+        return
+    }
+
+    h.send(w, http.StatusOK, userResource(*user, h.basePath))
+}
+
+func (h *Handler) CreateUser(w http.ResponseWriter, r *http.Request) {
+    var req User
+    if !h.decode(w, r, &req) {
+        return
+    }
+    if req.UserName == "" {
+        h.sendError(w, http.StatusBadRequest, "invalidValue", "userName is required")
+        return
+    }
+
+    active := true
+    if req.Active != nil {
+        active = *req.Active
+    }
+
+    user, err := h.svc.ProvisionUser(r.Context(), req.UserName, req.displayName(), active)
+    if err != nil {
+        h.sendServiceError(w, r, err)
+        return
+    }
+
+    h.send(w, http.StatusCreated, userResource(*user, h.basePath))
+}
+
+func (h *Handler) PatchUser(w http.ResponseWriter, r *http.Request) {
+    var req PatchRequest
+    if !h.decode(w, r, &req) {
+        return
+    }
+
+    patch, err := parseUserPatch(req)
+    if err != nil {
+        h.sendError(w, http.StatusBadRequest, "invalidValue", err.Error())
+        return
+    }
+
+    user, err := h.svc.UpdateUser(r.Context(), chi.URLParam(r, "id"), patch.name, patch.active)
+    if err != nil {
+        h.sendServiceError(w, r, err)
+        return
+    }
+
+    h.send(w, http.StatusOK, userResource(*user, h.basePath))
+}
+
+// DeleteUser deprovisions the user: it is deactivated, removed from teams
+// and its open reviews are reassigned. History is kept, so the row stays.
+func (h *Handler) DeleteUser(w http.ResponseWriter, r *http.Request) {
+    if _, err := h.svc.DeprovisionUser(r.Context(), chi.URLParam(r, "id")); err != nil {
+        h.sendServiceError(w, r, err)
+        return
+    }
+
+    w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) ListGroups(w http.ResponseWriter, r *http.Request) {
+    f, err := parseFilter(r.URL.Query().Get("filter"))
+    if err != nil {
+        h.sendError(w, http.StatusBadRequest, "invalidFilter", err.Error())
+        return
+    }
+
+    teams, err := h.svc.ListTeams(r.Context())
+    if err != nil {
+        h.sendServiceError(w, r, err)
+        return
+    }
+
+    var resources []interface{}
+    for _, t := range teams {
+        if !f.match(groupAttrs(t)) {
+            continue
+        }
+        team, members, err := h.svc.GetTeamByID(r.Context(), t.ID)
+        if err != nil {
+            h.sendServiceError(w, r, err)
+            return
+        }
+        resources = append(resources, groupResource(*team, members, h.basePath))
+    }
+
+    h.sendList(w, r, resources)
+}
+
+func (h *Handler) GetGroup(w http.ResponseWriter, r *http.Request) {
+    teamID, ok := h.groupID(w, r)
+    if !ok {
+        return
+    }
+
+    h.sendGroup(w, r, teamID, http.StatusOK)
+}
+
+func (h *Handler) CreateGroup(w http.ResponseWriter, r *http.Request) {
+    var req Group
+    if !h.decode(w, r, &req) {
+        return
+    }
+    if req.DisplayName == "" {
+        h.sendError(w, http.StatusBadRequest, "invalidValue", "displayName is required")
+        return
+    }
+
+    // Members must already be provisioned as users
+    memberIDs := make([]string, len(req.Members))
+    for i, m := range req.Members {
+        memberIDs[i] = m.Value
+    }
+
+    team, err := h.svc.ProvisionTeam(r.Context(), req.DisplayName, memberIDs)
+    if err != nil {
+        h.sendServiceError(w, r, err)
+        return
+    }
+
+    h.sendGroup(w, r, team.ID, http.StatusCreated)
+}
+
+func (h *Handler) PatchGroup(w http.ResponseWriter, r *http.Request) {
+    teamID, ok := h.groupID(w, r)
+    if !ok {
+        return
+    }
+    ctx, ok := h.ifMatch(w, r)
+    if !ok {
+        return
+    }
+
+    var req PatchRequest
+    if !h.decode(w, r, &req) {
+        return
+    }
+
+    var changes []service.TeamChange
+    for _, op := range req.Operations {
+        opChanges, err := groupChanges(op)
+        if err != nil {
+            h.sendError(w, http.StatusBadRequest, "invalidValue", err.Error())
+            return
+        }
+        changes = append(changes, opChanges...)
+    }
+    if err := h.svc.PatchTeam(ctx, teamID, changes...); err != nil {
+        h.sendServiceError(w, r, err)
+        return
+    }
+
+    h.sendGroup(w, r, teamID, http.StatusOK)
+}
+
+func (h *Handler) DeleteGroup(w http.ResponseWriter, r *http.Request) {
+    teamID, ok := h.groupID(w, r)
+    if !ok {
+        return
+    }
+    ctx, ok := h.ifMatch(w, r)
+    if !ok {
+        return
+    }
+
+    if err := h.svc.DeleteTeam(ctx, teamID); err != nil {
+        h.sendServiceError(w, r, err)
+        return
+    }
+
+    w.WriteHeader(http.StatusNoContent)
+}
+
+type invalidValueError struct {
+    msg string
+}
+
+func (e *invalidValueError) Error() string {
+    return e.msg
+}
+
+func invalidValue(err error) error {
+    return &invalidValueError{msg: err.Error()}
+}
+
+// groupChanges translates one PATCH operation into team changes; PatchGroup applies
+// the changes of all operations at once, so a failing operation leaves the group intact
+func groupChanges(op PatchOperation) ([]service.TeamChange, error) {
+    path := strings.ToLower(op.Path)
+
+    switch strings.ToLower(op.Op) {
+    case "add":
+        if path != "members" {
+            return nil, &invalidValueError{msg: "unsupported path " + op.Path + " for add"}
+        }
+        ids, err := parseMembers(op.Value)
+        if err != nil {
+            return nil, invalidValue(err)
+        }
+        return []service.TeamChange{{Op: service.TeamChangeAdd, UserIDs: ids}}, nil
+
+    case "remove":
+        if userID, ok := memberFromPath(op.Path); ok {
+            return []service.TeamChange{{Op: service.TeamChangeRemove, UserIDs: []string{userID}}}, nil
+        }
+        if path != "members" {
+            return nil, &invalidValueError{msg: "unsupported path " + op.Path + " for remove"}
+        }
+        if len(op.Value) == 0 {
+            return []service.TeamChange{{Op: service.TeamChangeSet}}, nil
+        }
+        ids, err := parseMembers(op.Value)
+        if err != nil {
+            return nil, invalidValue(err)
+        }
+        return []service.TeamChange{{Op: service.TeamChangeRemove, UserIDs: ids}}, nil
+
+    case "replace":
+        switch path {
+        case "displayname":
+            name, err := parseString(op.Value)
+            if err != nil {
+                return nil, invalidValue(err)
+            }
+            return []service.TeamChange{{Op: service.TeamChangeRename, Name: name}}, nil
+        case "members":
+            ids, err := parseMembers(op.Value)
+            if err != nil {
+                return nil, invalidValue(err)
+            }
+            return []service.TeamChange{{Op: service.TeamChangeSet, UserIDs: ids}}, nil
+        case "":
+            var g Group
+            if err := json.Unmarshal(op.Value, &g); err != nil {
+                return nil, invalidValue(err)
+            }
+            var changes []service.TeamChange
+            if g.DisplayName != "" {
+                changes = append(changes, service.TeamChange{Op: service.TeamChangeRename, Name: g.DisplayName})
+            }
+            if g.Members != nil {
+                ids := make([]string, len(g.Members))
+                for i, m := range g.Members {
+                    ids[i] = m.Value
+                }
+                changes = append(changes, service.TeamChange{Op: service.TeamChangeSet, UserIDs: ids})
+            }
+            return changes, nil
+        }
+        return nil, &invalidValueError{msg: "unsupported path " + op.Path + " for replace"}
+    }
+
+    return nil, &invalidValueError{msg: "unsupported operation " + op.Op}
+}
+
+func (h *Handler) groupID(w http.ResponseWriter, r *http.Request) (int64, bool) {
+    id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+    if err != nil {
+        h.sendError(w, http.StatusNotFound, "", "group not found")
+        return 0, false
+    }
+    return id, true
+}
+
+func (h *Handler) sendGroup(w http.ResponseWriter, r *http.Request, teamID int64, status int) {
+    team, members, err := h.svc.GetTeamByID(r.Context(), teamID)
+    if err != nil {
+        h.sendServiceError(w, r, err)
+        return
+    }
+
+    if version := groupVersion(*team); version != "" {
+        w.Header().Set("ETag", version)
+    }
+    h.send(w, status, groupResource(*team, members, h.basePath))
+}
+
+// ifMatch makes a group change conditional on If-Match (RFC 7644, section 3.14).
+// Weak tags are accepted as identity providers commonly send them.
+func (h *Handler) ifMatch(w http.ResponseWriter, r *http.Request) (context.Context, bool) {
+    tag := strings.TrimSpace(r.Header.Get("If-Match"))
+    if tag == "" || tag == "*" {
+        return r.Context(), true
+    }
+    version, err := strconv.Unquote(strings.TrimPrefix(tag, "W/"))
+    n, parseErr := strconv.ParseInt(version, 10, 64)
+    if err != nil || parseErr != nil || n <= 0 {
+        h.sendError(w, http.StatusBadRequest, "invalidValue", "If-Match must be an entity tag from the ETag header or *")
+        return nil, false
+    }
+    return service.WithExpectedVersion(r.Context(), n), true
+}
+
+// sendList applies startIndex/count pagination (1-based, as in RFC 7644)
+func (h *Handler) sendList(w http.ResponseWriter, r *http.Request, resources []interface{}) {
+    total := len(resources)
+
+    start := 1
+    if v, err := strconv.Atoi(r.URL.Query().Get("startIndex")); err == nil && v > 1 {
+        start = v
+    }
+    count := total
+    if v, err := strconv.Atoi(r.URL.Query().Get("count")); err == nil && v >= 0 {
+        count = v
+    }
+
+    page := []interface{}{}
+    if start <= total {
+        end := start - 1 + count
+        if end > total {
+            end = total
+        }
+        page = resources[start-1 : end]
+    }
+
+    h.send(w, http.StatusOK, ListResponse{
+        Schemas:      []string{SchemaListResponse},
+        TotalResults: total,
+        StartIndex:   start,
+        ItemsPerPage: len(page),
+        Resources:    page,
+    })
+}
+
+// decode читает тело запроса в dst; неизвестные атрибуты, лишние данные после объекта
+// и тело больше лимита отклоняются. При ошибке ответ уже отправлен.
+func (h *Handler) decode(w http.ResponseWriter, r *http.Request, dst interface{}) bool {
+    dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, h.bodyLimit))
+    dec.DisallowUnknownFields()
+    err := dec.Decode(dst)
+    if err == nil && dec.Decode(&json.RawMessage{}) != io.EOF {
+        err = errors.New("request body must contain a single JSON object")
+    }
+
+    var tooLarge *http.MaxBytesError
+    switch {
+    case err == nil:
+        return true
+    case errors.As(err, &tooLarge):
+        h.sendError(w, http.StatusRequestEntityTooLarge, "", fmt.Sprintf("request body exceeds %d bytes", tooLarge.Limit))
+    case strings.HasPrefix(err.Error(), "json: unknown field "):
+        // Для этой ошибки в encoding/json нет отдельного типа
+        h.sendError(w, http.StatusBadRequest, "invalidSyntax", "unknown attribute "+strings.TrimPrefix(err.Error(), "json: unknown field "))
+    default:
+        h.sendError(w, http.StatusBadRequest, "invalidSyntax", "Invalid request body")
+    }
+    return false
+}
+
+// statusByKind - статус ответа по классу ошибки сервиса, как в JSON API
+var statusByKind = map[service.Kind]int{
+    service.KindInvalid:       http.StatusBadRequest,
+    service.KindNotFound:      http.StatusNotFound,
+    service.KindExists:        http.StatusConflict,
+    service.KindConflict:      http.StatusConflict,
+    service.KindForbidden:     http.StatusForbidden,
+    service.KindUnprocessable: http.StatusUnprocessableEntity,
+    service.KindPrecondition:  http.StatusPreconditionFailed,
+}
+
+// scimTypeByKind - scimType из RFC 7644 (раздел 3.12) для классов, у которых он есть
+var scimTypeByKind = map[service.Kind]string{
+    service.KindInvalid: "invalidValue",
+    service.KindExists:  "uniqueness",
+}
+
+// sendServiceError отвечает по классу ошибки сервиса; сбои базы и ошибки без типа записываются в лог,
+// а клиент получает общее сообщение
+func (h *Handler) sendServiceError(w http.ResponseWriter, r *http.Request, err error) {
+    var se *service.Error
+    if !errors.As(err, &se) || se.Kind == service.KindInternal {
+        slog.ErrorContext(r.Context(), "scim request failed", "error", err)
+        h.sendError(w, http.StatusInternalServerError, "", "internal error")
+        return
+    }
+    h.sendError(w, statusByKind[se.Kind], scimTypeByKind[se.Kind], err.Error())
+}
+
+func (h *Handler) send(w http.ResponseWriter, status int, body interface{}) {
+    w.Header().Set("Content-Type", ContentType)
+    w.WriteHeader(status)
+    json.NewEncoder(w).Encode(body)
+}
+
+func (h *Handler) sendError(w http.ResponseWriter, status int, scimType, detail string) {
+    h.send(w, status, Error{
+        Schemas:  []string{SchemaError},
+        Status:   strconv.Itoa(status),
+        ScimType: scimType,
+        Detail:   detail,
+    })
+}
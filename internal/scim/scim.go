@@ -0,0 +1,258 @@
+// Package scim реализует подмножество SCIM 2.0 (RFC 7643/7644) для автоматического
+// провижининга пользователей и команд из identity provider.
+//
+// Соответствие ресурсов:
+//   User.id = User.userName = users.id, User.displayName = users.name, User.active = users.is_active
+//   Group.id = teams.id, Group.displayName = teams.name, Group.members = team_members
+package scim
+
+import (
+    "encoding/json"
+    "fmt"
+    "regexp"
+    "strconv"
+    "strings"
+
+    "pr-review-assigner/internal/repo"
+)
+
+const (
+    SchemaUser         = "urn:ietf:params:scim:schemas:core:2.0:User"
+    SchemaGroup        = "urn:ietf:params:scim:schemas:core:2.0:Group"
+    SchemaListResponse = "urn:ietf:params:scim:api:messages:2.0:ListResponse"
+    SchemaPatchOp      = "urn:ietf:params:scim:api:messages:2.0:PatchOp"
+    SchemaError        = "urn:ietf:params:scim:api:messages:2.0:Error"
+
+    ContentType = "application/scim+json"
+)
+
+type User struct {
+    Schemas     []string `json:"schemas"`
+    ID          string   `json:"id,omitempty"`
+    UserName    string   `json:"userName"`
+    DisplayName string   `json:"displayName,omitempty"`
+    Name        *Name    `json:"name,omitempty"`
+    Active      *bool    `json:"active,omitempty"`
+    Meta        *Meta    `json:"meta,omitempty"`
+}
+
+type Name struct {
+    Formatted  string `json:"formatted,omitempty"`
+    GivenName  string `json:"givenName,omitempty"`
+    FamilyName string `json:"familyName,omitempty"`
+}
+
+type Group struct {
+    Schemas     []string `json:"schemas"`
+    ID          string   `json:"id,omitempty"`
+    DisplayName string   `json:"displayName"`
+    Members     []Member `json:"members"`
+    Meta        *Meta    `json:"meta,omitempty"`
+}
+
+type Member struct {
+    Value   string `json:"value"`
+    Display string `json:"display,omitempty"`
+}
+
+type Meta struct {
+    ResourceType string `json:"resourceType"`
+    Location     string `json:"location"`
+    Version      string `json:"version,omitempty"` // совпадает с ETag группы
+}
+
+type ListResponse struct {
+    Schemas      []string      `json:"schemas"`
+    TotalResults int           `json:"totalResults"`
+    StartIndex   int           `json:"startIndex"`
+    ItemsPerPage int           `json:"itemsPerPage"`
+    Resources    []interface{} `json:"Resources"`
+}
+
+type PatchRequest struct {
+    Schemas    []string         `json:"schemas"`
+    Operations []PatchOperation `json:"Operations"`
+}
+
+type PatchOperation struct {
+    Op    string          `json:"op"`
+    Path  string          `json:"path,omitempty"`
+    Value json.RawMessage `json:"value,omitempty"`
+}
+
+type Error struct {
+    Schemas  []string `json:"schemas"`
+    Status   string   `json:"status"`
+    ScimType string   `json:"scimType,omitempty"`
+    Detail   string   `json:"detail"`
+}
+
+// displayName выбирает имя пользователя из доступных атрибутов
+func (u *User) displayName() string {
+    if u.DisplayName != "" {
+        return u.DisplayName
+    }
+    if u.Name != nil {
+        if u.Name.Formatted != "" {
+            return u.Name.Formatted
+        }
+        if full := strings.TrimSpace(u.Name.GivenName + " " + u.Name.FamilyName); full != "" {
+            return full
+        }
+    }
+    return u.UserName
+}
+
+func userResource(u repo.User, basePath string) User {
+    active := u.IsActive
+    return User{
+        Schemas:     []string{SchemaUser},
+        ID:          u.ID,
+        UserName:    u.ID,
+        DisplayName: u.Name,
+        Name:        &Name{Formatted: u.Name},
+        Active:      &active,
+        Meta:        &Meta{ResourceType: "User", Location: basePath + "/Users/" + u.ID},
+    }
+}
+
+func userAttrs(u repo.User) map[string]string {
+    return map[string]string{
+        "id":             u.ID,
+        "username":       u.ID,
+        "displayname":    u.Name,
+        "name.formatted": u.Name,
+        "active":         strconv.FormatBool(u.IsActive),
+    }
+}
+
+// groupVersion - версия команды в виде ETag; пустая, если версия не прочитана
+func groupVersion(t repo.Team) string {
+    if t.Version <= 0 {
+        return ""
+    }
+    return strconv.Quote(strconv.FormatInt(t.Version, 10))
+}
+
+func groupResource(t repo.Team, members []repo.User, basePath string) Group {
+    id := strconv.FormatInt(t.ID, 10)
+    g := Group{
+        Schemas:     []string{SchemaGroup},
+        ID:          id,
+        DisplayName: t.Name,
+        Members:     make([]Member, len(members)),
+        Meta:        &Meta{ResourceType: "Group", Location: basePath + "/Groups/" + id, Version: groupVersion(t)},
+    }
+    for i, m := range members {
+        g.Members[i] = Member{Value: m.ID, Display: m.Name}
+    }
+    return g
+}
+
+func groupAttrs(t repo.Team) map[string]string {
+    return map[string]string{
+        "id":          strconv.FormatInt(t.ID, 10),
+        "displayname": t.Name,
+    }
+}
+
+// parseBool принимает как JSON-булевы значения, так и строки "True"/"False" (их шлет Azure AD)
+func parseBool(raw json.RawMessage) (bool, error) {
+    var b bool
+    if err := json.Unmarshal(raw, &b); err == nil {
+        return b, nil
+    }
+    var s string
+    if err := json.Unmarshal(raw, &s); err != nil {
+        return false, fmt.Errorf("expected boolean, got %s", raw)
+    }
+    return strconv.ParseBool(s)
+}
+
+func parseString(raw json.RawMessage) (string, error) {
+    var s string
+    if err := json.Unmarshal(raw, &s); err != nil {
+        return "", fmt.Errorf("expected string, got %s", raw)
+    }
+    return s, nil
+}
+
+// userPatch - изменения пользователя, собранные из PatchOp
+type userPatch struct {
+    name   *string
+    active *bool
+}
+
+func parseUserPatch(req PatchRequest) (*userPatch, error) {
+    patch := &userPatch{}
+    for _, op := range req.Operations {
+        switch strings.ToLower(op.Op) {
+        case "add", "replace":
+        default:
+            return nil, fmt.Errorf("unsupported operation %q for User", op.Op)
+        }
+
+        if op.Path == "" {
+            // Значение - объект с атрибутами
+            var u User
+            if err := json.Unmarshal(op.Value, &u); err != nil {
+                return nil, fmt.Errorf("invalid value: %v", err)
+            }
+            var attrs map[string]json.RawMessage
+            json.Unmarshal(op.Value, &attrs)
+            if raw, ok := attrs["active"]; ok {
+                active, err := parseBool(raw)
+                if err != nil {
+                    return nil, err
+                }
+                patch.active = &active
+            }
+            if u.DisplayName != "" || u.Name != nil {
+                name := u.displayName()
+                patch.name = &name
+            }
+            continue
+        }
+
+        switch strings.ToLower(op.Path) {
+        case "active":
+            active, err := parseBool(op.Value)
+            if err != nil {
+                return nil, err
+            }
+            patch.active = &active
+        case "displayname", "name.formatted":
+            name, err := parseString(op.Value)
+            if err != nil {
+                return nil, err
+            }
+            patch.name = &name
+        default:
+            return nil, fmt.Errorf("unsupported path %q for User", op.Path)
+        }
+    }
+    return patch, nil
+}
+
+// memberPathRe разбирает путь вида members[value eq "u1"]
+var memberPathRe = regexp.MustCompile(`(?i)^members\[\s*value\s+eq\s+"([^"]*)"\s*\]$`)
+
+func memberFromPath(path string) (string, bool) {
+    m := memberPathRe.FindStringSubmatch(strings.TrimSpace(path))
+    if m == nil {
+        return "", false
+    }
+    return m[1], true
+}
+
+func parseMembers(raw json.RawMessage) ([]string, error) {
+    var members []Member
+    if err := json.Unmarshal(raw, &members); err != nil {
+        return nil, fmt.Errorf("invalid members: %v", err)
+    }
+    ids := make([]string, len(members))
+    for i, m := range members {
+        ids[i] = m.Value
+    }
+    return ids, nil
+}
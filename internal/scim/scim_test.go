@@ -0,0 +1,268 @@
+package scim
+
+import (
+    "context"
+    "encoding/json"
+    "errors"
+    "net/http"
+    "net/http/httptest"
+    "strconv"
+    "strings"
+    "testing"
+
+    "pr-review-assigner/internal/auth"
+    "pr-review-assigner/internal/repo"
+    "pr-review-assigner/internal/repo/memory"
+    "pr-review-assigner/internal/service"
+)
+
+func TestParseFilter(t *testing.T) {
+    f, err := parseFilter(`userName eq "Alice" and active eq true`)
+    if err != nil {
+        t.Fatalf("parseFilter failed: %v", err)
+    }
+
+    if !f.match(map[string]string{"username": "alice", "active": "true"}) {
+        t.Error("Expected case-insensitive match")
+    }
+    if f.match(map[string]string{"username": "alice", "active": "false"}) {
+        t.Error("Expected inactive user not to match")
+    }
+
+    f, _ = parseFilter(`displayName sw "back"`)
+    if !f.match(map[string]string{"displayname": "backend"}) {
+        t.Error("Expected sw to match prefix")
+    }
+
+    if _, err := parseFilter(`userName gt "a"`); err == nil {
+        t.Error("Expected error for unsupported operator")
+    }
+}
+
+func TestParseUserPatch(t *testing.T) {
+    var req PatchRequest
+    json.Unmarshal([]byte(`{
+        "schemas": ["urn:ietf:params:scim:api:messages:2.0:PatchOp"],
+        "Operations": [
+            {"op": "Replace", "path": "active", "value": "False"},
+            {"op": "replace", "value": {"displayName": "Alice Smith"}}
+        ]
+    }`), &req)
+
+    patch, err := parseUserPatch(req)
+    if err != nil {
+        t.Fatalf("parseUserPatch failed: %v", err)
+    }
+    if patch.active == nil || *patch.active {
+        t.Error("Expected active=false")
+    }
+    if patch.name == nil || *patch.name != "Alice Smith" {
+        t.Errorf("Expected name to be replaced, got %v", patch.name)
+    }
+}
+
+func TestMemberFromPath(t *testing.T) {
+    id, ok := memberFromPath(`members[value eq "u1"]`)
+    if !ok || id != "u1" {
+        t.Errorf("Expected u1, got %q", id)
+    }
+    if _, ok := memberFromPath("members"); ok {
+        t.Error("Plain members path should not be parsed as a filter")
+    }
+}
+
+func TestGroupIfMatch(t *testing.T) {
+    svc := service.New(memory.New())
+    ctx := context.Background()
+    for _, id := range []string{"u1", "u2"} {
+        if _, err := svc.ProvisionUser(ctx, id, id, true); err != nil {
+            t.Fatal(err)
+        }
+    }
+    if err := svc.CreateTeam(ctx, "backend", nil); err != nil {
+        t.Fatal(err)
+    }
+    team, _, _ := svc.GetTeam(ctx, "backend")
+    router := asAdmin(NewHandler(svc, "/scim/v2").Routes())
+    path := "/Groups/" + strconv.FormatInt(team.ID, 10)
+
+    send := func(method, ifMatch, body string) *httptest.ResponseRecorder {
+        req := httptest.NewRequest(method, path, strings.NewReader(body))
+        if ifMatch != "" {
+            req.Header.Set("If-Match", ifMatch)
+        }
+        rec := httptest.NewRecorder()
+        router.ServeHTTP(rec, req)
+        return rec
+    }
+    add := func(userID string) string {
+        return `{"schemas":["urn:ietf:params:scim:api:messages:2.0:PatchOp"],"Operations":[{"op":"add","path":"members","value":[{"value":"` + userID + `"}]}]}`
+    }
+
+    rec := send(http.MethodGet, "", "")
+    stale := rec.Header().Get("ETag")
+    var g Group
+    json.NewDecoder(rec.Body).Decode(&g)
+    if stale == "" || g.Meta == nil || g.Meta.Version != stale {
+        t.Fatalf("expected the ETag to match meta.version, got %q and %+v", stale, g.Meta)
+    }
+
+    rec = send(http.MethodPatch, stale, add("u1"))
+    if rec.Code != http.StatusOK || rec.Header().Get("ETag") == stale {
+        t.Fatalf("expected the patch to apply with a new ETag, got %d %q", rec.Code, rec.Header().Get("ETag"))
+    }
+    if rec := send(http.MethodPatch, "W/"+stale, add("u2")); rec.Code != http.StatusPreconditionFailed {
+        t.Errorf("expected 412 for a stale If-Match, got %d: %s", rec.Code, rec.Body)
+    }
+    if rec := send(http.MethodDelete, stale, ""); rec.Code != http.StatusPreconditionFailed {
+        t.Errorf("expected 412 for deleting with a stale If-Match, got %d", rec.Code)
+    }
+    if rec := send(http.MethodPatch, "bogus", add("u2")); rec.Code != http.StatusBadRequest {
+        t.Errorf("expected 400 for a malformed If-Match, got %d", rec.Code)
+    }
+}
+
+func TestCreateGroupIsAtomic(t *testing.T) {
+    svc := service.New(memory.New())
+    if _, err := svc.ProvisionUser(context.Background(), "u1", "Alice", true); err != nil {
+        t.Fatal(err)
+    }
+    router := asAdmin(NewHandler(svc, "/scim/v2").Routes())
+    create := func(members string) *httptest.ResponseRecorder {
+        body := `{"schemas":["urn:ietf:params:scim:schemas:core:2.0:Group"],"displayName":"backend","members":[` + members + `]}`
+        rec := httptest.NewRecorder()
+        router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/Groups", strings.NewReader(body)))
+        return rec
+    }
+
+    if rec := create(`{"value":"u1"},{"value":"missing"}`); rec.Code != http.StatusBadRequest {
+        t.Fatalf("expected 400 for an unknown member, got %d: %s", rec.Code, rec.Body)
+    }
+    // Неудачное создание не оставляет пустую команду, повтор проходит
+    if rec := create(`{"value":"u1"}`); rec.Code != http.StatusCreated {
+        t.Fatalf("expected the retry to create the group, got %d: %s", rec.Code, rec.Body)
+    }
+    if _, members, err := svc.GetTeam(context.Background(), "backend"); err != nil || len(members) != 1 {
+        t.Errorf("expected backend with one member, got %+v %v", members, err)
+    }
+}
+
+// asAdmin выполняет запросы от имени администратора, как после auth.Middleware
+func asAdmin(h http.Handler) http.Handler {
+    return withScopes(h, auth.ScopeAdmin)
+}
+
+func withScopes(h http.Handler, scopes ...string) http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        p := &auth.Principal{Subject: "idp", Scopes: scopes}
+        h.ServeHTTP(w, r.WithContext(auth.WithPrincipal(r.Context(), p)))
+    })
+}
+
+// Группы - это команды: токену только с admin:users они недоступны
+func TestGroupScopes(t *testing.T) {
+    svc := service.New(memory.New())
+    ctx := context.Background()
+    if _, err := svc.ProvisionUser(ctx, "u1", "Alice", true); err != nil {
+        t.Fatal(err)
+    }
+    team, err := svc.ProvisionTeam(ctx, "backend", []string{"u1"})
+    if err != nil {
+        t.Fatal(err)
+    }
+    group := "/Groups/" + strconv.FormatInt(team.ID, 10)
+    routes := NewHandler(svc, "/scim/v2").Routes()
+    usersOnly := withScopes(routes, auth.ScopeAdminUsers)
+    teamsOnly := withScopes(routes, auth.ScopeAdminTeams)
+
+    send := func(h http.Handler, method, path, body string) int {
+        rec := httptest.NewRecorder()
+        h.ServeHTTP(rec, httptest.NewRequest(method, path, strings.NewReader(body)))
+        return rec.Code
+    }
+    rename := `{"schemas":["urn:ietf:params:scim:api:messages:2.0:PatchOp"],"Operations":[{"op":"replace","path":"displayName","value":"platform"}]}`
+    for _, c := range []struct{ method, path, body string }{
+        {http.MethodGet, "/Groups", ""},
+        {http.MethodPost, "/Groups", `{"displayName":"frontend","members":[{"value":"u1"}]}`},
+        {http.MethodPatch, group, rename},
+        {http.MethodDelete, group, ""},
+    } {
+        if code := send(usersOnly, c.method, c.path, c.body); code != http.StatusForbidden {
+            t.Errorf("%s %s with admin:users: expected 403, got %d", c.method, c.path, code)
+        }
+    }
+    if _, _, err := svc.GetTeam(ctx, "backend"); err != nil {
+        t.Errorf("expected the team to be untouched: %v", err)
+    }
+
+    if code := send(usersOnly, http.MethodGet, "/Users/u1", ""); code != http.StatusOK {
+        t.Errorf("expected admin:users to read users, got %d", code)
+    }
+    if code := send(teamsOnly, http.MethodGet, "/Users/u1", ""); code != http.StatusForbidden {
+        t.Errorf("expected admin:teams to be denied users, got %d", code)
+    }
+    if code := send(teamsOnly, http.MethodPatch, group, rename); code != http.StatusOK {
+        t.Errorf("expected admin:teams to rename the group, got %d", code)
+    }
+    if code := send(routes, http.MethodGet, "/Groups", ""); code != http.StatusUnauthorized {
+        t.Errorf("expected 401 without a principal, got %d", code)
+    }
+}
+
+// failingRepo имитирует сбой базы при чтении пользователей
+type failingRepo struct {
+    *memory.Repo
+}
+
+func (failingRepo) ListUsers(ctx context.Context) ([]repo.User, error) {
+    return nil, errors.New("pq: relation \"users\" does not exist")
+}
+
+func TestServiceErrors(t *testing.T) {
+    svc := service.New(memory.New())
+    router := asAdmin(NewHandler(svc, "/scim/v2").Routes())
+    send := func(h http.Handler, method, path, body string) (int, Error) {
+        rec := httptest.NewRecorder()
+        h.ServeHTTP(rec, httptest.NewRequest(method, path, strings.NewReader(body)))
+        var e Error
+        json.NewDecoder(rec.Body).Decode(&e)
+        return rec.Code, e
+    }
+
+    if code, e := send(router, http.MethodGet, "/Users/missing", ""); code != http.StatusNotFound || e.Status != "404" {
+        t.Errorf("expected 404 for a missing user, got %d %+v", code, e)
+    }
+    send(router, http.MethodPost, "/Users", `{"userName":"u1"}`)
+    if code, e := send(router, http.MethodPost, "/Users", `{"userName":"u1"}`); code != http.StatusConflict || e.ScimType != "uniqueness" {
+        t.Errorf("expected 409 uniqueness for a duplicate user, got %d %+v", code, e)
+    }
+
+    // Текст ошибки базы не уходит клиенту
+    broken := asAdmin(NewHandler(service.New(failingRepo{memory.New()}), "/scim/v2").Routes())
+    if code, e := send(broken, http.MethodGet, "/Users", ""); code != http.StatusInternalServerError || strings.Contains(e.Detail, "pq") {
+        t.Errorf("expected a generic 500, got %d %+v", code, e)
+    }
+}
+
+func TestRequestBodyLimits(t *testing.T) {
+    h := NewHandler(service.New(memory.New()), "/scim/v2")
+    h.SetBodyLimit(64)
+    router := asAdmin(h.Routes())
+    send := func(body string) (int, Error) {
+        rec := httptest.NewRecorder()
+        router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/Users", strings.NewReader(body)))
+        var e Error
+        json.NewDecoder(rec.Body).Decode(&e)
+        return rec.Code, e
+    }
+
+    if code, _ := send(`{"userName":"u1","displayName":"` + strings.Repeat("a", 100) + `"}`); code != http.StatusRequestEntityTooLarge {
+        t.Errorf("expected 413 for a body over the limit, got %d", code)
+    }
+    if code, e := send(`{"userName":"u1","nickName":"al"}`); code != http.StatusBadRequest || e.ScimType != "invalidSyntax" || !strings.Contains(e.Detail, "nickName") {
+        t.Errorf("expected 400 naming the unknown attribute, got %d %+v", code, e)
+    }
+    if code, _ := send(`{"userName":"u1"}`); code != http.StatusCreated {
+        t.Errorf("expected a small valid body to be accepted, got %d", code)
+    }
+}
@@ -0,0 +1,77 @@
+package server
+
+import (
+    "crypto/tls"
+    "log/slog"
+    "os"
+    "sync"
+    "time"
+)
+
+// certCheckInterval - как часто проверять файлы сертификата; чаще при каждом рукопожатии не нужно
+const certCheckInterval = 10 * time.Second
+
+// CertReloader отдает текущий сертификат и перечитывает пару файлов, когда меняется время их изменения,
+// поэтому обновление сертификата (certbot, cert-manager) не требует перезапуска
+type CertReloader struct {
+    certFile, keyFile string
+    checkInterval     time.Duration
+
+    mu        sync.Mutex
+    cert      *tls.Certificate
+    certMod   time.Time
+    keyMod    time.Time
+    checkedAt time.Time
+}
+
+// NewCertReloader загружает пару сразу, чтобы ошибка в путях обнаружилась при старте
+func NewCertReloader(certFile, keyFile string) (*CertReloader, error) {
+    r := &CertReloader{certFile: certFile, keyFile: keyFile, checkInterval: certCheckInterval}
+    if err := r.reload(); err != nil {
+        return nil, err
+    }
+    return r, nil
+}
+
+// GetCertificate подходит для tls.Config.GetCertificate. Если новые файлы не читаются
+// (например, записан только сертификат без ключа), используется прежний сертификат.
+func (r *CertReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+
+    if time.Since(r.checkedAt) >= r.checkInterval {
+        r.checkedAt = time.Now()
+        if r.changed() {
+            if err := r.reload(); err != nil {
+                slog.Warn("tls: keeping the previous certificate", "error", err)
+            } else {
+                slog.Info("tls: certificate reloaded", "file", r.certFile)
+            }
+        }
+    }
+    return r.cert, nil
+}
+
+func (r *CertReloader) changed() bool {
+    certMod, keyMod := modTime(r.certFile), modTime(r.keyFile)
+    return !certMod.Equal(r.certMod) || !keyMod.Equal(r.keyMod)
+}
+
+func (r *CertReloader) reload() error {
+    certMod, keyMod := modTime(r.certFile), modTime(r.keyFile)
+    cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+    if err != nil {
+        return err
+    }
+    r.cert, r.certMod, r.keyMod = &cert, certMod, keyMod
+    r.checkedAt = time.Now()
+    return nil
+}
+
+func modTime(path string) time.Time {
+    info, err := os.Stat(path)
+    if err != nil {
+        return time.Time{}
+    }
+    return info.ModTime()
+}
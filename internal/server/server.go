@@ -0,0 +1,140 @@
+// Package server запускает HTTP-сервер с таймаутами, TLS с перечитыванием сертификата,
+// дополнительным Unix-сокетом и плавной остановкой: после отмены контекста новые соединения
+// не принимаются, а начатые запросы дорабатывают до ShutdownTimeout.
+package server
+
+import (
+    "context"
+    "crypto/tls"
+    "errors"
+    "fmt"
+    "log/slog"
+    "net"
+    "net/http"
+    "os"
+    "sync"
+    "time"
+
+    "pr-review-assigner/internal/config"
+)
+
+type Server struct {
+    cfg       config.Server
+    http      *http.Server
+    certs     *CertReloader // nil без TLS
+    listeners []net.Listener
+}
+
+// New проверяет сертификат, если TLS включен, но еще не открывает сокеты
+func New(cfg config.Server, handler http.Handler) (*Server, error) {
+    s := &Server{
+        cfg: cfg,
+        http: &http.Server{
+            Handler:      handler,
+            ReadTimeout:  time.Duration(cfg.ReadTimeout),
+            WriteTimeout: time.Duration(cfg.WriteTimeout),
+            IdleTimeout:  time.Duration(cfg.IdleTimeout),
+        },
+    }
+    if cfg.TLSCertFile != "" {
+        certs, err := NewCertReloader(cfg.TLSCertFile, cfg.TLSKeyFile)
+        if err != nil {
+            return nil, err
+        }
+        s.certs = certs
+        s.http.TLSConfig = &tls.Config{MinVersion: tls.VersionTLS12, GetCertificate: certs.GetCertificate}
+    }
+    return s, nil
+}
+
+// RegisterOnShutdown вызывает f в начале остановки, например чтобы закрыть долгие потоки событий,
+// которые иначе держали бы соединения до конца ShutdownTimeout
+func (s *Server) RegisterOnShutdown(f func()) {
+    s.http.RegisterOnShutdown(f)
+}
+
+// Listen открывает TCP-адрес и, если задан, Unix-сокет
+func (s *Server) Listen() error {
+    tcp, err := net.Listen("tcp", s.cfg.Addr)
+    if err != nil {
+        return err
+    }
+    s.listeners = append(s.listeners, tcp)
+
+    if s.cfg.UnixSocket != "" {
+        // Сокет, оставшийся после аварийного завершения, мешает bind
+        if err := os.Remove(s.cfg.UnixSocket); err != nil && !errors.Is(err, os.ErrNotExist) {
+            tcp.Close()
+            return err
+        }
+        unix, err := net.Listen("unix", s.cfg.UnixSocket)
+        if err != nil {
+            tcp.Close()
+            return err
+        }
+        s.listeners = append(s.listeners, unix)
+    }
+    return nil
+}
+
+// Addr - адрес TCP-слушателя после Listen; полезен при порте 0
+func (s *Server) Addr() net.Addr {
+    return s.listeners[0].Addr()
+}
+
+// Serve обслуживает открытые сокеты до отмены ctx, затем ждет завершения начатых запросов.
+// Возвращает nil после плавной остановки и ошибку, если сокет закрылся сам или запросы не успели завершиться.
+func (s *Server) Serve(ctx context.Context) error {
+    errc := make(chan error, len(s.listeners))
+    var wg sync.WaitGroup
+    for i, l := range s.listeners {
+        wg.Add(1)
+        // Unix-сокет локальный, TLS на нем не нужен
+        useTLS := s.certs != nil && i == 0
+        go func(l net.Listener) {
+            defer wg.Done()
+            var err error
+            if useTLS {
+                err = s.http.ServeTLS(l, "", "")
+            } else {
+                err = s.http.Serve(l)
+            }
+            if !errors.Is(err, http.ErrServerClosed) {
+                errc <- err
+            }
+        }(l)
+    }
+
+    var serveErr error
+    select {
+    case <-ctx.Done():
+    case serveErr = <-errc:
+    }
+
+    shutdownCtx, cancel := context.WithTimeout(context.Background(), time.Duration(s.cfg.ShutdownTimeout))
+    defer cancel()
+    err := s.http.Shutdown(shutdownCtx)
+    if err != nil {
+        // Оставшиеся соединения обрываются, чтобы процесс все-таки завершился
+        s.http.Close()
+        err = fmt.Errorf("shutdown: %w", err)
+    }
+    wg.Wait()
+    return errors.Join(serveErr, err)
+}
+
+// Run - Listen и Serve
+func (s *Server) Run(ctx context.Context) error {
+    if err := s.Listen(); err != nil {
+        return err
+    }
+    scheme := "http"
+    if s.certs != nil {
+        scheme = "https"
+    }
+    slog.Info("server starting", "addr", s.Addr().String(), "scheme", scheme)
+    if s.cfg.UnixSocket != "" {
+        slog.Info("server also listening on a unix socket", "path", s.cfg.UnixSocket)
+    }
+    return s.Serve(ctx)
+}
@@ -0,0 +1,235 @@
+package server
+
+import (
+    "context"
+    "crypto/ecdsa"
+    "crypto/elliptic"
+    "crypto/rand"
+    "crypto/tls"
+    "crypto/x509"
+    "crypto/x509/pkix"
+    "encoding/pem"
+    "io"
+    "math/big"
+    "net"
+    "net/http"
+    "os"
+    "path/filepath"
+    "testing"
+    "time"
+
+    "pr-review-assigner/internal/config"
+)
+
+func testConfig() config.Server {
+    return config.Server{
+        Addr:            "127.0.0.1:0",
+        ReadTimeout:     config.Duration(5 * time.Second),
+        WriteTimeout:    config.Duration(5 * time.Second),
+        IdleTimeout:     config.Duration(5 * time.Second),
+        ShutdownTimeout: config.Duration(5 * time.Second),
+    }
+}
+
+// start запускает сервер и возвращает функцию остановки, ждущую результата Serve
+func start(t *testing.T, cfg config.Server, handler http.Handler) (*Server, func() error) {
+    t.Helper()
+    s, err := New(cfg, handler)
+    if err != nil {
+        t.Fatalf("New: %v", err)
+    }
+    if err := s.Listen(); err != nil {
+        t.Fatalf("Listen: %v", err)
+    }
+    ctx, cancel := context.WithCancel(context.Background())
+    done := make(chan error, 1)
+    go func() { done <- s.Serve(ctx) }()
+
+    var stopped bool
+    var result error
+    stop := func() error {
+        if !stopped {
+            stopped = true
+            cancel()
+            result = <-done
+        }
+        return result
+    }
+    t.Cleanup(func() { stop() })
+    return s, stop
+}
+
+// Начатый запрос дорабатывает после сигнала остановки, а новые соединения уже не принимаются
+func TestShutdownCompletesInFlightRequests(t *testing.T) {
+    started, release := make(chan struct{}), make(chan struct{})
+    shutdownHooks := make(chan struct{})
+    s, stop := start(t, testConfig(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        close(started)
+        <-release
+        io.WriteString(w, "reassigned")
+    }))
+    s.RegisterOnShutdown(func() { close(shutdownHooks) })
+    addr := s.Addr().String()
+
+    type result struct {
+        body string
+        err  error
+    }
+    res := make(chan result, 1)
+    go func() {
+        resp, err := http.Get("http://" + addr + "/pullRequest/reassign")
+        if err != nil {
+            res <- result{err: err}
+            return
+        }
+        defer resp.Body.Close()
+        body, err := io.ReadAll(resp.Body)
+        res <- result{string(body), err}
+    }()
+    <-started
+
+    stopped := make(chan error, 1)
+    go func() { stopped <- stop() }()
+    <-shutdownHooks
+
+    // Слушатель закрывается сразу после начала остановки
+    deadline := time.Now().Add(5 * time.Second)
+    for {
+        conn, err := net.Dial("tcp", addr)
+        if err != nil {
+            break
+        }
+        conn.Close()
+        if time.Now().After(deadline) {
+            t.Fatal("server still accepts connections during shutdown")
+        }
+        time.Sleep(10 * time.Millisecond)
+    }
+
+    select {
+    case err := <-stopped:
+        t.Fatalf("Serve returned before the in-flight request finished: %v", err)
+    default:
+    }
+
+    close(release)
+    if r := <-res; r.err != nil || r.body != "reassigned" {
+        t.Errorf("in-flight request was cut: %q, %v", r.body, r.err)
+    }
+    if err := <-stopped; err != nil {
+        t.Errorf("expected clean shutdown, got %v", err)
+    }
+}
+
+// Запрос, не уложившийся в ShutdownTimeout, обрывается, и Serve сообщает об этом
+func TestShutdownTimeout(t *testing.T) {
+    cfg := testConfig()
+    cfg.ShutdownTimeout = config.Duration(50 * time.Millisecond)
+    started, release := make(chan struct{}), make(chan struct{})
+    defer close(release)
+    s, stop := start(t, cfg, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        close(started)
+        <-release
+    }))
+
+    go http.Get("http://" + s.Addr().String() + "/")
+    <-started
+    if err := stop(); err == nil {
+        t.Error("expected shutdown timeout error")
+    }
+}
+
+func TestUnixSocket(t *testing.T) {
+    cfg := testConfig()
+    cfg.UnixSocket = filepath.Join(t.TempDir(), "assigner.sock")
+    // Оставшийся от прошлого запуска файл не мешает
+    os.WriteFile(cfg.UnixSocket, nil, 0o600)
+    start(t, cfg, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        io.WriteString(w, "ok")
+    }))
+
+    client := &http.Client{Transport: &http.Transport{
+        DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+            return (&net.Dialer{}).DialContext(ctx, "unix", cfg.UnixSocket)
+        },
+    }}
+    resp, err := client.Get("http://unix/health")
+    if err != nil {
+        t.Fatalf("GET over unix socket: %v", err)
+    }
+    defer resp.Body.Close()
+    if body, _ := io.ReadAll(resp.Body); string(body) != "ok" {
+        t.Errorf("unexpected body %q", body)
+    }
+}
+
+// Замененный на диске сертификат отдается новым соединениям без перезапуска
+func TestTLSCertificateReload(t *testing.T) {
+    dir := t.TempDir()
+    cfg := testConfig()
+    cfg.TLSCertFile, cfg.TLSKeyFile = filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+    writeCert(t, cfg.TLSCertFile, cfg.TLSKeyFile, 1)
+
+    s, _ := start(t, cfg, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+    s.certs.checkInterval = 0
+    serial := func() int64 {
+        t.Helper()
+        conn, err := tls.Dial("tcp", s.Addr().String(), &tls.Config{InsecureSkipVerify: true})
+        if err != nil {
+            t.Fatalf("tls dial: %v", err)
+        }
+        defer conn.Close()
+        return conn.ConnectionState().PeerCertificates[0].SerialNumber.Int64()
+    }
+
+    if got := serial(); got != 1 {
+        t.Fatalf("expected certificate 1, got %d", got)
+    }
+    writeCert(t, cfg.TLSCertFile, cfg.TLSKeyFile, 2)
+    if got := serial(); got != 2 {
+        t.Errorf("expected reloaded certificate 2, got %d", got)
+    }
+
+    // Битый файл не ломает рукопожатие: остается прежний сертификат
+    os.WriteFile(cfg.TLSKeyFile, []byte("garbage"), 0o600)
+    touch(t, cfg.TLSKeyFile, 3)
+    if got := serial(); got != 2 {
+        t.Errorf("expected previous certificate 2 after a bad key, got %d", got)
+    }
+}
+
+func writeCert(t *testing.T, certFile, keyFile string, serial int64) {
+    t.Helper()
+    key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+    if err != nil {
+        t.Fatal(err)
+    }
+    tmpl := &x509.Certificate{
+        SerialNumber: big.NewInt(serial),
+        Subject:      pkix.Name{CommonName: "localhost"},
+        NotBefore:    time.Now().Add(-time.Hour),
+        NotAfter:     time.Now().Add(time.Hour),
+        IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+    }
+    der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+    if err != nil {
+        t.Fatal(err)
+    }
+    keyDER, err := x509.MarshalECPrivateKey(key)
+    if err != nil {
+        t.Fatal(err)
+    }
+    os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600)
+    os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600)
+    // Время изменения файловой системы может быть грубее интервала между записями
+    touch(t, certFile, serial)
+    touch(t, keyFile, serial)
+}
+
+func touch(t *testing.T, path string, n int64) {
+    t.Helper()
+    mod := time.Unix(1_700_000_000+n*60, 0)
+    if err := os.Chtimes(path, mod, mod); err != nil {
+        t.Fatal(err)
+    }
+}
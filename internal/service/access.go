@@ -0,0 +1,101 @@
+package service
+
+import (
+    "context"
+
+    "pr-review-assigner/internal/auth"
+    "pr-review-assigner/internal/repo"
+)
+
+// Роли вызывающего определяются по auth.Principal из контекста:
+//   - нет Principal - внутренний вызов (CLI, фоновые задачи), разрешено все;
+//   - admin-scope соответствующей области (admin:users, admin:teams, admin) - администратор;
+//   - токен без пользователя - сервисный аккаунт, ограничен только scope'ами;
+//   - токен пользователя - участник, а для команд с is_lead - тимлид этих команд.
+// Роль не расширяет scope'ы: не-администратор меняет данные только токеном с write:prs,
+// токен только с read остается токеном на чтение и для лида.
+// Проверки выполняются здесь, чтобы любой транспорт получал одинаковые правила,
+// и до поиска ресурсов, чтобы 403 и 404 не выдавали, какие из них существуют.
+
+// authorizeUserActivity: менять активность может admin:users, сам пользователь или лид его команды
+func (s *Service) authorizeUserActivity(ctx context.Context, userID string) error {
+    p := auth.FromContext(ctx)
+    if p == nil || p.HasScope(auth.ScopeAdminUsers) {
+        return nil
+    }
+    if p.UserID == "" || !p.HasScope(auth.ScopeWritePRs) {
+        return ErrForbidden
+    }
+    if p.UserID == userID {
+        return nil
+    }
+    return s.requireLeadOf(ctx, p.UserID, userID)
+}
+
+// authorizeReassign: участник может снять только себя, лид - участников своей команды
+func (s *Service) authorizeReassign(ctx context.Context, oldUserID string) error {
+    p := auth.FromContext(ctx)
+    if p == nil || p.HasScope(auth.ScopeAdmin) {
+        return nil
+    }
+    if !p.HasScope(auth.ScopeWritePRs) {
+        return ErrForbidden
+    }
+    if p.UserID == "" || p.UserID == oldUserID {
+        return nil
+    }
+    return s.requireLeadOf(ctx, p.UserID, oldUserID)
+}
+
+// authorizeTeam: управлять командой целиком может admin:teams или лид этой команды
+func (s *Service) authorizeTeam(ctx context.Context, teamName string) error {
+    p := auth.FromContext(ctx)
+    if p == nil || p.HasScope(auth.ScopeAdminTeams) {
+        return nil
+    }
+    if p.UserID == "" || !p.HasScope(auth.ScopeWritePRs) {
+        return ErrForbidden
+    }
+
+    lead, err := isTeamLead(ctx, s.Repo, teamName, p.UserID)
+    if err != nil {
+        return err
+    }
+    if !lead {
+        return ErrForbidden
+    }
+    return nil
+}
+
+// requireLeadOf проверяет, что leadID - лид хотя бы одной команды пользователя userID
+func (s *Service) requireLeadOf(ctx context.Context, leadID, userID string) error {
+    teams, err := s.Repo.GetUserTeams(ctx, userID)
+    if err != nil {
+        return err
+    }
+
+    for _, team := range teams {
+        lead, err := isTeamLead(ctx, s.Repo, team.Name, leadID)
+        if err != nil {
+            return err
+        }
+        if lead {
+            return nil
+        }
+    }
+    return ErrForbidden
+}
+
+func isTeamLead(ctx context.Context, r repo.RepoInterface, teamName, userID string) (bool, error) {
+    members, err := r.GetTeamMembers(ctx, teamName)
+    if err != nil {
+        return false, err
+    }
+
+    for _, member := range members {
+        if member.ID == userID {
+            return member.IsLead, nil
+        }
+    }
+    return false, nil
+}
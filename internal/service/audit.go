@@ -0,0 +1,105 @@
+package service
+
+import (
+    "context"
+    "encoding/json"
+
+    "pr-review-assigner/internal/auth"
+    "pr-review-assigner/internal/repo"
+    "pr-review-assigner/internal/reqmeta"
+    "pr-review-assigner/internal/tracing"
+)
+
+// Действия, записываемые в журнал аудита
+const (
+    AuditTeamAdd           = "team.add"
+    AuditTeamDeactivate    = "team.deactivate"
+    AuditTeamSync          = "team.sync"
+    AuditTeamRename        = "team.rename"
+    AuditTeamMembersAdd    = "team.members_add"
+    AuditTeamMembersRemove = "team.members_remove"
+    AuditTeamMembersSet    = "team.members_set"
+    AuditTeamDelete        = "team.delete"
+    AuditUserSetActive     = "user.set_active"
+    AuditUserProvision     = "user.provision"
+    AuditUserUpdate        = "user.update"
+    AuditUserDeprovision   = "user.deprovision"
+    AuditPRCreate          = "pr.create"
+    AuditPRMerge           = "pr.merge"
+    AuditPRReassign        = "pr.reassign"
+    AuditTokenCreate       = "token.create"
+    AuditTokenRevoke       = "token.revoke"
+    AuditStateImport       = "state.import"
+)
+
+const (
+    defaultAuditLimit = 100
+    maxAuditLimit     = 1000
+)
+
+// audit пишет запись журнала через r - ту же транзакцию, в которой выполняется изменение
+func (s *Service) audit(ctx context.Context, r repo.RepoInterface, action, targetType, targetID string, before, after interface{}) error {
+    entry := &repo.AuditEntry{
+        Actor:      actorOf(ctx),
+        Action:     action,
+        TargetType: targetType,
+        TargetID:   targetID,
+    }
+
+    var err error
+    if entry.Before, err = snapshot(before); err != nil {
+        return err
+    }
+    if entry.After, err = snapshot(after); err != nil {
+        return err
+    }
+
+    meta := reqmeta.FromContext(ctx)
+    entry.RequestID = meta.RequestID
+    entry.SourceIP = meta.SourceIP
+
+    return r.AddAuditEntry(ctx, entry)
+}
+
+// ListAudit возвращает записи журнала, новые первыми
+func (s *Service) ListAudit(ctx context.Context, filter repo.AuditFilter) (_ []repo.AuditEntry, err error) {
+    ctx, span := startSpan(ctx, "ListAudit")
+    defer func() { tracing.End(span, err) }()
+
+    if filter.Limit <= 0 {
+        filter.Limit = defaultAuditLimit
+    }
+    if filter.Limit > maxAuditLimit {
+        filter.Limit = maxAuditLimit
+    }
+    return s.Repo.ListAuditEntries(ctx, filter)
+}
+
+// actorOf: user:<users.id> для токенов пользователей, учетные данные (token:<id>, jwt:<iss>|<sub>, bootstrap)
+// для остальных и system для внутренних вызовов. Префикс не дает сервисному токену с именем
+// пользователя выдать себя за него в журнале.
+func actorOf(ctx context.Context) string {
+    p := auth.FromContext(ctx)
+    switch {
+    case p == nil:
+        return "system"
+    case p.UserID != "":
+        return "user:" + p.UserID
+    case p.Credential != "":
+        return p.Credential
+    default:
+        // Принципалы без учетных данных создаются внутри процесса (prctl -db, тесты)
+        return "subject:" + p.Subject
+    }
+}
+
+func snapshot(v interface{}) (repo.JSONB, error) {
+    if v == nil {
+        return nil, nil
+    }
+    data, err := json.Marshal(v)
+    if err != nil {
+        return nil, err
+    }
+    return repo.JSONB(data), nil
+}
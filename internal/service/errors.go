@@ -0,0 +1,120 @@
+package service
+
+import (
+    "database/sql"
+    "errors"
+    "fmt"
+)
+
+// Kind - класс ошибки сервиса; по нему транспорты выбирают статус (HTTP, gRPC)
+type Kind int
+
+const (
+    KindInternal      Kind = iota // сбой базы или ошибка в коде, клиенту подробности не показываются
+    KindInvalid                   // некорректные входные данные
+    KindNotFound                  // сущность не найдена
+    KindExists                    // сущность с таким ключом уже есть
+    KindConflict                  // операция невозможна в текущем состоянии
+    KindForbidden                 // у вызывающего нет прав на операцию
+    KindUnprocessable             // данные корректны, но операцию над ними выполнить нельзя
+    KindPrecondition              // ресурс изменился с тех пор, как клиент его прочитал
+)
+
+// Коды ошибок - стабильная часть API: клиенты ветвятся по ним, а не по тексту
+const (
+    CodeInternal            = "INTERNAL_ERROR"
+    CodeBadRequest          = "BAD_REQUEST"
+    CodeNotFound            = "NOT_FOUND"
+    CodeTeamExists          = "TEAM_EXISTS"
+    CodePRExists            = "PR_EXISTS"
+    CodeUserExists          = "USER_EXISTS"
+    CodePRMerged            = "PR_MERGED"
+    CodeNotAssigned         = "NOT_ASSIGNED"
+    CodeNoCandidate         = "NO_CANDIDATE"
+    CodeNoTeam              = "NO_TEAM"
+    CodeForbidden           = "FORBIDDEN"
+    CodeInvalidManifest     = "INVALID_MANIFEST"
+    CodeInvalidSnapshot     = "INVALID_SNAPSHOT"
+    CodeInvalidTokenRequest = "INVALID_TOKEN_REQUEST"
+    CodeIdempotencyReused   = "IDEMPOTENCY_KEY_REUSED"
+    CodeIdempotencyInUse    = "IDEMPOTENCY_KEY_IN_USE"
+    CodePreconditionFailed  = "PRECONDITION_FAILED"
+)
+
+// FieldError описывает ошибку в одном поле запроса; Field - путь вида teams[0].team_name
+type FieldError struct {
+    Field   string `json:"field"`
+    Message string `json:"message"`
+}
+
+// Error - ошибка сервиса со стабильным кодом. Error() возвращает только Message, который можно
+// показать клиенту; причина (например, sql.ErrNoRows) доступна через errors.Is/errors.As.
+type Error struct {
+    Kind    Kind
+    Code    string
+    Message string
+    Fields  []FieldError
+    Err     error
+}
+
+func (e *Error) Error() string {
+    return e.Message
+}
+
+func (e *Error) Unwrap() error {
+    return e.Err
+}
+
+// Is сравнивает по коду, поэтому errors.Is(err, ErrNotFound) верно для любого "не найдено"
+func (e *Error) Is(target error) bool {
+    t, ok := target.(*Error)
+    return ok && t.Code == e.Code
+}
+
+var (
+    ErrTeamExists          = &Error{Kind: KindExists, Code: CodeTeamExists, Message: "team already exists"}
+    ErrPRExists            = &Error{Kind: KindExists, Code: CodePRExists, Message: "PR already exists"}
+    ErrUserExists          = &Error{Kind: KindExists, Code: CodeUserExists, Message: "user already exists"}
+    ErrPRMerged            = &Error{Kind: KindConflict, Code: CodePRMerged, Message: "PR is merged"}
+    ErrNotAssigned         = &Error{Kind: KindConflict, Code: CodeNotAssigned, Message: "reviewer not assigned"}
+    ErrNoCandidate         = &Error{Kind: KindConflict, Code: CodeNoCandidate, Message: "no active candidate in team"}
+    ErrNotFound            = &Error{Kind: KindNotFound, Code: CodeNotFound, Message: "resource not found"}
+    ErrInvalidRequest      = &Error{Kind: KindInvalid, Code: CodeBadRequest, Message: "invalid request"} // поля перечислены в Fields
+    ErrNoTeam              = &Error{Kind: KindUnprocessable, Code: CodeNoTeam, Message: "user has no team"}
+    ErrForbidden           = &Error{Kind: KindForbidden, Code: CodeForbidden, Message: "operation not permitted for caller"}
+    ErrInvalidManifest     = &Error{Kind: KindInvalid, Code: CodeInvalidManifest, Message: "invalid team manifest"}
+    ErrInvalidSnapshot     = &Error{Kind: KindInvalid, Code: CodeInvalidSnapshot, Message: "invalid snapshot"}
+    ErrInvalidTokenRequest = &Error{Kind: KindInvalid, Code: CodeInvalidTokenRequest, Message: "invalid token request"}
+    ErrIdempotencyReused   = &Error{Kind: KindUnprocessable, Code: CodeIdempotencyReused, Message: "idempotency key was used with a different request"}
+    ErrIdempotencyInUse    = &Error{Kind: KindConflict, Code: CodeIdempotencyInUse, Message: "request with this idempotency key is still in progress"}
+    ErrPreconditionFailed  = &Error{Kind: KindPrecondition, Code: CodePreconditionFailed, Message: "resource was modified"}
+)
+
+// Invalid - ошибка входных данных транспорта (тело не разбирается, не хватает параметра);
+// err, если есть, сохраняется как причина
+func Invalid(message string, err error) *Error {
+    return &Error{Kind: KindInvalid, Code: CodeBadRequest, Message: message, Err: err}
+}
+
+// InvalidField - ошибка входных данных в одном поле
+func InvalidField(field, message string) *Error {
+    return &Error{Kind: KindInvalid, Code: CodeBadRequest, Message: field + " " + message,
+        Fields: []FieldError{{Field: field, Message: message}}}
+}
+
+// notFound отличает отсутствие строки от сбоя базы: sql.ErrNoRows превращается в NOT_FOUND
+// с именем сущности, остальные ошибки возвращаются как есть с контекстом и станут 500
+func notFound(err error, what string, id interface{}) error {
+    if errors.Is(err, sql.ErrNoRows) {
+        return &Error{Kind: KindNotFound, Code: CodeNotFound, Message: fmt.Sprintf("%s %v not found", what, id), Err: err}
+    }
+    return fmt.Errorf("get %s %v: %w", what, id, err)
+}
+
+// noTeam - у пользователя нет команды, из которой можно выбрать ревьюверов; сбой базы возвращается как есть
+func noTeam(err error, role, userID string) error {
+    if errors.Is(err, sql.ErrNoRows) {
+        return &Error{Kind: KindUnprocessable, Code: CodeNoTeam, Message: fmt.Sprintf("%s %s has no team", role, userID), Err: err}
+    }
+    return fmt.Errorf("get team of %s %s: %w", role, userID, err)
+}
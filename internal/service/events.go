@@ -0,0 +1,80 @@
+package service
+
+import (
+    "context"
+
+    "pr-review-assigner/internal/events"
+    "pr-review-assigner/internal/repo"
+    "pr-review-assigner/internal/tracing"
+)
+
+const (
+    defaultEventsLimit = 1000
+    maxEventsLimit     = 10000
+)
+
+// EventFilter - выборка истории событий после AfterID; пустые поля не ограничивают выборку
+type EventFilter struct {
+    AfterID  int64
+    TeamName string
+    UserID   string
+    Limit    int
+}
+
+// ListEvents возвращает сохраненные события по возрастанию ID, например для догона после переподключения
+func (s *Service) ListEvents(ctx context.Context, filter EventFilter) (_ []events.Event, err error) {
+    ctx, span := startSpan(ctx, "ListEvents")
+    defer func() { tracing.End(span, err) }()
+
+    if filter.Limit <= 0 {
+        filter.Limit = defaultEventsLimit
+    }
+    if filter.Limit > maxEventsLimit {
+        filter.Limit = maxEventsLimit
+    }
+
+    stored, err := s.Repo.ListPREvents(ctx, repo.PREventFilter{
+        AfterID:  filter.AfterID,
+        TeamName: filter.TeamName,
+        UserID:   filter.UserID,
+        Limit:    filter.Limit,
+    })
+    if err != nil {
+        return nil, err
+    }
+
+    result := make([]events.Event, len(stored))
+    for i, e := range stored {
+        result[i] = events.Event{
+            ID:             e.ID,
+            Type:           e.Type,
+            PRID:           e.PRID,
+            TeamName:       e.TeamName,
+            AuthorID:       e.AuthorID,
+            ReviewerID:     e.ReviewerID,
+            ReplacedUserID: e.ReplacedUserID,
+            Timestamp:      e.CreatedAt,
+        }
+    }
+    return result, nil
+}
+
+// record сохраняет событие в той же транзакции, что и изменение, и добавляет его в pending;
+// подписчикам pending публикуется только после коммита
+func (s *Service) record(ctx context.Context, tx repo.RepoInterface, pending *[]events.Event, e events.Event) error {
+    stored := &repo.PREvent{
+        Type:           e.Type,
+        PRID:           e.PRID,
+        TeamName:       e.TeamName,
+        AuthorID:       e.AuthorID,
+        ReviewerID:     e.ReviewerID,
+        ReplacedUserID: e.ReplacedUserID,
+    }
+    if err := tx.AddPREvent(ctx, stored); err != nil {
+        return err
+    }
+
+    e.ID, e.Timestamp = stored.ID, stored.CreatedAt
+    *pending = append(*pending, e)
+    return nil
+}
@@ -0,0 +1,163 @@
+package service
+
+import (
+    "context"
+    "database/sql"
+    "errors"
+    "fmt"
+    "time"
+
+    "pr-review-assigner/internal/auth"
+    "pr-review-assigner/internal/repo"
+    "pr-review-assigner/internal/tracing"
+)
+
+// DefaultIdempotencyTTL - сколько хранится ответ на запрос с Idempotency-Key, если Service.IdempotencyTTL не задан
+const DefaultIdempotencyTTL = 24 * time.Hour
+
+// DefaultIdempotencyLease - сколько ключ занят выполняющимся запросом, если Service.IdempotencyLease не задан.
+// Если процесс упал, не успев сохранить ответ, повтор с тем же ключом выполнится после истечения аренды,
+// а не через IdempotencyTTL.
+const DefaultIdempotencyLease = time.Minute
+
+// MaxIdempotencyKeyLength - ограничение длины ключа; обычно это UUID или id задачи CI
+const MaxIdempotencyKeyLength = 255
+
+// ErrIdempotencyLeaseExpired - ответ не сохранен: аренда ключа истекла, и ключ уже занял или освободил другой запрос
+var ErrIdempotencyLeaseExpired = errors.New("idempotency key lease expired")
+
+// IdempotencyReservation - ключ, занятый выполняющимся запросом. Запрос должен уложиться в Deadline:
+// после него повтор с тем же ключом может выполниться заново.
+type IdempotencyReservation struct {
+    Key       string
+    CreatedAt time.Time // отличает эту резервацию от следующих резерваций того же ключа
+    Deadline  time.Time
+}
+
+// StoredResponse - ответ, сохраненный для повтора запроса с тем же Idempotency-Key
+type StoredResponse struct {
+    Status      int
+    ContentType string
+    ETag        string // версия ресурса из первого ответа: без нее клиент не сможет отправить If-Match после повтора
+    Body        []byte
+}
+
+// BeginIdempotentRequest резервирует ключ вызывающего для запроса с хешем requestHash.
+// Возвращает резервацию, если запрос нужно выполнить (затем CompleteIdempotentRequest или AbortIdempotentRequest),
+// или сохраненный ответ, если такой запрос уже выполнялся. Тот же ключ с другим запросом -
+// ErrIdempotencyReused, ключ еще не завершенного запроса - ErrIdempotencyInUse.
+func (s *Service) BeginIdempotentRequest(ctx context.Context, key, requestHash string) (_ *StoredResponse, _ *IdempotencyReservation, err error) {
+    ctx, span := startSpan(ctx, "BeginIdempotentRequest")
+    defer func() { tracing.End(span, err) }()
+
+    switch {
+    case key == "":
+        return nil, nil, InvalidField("Idempotency-Key", "must not be empty")
+    case len(key) > MaxIdempotencyKeyLength:
+        return nil, nil, InvalidField("Idempotency-Key", fmt.Sprintf("must be at most %d characters", MaxIdempotencyKeyLength))
+    }
+
+    owner := idempotencyOwner(ctx)
+    // Две попытки: между резервацией и чтением ключ могли удалить (сбой запроса, истечение срока)
+    for attempt := 0; attempt < 2; attempt++ {
+        now := time.Now()
+        reserved := &repo.IdempotencyKey{Owner: owner, Key: key, RequestHash: requestHash, ExpiresAt: now.Add(s.idempotencyLease())}
+        created, err := s.Repo.CreateIdempotencyKey(ctx, reserved)
+        if err != nil {
+            return nil, nil, err
+        }
+        if created {
+            return nil, &IdempotencyReservation{Key: key, CreatedAt: reserved.CreatedAt, Deadline: reserved.ExpiresAt}, nil
+        }
+
+        stored, err := s.Repo.GetIdempotencyKey(ctx, owner, key)
+        if errors.Is(err, sql.ErrNoRows) {
+            continue
+        }
+        if err != nil {
+            return nil, nil, err
+        }
+        // Истекший ключ (в том числе брошенная резервация), который еще не удалила очистка, считается свободным
+        if !stored.ExpiresAt.After(now) {
+            if err := s.Repo.DeleteIdempotencyKey(ctx, owner, key, stored.CreatedAt); err != nil {
+                return nil, nil, err
+            }
+            continue
+        }
+        if stored.RequestHash != requestHash {
+            return nil, nil, ErrIdempotencyReused
+        }
+        if stored.Status == 0 {
+            return nil, nil, ErrIdempotencyInUse
+        }
+        return &StoredResponse{Status: stored.Status, ContentType: stored.ContentType, ETag: stored.ETag, Body: stored.Body}, nil, nil
+    }
+    return nil, nil, ErrIdempotencyInUse
+}
+
+// CompleteIdempotentRequest сохраняет ответ на запрос, зарезервированный BeginIdempotentRequest, на IdempotencyTTL.
+// Если резервацию уже сменила другая (аренда истекла), ответ не сохраняется - ErrIdempotencyLeaseExpired.
+func (s *Service) CompleteIdempotentRequest(ctx context.Context, res *IdempotencyReservation, resp StoredResponse) (err error) {
+    ctx, span := startSpan(ctx, "CompleteIdempotentRequest")
+    defer func() { tracing.End(span, err) }()
+
+    completed, err := s.Repo.CompleteIdempotencyKey(ctx, &repo.IdempotencyKey{
+        Owner: idempotencyOwner(ctx), Key: res.Key, CreatedAt: res.CreatedAt,
+        Status: resp.Status, ContentType: resp.ContentType, ETag: resp.ETag, Body: resp.Body,
+        ExpiresAt: time.Now().Add(s.idempotencyTTL()),
+    })
+    if err != nil {
+        return err
+    }
+    if !completed {
+        return ErrIdempotencyLeaseExpired
+    }
+    return nil
+}
+
+// AbortIdempotentRequest освобождает ключ, если запрос завершился сбоем: повтор выполнится заново.
+// Чужая резервация того же ключа, сделанная после истечения аренды, не затрагивается.
+func (s *Service) AbortIdempotentRequest(ctx context.Context, res *IdempotencyReservation) (err error) {
+    ctx, span := startSpan(ctx, "AbortIdempotentRequest")
+    defer func() { tracing.End(span, err) }()
+
+    return s.Repo.DeleteIdempotencyKey(ctx, idempotencyOwner(ctx), res.Key, res.CreatedAt)
+}
+
+// PurgeIdempotencyKeys удаляет истекшие ключи и возвращает их число
+func (s *Service) PurgeIdempotencyKeys(ctx context.Context) (_ int64, err error) {
+    ctx, span := startSpan(ctx, "PurgeIdempotencyKeys")
+    defer func() { tracing.End(span, err) }()
+
+    return s.Repo.DeleteExpiredIdempotencyKeys(ctx, time.Now())
+}
+
+func (s *Service) idempotencyTTL() time.Duration {
+    if s.IdempotencyTTL <= 0 {
+        return DefaultIdempotencyTTL
+    }
+    return s.IdempotencyTTL
+}
+
+func (s *Service) idempotencyLease() time.Duration {
+    if s.IdempotencyLease <= 0 {
+        return DefaultIdempotencyLease
+    }
+    return s.IdempotencyLease
+}
+
+// idempotencyOwner - пространство ключей вызывающего, чтобы разные клиенты не получали ответы друг друга
+// при совпадении ключей. Subject для этого не годится: имена токенов не уникальны, а sub из JWT может
+// совпасть с именем токена, поэтому владелец - учетные данные (Principal.Credential).
+func idempotencyOwner(ctx context.Context) string {
+    p := auth.FromContext(ctx)
+    switch {
+    case p == nil:
+        return ""
+    case p.Credential != "":
+        return p.Credential
+    default:
+        // Принципалы без учетных данных создаются внутри процесса (prctl -db, тесты)
+        return "subject:" + p.Subject
+    }
+}
@@ -0,0 +1,528 @@
+package service
+
+import (
+    "context"
+    "database/sql"
+    "errors"
+    "fmt"
+    "math/rand"
+
+    "go.opentelemetry.io/otel/attribute"
+
+    "pr-review-assigner/internal/events"
+    "pr-review-assigner/internal/repo"
+    "pr-review-assigner/internal/tracing"
+)
+
+// Reassignment описывает замену ревьювера при деактивации пользователя
+type Reassignment struct {
+    PRID      string `json:"pull_request_id"`
+    OldUserID string `json:"old_user_id"`
+    NewUserID string `json:"new_user_id,omitempty"` // пусто, если замены не нашлось
+}
+
+// ListUsers возвращает всех пользователей
+func (s *Service) ListUsers(ctx context.Context) (_ []repo.User, err error) {
+    ctx, span := startSpan(ctx, "ListUsers")
+    defer func() { tracing.End(span, err) }()
+
+    return s.Repo.ListUsers(ctx)
+}
+
+// GetUser возвращает пользователя по ID вместе с именем команды; TeamName пуст, если команды нет
+func (s *Service) GetUser(ctx context.Context, userID string) (_ *repo.User, err error) {
+    ctx, span := startSpan(ctx, "GetUser", attrUserID.String(userID))
+    defer func() { tracing.End(span, err) }()
+
+    user, err := s.Repo.GetUserByID(ctx, userID)
+    if err != nil {
+        return nil, notFound(err, "user", userID)
+    }
+    user.TeamName, err = s.Repo.GetUserTeam(ctx, userID)
+    if err != nil && !errors.Is(err, sql.ErrNoRows) {
+        return nil, err
+    }
+    return user, nil
+}
+
+// ProvisionUser создает нового пользователя вне команды
+func (s *Service) ProvisionUser(ctx context.Context, userID, username string, active bool) (_ *repo.User, err error) {
+    ctx, span := startSpan(ctx, "ProvisionUser", attrUserID.String(userID))
+    defer func() { tracing.End(span, err) }()
+
+    var v validation
+    v.id("user_id", userID)
+    v.name("username", username)
+    if err := v.err(ErrInvalidRequest); err != nil {
+        return nil, err
+    }
+
+    if _, err := s.Repo.GetUserByID(ctx, userID); err == nil {
+        return nil, ErrUserExists
+    } else if !errors.Is(err, sql.ErrNoRows) {
+        return nil, err
+    }
+
+    user := &repo.User{ID: userID, Name: username, IsActive: active}
+    err = s.Repo.WithTx(ctx, func(tx repo.RepoInterface) error {
+        if err := tx.CreateUser(ctx, userID, username); err != nil {
+            return err
+        }
+        if err := tx.SetUserActive(ctx, userID, active); err != nil {
+            return err
+        }
+        return s.audit(ctx, tx, AuditUserProvision, "user", userID, nil, user)
+    })
+    if err != nil {
+        return nil, err
+    }
+
+    return user, nil
+}
+
+// UpdateUser меняет имя и/или активность; при деактивации открытые ревью переназначаются
+func (s *Service) UpdateUser(ctx context.Context, userID string, username *string, active *bool) (_ *repo.User, err error) {
+    ctx, span := startSpan(ctx, "UpdateUser", attrUserID.String(userID))
+    defer func() { tracing.End(span, err) }()
+
+    user, err := s.Repo.GetUserByID(ctx, userID)
+    if err != nil {
+        return nil, notFound(err, "user", userID)
+    }
+
+    before := *user
+    var pending []events.Event
+    err = s.Repo.WithTx(ctx, func(tx repo.RepoInterface) error {
+        if username != nil && *username != user.Name {
+            if err := tx.CreateUser(ctx, userID, *username); err != nil {
+                return err
+            }
+            user.Name = *username
+        }
+
+        if active != nil && *active != user.IsActive {
+            if err := tx.SetUserActive(ctx, userID, *active); err != nil {
+                return err
+            }
+            user.IsActive = *active
+
+            if !*active {
+                if _, err := s.reassignOpenReviews(ctx, tx, []string{userID}, &pending); err != nil {
+                    return err
+                }
+            }
+        }
+
+        if *user == before {
+            return nil
+        }
+        return s.audit(ctx, tx, AuditUserUpdate, "user", userID, before, user)
+    })
+    if err != nil {
+        return nil, err
+    }
+
+    s.Events.Publish(pending...)
+
+    return user, nil
+}
+
+// DeprovisionUser деактивирует пользователя, переназначает его ревью и убирает из команд
+func (s *Service) DeprovisionUser(ctx context.Context, userID string) (_ []Reassignment, err error) {
+    ctx, span := startSpan(ctx, "DeprovisionUser", attrUserID.String(userID))
+    defer func() { tracing.End(span, err) }()
+
+    user, err := s.Repo.GetUserByID(ctx, userID)
+    if err != nil {
+        return nil, notFound(err, "user", userID)
+    }
+
+    var reassigned []Reassignment
+    var pending []events.Event
+    err = s.Repo.WithTx(ctx, func(tx repo.RepoInterface) error {
+        if err := tx.SetUserActive(ctx, userID, false); err != nil {
+            return err
+        }
+
+        // Замену ищем до удаления из команд - кандидаты берутся из команды ревьювера
+        var err error
+        reassigned, err = s.reassignOpenReviews(ctx, tx, []string{userID}, &pending)
+        if err != nil {
+            return err
+        }
+
+        teams, err := tx.GetUserTeams(ctx, userID)
+        if err != nil {
+            return err
+        }
+        for _, team := range teams {
+            if err := tx.RemoveMember(ctx, team.ID, userID); err != nil {
+                return err
+            }
+        }
+
+        before := map[string]interface{}{"user": user, "teams": teams}
+        after := map[string]interface{}{"user": repo.User{ID: user.ID, Name: user.Name}, "reassigned": reassigned}
+        return s.audit(ctx, tx, AuditUserDeprovision, "user", userID, before, after)
+    })
+    if err != nil {
+        return nil, err
+    }
+
+    s.Events.Publish(pending...)
+
+    return reassigned, nil
+}
+
+// ProvisionTeam создает команду из уже существующих пользователей в одной транзакции:
+// неизвестный участник не оставляет после себя пустую команду
+func (s *Service) ProvisionTeam(ctx context.Context, teamName string, userIDs []string) (_ *repo.Team, err error) {
+    ctx, span := startSpan(ctx, "ProvisionTeam", attrTeamName.String(teamName), attribute.Int("team.members", len(userIDs)))
+    defer func() { tracing.End(span, err) }()
+
+    var v validation
+    v.teamName("team_name", teamName)
+    if err := v.err(ErrInvalidRequest); err != nil {
+        return nil, err
+    }
+
+    var team *repo.Team
+    err = s.Repo.WithTx(ctx, func(tx repo.RepoInterface) error {
+        exists, err := tx.TeamExists(ctx, teamName)
+        if err != nil {
+            return err
+        }
+        if exists {
+            return ErrTeamExists
+        }
+
+        teamID, err := tx.CreateTeam(ctx, teamName)
+        if err != nil {
+            return err
+        }
+        for i, userID := range userIDs {
+            if _, err := tx.GetUserByID(ctx, userID); errors.Is(err, sql.ErrNoRows) {
+                return InvalidField(fmt.Sprintf("members[%d]", i), fmt.Sprintf("is an unknown user %q", userID))
+            } else if err != nil {
+                return err
+            }
+            if err := tx.AddMember(ctx, teamID, userID); err != nil {
+                return err
+            }
+        }
+
+        team, err = tx.GetTeamByID(ctx, teamID)
+        if err != nil {
+            return err
+        }
+        after := map[string]interface{}{"team_name": teamName, "user_ids": userIDs}
+        return s.audit(ctx, tx, AuditTeamAdd, "team", teamName, nil, after)
+    })
+    if err != nil {
+        return nil, err
+    }
+
+    return team, nil
+}
+
+// ListTeams возвращает все команды
+func (s *Service) ListTeams(ctx context.Context) (_ []repo.Team, err error) {
+    ctx, span := startSpan(ctx, "ListTeams")
+    defer func() { tracing.End(span, err) }()
+
+    return s.Repo.ListTeams(ctx)
+}
+
+// GetTeamByID возвращает команду с участниками по ID
+func (s *Service) GetTeamByID(ctx context.Context, teamID int64) (_ *repo.Team, _ []repo.User, err error) {
+    ctx, span := startSpan(ctx, "GetTeamByID", attrTeamID.Int64(teamID))
+    defer func() { tracing.End(span, err) }()
+
+    team, err := s.Repo.GetTeamByID(ctx, teamID)
+    if err != nil {
+        return nil, nil, notFound(err, "team", teamID)
+    }
+
+    members, err := s.Repo.GetTeamMembers(ctx, team.Name)
+    if err != nil {
+        return nil, nil, err
+    }
+
+    return team, members, nil
+}
+
+// TeamChange - одно изменение команды в PatchTeam
+type TeamChange struct {
+    Op      string   // одна из TeamChange*
+    UserIDs []string // участники для add, remove и set
+    Name    string   // новое имя для rename
+}
+
+const (
+    TeamChangeAdd    = "add"    // добавить существующих пользователей
+    TeamChangeRemove = "remove" // убрать участников
+    TeamChangeSet    = "set"    // заменить состав целиком
+    TeamChangeRename = "rename" // переименовать команду
+)
+
+// PatchTeam применяет изменения команды по порядку в одной транзакции: либо все, либо ни одного.
+// С WithExpectedVersion изменения выполняются, только если версия команды не изменилась.
+func (s *Service) PatchTeam(ctx context.Context, teamID int64, changes ...TeamChange) (err error) {
+    ctx, span := startSpan(ctx, "PatchTeam", attrTeamID.Int64(teamID), attribute.Int("team.changes", len(changes)))
+    defer func() { tracing.End(span, err) }()
+
+    var v validation
+    for i, change := range changes {
+        switch change.Op {
+        case TeamChangeAdd, TeamChangeRemove, TeamChangeSet:
+        case TeamChangeRename:
+            v.teamName(fmt.Sprintf("changes[%d].name", i), change.Name)
+        default:
+            v.add(fmt.Sprintf("changes[%d].op", i), fmt.Sprintf("is an unknown operation %q", change.Op))
+        }
+    }
+    if err := v.err(ErrInvalidRequest); err != nil {
+        return err
+    }
+
+    team, err := s.Repo.GetTeamByID(ctx, teamID)
+    if err != nil {
+        return notFound(err, "team", teamID)
+    }
+    if err := checkVersion(ctx, "team", team.Name, team.Version); err != nil {
+        return err
+    }
+
+    return s.Repo.WithTx(ctx, func(tx repo.RepoInterface) error {
+        if err := matchTeamVersion(ctx, tx, team); err != nil {
+            return err
+        }
+        current := *team
+        for _, change := range changes {
+            if err := s.applyTeamChange(ctx, tx, &current, change); err != nil {
+                return err
+            }
+        }
+        return nil
+    })
+}
+
+// RenameTeam переименовывает команду
+func (s *Service) RenameTeam(ctx context.Context, teamID int64, name string) error {
+    return s.PatchTeam(ctx, teamID, TeamChange{Op: TeamChangeRename, Name: name})
+}
+
+// AddTeamMembers добавляет существующих пользователей в команду
+func (s *Service) AddTeamMembers(ctx context.Context, teamID int64, userIDs []string) error {
+    return s.PatchTeam(ctx, teamID, TeamChange{Op: TeamChangeAdd, UserIDs: userIDs})
+}
+
+// RemoveTeamMembers убирает пользователей из команды
+func (s *Service) RemoveTeamMembers(ctx context.Context, teamID int64, userIDs []string) error {
+    return s.PatchTeam(ctx, teamID, TeamChange{Op: TeamChangeRemove, UserIDs: userIDs})
+}
+
+// SetTeamMembers заменяет состав команды целиком
+func (s *Service) SetTeamMembers(ctx context.Context, teamID int64, userIDs []string) error {
+    return s.PatchTeam(ctx, teamID, TeamChange{Op: TeamChangeSet, UserIDs: userIDs})
+}
+
+// applyTeamChange выполняет одно изменение в транзакции PatchTeam; team.Name следует за переименованием
+func (s *Service) applyTeamChange(ctx context.Context, tx repo.RepoInterface, team *repo.Team, change TeamChange) error {
+    switch change.Op {
+    case TeamChangeRename:
+        if team.Name == change.Name {
+            return nil
+        }
+        exists, err := tx.TeamExists(ctx, change.Name)
+        if err != nil {
+            return err
+        }
+        if exists {
+            return ErrTeamExists
+        }
+        if err := tx.RenameTeam(ctx, team.ID, change.Name); err != nil {
+            return err
+        }
+        before := *team
+        team.Name = change.Name
+        return s.audit(ctx, tx, AuditTeamRename, "team", team.Name, before, repo.Team{ID: team.ID, Name: team.Name})
+
+    case TeamChangeAdd:
+        for _, userID := range change.UserIDs {
+            if _, err := tx.GetUserByID(ctx, userID); err != nil {
+                return notFound(err, "user", userID)
+            }
+            if err := tx.AddMember(ctx, team.ID, userID); err != nil {
+                return err
+            }
+        }
+        return s.audit(ctx, tx, AuditTeamMembersAdd, "team", team.Name, nil, map[string]interface{}{"user_ids": change.UserIDs})
+
+    case TeamChangeRemove:
+        for _, userID := range change.UserIDs {
+            if err := tx.RemoveMember(ctx, team.ID, userID); err != nil {
+                return err
+            }
+        }
+        return s.audit(ctx, tx, AuditTeamMembersRemove, "team", team.Name, map[string]interface{}{"user_ids": change.UserIDs}, nil)
+    }
+
+    desired := make(map[string]bool, len(change.UserIDs))
+    for _, userID := range change.UserIDs {
+        if _, err := tx.GetUserByID(ctx, userID); err != nil {
+            return notFound(err, "user", userID)
+        }
+        desired[userID] = true
+        if err := tx.AddMember(ctx, team.ID, userID); err != nil {
+            return err
+        }
+    }
+
+    current, err := tx.GetTeamMembers(ctx, team.Name)
+    if err != nil {
+        return err
+    }
+    before := make([]string, 0, len(current))
+    for _, member := range current {
+        if !desired[member.ID] {
+            if err := tx.RemoveMember(ctx, team.ID, member.ID); err != nil {
+                return err
+            }
+        }
+        before = append(before, member.ID)
+    }
+
+    return s.audit(ctx, tx, AuditTeamMembersSet, "team", team.Name,
+        map[string]interface{}{"user_ids": before}, map[string]interface{}{"user_ids": change.UserIDs})
+}
+
+// DeleteTeam удаляет команду; пользователи остаются
+func (s *Service) DeleteTeam(ctx context.Context, teamID int64) (err error) {
+    ctx, span := startSpan(ctx, "DeleteTeam", attrTeamID.Int64(teamID))
+    defer func() { tracing.End(span, err) }()
+
+    team, err := s.Repo.GetTeamByID(ctx, teamID)
+    if err != nil {
+        return notFound(err, "team", teamID)
+    }
+    if err := checkVersion(ctx, "team", team.Name, team.Version); err != nil {
+        return err
+    }
+    members, err := s.Repo.GetTeamMembers(ctx, team.Name)
+    if err != nil {
+        return err
+    }
+
+    return s.Repo.WithTx(ctx, func(tx repo.RepoInterface) error {
+        if err := matchTeamVersion(ctx, tx, team); err != nil {
+            return err
+        }
+        if err := tx.DeleteTeam(ctx, teamID); err != nil {
+            return err
+        }
+        before := map[string]interface{}{"team_name": team.Name, "members": members}
+        return s.audit(ctx, tx, AuditTeamDelete, "team", team.Name, before, nil)
+    })
+}
+
+// reassignOpenReviews снимает пользователей с открытых PR и подбирает им замену из их команд;
+// события о заменах добавляются в pending
+func (s *Service) reassignOpenReviews(ctx context.Context, r repo.RepoInterface, userIDs []string, pending *[]events.Event) ([]Reassignment, error) {
+    prs, err := r.GetOpenPRsWithReviewersByUserIDs(ctx, userIDs)
+    if err != nil {
+        return nil, err
+    }
+
+    leaving := make(map[string]bool, len(userIDs))
+    for _, id := range userIDs {
+        leaving[id] = true
+    }
+
+    result := []Reassignment{}
+    for _, pr := range prs {
+        reviewers, err := r.GetPRReviewers(ctx, pr.ID)
+        if err != nil {
+            return nil, err
+        }
+
+        assigned := make(map[string]bool, len(reviewers))
+        for _, reviewer := range reviewers {
+            assigned[reviewer.ID] = true
+        }
+
+        for _, reviewer := range reviewers {
+            if !leaving[reviewer.ID] {
+                continue
+            }
+
+            replacement, err := pickReplacement(ctx, r, reviewer.ID, pr.AuthorID, assigned, leaving)
+            if err != nil {
+                return nil, err
+            }
+
+            if err := r.RemoveReviewer(ctx, pr.ID, reviewer.ID); err != nil {
+                return nil, err
+            }
+            delete(assigned, reviewer.ID)
+
+            item := Reassignment{PRID: pr.ID, OldUserID: reviewer.ID}
+            if replacement != "" {
+                if err := r.AddReviewer(ctx, pr.ID, replacement); err != nil {
+                    return nil, err
+                }
+                if err := r.AddAssignmentEvent(ctx, pr.ID, replacement); err != nil {
+                    return nil, err
+                }
+                assigned[replacement] = true
+                item.NewUserID = replacement
+
+                authorTeam, err := r.GetUserTeam(ctx, pr.AuthorID)
+                warnIgnored(ctx, "get author team", err)
+                replaced := events.Event{
+                    Type:           events.TypeReviewerReplaced,
+                    PRID:           pr.ID,
+                    TeamName:       authorTeam,
+                    AuthorID:       pr.AuthorID,
+                    ReviewerID:     replacement,
+                    ReplacedUserID: reviewer.ID,
+                }
+                if err := s.record(ctx, r, pending, replaced); err != nil {
+                    return nil, err
+                }
+            }
+            result = append(result, item)
+        }
+    }
+
+    return result, nil
+}
+
+// pickReplacement выбирает случайного активного коллегу ревьювера, еще не назначенного на PR
+func pickReplacement(ctx context.Context, r repo.RepoInterface, reviewerID, authorID string, assigned, leaving map[string]bool) (string, error) {
+    teamName, err := r.GetUserTeam(ctx, reviewerID)
+    if errors.Is(err, sql.ErrNoRows) {
+        // Ревьювер вне команды - заменить некем
+        return "", nil
+    }
+    if err != nil {
+        return "", err
+    }
+
+    candidates, err := r.GetActiveTeamMembersExcept(ctx, teamName, authorID)
+    if err != nil {
+        return "", err
+    }
+
+    var eligible []string
+    for _, c := range candidates {
+        if !assigned[c.ID] && !leaving[c.ID] {
+            eligible = append(eligible, c.ID)
+        }
+    }
+    if len(eligible) == 0 {
+        return "", nil
+    }
+
+    return eligible[rand.Intn(len(eligible))], nil
+}
@@ -2,71 +2,114 @@ package service
 
 import (
     "context"
+    "database/sql"
     "errors"
+    "log/slog"
     "math/rand"
+    "sort"
     "time"
 
+    "go.opentelemetry.io/otel/attribute"
+    "go.opentelemetry.io/otel/trace"
+
+    "pr-review-assigner/internal/events"
     "pr-review-assigner/internal/repo"
+    "pr-review-assigner/internal/tracing"
 )
 
-var (
-    ErrTeamExists    = errors.New("team already exists")
-    ErrPRExists      = errors.New("PR already exists") 
-    ErrPRMerged      = errors.New("PR is merged")
-    ErrNotAssigned   = errors.New("reviewer not assigned")
-    ErrNoCandidate   = errors.New("no active candidate in team")
-    ErrNotFound      = errors.New("resource not found")
+// warnIgnored пишет в лог ошибку, после которой операция продолжается с пустым значением.
+// sql.ErrNoRows не пишется: например, пользователь без команды - обычная ситуация.
+func warnIgnored(ctx context.Context, op string, err error) {
+    if err != nil && !errors.Is(err, sql.ErrNoRows) {
+        slog.WarnContext(ctx, "ignored error", "op", op, "error", err)
+    }
+}
+
+// Стратегии выбора ревьюверов при создании PR
+const (
+    StrategyRandom      = "random"       // случайные активные участники команды
+    StrategyLeastLoaded = "least_loaded" // участники с наименьшим числом открытых ревью, при равенстве - случайно
 )
 
+// Strategies - допустимые значения Service.Strategy
+var Strategies = []string{StrategyRandom, StrategyLeastLoaded}
+
 type Service struct {
-    Repo repo.RepoInterface  // Изменено на интерфейс
+    Repo             repo.RepoInterface // Изменено на интерфейс
+    Events           *events.Broker     // события по PR, публикуются после коммита
+    ReviewerCount    int                // сколько ревьюверов назначать на новый PR
+    Strategy         string             // одна из Strategies
+    IdempotencyTTL   time.Duration      // сколько хранится ответ на запрос с Idempotency-Key
+    IdempotencyLease time.Duration      // сколько ключ занят выполняющимся запросом
 }
 
 func New(r repo.RepoInterface) *Service {  // Принимает интерфейс
     rand.Seed(time.Now().UnixNano())
-    return &Service{Repo: r}
+    return &Service{Repo: r, Events: events.NewBroker(), ReviewerCount: 2, Strategy: StrategyRandom}
 }
 
 // CreateTeam создает команду с участниками
-func (s *Service) CreateTeam(ctx context.Context, teamName string, members []repo.TeamMember) error {
-    exists, err := s.Repo.TeamExists(ctx, teamName)
-    if err != nil {
-        return err
-    }
-    if exists {
-        return ErrTeamExists
-    }
-
-    teamID, err := s.Repo.CreateTeam(ctx, teamName)
-    if err != nil {
+func (s *Service) CreateTeam(ctx context.Context, teamName string, members []repo.TeamMember) (err error) {
+    ctx, span := startSpan(ctx, "CreateTeam", attrTeamName.String(teamName), attribute.Int("team.members", len(members)))
+    defer func() { tracing.End(span, err) }()
+
+    var v validation
+    v.teamName("team_name", teamName)
+    v.members("members", members)
+    if err := v.err(ErrInvalidRequest); err != nil {
         return err
     }
 
-    for _, member := range members {
-        // Создаем/обновляем пользователя
-        if err := s.Repo.CreateUser(ctx, member.UserID, member.Username); err != nil {
+    return s.Repo.WithTx(ctx, func(tx repo.RepoInterface) error {
+        exists, err := tx.TeamExists(ctx, teamName)
+        if err != nil {
             return err
         }
+        if exists {
+            return ErrTeamExists
+        }
 
-        // Устанавливаем активность
-        if err := s.Repo.SetUserActive(ctx, member.UserID, member.IsActive); err != nil {
+        teamID, err := tx.CreateTeam(ctx, teamName)
+        if err != nil {
             return err
         }
 
-        // Добавляем в команду
-        if err := s.Repo.AddMember(ctx, teamID, member.UserID); err != nil {
-            return err
+        for _, member := range members {
+            // Создаем/обновляем пользователя
+            if err := tx.CreateUser(ctx, member.UserID, member.Username); err != nil {
+                return err
+            }
+
+            // Устанавливаем активность
+            if err := tx.SetUserActive(ctx, member.UserID, member.IsActive); err != nil {
+                return err
+            }
+
+            // Добавляем в команду
+            if err := tx.AddMember(ctx, teamID, member.UserID); err != nil {
+                return err
+            }
+
+            if member.IsLead {
+                if err := tx.SetTeamLead(ctx, teamID, member.UserID, true); err != nil {
+                    return err
+                }
+            }
         }
-    }
 
-    return nil
+        after := map[string]interface{}{"team_name": teamName, "members": members}
+        return s.audit(ctx, tx, AuditTeamAdd, "team", teamName, nil, after)
+    })
 }
 
 // GetTeam возвращает команду с участниками
-func (s *Service) GetTeam(ctx context.Context, teamName string) (*repo.Team, []repo.User, error) {
+func (s *Service) GetTeam(ctx context.Context, teamName string) (_ *repo.Team, _ []repo.User, err error) {
+    ctx, span := startSpan(ctx, "GetTeam", attrTeamName.String(teamName))
+    defer func() { tracing.End(span, err) }()
+
     team, err := s.Repo.GetTeamByName(ctx, teamName)
     if err != nil {
-        return nil, nil, ErrNotFound
+        return nil, nil, notFound(err, "team", teamName)
     }
 
     members, err := s.Repo.GetTeamMembers(ctx, teamName)
@@ -78,27 +121,58 @@ func (s *Service) GetTeam(ctx context.Context, teamName string) (*repo.Team, []r
 }
 
 // SetUserActive устанавливает флаг активности пользователя
-func (s *Service) SetUserActive(ctx context.Context, userID string, active bool) (*repo.User, error) {
-    user, err := s.Repo.GetUserByID(ctx, userID)
-    if err != nil {
-        return nil, ErrNotFound
+func (s *Service) SetUserActive(ctx context.Context, userID string, active bool) (_ *repo.User, err error) {
+    ctx, span := startSpan(ctx, "SetUserActive", attrUserID.String(userID), attribute.Bool("user.active", active))
+    defer func() { tracing.End(span, err) }()
+
+    var v validation
+    v.ref("user_id", userID)
+    if err := v.err(ErrInvalidRequest); err != nil {
+        return nil, err
     }
 
-    if err := s.Repo.SetUserActive(ctx, userID, active); err != nil {
+    if err := s.authorizeUserActivity(ctx, userID); err != nil {
         return nil, err
     }
 
-    // Получаем команду пользователя
-    teamName, _ := s.Repo.GetUserTeam(ctx, userID)
+    user, err := s.Repo.GetUserByID(ctx, userID)
+    if err != nil {
+        return nil, notFound(err, "user", userID)
+    }
 
+    // Получаем команду пользователя
+    teamName, err := s.Repo.GetUserTeam(ctx, userID)
+    warnIgnored(ctx, "get user team", err)
     user.TeamName = teamName
+    before := *user
+
     user.IsActive = active
+    err = s.Repo.WithTx(ctx, func(tx repo.RepoInterface) error {
+        if err := tx.SetUserActive(ctx, userID, active); err != nil {
+            return err
+        }
+        return s.audit(ctx, tx, AuditUserSetActive, "user", userID, before, user)
+    })
+    if err != nil {
+        return nil, err
+    }
 
     return user, nil
 }
 
 // CreatePR создает PR и назначает ревьюверов
-func (s *Service) CreatePR(ctx context.Context, prID, prName, authorID string) (*repo.PR, error) {
+func (s *Service) CreatePR(ctx context.Context, prID, prName, authorID string) (_ *repo.PR, err error) {
+    ctx, span := startSpan(ctx, "CreatePR", attrPRID.String(prID), attrUserID.String(authorID))
+    defer func() { tracing.End(span, err) }()
+
+    var v validation
+    v.id("pull_request_id", prID)
+    v.name("pull_request_name", prName)
+    v.ref("author_id", authorID)
+    if err := v.err(ErrInvalidRequest); err != nil {
+        return nil, err
+    }
+
     exists, err := s.Repo.PRExists(ctx, prID)
     if err != nil {
         return nil, err
@@ -110,53 +184,85 @@ func (s *Service) CreatePR(ctx context.Context, prID, prName, authorID string) (
     // Проверяем существование автора
     _, err = s.Repo.GetUserByID(ctx, authorID)
     if err != nil {
-        return nil, ErrNotFound
+        return nil, notFound(err, "author", authorID)
     }
 
     // Получаем команду автора
     teamName, err := s.Repo.GetUserTeam(ctx, authorID)
     if err != nil {
-        return nil, errors.New("author has no team")
+        return nil, noTeam(err, "author", authorID)
     }
+    span.SetAttributes(attrTeamName.String(teamName))
 
-    // Создаем PR
-    if err := s.Repo.CreatePRWithID(ctx, prID, prName, authorID); err != nil {
-        return nil, err
-    }
+    var pr *repo.PR
+    var pending []events.Event
+    err = s.Repo.WithTx(ctx, func(tx repo.RepoInterface) error {
+        // Создаем PR
+        if err := tx.CreatePRWithID(ctx, prID, prName, authorID); err != nil {
+            return err
+        }
+        event := events.Event{PRID: prID, TeamName: teamName, AuthorID: authorID}
+        created := event
+        created.Type = events.TypePRCreated
+        if err := s.record(ctx, tx, &pending, created); err != nil {
+            return err
+        }
 
-    // Назначаем ревьюверов
-    reviewers, err := s.assignReviewers(ctx, teamName, authorID)
-    if err != nil {
-        // PR создан, но ревьюверы не назначены - это допустимо
-    }
+        // Назначаем ревьюверов; PR без ревьюверов допустим
+        reviewers, err := s.assignReviewers(ctx, tx, teamName, authorID)
+        if err != nil {
+            return err
+        }
 
-    // Добавляем ревьюверов в PR
-    for _, reviewer := range reviewers {
-        if err := s.Repo.AddReviewer(ctx, prID, reviewer.ID); err != nil {
-            continue
+        // Добавляем ревьюверов в PR
+        for _, reviewer := range reviewers {
+            if err := tx.AddReviewer(ctx, prID, reviewer.ID); err != nil {
+                return err
+            }
+            if err := tx.AddAssignmentEvent(ctx, prID, reviewer.ID); err != nil {
+                return err
+            }
+            assigned := event
+            assigned.Type, assigned.ReviewerID = events.TypeReviewerAssigned, reviewer.ID
+            if err := s.record(ctx, tx, &pending, assigned); err != nil {
+                return err
+            }
         }
-        s.Repo.AddAssignmentEvent(ctx, prID, reviewer.ID)
-    }
 
-    pr := &repo.PR{
-        ID:        prID,
-        Title:     prName,
-        AuthorID:  authorID,
-        Status:    "OPEN",
-        Reviewers: reviewers,
+        version, err := prVersion(ctx, tx, prID)
+        if err != nil {
+            return err
+        }
+        pr = &repo.PR{
+            ID:        prID,
+            Title:     prName,
+            AuthorID:  authorID,
+            Status:    "OPEN",
+            Version:   version,
+            Reviewers: reviewers,
+        }
+        return s.audit(ctx, tx, AuditPRCreate, "pull_request", prID, nil, pr)
+    })
+    if err != nil {
+        return nil, err
     }
 
+    s.Events.Publish(pending...)
+
     return pr, nil
 }
 
-// assignReviewers назначает до 2 случайных активных ревьюверов из команды
-func (s *Service) assignReviewers(ctx context.Context, teamName, excludeUserID string) ([]repo.User, error) {
-    candidates, err := s.Repo.GetActiveTeamMembersExcept(ctx, teamName, excludeUserID)
+// assignReviewers выбирает до ReviewerCount активных ревьюверов из команды по стратегии Strategy
+func (s *Service) assignReviewers(ctx context.Context, r repo.RepoInterface, teamName, excludeUserID string) ([]repo.User, error) {
+    candidates, err := r.GetActiveTeamMembersExcept(ctx, teamName, excludeUserID)
     if err != nil {
         return nil, err
     }
 
+    span := trace.SpanFromContext(ctx)
+    span.SetAttributes(attrCandidates.Int(len(candidates)))
     if len(candidates) == 0 {
+        span.SetAttributes(attrAssigned.Int(0))
         return []repo.User{}, nil
     }
 
@@ -165,37 +271,88 @@ func (s *Service) assignReviewers(ctx context.Context, teamName, excludeUserID s
         candidates[i], candidates[j] = candidates[j], candidates[i]
     })
 
-    // Берем до 2 кандидатов
-    limit := 2
+    if s.Strategy == StrategyLeastLoaded {
+        // Нагрузка всех кандидатов - одним запросом; сортировка устойчивая,
+        // поэтому при равной нагрузке сохраняется случайный порядок
+        ids := make([]string, len(candidates))
+        for i, c := range candidates {
+            ids[i] = c.ID
+        }
+        prs, err := r.GetOpenPRsWithReviewersByUserIDs(ctx, ids)
+        if err != nil {
+            return nil, err
+        }
+        load := make(map[string]int, len(candidates))
+        for _, pr := range prs {
+            for _, reviewer := range pr.Reviewers {
+                load[reviewer.ID]++
+            }
+        }
+        sort.SliceStable(candidates, func(i, j int) bool { return load[candidates[i].ID] < load[candidates[j].ID] })
+    }
+
+    limit := s.ReviewerCount
     if len(candidates) < limit {
         limit = len(candidates)
     }
+    span.SetAttributes(attrAssigned.Int(limit))
 
     return candidates[:limit], nil
 }
 
+// GetPR возвращает PR с ревьюверами
+func (s *Service) GetPR(ctx context.Context, prID string) (_ *repo.PR, err error) {
+    ctx, span := startSpan(ctx, "GetPR", attrPRID.String(prID))
+    defer func() { tracing.End(span, err) }()
+
+    pr, err := s.Repo.GetPRByID(ctx, prID)
+    if err != nil {
+        return nil, notFound(err, "PR", prID)
+    }
+
+    reviewers, err := s.Repo.GetPRReviewers(ctx, prID)
+    if err != nil {
+        return nil, err
+    }
+    pr.Reviewers = reviewers
+
+    return pr, nil
+}
+
 // MergePR помечает PR как мерженный
-func (s *Service) MergePR(ctx context.Context, prID string) (*repo.PR, error) {
+func (s *Service) MergePR(ctx context.Context, prID string) (_ *repo.PR, err error) {
+    ctx, span := startSpan(ctx, "MergePR", attrPRID.String(prID))
+    defer func() { tracing.End(span, err) }()
+
+    var v validation
+    v.ref("pull_request_id", prID)
+    if err := v.err(ErrInvalidRequest); err != nil {
+        return nil, err
+    }
+
     pr, err := s.Repo.GetPRByID(ctx, prID)
     if err != nil {
-        return nil, ErrNotFound
+        return nil, notFound(err, "PR", prID)
+    }
+    if err := checkVersion(ctx, "PR", prID, pr.Version); err != nil {
+        return nil, err
     }
 
     if pr.Status == "MERGED" {
         // Идемпотентность - возвращаем текущее состояние
-        reviewers, _ := s.Repo.GetPRReviewers(ctx, prID)
+        reviewers, err := s.Repo.GetPRReviewers(ctx, prID)
+        warnIgnored(ctx, "get merged PR reviewers", err)
         pr.Reviewers = reviewers
         return pr, nil
     }
 
-    if err := s.Repo.SetPRStatus(ctx, prID, "MERGED"); err != nil {
-        return nil, err
-    }
-
     reviewers, err := s.Repo.GetPRReviewers(ctx, prID)
     if err != nil {
+        warnIgnored(ctx, "get PR reviewers", err)
         reviewers = []repo.User{}
     }
+    before := *pr
+    before.Reviewers = reviewers
 
     mergedPR := &repo.PR{
         ID:        pr.ID,
@@ -205,15 +362,60 @@ func (s *Service) MergePR(ctx context.Context, prID string) (*repo.PR, error) {
         Reviewers: reviewers,
     }
 
+    teamName, err := s.Repo.GetUserTeam(ctx, pr.AuthorID)
+    warnIgnored(ctx, "get author team", err)
+    span.SetAttributes(attrTeamName.String(teamName))
+    var pending []events.Event
+    err = s.Repo.WithTx(ctx, func(tx repo.RepoInterface) error {
+        if err := matchPRVersion(ctx, tx, prID); err != nil {
+            return err
+        }
+        if err := tx.SetPRStatus(ctx, prID, "MERGED"); err != nil {
+            return err
+        }
+        version, err := prVersion(ctx, tx, prID)
+        if err != nil {
+            return err
+        }
+        mergedPR.Version = version
+        merged := events.Event{Type: events.TypePRMerged, PRID: prID, TeamName: teamName, AuthorID: pr.AuthorID}
+        if err := s.record(ctx, tx, &pending, merged); err != nil {
+            return err
+        }
+        return s.audit(ctx, tx, AuditPRMerge, "pull_request", prID, before, mergedPR)
+    })
+    if err != nil {
+        return nil, err
+    }
+
+    s.Events.Publish(pending...)
+
     return mergedPR, nil
 }
 
 // ReassignReviewer переназначает ревьювера
-func (s *Service) ReassignReviewer(ctx context.Context, prID, oldUserID string) (*repo.PR, string, error) {
+func (s *Service) ReassignReviewer(ctx context.Context, prID, oldUserID string) (_ *repo.PR, _ string, err error) {
+    ctx, span := startSpan(ctx, "ReassignReviewer", attrPRID.String(prID), attrUserID.String(oldUserID))
+    defer func() { tracing.End(span, err) }()
+
+    var v validation
+    v.ref("pull_request_id", prID)
+    v.ref("old_user_id", oldUserID)
+    if err := v.err(ErrInvalidRequest); err != nil {
+        return nil, "", err
+    }
+
+    if err := s.authorizeReassign(ctx, oldUserID); err != nil {
+        return nil, "", err
+    }
+
     // Проверяем PR
     pr, err := s.Repo.GetPRByID(ctx, prID)
     if err != nil {
-        return nil, "", ErrNotFound
+        return nil, "", notFound(err, "PR", prID)
+    }
+    if err := checkVersion(ctx, "PR", prID, pr.Version); err != nil {
+        return nil, "", err
     }
 
     if pr.Status == "MERGED" {
@@ -241,46 +443,90 @@ func (s *Service) ReassignReviewer(ctx context.Context, prID, oldUserID string)
     // Получаем команду старого ревьювера
     teamName, err := s.Repo.GetUserTeam(ctx, oldUserID)
     if err != nil {
-        return nil, "", errors.New("old reviewer has no team")
+        return nil, "", noTeam(err, "reviewer", oldUserID)
     }
 
     // Ищем замену из команды старого ревьювера
     newReviewer, err := s.Repo.GetRandomActiveTeamMember(ctx, teamName, oldUserID)
-    if err != nil {
+    if errors.Is(err, sql.ErrNoRows) {
         return nil, "", ErrNoCandidate
     }
-
-    // Выполняем замену
-    if err := s.Repo.RemoveReviewer(ctx, prID, oldUserID); err != nil {
+    if err != nil {
         return nil, "", err
     }
+    span.SetAttributes(attrTeamName.String(teamName), attrReviewerID.String(newReviewer.ID))
 
-    if err := s.Repo.AddReviewer(ctx, prID, newReviewer.ID); err != nil {
-        return nil, "", err
-    }
+    authorTeam, err := s.Repo.GetUserTeam(ctx, pr.AuthorID)
+    warnIgnored(ctx, "get author team", err)
+    before := *pr
+    before.Reviewers = reviewers
+    var updatedPR *repo.PR
+    var pending []events.Event
+    err = s.Repo.WithTx(ctx, func(tx repo.RepoInterface) error {
+        if err := matchPRVersion(ctx, tx, prID); err != nil {
+            return err
+        }
 
-    // Записываем событие назначения
-    s.Repo.AddAssignmentEvent(ctx, prID, newReviewer.ID)
+        // Выполняем замену
+        if err := tx.RemoveReviewer(ctx, prID, oldUserID); err != nil {
+            return err
+        }
 
-    // Получаем обновленный список ревьюверов
-    updatedReviewers, _ := s.Repo.GetPRReviewers(ctx, prID)
+        if err := tx.AddReviewer(ctx, prID, newReviewer.ID); err != nil {
+            return err
+        }
 
-    updatedPR := &repo.PR{
-        ID:        pr.ID,
-        Title:     pr.Title,
-        AuthorID:  pr.AuthorID,
-        Status:    pr.Status,
-        Reviewers: updatedReviewers,
+        // Записываем событие назначения
+        if err := tx.AddAssignmentEvent(ctx, prID, newReviewer.ID); err != nil {
+            return err
+        }
+        replaced := events.Event{
+            Type:           events.TypeReviewerReplaced,
+            PRID:           prID,
+            TeamName:       authorTeam,
+            AuthorID:       pr.AuthorID,
+            ReviewerID:     newReviewer.ID,
+            ReplacedUserID: oldUserID,
+        }
+        if err := s.record(ctx, tx, &pending, replaced); err != nil {
+            return err
+        }
+
+        // Получаем обновленный список ревьюверов
+        updatedReviewers, err := tx.GetPRReviewers(ctx, prID)
+        warnIgnored(ctx, "get updated PR reviewers", err)
+        version, err := prVersion(ctx, tx, prID)
+        if err != nil {
+            return err
+        }
+
+        updatedPR = &repo.PR{
+            ID:        pr.ID,
+            Title:     pr.Title,
+            AuthorID:  pr.AuthorID,
+            Status:    pr.Status,
+            Version:   version,
+            Reviewers: updatedReviewers,
+        }
+        return s.audit(ctx, tx, AuditPRReassign, "pull_request", prID, before, updatedPR)
+    })
+    if err != nil {
+        return nil, "", err
     }
 
+    s.Events.Publish(pending...)
+
     return updatedPR, newReviewer.ID, nil
 }
 
 // GetUserReviews возвращает PR где пользователь ревьювер
-func (s *Service) GetUserReviews(ctx context.Context, userID string) ([]repo.PR, error) {
-    _, err := s.Repo.GetUserByID(ctx, userID)
+func (s *Service) GetUserReviews(ctx context.Context, userID string) (_ []repo.PR, err error) {
+    ctx, span := startSpan(ctx, "GetUserReviews", attrUserID.String(userID))
+    defer func() { tracing.End(span, err) }()
+
+    _, err = s.Repo.GetUserByID(ctx, userID)
     if err != nil {
-        return nil, ErrNotFound
+        return nil, notFound(err, "user", userID)
     }
 
     prs, err := s.Repo.GetPRsByReviewer(ctx, userID)
@@ -291,32 +537,111 @@ func (s *Service) GetUserReviews(ctx context.Context, userID string) ([]repo.PR,
     return prs, nil
 }
 
+// ListTeamOpenPRs возвращает открытые PR авторов команды вместе с ревьюверами
+func (s *Service) ListTeamOpenPRs(ctx context.Context, teamName string) (_ []repo.PR, err error) {
+    ctx, span := startSpan(ctx, "ListTeamOpenPRs", attrTeamName.String(teamName))
+    defer func() { tracing.End(span, err) }()
+
+    if _, err := s.Repo.GetTeamByName(ctx, teamName); err != nil {
+        return nil, notFound(err, "team", teamName)
+    }
+
+    prs, err := s.Repo.GetOpenPRsByTeam(ctx, teamName)
+    if err != nil {
+        return nil, err
+    }
+
+    for i := range prs {
+        reviewers, err := s.Repo.GetPRReviewers(ctx, prs[i].ID)
+        if err != nil {
+            return nil, err
+        }
+        prs[i].Reviewers = reviewers
+    }
+
+    return prs, nil
+}
+
+// Stats - статистика назначений: user_id -> количество назначений
+type Stats struct {
+    AssignmentStats map[string]int
+    Timestamp       time.Time
+}
+
 // GetStats возвращает статистику назначений
-func (s *Service) GetStats(ctx context.Context) (map[string]interface{}, error) {
+func (s *Service) GetStats(ctx context.Context) (_ *Stats, err error) {
+    ctx, span := startSpan(ctx, "GetStats")
+    defer func() { tracing.End(span, err) }()
+
     stats, err := s.Repo.GetAssignmentStats(ctx)
     if err != nil {
         return nil, err
     }
-
-    result := map[string]interface{}{
-        "assignment_stats": stats,
-        "timestamp":        time.Now().Format(time.RFC3339),
+    if stats == nil {
+        stats = map[string]int{}
     }
 
-    return result, nil
+    return &Stats{AssignmentStats: stats, Timestamp: time.Now()}, nil
 }
 
 // BulkDeactivateTeam массово деактивирует пользователей команды
-func (s *Service) BulkDeactivateTeam(ctx context.Context, teamName string, reassign bool) error {
+func (s *Service) BulkDeactivateTeam(ctx context.Context, teamName string, reassign bool) (err error) {
+    ctx, span := startSpan(ctx, "BulkDeactivateTeam", attrTeamName.String(teamName), attribute.Bool("reassign", reassign))
+    defer func() { tracing.End(span, err) }()
+
+    if err := s.authorizeTeam(ctx, teamName); err != nil {
+        return err
+    }
+
     team, err := s.Repo.GetTeamByName(ctx, teamName)
     if err != nil {
-        return ErrNotFound
+        return notFound(err, "team", teamName)
+    }
+    if err := checkVersion(ctx, "team", teamName, team.Version); err != nil {
+        return err
     }
 
-    // Деактивируем пользователей
-    if err := s.Repo.DeactivateTeamMembers(ctx, team.ID); err != nil {
+    var pending []events.Event
+    err = s.Repo.WithTx(ctx, func(tx repo.RepoInterface) error {
+        if err := matchTeamVersion(ctx, tx, team); err != nil {
+            return err
+        }
+        before, err := tx.GetTeamMembers(ctx, teamName)
+        if err != nil {
+            return err
+        }
+
+        // Деактивируем пользователей
+        if err := tx.DeactivateTeamMembers(ctx, team.ID); err != nil {
+            return err
+        }
+
+        after := map[string]interface{}{"members": before}
+        if reassign {
+            userIDs := make([]string, len(before))
+            for i, member := range before {
+                userIDs[i] = member.ID
+            }
+
+            // Переназначаем открытые ревью деактивированных участников
+            reassigned, err := s.reassignOpenReviews(ctx, tx, userIDs, &pending)
+            if err != nil {
+                return err
+            }
+            after["reassigned"] = reassigned
+        }
+
+        members, err := tx.GetTeamMembers(ctx, teamName)
+        if err != nil {
+            return err
+        }
+        after["members"] = members
+        return s.audit(ctx, tx, AuditTeamDeactivate, "team", teamName, map[string]interface{}{"members": before}, after)
+    })
+    if err != nil {
         return err
     }
 
+    s.Events.Publish(pending...)
     return nil
 }
\ No newline at end of file
@@ -1,279 +1,23 @@
 package service
 
 import (
+    "bytes"
     "context"
+    "database/sql"
     "errors"
+    "strconv"
+    "strings"
     "testing"
+    "time"
 
+    "pr-review-assigner/internal/auth"
     "pr-review-assigner/internal/repo"
+    "pr-review-assigner/internal/repo/memory"
+    "pr-review-assigner/internal/reqmeta"
 )
 
-// Mock репозитория для тестирования
-type mockRepo struct {
-    users        map[string]*repo.User
-    teams        map[string]*repo.Team
-    teamMembers  map[string][]string // teamName -> userIDs
-    prs          map[string]*repo.PR
-    prReviewers  map[string][]string // prID -> reviewerIDs
-    assignments  []struct{ prID, userID string }
-}
-
-func newMockRepo() *mockRepo {
-    return &mockRepo{
-        users:       make(map[string]*repo.User),
-        teams:       make(map[string]*repo.Team),
-        teamMembers: make(map[string][]string),
-        prs:         make(map[string]*repo.PR),
-        prReviewers: make(map[string][]string),
-    }
-}
-
-func (m *mockRepo) CreateUser(ctx context.Context, userID, username string) error {
-    m.users[userID] = &repo.User{
-        ID:       userID,
-        Name:     username,
-        IsActive: true,
-    }
-    return nil
-}
-
-func (m *mockRepo) GetUserByID(ctx context.Context, userID string) (*repo.User, error) {
-    user, exists := m.users[userID]
-    if !exists {
-        return nil, errors.New("user not found")
-    }
-    return user, nil
-}
-
-func (m *mockRepo) SetUserActive(ctx context.Context, userID string, active bool) error {
-    user, exists := m.users[userID]
-    if !exists {
-        return errors.New("user not found")
-    }
-    user.IsActive = active
-    return nil
-}
-
-func (m *mockRepo) TeamExists(ctx context.Context, name string) (bool, error) {
-    _, exists := m.teams[name]
-    return exists, nil
-}
-
-func (m *mockRepo) CreateTeam(ctx context.Context, name string) (int64, error) {
-    if _, exists := m.teams[name]; exists {
-        return 0, errors.New("team exists")
-    }
-    m.teams[name] = &repo.Team{
-        ID:   int64(len(m.teams) + 1),
-        Name: name,
-    }
-    return m.teams[name].ID, nil
-}
-
-func (m *mockRepo) AddMember(ctx context.Context, teamID int64, userID string) error {
-    // Находим команду по ID
-    var teamName string
-    for name, team := range m.teams {
-        if team.ID == teamID {
-            teamName = name
-            break
-        }
-    }
-    if teamName == "" {
-        return errors.New("team not found")
-    }
-    
-    m.teamMembers[teamName] = append(m.teamMembers[teamName], userID)
-    return nil
-}
-
-func (m *mockRepo) GetTeamByName(ctx context.Context, name string) (*repo.Team, error) {
-    team, exists := m.teams[name]
-    if !exists {
-        return nil, errors.New("team not found")
-    }
-    return team, nil
-}
-
-func (m *mockRepo) GetTeamMembers(ctx context.Context, teamName string) ([]repo.User, error) {
-    memberIDs := m.teamMembers[teamName]
-    var users []repo.User
-    for _, id := range memberIDs {
-        if user, exists := m.users[id]; exists {
-            users = append(users, *user)
-        }
-    }
-    return users, nil
-}
-
-func (m *mockRepo) GetActiveTeamMembersExcept(ctx context.Context, teamName string, excludeUserID string) ([]repo.User, error) {
-    memberIDs := m.teamMembers[teamName]
-    var users []repo.User
-    for _, id := range memberIDs {
-        if user, exists := m.users[id]; exists && user.IsActive && user.ID != excludeUserID {
-            users = append(users, *user)
-        }
-    }
-    return users, nil
-}
-
-func (m *mockRepo) PRExists(ctx context.Context, prID string) (bool, error) {
-    _, exists := m.prs[prID]
-    return exists, nil
-}
-
-func (m *mockRepo) CreatePRWithID(ctx context.Context, prID, title, authorID string) error {
-    if _, exists := m.prs[prID]; exists {
-        return errors.New("PR exists")
-    }
-    m.prs[prID] = &repo.PR{
-        ID:       prID,
-        Title:    title,
-        AuthorID: authorID,
-        Status:   "OPEN",
-    }
-    return nil
-}
-
-func (m *mockRepo) GetPRByID(ctx context.Context, prID string) (*repo.PR, error) {
-    pr, exists := m.prs[prID]
-    if !exists {
-        return nil, errors.New("PR not found")
-    }
-    return pr, nil
-}
-
-func (m *mockRepo) AddReviewer(ctx context.Context, prID, userID string) error {
-    m.prReviewers[prID] = append(m.prReviewers[prID], userID)
-    return nil
-}
-
-func (m *mockRepo) RemoveReviewer(ctx context.Context, prID, userID string) error {
-    reviewers := m.prReviewers[prID]
-    for i, id := range reviewers {
-        if id == userID {
-            m.prReviewers[prID] = append(reviewers[:i], reviewers[i+1:]...)
-            return nil
-        }
-    }
-    return errors.New("reviewer not found")
-}
-
-func (m *mockRepo) GetPRReviewers(ctx context.Context, prID string) ([]repo.User, error) {
-    reviewerIDs := m.prReviewers[prID]
-    var users []repo.User
-    for _, id := range reviewerIDs {
-        if user, exists := m.users[id]; exists {
-            users = append(users, *user)
-        }
-    }
-    return users, nil
-}
-
-func (m *mockRepo) SetPRStatus(ctx context.Context, prID string, status string) error {
-    pr, exists := m.prs[prID]
-    if !exists {
-        return errors.New("PR not found")
-    }
-    pr.Status = status
-    return nil
-}
-
-func (m *mockRepo) GetPRsByReviewer(ctx context.Context, userID string) ([]repo.PR, error) {
-    var result []repo.PR
-    for prID, reviewers := range m.prReviewers {
-        for _, reviewerID := range reviewers {
-            if reviewerID == userID {
-                if pr, exists := m.prs[prID]; exists {
-                    result = append(result, *pr)
-                }
-                break
-            }
-        }
-    }
-    return result, nil
-}
-
-func (m *mockRepo) GetUserTeam(ctx context.Context, userID string) (string, error) {
-    for teamName, members := range m.teamMembers {
-        for _, memberID := range members {
-            if memberID == userID {
-                return teamName, nil
-            }
-        }
-    }
-    return "", errors.New("user not in any team")
-}
-
-func (m *mockRepo) GetRandomActiveTeamMember(ctx context.Context, teamName, excludeUserID string) (*repo.User, error) {
-    members, err := m.GetActiveTeamMembersExcept(ctx, teamName, excludeUserID)
-    if err != nil {
-        return nil, err
-    }
-    if len(members) == 0 {
-        return nil, errors.New("no active members")
-    }
-    // Возвращаем первого доступного (в реальности должен быть случайный)
-    return &members[0], nil
-}
-
-func (m *mockRepo) AddAssignmentEvent(ctx context.Context, prID, userID string) error {
-    m.assignments = append(m.assignments, struct{ prID, userID string }{prID, userID})
-    return nil
-}
-
-func (m *mockRepo) GetAssignmentStats(ctx context.Context) (map[string]int, error) {
-    stats := make(map[string]int)
-    for _, assignment := range m.assignments {
-        stats[assignment.userID]++
-    }
-    return stats, nil
-}
-
-func (m *mockRepo) DeactivateTeamMembers(ctx context.Context, teamID int64) error {
-    // Находим команду по ID
-    var teamName string
-    for name, team := range m.teams {
-        if team.ID == teamID {
-            teamName = name
-            break
-        }
-    }
-    if teamName == "" {
-        return errors.New("team not found")
-    }
-
-    // Деактивируем всех членов команды
-    for _, userID := range m.teamMembers[teamName] {
-        if user, exists := m.users[userID]; exists {
-            user.IsActive = false
-        }
-    }
-    return nil
-}
-
-func (m *mockRepo) GetOpenPRsWithReviewersByUserIDs(ctx context.Context, userIDs []string) ([]repo.PR, error) {
-    var result []repo.PR
-    for prID, pr := range m.prs {
-        if pr.Status != "OPEN" {
-            continue
-        }
-        for _, reviewerID := range m.prReviewers[prID] {
-            for _, targetID := range userIDs {
-                if reviewerID == targetID {
-                    result = append(result, *pr)
-                    break
-                }
-            }
-        }
-    }
-    return result, nil
-}
-
-// Тесты
-
 func TestCreateTeam(t *testing.T) {
-    mockRepo := newMockRepo()
+    mockRepo := memory.New()
     service := New(mockRepo)
     ctx := context.Background()
 
@@ -296,7 +40,7 @@ func TestCreateTeam(t *testing.T) {
 }
 
 func TestCreatePR(t *testing.T) {
-    mockRepo := newMockRepo()
+    mockRepo := memory.New()
     service := New(mockRepo)
     ctx := context.Background()
 
@@ -340,8 +84,48 @@ func TestCreatePR(t *testing.T) {
     }
 }
 
+func TestReviewerStrategy(t *testing.T) {
+    service := New(memory.New())
+    ctx := context.Background()
+    service.CreateTeam(ctx, "dev-team", []repo.TeamMember{
+        {UserID: "author1", Username: "Author", IsActive: true},
+        {UserID: "r1", Username: "R1", IsActive: true},
+        {UserID: "r2", Username: "R2", IsActive: true},
+        {UserID: "r3", Username: "R3", IsActive: true},
+    })
+
+    // Один ревьювер на PR, каждый раз наименее загруженный: нагрузка распределяется поровну
+    service.ReviewerCount = 1
+    service.Strategy = StrategyLeastLoaded
+    load := map[string]int{}
+    for i := 0; i < 6; i++ {
+        pr, err := service.CreatePR(ctx, "pr-"+string(rune('a'+i)), "Test PR", "author1")
+        if err != nil || len(pr.Reviewers) != 1 {
+            t.Fatalf("expected one reviewer, got %+v, %v", pr, err)
+        }
+        load[pr.Reviewers[0].ID]++
+    }
+    if load["r1"] != 2 || load["r2"] != 2 || load["r3"] != 2 {
+        t.Errorf("expected two reviews each, got %v", load)
+    }
+
+    // Мерженные PR не считаются нагрузкой
+    prs, _ := service.Repo.GetPRsByReviewer(ctx, "r1")
+    for _, pr := range prs {
+        service.MergePR(ctx, pr.ID)
+    }
+    if pr, _ := service.CreatePR(ctx, "pr-next", "Test PR", "author1"); pr.Reviewers[0].ID != "r1" {
+        t.Errorf("expected r1 with no open reviews, got %s", pr.Reviewers[0].ID)
+    }
+
+    service.ReviewerCount = 3
+    if pr, _ := service.CreatePR(ctx, "pr-all", "Test PR", "author1"); len(pr.Reviewers) != 3 {
+        t.Errorf("expected three reviewers, got %d", len(pr.Reviewers))
+    }
+}
+
 func TestMergePR(t *testing.T) {
-    mockRepo := newMockRepo()
+    mockRepo := memory.New()
     service := New(mockRepo)
     ctx := context.Background()
 
@@ -374,7 +158,7 @@ func TestMergePR(t *testing.T) {
 }
 
 func TestReassignReviewer(t *testing.T) {
-    mockRepo := newMockRepo()
+    mockRepo := memory.New()
     service := New(mockRepo)
     ctx := context.Background()
 
@@ -430,7 +214,7 @@ func TestReassignReviewer(t *testing.T) {
 }
 
 func TestBulkDeactivateTeam(t *testing.T) {
-    mockRepo := newMockRepo()
+    mockRepo := memory.New()
     service := New(mockRepo)
     ctx := context.Background()
 
@@ -460,7 +244,7 @@ func TestBulkDeactivateTeam(t *testing.T) {
 }
 
 func TestSetUserActive(t *testing.T) {
-    mockRepo := newMockRepo()
+    mockRepo := memory.New()
     service := New(mockRepo)
     ctx := context.Background()
 
@@ -484,4 +268,815 @@ func TestSetUserActive(t *testing.T) {
     if user.Name != "TestUser" {
         t.Errorf("Expected username 'TestUser', got '%s'", user.Name)
     }
-}
\ No newline at end of file
+}
+
+func TestSyncTeams(t *testing.T) {
+    mockRepo := memory.New()
+    service := New(mockRepo)
+    ctx := context.Background()
+
+    service.CreateTeam(ctx, "old-backend", []repo.TeamMember{
+        {UserID: "u1", Username: "Alice", IsActive: true},
+        {UserID: "u2", Username: "Bob", IsActive: true},
+    })
+
+    manifest, err := ParseTeamManifest(strings.NewReader(`
+teams:
+  - team_name: backend
+    renamed_from: [old-backend]
+    members:
+      - {user_id: u1, username: Alice Smith, is_active: true}
+      - {user_id: u3, username: Carol, is_active: false}
+  - team_name: frontend
+    members:
+      - {user_id: u4, username: Dave, is_active: true}
+`))
+    if err != nil {
+        t.Fatalf("ParseTeamManifest failed: %v", err)
+    }
+
+    // Dry run ничего не меняет
+    plan, err := service.SyncTeams(ctx, manifest, true)
+    if err != nil {
+        t.Fatalf("SyncTeams dry run failed: %v", err)
+    }
+    if !plan.DryRun {
+        t.Error("Expected dry_run flag in plan")
+    }
+    if len(plan.TeamsRenamed) != 1 || plan.TeamsRenamed[0].To != "backend" {
+        t.Errorf("Expected rename to backend, got %+v", plan.TeamsRenamed)
+    }
+    if len(plan.TeamsCreated) != 1 || plan.TeamsCreated[0] != "frontend" {
+        t.Errorf("Expected frontend to be created, got %+v", plan.TeamsCreated)
+    }
+    if len(plan.MembersRemoved) != 1 || plan.MembersRemoved[0].UserID != "u2" {
+        t.Errorf("Expected u2 to be removed, got %+v", plan.MembersRemoved)
+    }
+    if len(plan.MembersAdded) != 2 {
+        t.Errorf("Expected 2 added members, got %+v", plan.MembersAdded)
+    }
+    if len(plan.UsersRenamed) != 1 || plan.UsersRenamed[0].To != "Alice Smith" {
+        t.Errorf("Expected u1 rename, got %+v", plan.UsersRenamed)
+    }
+    if exists, _ := mockRepo.TeamExists(ctx, "backend"); exists {
+        t.Fatal("Dry run should not apply changes")
+    }
+
+    // Применение
+    if _, err := service.SyncTeams(ctx, manifest, false); err != nil {
+        t.Fatalf("SyncTeams failed: %v", err)
+    }
+
+    _, members, err := service.GetTeam(ctx, "backend")
+    if err != nil {
+        t.Fatalf("GetTeam failed: %v", err)
+    }
+    if len(members) != 2 {
+        t.Errorf("Expected 2 members in backend, got %d", len(members))
+    }
+    u3, _ := mockRepo.GetUserByID(ctx, "u3")
+    if u3 == nil || u3.IsActive {
+        t.Error("u3 should be created inactive")
+    }
+
+    // Повторная синхронизация ничего не меняет
+    plan, err = service.SyncTeams(ctx, manifest, true)
+    if err != nil {
+        t.Fatalf("SyncTeams failed: %v", err)
+    }
+    if !plan.Empty() {
+        t.Errorf("Expected empty plan after sync, got %+v", plan)
+    }
+}
+
+func TestSyncTeamsInvalidManifest(t *testing.T) {
+    service := New(memory.New())
+
+    manifest := &TeamManifest{Teams: []ManifestTeam{
+        {TeamName: "a", Members: []repo.TeamMember{{UserID: "u1"}, {UserID: "u1"}}},
+    }}
+    if _, err := service.SyncTeams(context.Background(), manifest, true); !errors.Is(err, ErrInvalidManifest) {
+        t.Errorf("Expected ErrInvalidManifest, got %v", err)
+    }
+
+    // Прежнее имя может принадлежать только одной команде манифеста
+    manifest = &TeamManifest{Teams: []ManifestTeam{
+        {TeamName: "backend", RenamedFrom: []string{"old", "backend"}},
+        {TeamName: "platform", RenamedFrom: []string{"old", "frontend"}},
+        {TeamName: "frontend"},
+    }}
+    err := validateManifest(manifest)
+    var se *Error
+    if !errors.As(err, &se) {
+        t.Fatalf("Expected ErrInvalidManifest, got %v", err)
+    }
+    var fields []string
+    for _, f := range se.Fields {
+        fields = append(fields, f.Field+" "+f.Message)
+    }
+    want := "teams[0].renamed_from[1] must not be the team's own name," +
+        "teams[1].renamed_from[0] is also claimed by teams[0].renamed_from[0]," +
+        "teams[1].renamed_from[1] is the name of teams[2]"
+    if strings.Join(fields, ",") != want {
+        t.Errorf("unexpected field errors %v", fields)
+    }
+}
+
+// TestConditionalTeamChanges: изменения состава через SCIM и sync принимают ожидаемую версию команды
+func TestConditionalTeamChanges(t *testing.T) {
+    svc := New(memory.New())
+    ctx := context.Background()
+    for _, id := range []string{"u1", "u2", "u3"} {
+        if _, err := svc.ProvisionUser(ctx, id, id, true); err != nil {
+            t.Fatal(err)
+        }
+    }
+    if err := svc.CreateTeam(ctx, "backend", nil); err != nil {
+        t.Fatal(err)
+    }
+    team, _, err := svc.GetTeam(ctx, "backend")
+    if err != nil {
+        t.Fatal(err)
+    }
+    stale := team.Version
+
+    if err := svc.AddTeamMembers(WithExpectedVersion(ctx, stale), team.ID, []string{"u1"}); err != nil {
+        t.Fatalf("expected the change with the current version to apply, got %v", err)
+    }
+    if err := svc.AddTeamMembers(WithExpectedVersion(ctx, stale), team.ID, []string{"u2"}); !errors.Is(err, ErrPreconditionFailed) {
+        t.Errorf("expected PRECONDITION_FAILED for a stale version, got %v", err)
+    }
+
+    // Изменения одного PATCH применяются вместе: ошибка во втором не оставляет следов первого
+    team, _, _ = svc.GetTeam(ctx, "backend")
+    err = svc.PatchTeam(ctx, team.ID,
+        TeamChange{Op: TeamChangeAdd, UserIDs: []string{"u2"}},
+        TeamChange{Op: TeamChangeAdd, UserIDs: []string{"missing"}})
+    if !errors.Is(err, ErrNotFound) {
+        t.Fatalf("expected NOT_FOUND for an unknown member, got %v", err)
+    }
+    if _, members, _ := svc.GetTeam(ctx, "backend"); len(members) != 1 {
+        t.Errorf("expected the failed patch to be rolled back, got %+v", members)
+    }
+    if err := svc.PatchTeam(WithExpectedVersion(ctx, team.Version), team.ID,
+        TeamChange{Op: TeamChangeRename, Name: "platform"},
+        TeamChange{Op: TeamChangeSet, UserIDs: []string{"u2", "u3"}}); err != nil {
+        t.Fatalf("expected a rename and a member change under one version, got %v", err)
+    }
+    if err := svc.DeleteTeam(WithExpectedVersion(ctx, team.Version), team.ID); !errors.Is(err, ErrPreconditionFailed) {
+        t.Errorf("expected PRECONDITION_FAILED for deleting a changed team, got %v", err)
+    }
+
+    team, _, _ = svc.GetTeam(ctx, "platform")
+    manifest := func(version int64) *TeamManifest {
+        return &TeamManifest{Teams: []ManifestTeam{{TeamName: "platform", Version: version, Members: []repo.TeamMember{
+            {UserID: "u3", Username: "u3", IsActive: true},
+        }}}}
+    }
+    if _, err := svc.SyncTeams(ctx, manifest(team.Version+1), false); !errors.Is(err, ErrPreconditionFailed) {
+        t.Errorf("expected PRECONDITION_FAILED for a stale manifest, got %v", err)
+    }
+    if _, members, _ := svc.GetTeam(ctx, "platform"); len(members) != 2 {
+        t.Errorf("expected the stale manifest not to be applied, got %+v", members)
+    }
+    if _, err := svc.SyncTeams(ctx, manifest(team.Version), false); err != nil {
+        t.Errorf("expected the manifest with the current version to apply, got %v", err)
+    }
+}
+
+func TestDeprovisionUserReassignsReviews(t *testing.T) {
+    mockRepo := memory.New()
+    service := New(mockRepo)
+    ctx := context.Background()
+
+    service.CreateTeam(ctx, "dev-team", []repo.TeamMember{
+        {UserID: "author1", Username: "Author", IsActive: true},
+        {UserID: "reviewer1", Username: "Reviewer1", IsActive: true},
+        {UserID: "reviewer2", Username: "Reviewer2", IsActive: true},
+        {UserID: "reviewer3", Username: "Reviewer3", IsActive: true},
+    })
+    pr, _ := service.CreatePR(ctx, "pr-1", "Test PR", "author1")
+    leaving := pr.Reviewers[0].ID
+
+    reassigned, err := service.DeprovisionUser(ctx, leaving)
+    if err != nil {
+        t.Fatalf("DeprovisionUser failed: %v", err)
+    }
+    if len(reassigned) != 1 || reassigned[0].NewUserID == "" {
+        t.Fatalf("Expected one reassignment with replacement, got %+v", reassigned)
+    }
+
+    reviewers, _ := mockRepo.GetPRReviewers(ctx, "pr-1")
+    for _, reviewer := range reviewers {
+        if reviewer.ID == leaving {
+            t.Error("Deprovisioned user should be removed from open PR")
+        }
+        if reviewer.ID == "author1" {
+            t.Error("Author should not become a reviewer")
+        }
+    }
+    if len(reviewers) != 2 {
+        t.Errorf("Expected 2 reviewers after reassignment, got %d", len(reviewers))
+    }
+
+    user, _ := service.GetUser(ctx, leaving)
+    if user.IsActive {
+        t.Error("Deprovisioned user should be inactive")
+    }
+    if teams, _ := mockRepo.GetUserTeams(ctx, leaving); len(teams) != 0 {
+        t.Error("Deprovisioned user should be removed from teams")
+    }
+}
+
+func TestBulkDeactivateTeamReassign(t *testing.T) {
+    mockRepo := memory.New()
+    service := New(mockRepo)
+    ctx := context.Background()
+
+    service.CreateTeam(ctx, "backend", []repo.TeamMember{
+        {UserID: "author1", Username: "Author", IsActive: true},
+    })
+    service.CreateTeam(ctx, "qa", []repo.TeamMember{
+        {UserID: "qa1", Username: "QA1", IsActive: true},
+    })
+    service.CreatePR(ctx, "pr-1", "Test PR", "author1")
+    mockRepo.AddReviewer(ctx, "pr-1", "qa1")
+
+    if err := service.BulkDeactivateTeam(ctx, "qa", true); err != nil {
+        t.Fatalf("BulkDeactivateTeam failed: %v", err)
+    }
+
+    // Замены в команде нет - ревьювер просто снимается
+    reviewers, _ := mockRepo.GetPRReviewers(ctx, "pr-1")
+    if len(reviewers) != 0 {
+        t.Errorf("Expected deactivated reviewer to be removed, got %+v", reviewers)
+    }
+}
+
+func TestCreateAPIToken(t *testing.T) {
+    mockRepo := memory.New()
+    service := New(mockRepo)
+    ctx := context.Background()
+
+    if _, _, err := service.CreateAPIToken(ctx, "ci", []string{"root"}, ""); !errors.Is(err, ErrInvalidTokenRequest) {
+        t.Errorf("Expected ErrInvalidTokenRequest for unknown scope, got %v", err)
+    }
+
+    token, secret, err := service.CreateAPIToken(ctx, "ci", []string{auth.ScopeWritePRs}, "")
+    if err != nil {
+        t.Fatalf("CreateAPIToken failed: %v", err)
+    }
+    if token.TokenHash == secret || token.TokenHash != auth.HashToken(secret) {
+        t.Error("Only the hash of the secret should be stored")
+    }
+
+    authn := auth.NewTokenAuthenticator(mockRepo, "")
+    p, err := authn.Authenticate(ctx, secret)
+    if err != nil {
+        t.Fatalf("Authenticate failed: %v", err)
+    }
+    if !p.HasScope(auth.ScopeWritePRs) || p.HasScope(auth.ScopeAdminTeams) {
+        t.Errorf("Unexpected scopes %v", p.Scopes)
+    }
+
+    service.RevokeAPIToken(ctx, token.ID)
+    if _, err := authn.Authenticate(ctx, secret); !errors.Is(err, auth.ErrUnauthorized) {
+        t.Errorf("Revoked token should be rejected, got %v", err)
+    }
+
+    // Повторный отзыв - NOT_FOUND и не пишется в журнал
+    if err := service.RevokeAPIToken(ctx, token.ID); !errors.Is(err, ErrNotFound) {
+        t.Errorf("Expected ErrNotFound for a revoked token, got %v", err)
+    }
+    revokes, _ := service.ListAudit(ctx, repo.AuditFilter{TargetType: "api_token", TargetID: strconv.FormatInt(token.ID, 10)})
+    if len(revokes) != 2 || revokes[0].Action != AuditTokenRevoke {
+        t.Errorf("Expected one create and one revoke entry, got %+v", revokes)
+    }
+}
+
+func TestRoleBasedAccess(t *testing.T) {
+    mockRepo := memory.New()
+    service := New(mockRepo)
+    ctx := context.Background()
+
+    service.CreateTeam(ctx, "backend", []repo.TeamMember{
+        {UserID: "lead1", Username: "Lead", IsActive: true, IsLead: true},
+        {UserID: "dev1", Username: "Dev1", IsActive: true},
+        {UserID: "dev2", Username: "Dev2", IsActive: true},
+    })
+    service.CreateTeam(ctx, "frontend", []repo.TeamMember{
+        {UserID: "fe1", Username: "FE1", IsActive: true},
+    })
+
+    as := func(userID string, scopes ...string) context.Context {
+        return auth.WithPrincipal(ctx, &auth.Principal{Subject: userID, UserID: userID, Scopes: scopes})
+    }
+
+    // Участник меняет активность только себе
+    if _, err := service.SetUserActive(as("dev1", auth.ScopeWritePRs), "dev1", false); err != nil {
+        t.Errorf("Member should change own activity, got %v", err)
+    }
+    if _, err := service.SetUserActive(as("dev1", auth.ScopeWritePRs), "dev2", false); err != ErrForbidden {
+        t.Errorf("Member should not change others' activity, got %v", err)
+    }
+
+    // Лид управляет только своей командой
+    if _, err := service.SetUserActive(as("lead1", auth.ScopeWritePRs), "dev2", true); err != nil {
+        t.Errorf("Lead should change activity in own team, got %v", err)
+    }
+    if _, err := service.SetUserActive(as("lead1", auth.ScopeWritePRs), "fe1", false); err != ErrForbidden {
+        t.Errorf("Lead should not change activity in other team, got %v", err)
+    }
+    if err := service.BulkDeactivateTeam(as("lead1", auth.ScopeWritePRs), "frontend", false); err != ErrForbidden {
+        t.Errorf("Lead should not deactivate other team, got %v", err)
+    }
+    if err := service.BulkDeactivateTeam(as("dev1", auth.ScopeWritePRs), "backend", false); err != ErrForbidden {
+        t.Errorf("Member should not deactivate team, got %v", err)
+    }
+
+    // Токен только на чтение ничего не меняет, даже у лида
+    if _, err := service.SetUserActive(as("dev1", auth.ScopeRead), "dev1", false); err != ErrForbidden {
+        t.Errorf("Read-only token should not change own activity, got %v", err)
+    }
+    if _, err := service.SetUserActive(as("lead1", auth.ScopeRead), "dev2", false); err != ErrForbidden {
+        t.Errorf("Read-only lead token should not change activity, got %v", err)
+    }
+    if err := service.BulkDeactivateTeam(as("lead1", auth.ScopeRead), "backend", false); err != ErrForbidden {
+        t.Errorf("Read-only lead token should not deactivate the team, got %v", err)
+    }
+    if _, _, err := service.ReassignReviewer(as("lead1", auth.ScopeRead), "pr-unknown", "dev1"); err != ErrForbidden {
+        t.Errorf("Read-only lead token should not reassign, got %v", err)
+    }
+
+    // Отказ не выдает, существует ли ресурс
+    if err := service.BulkDeactivateTeam(as("lead1", auth.ScopeWritePRs), "missing", false); err != ErrForbidden {
+        t.Errorf("Expected 403 rather than 404 for an unknown team, got %v", err)
+    }
+    if _, err := service.SetUserActive(as("lead1", auth.ScopeWritePRs), "missing", false); err != ErrForbidden {
+        t.Errorf("Expected 403 rather than 404 for an unknown user, got %v", err)
+    }
+
+    // Администратор может все
+    if err := service.BulkDeactivateTeam(as("admin", auth.ScopeAdmin), "frontend", false); err != nil {
+        t.Errorf("Admin should deactivate any team, got %v", err)
+    }
+}
+
+func TestReassignRequiresRole(t *testing.T) {
+    mockRepo := memory.New()
+    service := New(mockRepo)
+    ctx := context.Background()
+
+    service.CreateTeam(ctx, "backend", []repo.TeamMember{
+        {UserID: "author1", Username: "Author", IsActive: true},
+        {UserID: "dev1", Username: "Dev1", IsActive: true},
+        {UserID: "dev2", Username: "Dev2", IsActive: true},
+        {UserID: "dev3", Username: "Dev3", IsActive: true},
+    })
+    service.CreatePR(ctx, "pr-1", "Test PR", "author1")
+    reviewers, _ := mockRepo.GetPRReviewers(ctx, "pr-1")
+    reviewer := reviewers[0].ID
+
+    other := auth.WithPrincipal(ctx, &auth.Principal{UserID: "author1", Scopes: []string{auth.ScopeWritePRs}})
+    if _, _, err := service.ReassignReviewer(other, "pr-1", reviewer); err != ErrForbidden {
+        t.Errorf("Member should not reassign someone else, got %v", err)
+    }
+
+    self := auth.WithPrincipal(ctx, &auth.Principal{UserID: reviewer, Scopes: []string{auth.ScopeWritePRs}})
+    if _, _, err := service.ReassignReviewer(self, "pr-1", reviewer); err != nil {
+        t.Errorf("Member should reassign themselves, got %v", err)
+    }
+}
+
+func TestAuditLog(t *testing.T) {
+    mockRepo := memory.New()
+    service := New(mockRepo)
+    ctx := context.Background()
+
+    service.CreateTeam(ctx, "backend", []repo.TeamMember{
+        {UserID: "author1", Username: "Author", IsActive: true},
+        {UserID: "dev1", Username: "Dev1", IsActive: true},
+        {UserID: "dev2", Username: "Dev2", IsActive: true},
+    })
+
+    admin := auth.WithPrincipal(ctx, &auth.Principal{Subject: "ops", Scopes: []string{auth.ScopeAdmin}, Credential: "token:7"})
+    admin = reqmeta.With(admin, reqmeta.Meta{RequestID: "req-1", SourceIP: "10.0.0.1"})
+
+    service.CreatePR(admin, "pr-1", "Test PR", "author1")
+    service.MergePR(admin, "pr-1")
+    service.SetUserActive(admin, "dev1", false)
+
+    // Повторный merge идемпотентен и не пишется в журнал
+    service.MergePR(admin, "pr-1")
+
+    entries, err := service.ListAudit(ctx, repo.AuditFilter{Actor: "token:7"})
+    if err != nil {
+        t.Fatalf("Unexpected error: %v", err)
+    }
+    var actions []string
+    for _, e := range entries {
+        actions = append(actions, e.Action)
+    }
+    want := []string{AuditUserSetActive, AuditPRMerge, AuditPRCreate}
+    if strings.Join(actions, ",") != strings.Join(want, ",") {
+        t.Fatalf("Expected actions %v, got %v", want, actions)
+    }
+
+    setActive := entries[0]
+    if setActive.RequestID != "req-1" || setActive.SourceIP != "10.0.0.1" {
+        t.Errorf("Expected request metadata, got %q %q", setActive.RequestID, setActive.SourceIP)
+    }
+    if !strings.Contains(string(setActive.Before), `"is_active":true`) || !strings.Contains(string(setActive.After), `"is_active":false`) {
+        t.Errorf("Unexpected snapshots: before=%s after=%s", setActive.Before, setActive.After)
+    }
+
+    // Внутренние вызовы записываются от имени system
+    system, _ := service.ListAudit(ctx, repo.AuditFilter{Actor: "system", TargetType: "team", TargetID: "backend"})
+    if len(system) != 1 || system[0].Action != AuditTeamAdd {
+        t.Errorf("Expected team.add by system, got %+v", system)
+    }
+
+    // Сервисный токен с именем пользователя не выдает себя за этого пользователя
+    named := auth.WithPrincipal(ctx, &auth.Principal{Subject: "dev2", Scopes: []string{auth.ScopeAdmin}, Credential: "token:8"})
+    user := auth.WithPrincipal(ctx, &auth.Principal{Subject: "dev2", UserID: "dev2", Scopes: []string{auth.ScopeAdmin}, Credential: "token:9"})
+    service.SetUserActive(named, "dev1", true)
+    service.SetUserActive(user, "dev1", false)
+    if byToken, _ := service.ListAudit(ctx, repo.AuditFilter{Actor: "token:8"}); len(byToken) != 1 {
+        t.Errorf("Expected one entry by the named token, got %+v", byToken)
+    }
+    if byUser, _ := service.ListAudit(ctx, repo.AuditFilter{Actor: "user:dev2"}); len(byUser) != 1 {
+        t.Errorf("Expected one entry by the user, got %+v", byUser)
+    }
+}
+
+func TestEventHistory(t *testing.T) {
+    mockRepo := memory.New()
+    service := New(mockRepo)
+    ctx := context.Background()
+
+    service.CreateTeam(ctx, "backend", []repo.TeamMember{
+        {UserID: "author1", Username: "Author", IsActive: true},
+        {UserID: "dev1", Username: "Dev1", IsActive: true},
+    })
+
+    live, unsubscribe := service.Events.Subscribe()
+    defer unsubscribe()
+
+    service.CreatePR(ctx, "pr-1", "Test PR", "author1")
+    service.MergePR(ctx, "pr-1")
+
+    history, err := service.ListEvents(ctx, EventFilter{})
+    if err != nil {
+        t.Fatalf("Unexpected error: %v", err)
+    }
+    var types []string
+    for _, e := range history {
+        types = append(types, e.Type)
+        if e.TeamName != "backend" || e.AuthorID != "author1" {
+            t.Errorf("Unexpected event %+v", e)
+        }
+        // Подписчик получает те же события с теми же ID
+        if got := <-live; got.ID != e.ID || got.Type != e.Type {
+            t.Errorf("Expected published event %d %s, got %d %s", e.ID, e.Type, got.ID, got.Type)
+        }
+    }
+    want := []string{"pr.created", "reviewer.assigned", "pr.merged"}
+    if strings.Join(types, ",") != strings.Join(want, ",") {
+        t.Fatalf("Expected events %v, got %v", want, types)
+    }
+    if last := service.Events.LastID(); last != history[len(history)-1].ID {
+        t.Errorf("Expected the broker to remember the last published id %d, got %d", history[len(history)-1].ID, last)
+    }
+
+    // Догон после последнего полученного события
+    rest, _ := service.ListEvents(ctx, EventFilter{AfterID: history[0].ID, UserID: "dev1"})
+    if len(rest) != 1 || rest[0].ReviewerID != "dev1" {
+        t.Errorf("Expected only dev1 assignment after first event, got %+v", rest)
+    }
+}
+
+func TestSnapshotExportImport(t *testing.T) {
+    source := New(memory.New())
+    ctx := context.Background()
+
+    source.CreateTeam(ctx, "backend", []repo.TeamMember{
+        {UserID: "author1", Username: "Author", IsActive: true, IsLead: true},
+        {UserID: "dev1", Username: "Dev1", IsActive: true},
+        {UserID: "dev2", Username: "Dev2", IsActive: false},
+    })
+    source.CreatePR(ctx, "pr-1", "Test PR", "author1")
+    source.CreatePR(ctx, "pr-2", "Other PR", "author1")
+    source.MergePR(ctx, "pr-2")
+
+    snap, err := source.ExportSnapshot(ctx)
+    if err != nil {
+        t.Fatalf("ExportSnapshot failed: %v", err)
+    }
+    var buf bytes.Buffer
+    if err := WriteSnapshot(&buf, snap); err != nil {
+        t.Fatalf("WriteSnapshot failed: %v", err)
+    }
+    data := buf.String()
+    if !strings.HasPrefix(data, `{"kind":"header","header":{"version":1,`) {
+        t.Fatalf("Expected header first, got %q", strings.SplitN(data, "\n", 2)[0])
+    }
+
+    // Чужие данные целевой базы удаляются в режиме replace
+    targetRepo := memory.New()
+    target := New(targetRepo)
+    target.CreateTeam(ctx, "legacy", []repo.TeamMember{{UserID: "old", Username: "Old", IsActive: true}})
+    target.CreateTeam(ctx, "backend", []repo.TeamMember{{UserID: "author1", Username: "Author", IsActive: true}})
+    target.CreatePR(ctx, "pr-1", "Stale PR", "author1")
+    targetRepo.ShiftVersions(ctx, 10) // долго живущая база: версии выше, чем у свежего снимка
+    stale, _ := targetRepo.GetPRByID(ctx, "pr-1")
+
+    parsed, err := ReadSnapshot(strings.NewReader(data))
+    if err != nil {
+        t.Fatalf("ReadSnapshot failed: %v", err)
+    }
+    result, err := target.ImportSnapshot(ctx, parsed, ImportReplace)
+    if err != nil {
+        t.Fatalf("ImportSnapshot failed: %v", err)
+    }
+    if result.Counts[RecordUser] != 3 || result.Counts[RecordAssignment] != 2 {
+        t.Errorf("Unexpected import counts %v", result.Counts)
+    }
+    if _, err := targetRepo.GetUserByID(ctx, "old"); err != sql.ErrNoRows {
+        t.Error("Expected replace to drop users that are not in the snapshot")
+    }
+    if exists, _ := targetRepo.TeamExists(ctx, "legacy"); exists {
+        t.Error("Expected replace to drop teams that are not in the snapshot")
+    }
+    if dev2, _ := targetRepo.GetUserByID(ctx, "dev2"); dev2 == nil || dev2.IsActive {
+        t.Error("Expected dev2 to stay inactive")
+    }
+    members, _ := targetRepo.GetTeamMembers(ctx, "backend")
+    if len(members) != 3 || !members[0].IsLead || members[0].ID != "author1" {
+        t.Errorf("Expected author1 to stay team lead, got %+v", members)
+    }
+    if pr, _ := targetRepo.GetPRByID(ctx, "pr-2"); pr == nil || pr.Status != "MERGED" {
+        t.Errorf("Expected merged pr-2, got %+v", pr)
+    }
+    if reviewers, _ := targetRepo.GetPRReviewers(ctx, "pr-1"); len(reviewers) != 1 || reviewers[0].ID != "dev1" {
+        t.Errorf("Expected dev1 to review pr-1, got %v", reviewers)
+    }
+    // ETag, выданный до replace, не подходит к восстановленному PR: версии только растут
+    if pr, _ := targetRepo.GetPRByID(ctx, "pr-1"); pr == nil || pr.Version <= stale.Version {
+        t.Errorf("Expected restored pr-1 above version %d, got %+v", stale.Version, pr)
+    }
+    if _, err := target.MergePR(WithExpectedVersion(ctx, stale.Version), "pr-1"); !errors.Is(err, ErrPreconditionFailed) {
+        t.Errorf("Expected the pre-import version to fail with ErrPreconditionFailed, got %v", err)
+    }
+
+    // Повторный merge того же снимка не удваивает историю назначений
+    if _, err := target.ImportSnapshot(ctx, parsed, ImportMerge); err != nil {
+        t.Fatalf("ImportSnapshot merge failed: %v", err)
+    }
+    stats, _ := target.GetStats(ctx)
+    if stats.AssignmentStats["dev1"] != 2 {
+        t.Errorf("Expected 2 assignments for dev1 after repeated import, got %v", stats.AssignmentStats)
+    }
+
+    entries, _ := target.ListAudit(ctx, repo.AuditFilter{TargetType: "state"})
+    if len(entries) != 2 || entries[0].Action != AuditStateImport || entries[0].TargetID != ImportMerge {
+        t.Errorf("Expected two state.import audit entries, got %+v", entries)
+    }
+}
+
+func TestReadSnapshotRejectsInvalid(t *testing.T) {
+    header := func(counts string) string {
+        return `{"kind":"header","header":{"version":1,"exported_at":"2025-01-01T00:00:00Z","counts":{` + counts + `}}}` + "\n"
+    }
+    user := `{"kind":"user","user":{"user_id":"u1","username":"Alice","is_active":true}}` + "\n"
+    full := `"user":1,"team":0,"membership":0,"pr":0,"reviewer":0,"assignment":0`
+
+    cases := map[string]string{
+        "empty":            "",
+        "no header":        user,
+        "future version":   `{"kind":"header","header":{"version":2,"counts":{}}}` + "\n",
+        "truncated":        header(`"user":2,"team":0,"membership":0,"pr":0,"reviewer":0,"assignment":0`) + user,
+        "unknown kind":     header(full) + user + `{"kind":"token"}` + "\n",
+        "malformed record": header(full) + user + `{"kind":"team"}` + "\n",
+        "not json":         header(full) + "{",
+        "dangling membership": header(`"user":1,"team":0,"membership":1,"pr":0,"reviewer":0,"assignment":0`) + user +
+            `{"kind":"membership","membership":{"team_name":"backend","user_id":"u1","is_lead":false}}` + "\n",
+        "unknown author": header(`"user":1,"team":0,"membership":0,"pr":1,"reviewer":0,"assignment":0`) + user +
+            `{"kind":"pr","pr":{"pull_request_id":"pr-1","pull_request_name":"X","author_id":"u9","status":"OPEN"}}` + "\n",
+    }
+    for name, data := range cases {
+        if _, err := ReadSnapshot(strings.NewReader(data)); !errors.Is(err, ErrInvalidSnapshot) {
+            t.Errorf("%s: expected ErrInvalidSnapshot, got %v", name, err)
+        }
+    }
+
+    if _, err := ReadSnapshot(strings.NewReader(header(full) + user)); err != nil {
+        t.Errorf("Expected valid snapshot, got %v", err)
+    }
+}
+
+// brokenRepo имитирует сбой базы при чтении команд и пользователей
+type brokenRepo struct {
+    repo.RepoInterface
+    err error
+}
+
+func (r brokenRepo) GetTeamByName(ctx context.Context, name string) (*repo.Team, error) {
+    return nil, r.err
+}
+
+func (r brokenRepo) GetUserByID(ctx context.Context, id string) (*repo.User, error) {
+    return nil, r.err
+}
+
+// Отсутствие строки - NOT_FOUND с причиной sql.ErrNoRows, а сбой базы не выдается за "не найдено"
+func TestErrorsDistinguishNotFoundFromFailure(t *testing.T) {
+    ctx := context.Background()
+    store := memory.New()
+    service := New(store)
+
+    _, _, err := service.GetTeam(ctx, "missing")
+    var se *Error
+    if !errors.As(err, &se) || se.Kind != KindNotFound || !errors.Is(err, ErrNotFound) || !errors.Is(err, sql.ErrNoRows) {
+        t.Fatalf("expected NOT_FOUND wrapping sql.ErrNoRows, got %#v", err)
+    }
+
+    // Автор вне команды - 422 NO_TEAM, а не 500 с сырым текстом
+    store.CreateUser(ctx, "loner", "Loner")
+    if _, err := service.CreatePR(ctx, "pr-1", "Lonely PR", "loner"); !errors.Is(err, ErrNoTeam) || !errors.As(err, &se) || se.Kind != KindUnprocessable {
+        t.Errorf("expected NO_TEAM, got %v", err)
+    }
+
+    failure := errors.New("connection reset by peer")
+    broken := New(brokenRepo{RepoInterface: store, err: failure})
+    if _, _, err := broken.GetTeam(ctx, "backend"); errors.Is(err, ErrNotFound) || !errors.Is(err, failure) {
+        t.Errorf("expected the database failure, got %v", err)
+    }
+    if _, err := broken.ProvisionUser(ctx, "u1", "Alice", true); errors.Is(err, ErrUserExists) || !errors.Is(err, failure) {
+        t.Errorf("expected the database failure instead of a duplicate or a new user, got %v", err)
+    }
+}
+
+// Валидация сообщает обо всех ошибках сразу, каждая указывает на свое поле
+func TestFieldErrors(t *testing.T) {
+    manifest := &TeamManifest{Teams: []ManifestTeam{
+        {TeamName: "backend", Members: []repo.TeamMember{{UserID: "u1", Username: "Alice"}, {UserID: "", Username: "Bob"}}},
+        {TeamName: "backend", Members: []repo.TeamMember{{UserID: "u 2", Username: "Carol"}}},
+    }}
+    err := validateManifest(manifest)
+    var se *Error
+    if !errors.As(err, &se) || se.Code != CodeInvalidManifest {
+        t.Fatalf("expected INVALID_MANIFEST, got %#v", err)
+    }
+    var fields []string
+    for _, f := range se.Fields {
+        fields = append(fields, f.Field)
+    }
+    if strings.Join(fields, ",") != "teams[0].members[1].user_id,teams[1].team_name,teams[1].members[0].user_id" {
+        t.Errorf("unexpected fields %v", fields)
+    }
+    if !strings.HasPrefix(err.Error(), "invalid team manifest: teams[0].members[1].user_id is required; ") {
+        t.Errorf("unexpected message %q", err.Error())
+    }
+    if ErrInvalidManifest.Fields != nil {
+        t.Error("the sentinel must not collect fields")
+    }
+
+    // POST /team/add с пустым именем раньше создавал команду
+    service := New(memory.New())
+    err = service.CreateTeam(context.Background(), "", []repo.TeamMember{{UserID: "u1", Username: "Alice"}, {UserID: "u1", Username: "Alice"}})
+    if !errors.As(err, &se) || len(se.Fields) != 2 || se.Fields[0].Field != "team_name" || se.Fields[1].Field != "members[1].user_id" {
+        t.Errorf("expected team_name and duplicate member errors, got %v", err)
+    }
+}
+
+// TestLegacyIDs: записи, созданные до правил формата id, остаются доступными для изменений
+func TestLegacyIDs(t *testing.T) {
+    store := memory.New()
+    svc := New(store)
+    ctx := context.Background()
+
+    teamID, err := store.CreateTeam(ctx, "backend")
+    if err != nil {
+        t.Fatal(err)
+    }
+    for _, id := range []string{"org/author#1", "org/dev#2", "org/dev#3"} {
+        if err := store.CreateUser(ctx, id, id); err != nil {
+            t.Fatal(err)
+        }
+        if err := store.AddMember(ctx, teamID, id); err != nil {
+            t.Fatal(err)
+        }
+    }
+    if err := store.CreatePRWithID(ctx, "org/repo#12", "Legacy", "org/author#1"); err != nil {
+        t.Fatal(err)
+    }
+    if err := store.AddReviewer(ctx, "org/repo#12", "org/dev#2"); err != nil {
+        t.Fatal(err)
+    }
+
+    if _, _, err := svc.ReassignReviewer(ctx, "org/repo#12", "org/dev#2"); err != nil {
+        t.Errorf("expected a legacy PR to be reassigned, got %v", err)
+    }
+    if _, err := svc.SetUserActive(ctx, "org/dev#2", false); err != nil {
+        t.Errorf("expected a legacy user to be deactivated, got %v", err)
+    }
+    if _, err := svc.MergePR(ctx, "org/repo#12"); err != nil {
+        t.Errorf("expected a legacy PR to be merged, got %v", err)
+    }
+
+    // Новые id по-прежнему проверяются по формату
+    if _, err := svc.CreatePR(ctx, "org/repo#13", "New", "org/author#1"); !errors.Is(err, ErrInvalidRequest) {
+        t.Errorf("expected a new PR id with / to be rejected, got %v", err)
+    }
+}
+
+func TestIdempotentRequest(t *testing.T) {
+    svc := New(memory.New())
+    svc.IdempotencyTTL = time.Hour
+    ci := auth.WithPrincipal(context.Background(), &auth.Principal{Subject: "ci"})
+    bot := auth.WithPrincipal(context.Background(), &auth.Principal{Subject: "bot"})
+
+    stored, res, err := svc.BeginIdempotentRequest(ci, "k1", "h1")
+    if err != nil || stored != nil || res == nil || res.Key != "k1" || res.Deadline.IsZero() {
+        t.Fatalf("expected the first request to run, got %+v %+v %v", stored, res, err)
+    }
+    // Пока первый запрос не завершен, повтор не выполняется
+    if _, _, err := svc.BeginIdempotentRequest(ci, "k1", "h1"); !errors.Is(err, ErrIdempotencyInUse) {
+        t.Errorf("expected ErrIdempotencyInUse, got %v", err)
+    }
+    // Ключи разных вызывающих не пересекаются
+    if stored, res, err := svc.BeginIdempotentRequest(bot, "k1", "h2"); err != nil || stored != nil || res == nil {
+        t.Errorf("expected another caller's key to be independent, got %+v %v", stored, err)
+    }
+    // Одинаковый subject у разных учетных данных не делает ключ общим
+    jwt := auth.WithPrincipal(context.Background(), &auth.Principal{Subject: "ci", Credential: "jwt:https://idp|ci"})
+    if stored, res, err := svc.BeginIdempotentRequest(jwt, "k1", "h3"); err != nil || stored != nil || res == nil {
+        t.Errorf("expected a JWT with the same subject to have its own keys, got %+v %v", stored, err)
+    }
+
+    if err := svc.CompleteIdempotentRequest(ci, res, StoredResponse{Status: 201, ContentType: "application/json", Body: []byte("{}")}); err != nil {
+        t.Fatal(err)
+    }
+    stored, replay, err := svc.BeginIdempotentRequest(ci, "k1", "h1")
+    if err != nil || replay != nil || stored == nil || stored.Status != 201 || string(stored.Body) != "{}" {
+        t.Errorf("expected the stored response, got %+v %v", stored, err)
+    }
+    if _, _, err := svc.BeginIdempotentRequest(ci, "k1", "h2"); !errors.Is(err, ErrIdempotencyReused) {
+        t.Errorf("expected ErrIdempotencyReused, got %v", err)
+    }
+
+    // Освобожденный после сбоя ключ можно использовать снова
+    if err := svc.AbortIdempotentRequest(ci, res); err != nil {
+        t.Fatal(err)
+    }
+    if stored, res, err := svc.BeginIdempotentRequest(ci, "k1", "h2"); err != nil || stored != nil || res == nil {
+        t.Errorf("expected the released key to run again, got %+v %v", stored, err)
+    }
+
+    // Запрос, не завершенный из-за падения процесса, держит ключ только на время аренды, а не TTL
+    svc.IdempotencyLease = time.Millisecond
+    _, abandoned, err := svc.BeginIdempotentRequest(ci, "k2", "h1")
+    if err != nil || abandoned == nil {
+        t.Fatal(abandoned, err)
+    }
+    time.Sleep(2 * time.Millisecond)
+    stored, res, err = svc.BeginIdempotentRequest(ci, "k2", "h1")
+    if err != nil || stored != nil || res == nil {
+        t.Fatalf("expected the abandoned key to be reserved anew, got %+v %v", stored, err)
+    }
+    // Запрос, переживший аренду, не затирает и не освобождает новую резервацию
+    if err := svc.CompleteIdempotentRequest(ci, abandoned, StoredResponse{Status: 201}); !errors.Is(err, ErrIdempotencyLeaseExpired) {
+        t.Errorf("expected ErrIdempotencyLeaseExpired, got %v", err)
+    }
+    if err := svc.AbortIdempotentRequest(ci, abandoned); err != nil {
+        t.Fatal(err)
+    }
+    // Сохраненный ответ живет TTL, даже когда аренда уже истекла
+    if err := svc.CompleteIdempotentRequest(ci, res, StoredResponse{Status: 200}); err != nil {
+        t.Fatal(err)
+    }
+    time.Sleep(2 * time.Millisecond)
+    if stored, _, err := svc.BeginIdempotentRequest(ci, "k2", "h1"); err != nil || stored == nil || stored.Status != 200 {
+        t.Errorf("expected the completed key to outlive the lease, got %+v %v", stored, err)
+    }
+    svc.IdempotencyLease = 0
+
+    // Истекший ключ считается свободным
+    svc.IdempotencyTTL = time.Millisecond
+    _, res, err = svc.BeginIdempotentRequest(ci, "k3", "h1")
+    if err != nil || res == nil {
+        t.Fatal(res, err)
+    }
+    if err := svc.CompleteIdempotentRequest(ci, res, StoredResponse{Status: 200}); err != nil {
+        t.Fatal(err)
+    }
+    time.Sleep(2 * time.Millisecond)
+    svc.IdempotencyTTL = time.Hour
+    if stored, res, err := svc.BeginIdempotentRequest(ci, "k3", "h2"); err != nil || stored != nil || res == nil {
+        t.Errorf("expected the expired key to be reserved anew, got %+v %v", stored, err)
+    }
+
+    if _, _, err := svc.BeginIdempotentRequest(ci, strings.Repeat("k", MaxIdempotencyKeyLength+1), "h1"); !errors.Is(err, ErrInvalidRequest) {
+        t.Errorf("expected a too long key to be rejected, got %v", err)
+    }
+}
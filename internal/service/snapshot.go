@@ -0,0 +1,410 @@
+package service
+
+import (
+    "bufio"
+    "context"
+    "encoding/json"
+    "fmt"
+    "io"
+    "time"
+
+    "go.opentelemetry.io/otel/attribute"
+
+    "pr-review-assigner/internal/repo"
+    "pr-review-assigner/internal/tracing"
+)
+
+// SnapshotVersion - версия формата выгрузки; импорт принимает только ее
+const SnapshotVersion = 1
+
+// Виды строк выгрузки в порядке записи: ссылки всегда указывают на строки выше
+const (
+    RecordHeader     = "header"
+    RecordUser       = "user"
+    RecordTeam       = "team"
+    RecordMembership = "membership"
+    RecordPR         = "pr"
+    RecordReviewer   = "reviewer"
+    RecordAssignment = "assignment"
+)
+
+// Режимы импорта
+const (
+    ImportMerge   = "merge"   // записи снимка перезаписывают совпадающие, остальные данные остаются
+    ImportReplace = "replace" // перед загрузкой удаляются все команды, PR и пользователи не из снимка
+)
+
+// SnapshotRecord - одна строка JSON Lines; заполнено только поле, соответствующее Kind
+type SnapshotRecord struct {
+    Kind       string           `json:"kind" enum:"header,user,team,membership,pr,reviewer,assignment"`
+    Header     *SnapshotHeader  `json:"header,omitempty"`
+    User       *repo.User       `json:"user,omitempty"`
+    Team       *repo.Team       `json:"team,omitempty"`
+    Membership *repo.Membership `json:"membership,omitempty"`
+    PR         *repo.PRRecord   `json:"pr,omitempty"`
+    Reviewer   *repo.Reviewer   `json:"reviewer,omitempty"`
+    Assignment *repo.Assignment `json:"assignment,omitempty"`
+}
+
+// SnapshotHeader - первая строка выгрузки; по Counts импорт обнаруживает обрезанный файл
+type SnapshotHeader struct {
+    Version    int            `json:"version"`
+    ExportedAt time.Time      `json:"exported_at"`
+    Counts     map[string]int `json:"counts"`
+}
+
+// Snapshot - полное состояние сервиса: команды, пользователи, PR и история назначений
+type Snapshot struct {
+    Header      SnapshotHeader
+    Users       []repo.User
+    Teams       []repo.Team
+    Memberships []repo.Membership
+    PRs         []repo.PRRecord
+    Reviewers   []repo.Reviewer
+    Assignments []repo.Assignment
+}
+
+// ImportResult - режим и количество загруженных записей по видам
+type ImportResult struct {
+    Mode   string         `json:"mode" enum:"merge,replace"`
+    Counts map[string]int `json:"counts"`
+}
+
+func (s *Snapshot) counts() map[string]int {
+    return map[string]int{
+        RecordUser:       len(s.Users),
+        RecordTeam:       len(s.Teams),
+        RecordMembership: len(s.Memberships),
+        RecordPR:         len(s.PRs),
+        RecordReviewer:   len(s.Reviewers),
+        RecordAssignment: len(s.Assignments),
+    }
+}
+
+// ExportSnapshot читает все состояние в одной транзакции
+func (s *Service) ExportSnapshot(ctx context.Context) (_ *Snapshot, err error) {
+    ctx, span := startSpan(ctx, "ExportSnapshot")
+    defer func() { tracing.End(span, err) }()
+
+    snap := &Snapshot{}
+    err = s.Repo.WithTx(ctx, func(tx repo.RepoInterface) error {
+        var err error
+        if snap.Users, err = tx.ListUsers(ctx); err != nil {
+            return err
+        }
+        if snap.Teams, err = tx.ListTeams(ctx); err != nil {
+            return err
+        }
+        if snap.Memberships, err = tx.ListMemberships(ctx); err != nil {
+            return err
+        }
+        if snap.PRs, err = tx.ListPRRecords(ctx); err != nil {
+            return err
+        }
+        if snap.Reviewers, err = tx.ListReviewers(ctx); err != nil {
+            return err
+        }
+        snap.Assignments, err = tx.ListAssignments(ctx)
+        return err
+    })
+    if err != nil {
+        return nil, err
+    }
+
+    snap.Header = SnapshotHeader{Version: SnapshotVersion, ExportedAt: time.Now().UTC(), Counts: snap.counts()}
+    return snap, nil
+}
+
+// WriteSnapshot пишет снимок в формате JSON Lines: заголовок, затем записи по видам
+func WriteSnapshot(w io.Writer, snap *Snapshot) error {
+    bw := bufio.NewWriter(w)
+    enc := json.NewEncoder(bw)
+
+    records := []SnapshotRecord{{Kind: RecordHeader, Header: &snap.Header}}
+    for i := range snap.Users {
+        records = append(records, SnapshotRecord{Kind: RecordUser, User: &snap.Users[i]})
+    }
+    for i := range snap.Teams {
+        records = append(records, SnapshotRecord{Kind: RecordTeam, Team: &snap.Teams[i]})
+    }
+    for i := range snap.Memberships {
+        records = append(records, SnapshotRecord{Kind: RecordMembership, Membership: &snap.Memberships[i]})
+    }
+    for i := range snap.PRs {
+        records = append(records, SnapshotRecord{Kind: RecordPR, PR: &snap.PRs[i]})
+    }
+    for i := range snap.Reviewers {
+        records = append(records, SnapshotRecord{Kind: RecordReviewer, Reviewer: &snap.Reviewers[i]})
+    }
+    for i := range snap.Assignments {
+        records = append(records, SnapshotRecord{Kind: RecordAssignment, Assignment: &snap.Assignments[i]})
+    }
+
+    for _, rec := range records {
+        if err := enc.Encode(rec); err != nil {
+            return err
+        }
+    }
+    return bw.Flush()
+}
+
+// ReadSnapshot разбирает выгрузку и проверяет версию, количество записей и ссылочную целостность
+func ReadSnapshot(r io.Reader) (*Snapshot, error) {
+    scanner := bufio.NewScanner(r)
+    scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+    snap := &Snapshot{}
+    line, seenHeader := 0, false
+    for scanner.Scan() {
+        line++
+        if len(scanner.Bytes()) == 0 {
+            continue
+        }
+
+        var rec SnapshotRecord
+        if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+            return nil, fmt.Errorf("%w: line %d: %v", ErrInvalidSnapshot, line, err)
+        }
+        if !seenHeader && rec.Kind != RecordHeader {
+            return nil, fmt.Errorf("%w: line %d: the first record must be the header", ErrInvalidSnapshot, line)
+        }
+
+        var ok bool
+        switch rec.Kind {
+        case RecordHeader:
+            if ok = rec.Header != nil && !seenHeader; ok {
+                snap.Header, seenHeader = *rec.Header, true
+                if snap.Header.Version != SnapshotVersion {
+                    return nil, fmt.Errorf("%w: unsupported version %d (expected %d)", ErrInvalidSnapshot, snap.Header.Version, SnapshotVersion)
+                }
+            }
+        case RecordUser:
+            if ok = rec.User != nil; ok {
+                snap.Users = append(snap.Users, *rec.User)
+            }
+        case RecordTeam:
+            if ok = rec.Team != nil; ok {
+                snap.Teams = append(snap.Teams, *rec.Team)
+            }
+        case RecordMembership:
+            if ok = rec.Membership != nil; ok {
+                snap.Memberships = append(snap.Memberships, *rec.Membership)
+            }
+        case RecordPR:
+            if ok = rec.PR != nil; ok {
+                snap.PRs = append(snap.PRs, *rec.PR)
+            }
+        case RecordReviewer:
+            if ok = rec.Reviewer != nil; ok {
+                snap.Reviewers = append(snap.Reviewers, *rec.Reviewer)
+            }
+        case RecordAssignment:
+            if ok = rec.Assignment != nil; ok {
+                snap.Assignments = append(snap.Assignments, *rec.Assignment)
+            }
+        default:
+            return nil, fmt.Errorf("%w: line %d: unknown record kind %q", ErrInvalidSnapshot, line, rec.Kind)
+        }
+        if !ok {
+            return nil, fmt.Errorf("%w: line %d: malformed %s record", ErrInvalidSnapshot, line, rec.Kind)
+        }
+    }
+    if err := scanner.Err(); err != nil {
+        return nil, fmt.Errorf("%w: %v", ErrInvalidSnapshot, err)
+    }
+    if !seenHeader {
+        return nil, fmt.Errorf("%w: empty snapshot", ErrInvalidSnapshot)
+    }
+
+    if err := validateSnapshot(snap); err != nil {
+        return nil, err
+    }
+    return snap, nil
+}
+
+// validateSnapshot проверяет, что снимок самодостаточен: все ссылки указывают на записи из него же
+func validateSnapshot(snap *Snapshot) error {
+    invalid := func(format string, args ...interface{}) error {
+        return fmt.Errorf("%w: %s", ErrInvalidSnapshot, fmt.Sprintf(format, args...))
+    }
+
+    for kind, n := range snap.counts() {
+        if snap.Header.Counts[kind] != n {
+            return invalid("header declares %d %s records, found %d", snap.Header.Counts[kind], kind, n)
+        }
+    }
+
+    users := make(map[string]bool, len(snap.Users))
+    for _, u := range snap.Users {
+        if u.ID == "" || users[u.ID] {
+            return invalid("empty or duplicate user id %q", u.ID)
+        }
+        users[u.ID] = true
+    }
+
+    teams := make(map[string]bool, len(snap.Teams))
+    for _, t := range snap.Teams {
+        if t.Name == "" || teams[t.Name] {
+            return invalid("empty or duplicate team name %q", t.Name)
+        }
+        teams[t.Name] = true
+    }
+
+    seen := map[string]bool{}
+    for _, m := range snap.Memberships {
+        if !teams[m.TeamName] || !users[m.UserID] {
+            return invalid("membership %s/%s references an unknown team or user", m.TeamName, m.UserID)
+        }
+        key := "membership/" + m.TeamName + "/" + m.UserID
+        if seen[key] {
+            return invalid("duplicate membership %s/%s", m.TeamName, m.UserID)
+        }
+        seen[key] = true
+    }
+
+    prs := make(map[string]bool, len(snap.PRs))
+    for _, pr := range snap.PRs {
+        if pr.ID == "" || prs[pr.ID] {
+            return invalid("empty or duplicate PR id %q", pr.ID)
+        }
+        if !users[pr.AuthorID] {
+            return invalid("PR %s references unknown author %q", pr.ID, pr.AuthorID)
+        }
+        if pr.Status != "OPEN" && pr.Status != "MERGED" {
+            return invalid("PR %s has unknown status %q", pr.ID, pr.Status)
+        }
+        prs[pr.ID] = true
+    }
+
+    for _, rv := range snap.Reviewers {
+        if !prs[rv.PRID] || !users[rv.UserID] {
+            return invalid("reviewer %s/%s references an unknown PR or user", rv.PRID, rv.UserID)
+        }
+        key := "reviewer/" + rv.PRID + "/" + rv.UserID
+        if seen[key] {
+            return invalid("duplicate reviewer %s/%s", rv.PRID, rv.UserID)
+        }
+        seen[key] = true
+    }
+
+    for _, a := range snap.Assignments {
+        if !prs[a.PRID] || !users[a.UserID] {
+            return invalid("assignment %s/%s references an unknown PR or user", a.PRID, a.UserID)
+        }
+    }
+    return nil
+}
+
+// ImportSnapshot загружает снимок в одной транзакции. В режиме merge пользователи, команды и PR
+// из снимка создаются или перезаписываются, а набор ревьюверов каждого PR заменяется на снимок;
+// в режиме replace сначала удаляется текущее состояние, а версии восстановленных команд и PR
+// поднимаются выше прежних, чтобы If-Match со старым ETag не совпал с другим состоянием
+func (s *Service) ImportSnapshot(ctx context.Context, snap *Snapshot, mode string) (_ *ImportResult, err error) {
+    ctx, span := startSpan(ctx, "ImportSnapshot", attribute.String("import.mode", mode))
+    defer func() { tracing.End(span, err) }()
+
+    if mode != ImportMerge && mode != ImportReplace {
+        return nil, fmt.Errorf("%w: unknown import mode %q", ErrInvalidSnapshot, mode)
+    }
+    if err := validateSnapshot(snap); err != nil {
+        return nil, err
+    }
+
+    result := &ImportResult{Mode: mode, Counts: snap.counts()}
+    err = s.Repo.WithTx(ctx, func(tx repo.RepoInterface) error {
+        var replacedVersion int64
+        if mode == ImportReplace {
+            keep := make([]string, len(snap.Users))
+            for i, u := range snap.Users {
+                keep[i] = u.ID
+            }
+            var err error
+            if replacedVersion, err = tx.ResetState(ctx, keep); err != nil {
+                return err
+            }
+        }
+
+        for _, u := range snap.Users {
+            if err := tx.CreateUser(ctx, u.ID, u.Name); err != nil {
+                return err
+            }
+            if err := tx.SetUserActive(ctx, u.ID, u.IsActive); err != nil {
+                return err
+            }
+        }
+
+        teamIDs := make(map[string]int64, len(snap.Teams))
+        for _, t := range snap.Teams {
+            exists, err := tx.TeamExists(ctx, t.Name)
+            if err != nil {
+                return err
+            }
+            if !exists {
+                if teamIDs[t.Name], err = tx.CreateTeam(ctx, t.Name); err != nil {
+                    return err
+                }
+                continue
+            }
+            team, err := tx.GetTeamByName(ctx, t.Name)
+            if err != nil {
+                return err
+            }
+            teamIDs[t.Name] = team.ID
+        }
+
+        for _, m := range snap.Memberships {
+            if err := tx.AddMember(ctx, teamIDs[m.TeamName], m.UserID); err != nil {
+                return err
+            }
+            if err := tx.SetTeamLead(ctx, teamIDs[m.TeamName], m.UserID, m.IsLead); err != nil {
+                return err
+            }
+        }
+
+        reviewers := map[string]map[string]bool{}
+        for _, rv := range snap.Reviewers {
+            if reviewers[rv.PRID] == nil {
+                reviewers[rv.PRID] = map[string]bool{}
+            }
+            reviewers[rv.PRID][rv.UserID] = true
+        }
+        for _, pr := range snap.PRs {
+            if err := tx.UpsertPR(ctx, pr); err != nil {
+                return err
+            }
+            current, err := tx.GetPRReviewers(ctx, pr.ID)
+            if err != nil {
+                return err
+            }
+            for _, u := range current {
+                if !reviewers[pr.ID][u.ID] {
+                    if err := tx.RemoveReviewer(ctx, pr.ID, u.ID); err != nil {
+                        return err
+                    }
+                }
+            }
+            for userID := range reviewers[pr.ID] {
+                if err := tx.AddReviewer(ctx, pr.ID, userID); err != nil {
+                    return err
+                }
+            }
+        }
+
+        for _, a := range snap.Assignments {
+            if err := tx.RestoreAssignment(ctx, a); err != nil {
+                return err
+            }
+        }
+        if replacedVersion > 0 {
+            if err := tx.ShiftVersions(ctx, replacedVersion); err != nil {
+                return err
+            }
+        }
+
+        return s.audit(ctx, tx, AuditStateImport, "state", mode, nil, result)
+    })
+    if err != nil {
+        return nil, err
+    }
+    return result, nil
+}
@@ -0,0 +1,380 @@
+package service
+
+import (
+    "bytes"
+    "context"
+    "database/sql"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io"
+    "strings"
+
+    "go.opentelemetry.io/otel/attribute"
+    "gopkg.in/yaml.v3"
+
+    "pr-review-assigner/internal/repo"
+    "pr-review-assigner/internal/tracing"
+)
+
+// TeamManifest описывает желаемое состояние команд
+type TeamManifest struct {
+    Teams []ManifestTeam `json:"teams"`
+}
+
+type ManifestTeam struct {
+    TeamName    string            `json:"team_name"`
+    RenamedFrom []string          `json:"renamed_from,omitempty"`
+    Version     int64             `json:"version,omitempty"` // ожидаемая версия (ETag) существующей команды; 0 - без проверки
+    Members     []repo.TeamMember `json:"members"`
+}
+
+// SyncPlan содержит разницу между манифестом и базой данных
+type SyncPlan struct {
+    DryRun          bool             `json:"dry_run"`
+    TeamsCreated    []string         `json:"teams_created"`
+    TeamsRenamed    []TeamRename     `json:"teams_renamed"`
+    MembersAdded    []MemberChange   `json:"members_added"`
+    MembersRemoved  []MemberChange   `json:"members_removed"`
+    ActivityChanged []ActivityChange `json:"activity_changed"`
+    UsersRenamed    []UserRename     `json:"users_renamed"`
+    LeadsChanged    []LeadChange     `json:"leads_changed"`
+}
+
+type TeamRename struct {
+    From string `json:"from"`
+    To   string `json:"to"`
+}
+
+type MemberChange struct {
+    TeamName string `json:"team_name"`
+    UserID   string `json:"user_id"`
+}
+
+type ActivityChange struct {
+    UserID string `json:"user_id"`
+    From   bool   `json:"from"`
+    To     bool   `json:"to"`
+}
+
+type LeadChange struct {
+    TeamName string `json:"team_name"`
+    UserID   string `json:"user_id"`
+    IsLead   bool   `json:"is_lead"`
+}
+
+type UserRename struct {
+    UserID string `json:"user_id"`
+    From   string `json:"from"`
+    To     string `json:"to"`
+}
+
+// Empty сообщает, что применять нечего
+func (p *SyncPlan) Empty() bool {
+    return len(p.TeamsCreated) == 0 && len(p.TeamsRenamed) == 0 &&
+        len(p.MembersAdded) == 0 && len(p.MembersRemoved) == 0 &&
+        len(p.ActivityChanged) == 0 && len(p.UsersRenamed) == 0 &&
+        len(p.LeadsChanged) == 0
+}
+
+// teamSync - шаги применения манифеста для одной команды
+type teamSync struct {
+    name     string
+    fromName string // текущее имя в БД, пустое для новой команды
+    teamID   int64
+    version  int64 // ожидаемая версия команды, 0 - без проверки
+    members  []repo.TeamMember
+    remove   []string
+}
+
+// ParseTeamManifest читает манифест в формате YAML или JSON
+func ParseTeamManifest(r io.Reader) (*TeamManifest, error) {
+    data, err := io.ReadAll(r)
+    if err != nil {
+        return nil, err
+    }
+
+    // JSON является подмножеством YAML, поэтому достаточно одного парсера.
+    // Через промежуточный JSON используем те же теги, что и в API.
+    var raw interface{}
+    if err := yaml.Unmarshal(data, &raw); err != nil {
+        return nil, fmt.Errorf("%w: %v", ErrInvalidManifest, err)
+    }
+
+    converted, err := json.Marshal(raw)
+    if err != nil {
+        return nil, fmt.Errorf("%w: %v", ErrInvalidManifest, err)
+    }
+
+    var manifest TeamManifest
+    dec := json.NewDecoder(bytes.NewReader(converted))
+    dec.DisallowUnknownFields()
+    if err := dec.Decode(&manifest); err != nil {
+        return nil, fmt.Errorf("%w: %v", ErrInvalidManifest, err)
+    }
+
+    return &manifest, nil
+}
+
+// SyncTeams приводит команды к состоянию из манифеста; при dryRun только возвращает план
+func (s *Service) SyncTeams(ctx context.Context, manifest *TeamManifest, dryRun bool) (_ *SyncPlan, err error) {
+    ctx, span := startSpan(ctx, "SyncTeams", attribute.Bool("dry_run", dryRun))
+    defer func() { tracing.End(span, err) }()
+
+    if err := validateManifest(manifest); err != nil {
+        return nil, err
+    }
+
+    if dryRun {
+        plan, _, err := s.planSync(ctx, s.Repo, manifest)
+        if err != nil {
+            return nil, err
+        }
+        plan.DryRun = true
+        return plan, nil
+    }
+
+    var plan *SyncPlan
+    err = s.Repo.WithTx(ctx, func(tx repo.RepoInterface) error {
+        var steps []teamSync
+        var err error
+        plan, steps, err = s.planSync(ctx, tx, manifest)
+        if err != nil {
+            return err
+        }
+        if err := applySync(ctx, tx, steps); err != nil {
+            return err
+        }
+        if plan.Empty() {
+            return nil
+        }
+
+        names := make([]string, len(manifest.Teams))
+        for i, team := range manifest.Teams {
+            names[i] = team.TeamName
+        }
+        return s.audit(ctx, tx, AuditTeamSync, "manifest", strings.Join(names, ","), nil, plan)
+    })
+    if err != nil {
+        return nil, err
+    }
+
+    return plan, nil
+}
+
+// validateManifest проверяет манифест целиком и сообщает обо всех ошибках сразу
+func validateManifest(manifest *TeamManifest) error {
+    var v validation
+    teams := make(map[string]int)
+    users := make(map[string]repo.TeamMember)
+
+    for i, team := range manifest.Teams {
+        field := fmt.Sprintf("teams[%d]", i)
+        v.teamName(field+".team_name", team.TeamName)
+        if first, ok := teams[team.TeamName]; ok && team.TeamName != "" {
+            v.add(field+".team_name", fmt.Sprintf("duplicates teams[%d]", first))
+        } else {
+            teams[team.TeamName] = i
+        }
+
+        if team.Version < 0 {
+            v.add(field+".version", "must be positive")
+        }
+        v.members(field+".members", team.Members)
+        for j, member := range team.Members {
+            // Пользователь может состоять в нескольких командах, но описан должен быть одинаково
+            // (лидом он может быть лишь в части из них)
+            if prev, ok := users[member.UserID]; ok && (prev.Username != member.Username || prev.IsActive != member.IsActive) {
+                v.add(fmt.Sprintf("%s.members[%d]", field, j), fmt.Sprintf("user %q is described differently in several teams", member.UserID))
+            }
+            users[member.UserID] = member
+        }
+    }
+
+    // Прежнее имя должно указывать на одну команду: иначе две команды манифеста переименуют одну и ту же
+    claimed := make(map[string]string)
+    for i, team := range manifest.Teams {
+        for j, old := range team.RenamedFrom {
+            field := fmt.Sprintf("teams[%d].renamed_from[%d]", i, j)
+            if k, ok := teams[old]; ok && k == i {
+                v.add(field, "must not be the team's own name")
+            } else if ok {
+                v.add(field, fmt.Sprintf("is the name of teams[%d]", k))
+            } else if first, ok := claimed[old]; ok {
+                v.add(field, fmt.Sprintf("is also claimed by %s", first))
+            } else {
+                claimed[old] = field
+            }
+        }
+    }
+
+    return v.err(ErrInvalidManifest)
+}
+
+// planSync сравнивает манифест с текущим состоянием репозитория
+func (s *Service) planSync(ctx context.Context, r repo.RepoInterface, manifest *TeamManifest) (*SyncPlan, []teamSync, error) {
+    plan := &SyncPlan{
+        TeamsCreated:    []string{},
+        TeamsRenamed:    []TeamRename{},
+        MembersAdded:    []MemberChange{},
+        MembersRemoved:  []MemberChange{},
+        ActivityChanged: []ActivityChange{},
+        UsersRenamed:    []UserRename{},
+        LeadsChanged:    []LeadChange{},
+    }
+    steps := make([]teamSync, 0, len(manifest.Teams))
+    checkedUsers := make(map[string]bool)
+
+    for _, mt := range manifest.Teams {
+        step := teamSync{name: mt.TeamName, members: mt.Members, version: mt.Version}
+
+        team, err := findTeam(ctx, r, append([]string{mt.TeamName}, mt.RenamedFrom...))
+        if err != nil {
+            return nil, nil, err
+        }
+
+        var currentIDs []string
+        current := make(map[string]bool)
+        leads := make(map[string]bool)
+        if mt.Version != 0 {
+            switch {
+            case team == nil:
+                return nil, nil, preconditionFailed(fmt.Sprintf("team %s does not exist, expected version %d", mt.TeamName, mt.Version))
+            case team.Version != mt.Version:
+                return nil, nil, preconditionFailed(fmt.Sprintf("team %s was modified: current version is %d, expected %d", team.Name, team.Version, mt.Version))
+            }
+        }
+
+        if team == nil {
+            plan.TeamsCreated = append(plan.TeamsCreated, mt.TeamName)
+        } else {
+            step.fromName = team.Name
+            step.teamID = team.ID
+            if team.Name != mt.TeamName {
+                plan.TeamsRenamed = append(plan.TeamsRenamed, TeamRename{From: team.Name, To: mt.TeamName})
+            }
+
+            members, err := r.GetTeamMembers(ctx, team.Name)
+            if err != nil {
+                return nil, nil, err
+            }
+            for _, m := range members {
+                currentIDs = append(currentIDs, m.ID)
+                current[m.ID] = true
+                leads[m.ID] = m.IsLead
+            }
+        }
+
+        desired := make(map[string]bool)
+        for _, member := range mt.Members {
+            desired[member.UserID] = true
+            if !current[member.UserID] {
+                plan.MembersAdded = append(plan.MembersAdded, MemberChange{TeamName: mt.TeamName, UserID: member.UserID})
+            }
+            if member.IsLead != leads[member.UserID] {
+                plan.LeadsChanged = append(plan.LeadsChanged, LeadChange{TeamName: mt.TeamName, UserID: member.UserID, IsLead: member.IsLead})
+            }
+
+            if checkedUsers[member.UserID] {
+                continue
+            }
+            checkedUsers[member.UserID] = true
+
+            user, err := r.GetUserByID(ctx, member.UserID)
+            if errors.Is(err, sql.ErrNoRows) {
+                // Новый пользователь появится вместе с членством в команде
+                continue
+            }
+            if err != nil {
+                return nil, nil, err
+            }
+            if user.Name != member.Username {
+                plan.UsersRenamed = append(plan.UsersRenamed, UserRename{UserID: user.ID, From: user.Name, To: member.Username})
+            }
+            if user.IsActive != member.IsActive {
+                plan.ActivityChanged = append(plan.ActivityChanged, ActivityChange{UserID: user.ID, From: user.IsActive, To: member.IsActive})
+            }
+        }
+
+        for _, userID := range currentIDs {
+            if !desired[userID] {
+                step.remove = append(step.remove, userID)
+                plan.MembersRemoved = append(plan.MembersRemoved, MemberChange{TeamName: mt.TeamName, UserID: userID})
+            }
+        }
+
+        steps = append(steps, step)
+    }
+
+    return plan, steps, nil
+}
+
+// findTeam ищет команду по первому существующему имени из списка
+func findTeam(ctx context.Context, r repo.RepoInterface, names []string) (*repo.Team, error) {
+    for _, name := range names {
+        exists, err := r.TeamExists(ctx, name)
+        if err != nil {
+            return nil, err
+        }
+        if exists {
+            return r.GetTeamByName(ctx, name)
+        }
+    }
+    return nil, nil
+}
+
+// applySync применяет шаги плана внутри транзакции. Версии команд сверяются и блокируются
+// до первого изменения: изменения одной команды (например, активность общего участника) меняют версии других.
+func applySync(ctx context.Context, tx repo.RepoInterface, steps []teamSync) error {
+    for _, step := range steps {
+        if step.version == 0 {
+            continue
+        }
+        matched, err := tx.MatchTeamVersion(ctx, step.teamID, step.version)
+        if err != nil {
+            return err
+        }
+        if !matched {
+            return preconditionFailed(fmt.Sprintf("team %s was modified concurrently", step.fromName))
+        }
+    }
+
+    for _, step := range steps {
+        teamID := step.teamID
+        switch {
+        case step.fromName == "":
+            id, err := tx.CreateTeam(ctx, step.name)
+            if err != nil {
+                return err
+            }
+            teamID = id
+        case step.fromName != step.name:
+            if err := tx.RenameTeam(ctx, teamID, step.name); err != nil {
+                return err
+            }
+        }
+
+        for _, member := range step.members {
+            if err := tx.CreateUser(ctx, member.UserID, member.Username); err != nil {
+                return err
+            }
+            if err := tx.SetUserActive(ctx, member.UserID, member.IsActive); err != nil {
+                return err
+            }
+            if err := tx.AddMember(ctx, teamID, member.UserID); err != nil {
+                return err
+            }
+            if err := tx.SetTeamLead(ctx, teamID, member.UserID, member.IsLead); err != nil {
+                return err
+            }
+        }
+
+        for _, userID := range step.remove {
+            if err := tx.RemoveMember(ctx, teamID, userID); err != nil {
+                return err
+            }
+        }
+    }
+
+    return nil
+}
@@ -0,0 +1,93 @@
+package service
+
+import (
+    "context"
+    "fmt"
+    "strconv"
+    "strings"
+
+    "go.opentelemetry.io/otel/attribute"
+
+    "pr-review-assigner/internal/auth"
+    "pr-review-assigner/internal/repo"
+    "pr-review-assigner/internal/tracing"
+)
+
+// CreateAPIToken выпускает токен; открытое значение возвращается только один раз
+func (s *Service) CreateAPIToken(ctx context.Context, name string, scopes []string, userID string) (_ *repo.APIToken, _ string, err error) {
+    ctx, span := startSpan(ctx, "CreateAPIToken", attrUserID.String(userID))
+    defer func() { tracing.End(span, err) }()
+
+    var v validation
+    v.name("name", name)
+    if len(scopes) == 0 {
+        v.add("scopes", "must contain at least one scope")
+    }
+    for i, scope := range scopes {
+        if !auth.ValidScope(scope) {
+            v.add(fmt.Sprintf("scopes[%d]", i), fmt.Sprintf("is an unknown scope %q", scope))
+        }
+    }
+    if userID != "" {
+        v.ref("user_id", userID)
+    }
+    if err := v.err(ErrInvalidTokenRequest); err != nil {
+        return nil, "", err
+    }
+
+    token := &repo.APIToken{
+        Name:   name,
+        Scopes: strings.Join(scopes, " "),
+    }
+    if userID != "" {
+        if _, err := s.Repo.GetUserByID(ctx, userID); err != nil {
+            return nil, "", notFound(err, "user", userID)
+        }
+        token.UserID = &userID
+    }
+
+    secret, hash, err := auth.GenerateToken()
+    if err != nil {
+        return nil, "", err
+    }
+    token.TokenHash = hash
+
+    err = s.Repo.WithTx(ctx, func(tx repo.RepoInterface) error {
+        id, err := tx.CreateAPIToken(ctx, token)
+        if err != nil {
+            return err
+        }
+        token.ID = id
+        return s.audit(ctx, tx, AuditTokenCreate, "api_token", strconv.FormatInt(id, 10), nil, token)
+    })
+    if err != nil {
+        return nil, "", err
+    }
+
+    return token, secret, nil
+}
+
+// ListAPITokens возвращает все токены без секретов
+func (s *Service) ListAPITokens(ctx context.Context) (_ []repo.APIToken, err error) {
+    ctx, span := startSpan(ctx, "ListAPITokens")
+    defer func() { tracing.End(span, err) }()
+
+    return s.Repo.ListAPITokens(ctx)
+}
+
+// RevokeAPIToken отзывает токен; отсутствующий или уже отозванный токен - ErrNotFound без записи в журнал
+func (s *Service) RevokeAPIToken(ctx context.Context, id int64) (err error) {
+    ctx, span := startSpan(ctx, "RevokeAPIToken", attribute.Int64("token.id", id))
+    defer func() { tracing.End(span, err) }()
+
+    return s.Repo.WithTx(ctx, func(tx repo.RepoInterface) error {
+        revoked, err := tx.RevokeAPIToken(ctx, id)
+        if err != nil {
+            return err
+        }
+        if !revoked {
+            return &Error{Kind: KindNotFound, Code: CodeNotFound, Message: fmt.Sprintf("API token %d not found or already revoked", id)}
+        }
+        return s.audit(ctx, tx, AuditTokenRevoke, "api_token", strconv.FormatInt(id, 10), nil, nil)
+    })
+}
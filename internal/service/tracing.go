@@ -0,0 +1,28 @@
+package service
+
+import (
+    "context"
+
+    "go.opentelemetry.io/otel"
+    "go.opentelemetry.io/otel/attribute"
+    "go.opentelemetry.io/otel/trace"
+)
+
+// tracer - спаны операций сервиса; пока провайдер не настроен (tracing.Setup), они ничего не стоят
+var tracer = otel.Tracer("pr-review-assigner/internal/service")
+
+// Атрибуты спанов сервиса
+const (
+    attrPRID       = attribute.Key("pr.id")
+    attrUserID     = attribute.Key("user.id")
+    attrTeamName   = attribute.Key("team.name")
+    attrTeamID     = attribute.Key("team.id")
+    attrCandidates = attribute.Key("reviewers.candidates") // сколько активных участников рассматривалось
+    attrAssigned   = attribute.Key("reviewers.assigned")
+    attrReviewerID = attribute.Key("reviewer.id")
+)
+
+// startSpan открывает спан "Service.<name>"; закрывается через tracing.End с ошибкой операции
+func startSpan(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+    return tracer.Start(ctx, "Service."+name, trace.WithAttributes(attrs...))
+}
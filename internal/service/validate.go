@@ -0,0 +1,105 @@
+package service
+
+import (
+    "fmt"
+    "regexp"
+    "strings"
+    "unicode"
+    "unicode/utf8"
+
+    "pr-review-assigner/internal/repo"
+)
+
+// Ограничения входных данных. Идентификаторы приходят из внешних систем (Git-хостинг, SSO),
+// поэтому допускаются email и UUID, но не пробелы, слэши и управляющие символы.
+const (
+    MaxIDLength   = 128
+    MaxNameLength = 255
+)
+
+var idPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._@:-]*$`)
+
+// validation собирает ошибки по всем полям, чтобы клиент исправил их за один запрос
+type validation struct {
+    fields []FieldError
+}
+
+func (v *validation) add(field, message string) {
+    v.fields = append(v.fields, FieldError{Field: field, Message: message})
+}
+
+// id проверяет идентификатор создаваемого пользователя или PR
+func (v *validation) id(field, value string) {
+    switch {
+    case value == "":
+        v.add(field, "is required")
+    case len(value) > MaxIDLength:
+        v.add(field, fmt.Sprintf("must be at most %d characters", MaxIDLength))
+    case !idPattern.MatchString(value):
+        v.add(field, "must start with a letter or digit and contain only letters, digits and . _ @ : -")
+    }
+}
+
+// ref проверяет ссылку на существующего пользователя или PR. Формат id не навязывается:
+// записи, созданные до появления правил (например, org/repo#12), должны оставаться доступными
+func (v *validation) ref(field, value string) {
+    switch {
+    case value == "":
+        v.add(field, "is required")
+    case len(value) > MaxIDLength:
+        v.add(field, fmt.Sprintf("must be at most %d characters", MaxIDLength))
+    }
+}
+
+// name проверяет обязательное отображаемое имя
+func (v *validation) name(field, value string) {
+    switch {
+    case strings.TrimSpace(value) == "":
+        v.add(field, "is required")
+    case utf8.RuneCountInString(value) > MaxNameLength:
+        v.add(field, fmt.Sprintf("must be at most %d characters", MaxNameLength))
+    case strings.TrimSpace(value) != value:
+        v.add(field, "must not start or end with whitespace")
+    case strings.IndexFunc(value, unicode.IsControl) >= 0:
+        v.add(field, "must not contain control characters")
+    }
+}
+
+// teamName - имя команды; оно же сегмент пути /teams/{team}/..., поэтому без слэшей
+func (v *validation) teamName(field, value string) {
+    before := len(v.fields)
+    v.name(field, value)
+    if len(v.fields) == before && strings.Contains(value, "/") {
+        v.add(field, "must not contain /")
+    }
+}
+
+// members проверяет участников команды: идентификаторы, имена и повторы
+func (v *validation) members(prefix string, members []repo.TeamMember) {
+    seen := make(map[string]int, len(members))
+    for i, m := range members {
+        field := fmt.Sprintf("%s[%d]", prefix, i)
+        v.id(field+".user_id", m.UserID)
+        v.name(field+".username", m.Username)
+        if first, ok := seen[m.UserID]; ok && m.UserID != "" {
+            v.add(field+".user_id", fmt.Sprintf("duplicates %s[%d]", prefix, first))
+            continue
+        }
+        seen[m.UserID] = i
+    }
+}
+
+// err возвращает base со всеми собранными ошибками или nil, если ошибок нет
+func (v *validation) err(base *Error) error {
+    if len(v.fields) == 0 {
+        return nil
+    }
+    msgs := make([]string, len(v.fields))
+    for i, f := range v.fields {
+        msgs[i] = f.Field + " " + f.Message
+    }
+    e := *base
+    e.Message = base.Message + ": " + strings.Join(msgs, "; ")
+    e.Fields = append(append([]FieldError(nil), base.Fields...), v.fields...)
+    return &e
+}
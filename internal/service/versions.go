@@ -0,0 +1,71 @@
+package service
+
+import (
+    "context"
+    "fmt"
+
+    "pr-review-assigner/internal/repo"
+)
+
+type expectedVersionKey struct{}
+
+// WithExpectedVersion делает изменение PR или команды условным: операция выполнится, только если
+// версия изменяемого ресурса равна version (HTTP If-Match). Без этого изменения безусловные.
+func WithExpectedVersion(ctx context.Context, version int64) context.Context {
+    return context.WithValue(ctx, expectedVersionKey{}, version)
+}
+
+func expectedVersion(ctx context.Context) (int64, bool) {
+    v, ok := ctx.Value(expectedVersionKey{}).(int64)
+    return v, ok
+}
+
+// checkVersion сверяет прочитанную версию до проверок состояния: клиент с устаревшими данными
+// должен получить PRECONDITION_FAILED, а не, например, NOT_ASSIGNED по уже замененному ревьюверу
+func checkVersion(ctx context.Context, what, id string, current int64) error {
+    expected, ok := expectedVersion(ctx)
+    if !ok || expected == current {
+        return nil
+    }
+    return preconditionFailed(fmt.Sprintf("%s %s was modified: current version is %d, expected %d", what, id, current, expected))
+}
+
+func preconditionFailed(message string) error {
+    return &Error{Kind: KindPrecondition, Code: CodePreconditionFailed, Message: message}
+}
+
+// matchPRVersion повторяет проверку в транзакции и блокирует PR до ее конца, чтобы параллельное
+// изменение между чтением и записью тоже привело к PRECONDITION_FAILED
+func matchPRVersion(ctx context.Context, tx repo.RepoInterface, prID string) error {
+    expected, ok := expectedVersion(ctx)
+    if !ok {
+        return nil
+    }
+    matched, err := tx.MatchPRVersion(ctx, prID, expected)
+    if err != nil || matched {
+        return err
+    }
+    return preconditionFailed(fmt.Sprintf("PR %s was modified concurrently", prID))
+}
+
+// matchTeamVersion - то же для команды
+func matchTeamVersion(ctx context.Context, tx repo.RepoInterface, team *repo.Team) error {
+    expected, ok := expectedVersion(ctx)
+    if !ok {
+        return nil
+    }
+    matched, err := tx.MatchTeamVersion(ctx, team.ID, expected)
+    if err != nil || matched {
+        return err
+    }
+    return preconditionFailed(fmt.Sprintf("team %s was modified concurrently", team.Name))
+}
+
+// prVersion возвращает версию PR после изменений в транзакции, чтобы отдать ее клиенту как новый ETag
+func prVersion(ctx context.Context, tx repo.RepoInterface, prID string) (int64, error) {
+    pr, err := tx.GetPRByID(ctx, prID)
+    if err != nil {
+        return 0, err
+    }
+    return pr.Version, nil
+}
@@ -0,0 +1,140 @@
+// Package tracing настраивает OpenTelemetry: экспорт спанов по OTLP или в файл и спаны входящих HTTP-запросов.
+// Сервис и репозиторий берут трейсер через otel.Tracer, поэтому без Setup спаны ничего не стоят.
+package tracing
+
+import (
+    "context"
+    "fmt"
+    "io"
+    "net/http"
+    "os"
+    "strings"
+
+    "github.com/go-chi/chi/v5"
+    "github.com/go-chi/chi/v5/middleware"
+    "go.opentelemetry.io/otel"
+    "go.opentelemetry.io/otel/attribute"
+    "go.opentelemetry.io/otel/codes"
+    "go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+    "go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+    "go.opentelemetry.io/otel/propagation"
+    "go.opentelemetry.io/otel/sdk/resource"
+    sdktrace "go.opentelemetry.io/otel/sdk/trace"
+    "go.opentelemetry.io/otel/trace"
+
+    "pr-review-assigner/internal/reqmeta"
+)
+
+// ServiceName - service.name в ресурсе, если не задан OTEL_SERVICE_NAME
+const ServiceName = "pr-review-assigner"
+
+const (
+    ExporterNone   = "none"
+    ExporterOTLP   = "otlp"   // OTLP/HTTP, например в коллектор или Jaeger на :4318
+    ExporterStdout = "stdout" // JSON в stdout для локальной отладки
+    ExporterFile   = "file"   // JSON в файл, по спану на строку
+)
+
+// Exporters - допустимые значения настройки экспортера
+var Exporters = []string{ExporterNone, ExporterOTLP, ExporterStdout, ExporterFile}
+
+// Setup регистрирует глобальный TracerProvider с выбранным экспортером и возвращает функцию,
+// которая дописывает накопленные спаны при остановке. endpoint - URL для otlp (пустой - из OTEL_EXPORTER_OTLP_ENDPOINT),
+// file - путь для file. Сэмплирование задается стандартными OTEL_TRACES_SAMPLER и OTEL_TRACES_SAMPLER_ARG.
+func Setup(ctx context.Context, exporter, endpoint, file string) (func(context.Context) error, error) {
+    var (
+        exp    sdktrace.SpanExporter
+        closer io.Closer
+        err    error
+    )
+    switch exporter {
+    case ExporterNone, "":
+        return func(context.Context) error { return nil }, nil
+    case ExporterOTLP:
+        var opts []otlptracehttp.Option
+        if endpoint != "" {
+            opts = append(opts, otlptracehttp.WithEndpointURL(endpoint))
+        }
+        exp, err = otlptracehttp.New(ctx, opts...)
+    case ExporterStdout:
+        exp, err = stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+    case ExporterFile:
+        f, ferr := os.OpenFile(file, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+        if ferr != nil {
+            return nil, fmt.Errorf("tracing: %w", ferr)
+        }
+        closer = f
+        exp, err = stdouttrace.New(stdouttrace.WithWriter(f))
+    default:
+        return nil, fmt.Errorf("unknown tracing exporter %q, expected %s", exporter, strings.Join(Exporters, ", "))
+    }
+    if err != nil {
+        return nil, fmt.Errorf("tracing: %w", err)
+    }
+
+    // OTEL_SERVICE_NAME и OTEL_RESOURCE_ATTRIBUTES переопределяют имя по умолчанию
+    res, err := resource.New(ctx,
+        resource.WithAttributes(attribute.String("service.name", ServiceName)),
+        resource.WithFromEnv(),
+        resource.WithTelemetrySDK(),
+    )
+    if err != nil {
+        return nil, fmt.Errorf("tracing: %w", err)
+    }
+
+    tp := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exp), sdktrace.WithResource(res))
+    otel.SetTracerProvider(tp)
+    otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+    return func(ctx context.Context) error {
+        err := tp.Shutdown(ctx)
+        if closer != nil {
+            if cerr := closer.Close(); err == nil {
+                err = cerr
+            }
+        }
+        return err
+    }, nil
+}
+
+// Middleware открывает серверный спан на каждый запрос и продолжает трейс из заголовка traceparent.
+// Имя спана - метод и шаблон маршрута chi, например "POST /pullRequest/reassign"; 5xx отмечаются ошибкой.
+func Middleware(next http.Handler) http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+        // Трейсер берется из текущего провайдера: Setup может быть вызван после сборки роутера
+        tracer := otel.Tracer("pr-review-assigner/internal/tracing")
+        ctx, span := tracer.Start(ctx, r.Method, trace.WithSpanKind(trace.SpanKindServer),
+            trace.WithAttributes(
+                attribute.String("http.request.method", r.Method),
+                attribute.String("url.path", r.URL.Path),
+                attribute.String("request.id", reqmeta.FromContext(r.Context()).RequestID),
+            ))
+        defer span.End()
+
+        ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+        next.ServeHTTP(ww, r.WithContext(ctx))
+
+        status := ww.Status()
+        if status == 0 {
+            status = http.StatusOK
+        }
+        if rc := chi.RouteContext(r.Context()); rc != nil && rc.RoutePattern() != "" {
+            span.SetName(r.Method + " " + rc.RoutePattern())
+            span.SetAttributes(attribute.String("http.route", rc.RoutePattern()))
+        }
+        span.SetAttributes(attribute.Int("http.response.status_code", status))
+        if status >= 500 {
+            span.SetStatus(codes.Error, http.StatusText(status))
+        }
+    })
+}
+
+// End завершает спан, записав в него err; удобно в defer с именованным результатом
+func End(span trace.Span, err error) {
+    if err != nil {
+        span.RecordError(err)
+        span.SetStatus(codes.Error, err.Error())
+    }
+    span.End()
+}
@@ -0,0 +1,84 @@
+package tracing
+
+import (
+    "context"
+    "net/http"
+    "net/http/httptest"
+    "os"
+    "path/filepath"
+    "strings"
+    "testing"
+
+    "github.com/go-chi/chi/v5"
+    "go.opentelemetry.io/otel"
+    "go.opentelemetry.io/otel/attribute"
+    "go.opentelemetry.io/otel/propagation"
+    sdktrace "go.opentelemetry.io/otel/sdk/trace"
+    "go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// Спан запроса назван по шаблону маршрута и продолжает трейс вызывающего из traceparent
+func TestMiddleware(t *testing.T) {
+    rec := tracetest.NewSpanRecorder()
+    otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(rec)))
+    otel.SetTextMapPropagator(propagation.TraceContext{})
+
+    r := chi.NewRouter()
+    r.Use(Middleware)
+    r.Post("/pullRequest/{id}/merge", func(w http.ResponseWriter, r *http.Request) {
+        w.WriteHeader(http.StatusInternalServerError)
+    })
+
+    req := httptest.NewRequest(http.MethodPost, "/pullRequest/pr-1/merge", nil)
+    req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+    r.ServeHTTP(httptest.NewRecorder(), req)
+
+    spans := rec.Ended()
+    if len(spans) != 1 {
+        t.Fatalf("expected 1 span, got %d", len(spans))
+    }
+    s := spans[0]
+    if s.Name() != "POST /pullRequest/{id}/merge" {
+        t.Errorf("unexpected span name %q", s.Name())
+    }
+    if s.SpanContext().TraceID().String() != "4bf92f3577b34da6a3ce929d0e0e4736" || s.Parent().SpanID().String() != "00f067aa0ba902b7" {
+        t.Errorf("expected the span to continue the incoming trace, got %v parent %v", s.SpanContext(), s.Parent())
+    }
+    if s.Status().Code.String() != "Error" {
+        t.Errorf("expected error status for 500, got %v", s.Status())
+    }
+    found := false
+    for _, kv := range s.Attributes() {
+        if kv == attribute.Int("http.response.status_code", 500) {
+            found = true
+        }
+    }
+    if !found {
+        t.Errorf("expected status code attribute in %v", s.Attributes())
+    }
+}
+
+func TestSetupFileExporter(t *testing.T) {
+    path := filepath.Join(t.TempDir(), "spans.json")
+    shutdown, err := Setup(context.Background(), ExporterFile, "", path)
+    if err != nil {
+        t.Fatalf("Setup: %v", err)
+    }
+    _, span := otel.Tracer("test").Start(context.Background(), "Service.CreatePR")
+    span.End()
+    if err := shutdown(context.Background()); err != nil {
+        t.Fatalf("shutdown: %v", err)
+    }
+
+    data, err := os.ReadFile(path)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if !strings.Contains(string(data), `"Name":"Service.CreatePR"`) || !strings.Contains(string(data), ServiceName) {
+        t.Errorf("expected the span with the service name in the file, got %s", data)
+    }
+
+    if _, err := Setup(context.Background(), "zipkin", "", ""); err == nil {
+        t.Error("expected unknown exporter error")
+    }
+}
@@ -0,0 +1,9 @@
+CREATE TABLE api_tokens (
+  id SERIAL PRIMARY KEY,
+  name TEXT NOT NULL,
+  token_hash TEXT UNIQUE NOT NULL,
+  scopes TEXT NOT NULL,
+  user_id TEXT REFERENCES users(id) ON DELETE CASCADE,
+  created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now(),
+  revoked_at TIMESTAMP WITH TIME ZONE
+);
@@ -0,0 +1 @@
+ALTER TABLE team_members ADD COLUMN is_lead BOOLEAN NOT NULL DEFAULT false;
@@ -0,0 +1,16 @@
+CREATE TABLE audit_log (
+  id BIGSERIAL PRIMARY KEY,
+  created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now(),
+  actor TEXT NOT NULL,
+  action TEXT NOT NULL,
+  target_type TEXT NOT NULL,
+  target_id TEXT NOT NULL,
+  before JSONB,
+  after JSONB,
+  request_id TEXT,
+  source_ip TEXT
+);
+
+CREATE INDEX idx_audit_log_actor ON audit_log(actor, created_at);
+CREATE INDEX idx_audit_log_target ON audit_log(target_type, target_id, created_at);
+CREATE INDEX idx_audit_log_created_at ON audit_log(created_at);
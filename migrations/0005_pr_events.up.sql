@@ -0,0 +1,12 @@
+CREATE TABLE pr_events (
+  id BIGSERIAL PRIMARY KEY,
+  created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now(),
+  type TEXT NOT NULL,
+  pr_id TEXT NOT NULL,
+  team_name TEXT,
+  author_id TEXT NOT NULL,
+  reviewer_id TEXT,
+  replaced_user_id TEXT
+);
+
+CREATE INDEX idx_pr_events_team ON pr_events(team_name, id);
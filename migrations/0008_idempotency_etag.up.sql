@@ -0,0 +1 @@
+ALTER TABLE idempotency_keys ADD COLUMN etag TEXT;